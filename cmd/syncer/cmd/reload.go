@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/logs"
+	"k8s.io/klog/v2"
+
+	synceroptions "github.com/kcp-dev/kcp/cmd/syncer/options"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+// configReloadInterval is the interval at which the syncer configuration file is checked for changes.
+const configReloadInterval = 10 * time.Second
+
+// configReloader holds the settings applied at runtime: the resources to sync, the rate limits of the clients,
+// and the log verbosity. It reloads them when the syncer configuration file changes. The informers of the
+// resources still synced are kept, the syncers only start and stop the informers of the added and removed ones.
+type configReloader struct {
+	options    *synceroptions.Options
+	rateLimits *shared.RateLimits
+
+	lock          sync.RWMutex
+	configuration *synceroptions.SyncerConfiguration
+	resources     sets.String
+}
+
+func newConfigReloader(options *synceroptions.Options) *configReloader {
+	return &configReloader{
+		options:       options,
+		rateLimits:    shared.NewRateLimits(options.QPS, options.Burst),
+		configuration: options.Configuration,
+		resources:     sets.NewString(options.SyncedResourceTypes...),
+	}
+}
+
+// Resources returns the resources to sync of the SyncTargets whose resources are not set in the
+// SyncTargets config file.
+func (r *configReloader) Resources() sets.String {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return sets.NewString(r.resources.UnsortedList()...)
+}
+
+// Start checks the syncer configuration file for changes until the context is done.
+func (r *configReloader) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, r.reload, configReloadInterval)
+}
+
+func (r *configReloader) reload(ctx context.Context) {
+	logger := klog.FromContext(ctx).WithValues("config", r.options.Config)
+
+	configuration, err := synceroptions.LoadSyncerConfiguration(r.options.Config)
+	if err != nil {
+		logger.Error(err, "failed to reload the syncer configuration file, keeping the current configuration")
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if reflect.DeepEqual(configuration, r.configuration) {
+		return
+	}
+	logger.Info("reloading the syncer configuration file")
+
+	if !reflect.DeepEqual(configuration.APIImportPollInterval, r.configuration.APIImportPollInterval) ||
+		!reflect.DeepEqual(configuration.FeatureGates, r.configuration.FeatureGates) {
+		logger.Info("the changes to apiImportPollInterval and featureGates are only applied on restart")
+	}
+
+	previous := r.options.ReloadableSettings(r.configuration)
+	settings := r.options.ReloadableSettings(configuration)
+	if settings.QPS != previous.QPS || settings.Burst != previous.Burst {
+		logger.Info("changing the rate limits", "qps", settings.QPS, "burst", settings.Burst)
+		r.rateLimits.Set(settings.QPS, settings.Burst)
+	}
+	if settings.Verbosity != previous.Verbosity {
+		logger.Info("changing the log verbosity", "verbosity", settings.Verbosity)
+		if _, err := logs.GlogSetter(strconv.Itoa(int(settings.Verbosity))); err != nil {
+			logger.Error(err, "failed to change the log verbosity")
+		}
+	}
+	if resources := sets.NewString(settings.Resources...); !resources.Equal(r.resources) {
+		logger.Info("changing the resources to sync", "resources", resources.List())
+		r.resources = resources
+	}
+	r.configuration = configuration
+}
@@ -18,22 +18,45 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/kcp-dev/logicalcluster/v2"
 	"github.com/spf13/cobra"
 
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/component-base/version"
 	"k8s.io/klog/v2"
 
 	synceroptions "github.com/kcp-dev/kcp/cmd/syncer/options"
 	kcpfeatures "github.com/kcp-dev/kcp/pkg/features"
 	"github.com/kcp-dev/kcp/pkg/syncer"
+	"github.com/kcp-dev/kcp/pkg/syncer/credentials"
+	"github.com/kcp-dev/kcp/pkg/syncer/health"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
-const numThreads = 2
+const (
+	numThreads = 2
+
+	// leaderElectionHealthzTimeout is how long the leader can fail to renew its Lease past the renew deadline
+	// before the liveness check fails.
+	leaderElectionHealthzTimeout = 20 * time.Second
+)
 
 func NewSyncerCommand() *cobra.Command {
 	options := synceroptions.NewOptions()
@@ -41,10 +64,11 @@ func NewSyncerCommand() *cobra.Command {
 		Use:   "syncer",
 		Short: "Synchronizes resources in `kcp` assigned to the clusters",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := options.Logs.ValidateAndApply(kcpfeatures.DefaultFeatureGate); err != nil {
+			// The configuration file is loaded first, since it may set the log verbosity and the feature gates.
+			if err := options.Complete(); err != nil {
 				return err
 			}
-			if err := options.Complete(); err != nil {
+			if err := options.Logs.ValidateAndApply(kcpfeatures.DefaultFeatureGate); err != nil {
 				return err
 			}
 
@@ -75,48 +99,245 @@ func NewSyncerCommand() *cobra.Command {
 }
 
 func Run(options *synceroptions.Options, ctx context.Context) error {
-	klog.Infof("Syncing the following resource types: %s", options.SyncedResourceTypes)
+	var reloader *configReloader
+	if options.Config != "" {
+		reloader = newConfigReloader(options)
+	}
+
+	// The readiness checks are added by the syncers once started, so that a standby replica is ready.
+	livez := health.NewChecks("livez")
+	livez.Set("ping", nil)
+	readyz := health.NewChecks("readyz")
 
-	kcpConfigOverrides := &clientcmd.ConfigOverrides{
-		CurrentContext: options.FromContext,
+	var syncerConfigs []*syncer.SyncerConfig
+	for _, target := range options.SyncTargetConfigs() {
+		syncerConfig, err := newSyncerConfig(options, target, reloader)
+		if err != nil {
+			return fmt.Errorf("invalid configuration of SyncTarget %s|%s: %w", target.FromCluster, target.Name, err)
+		}
+		syncerConfig.HealthChecks = readyz
+		syncerConfigs = append(syncerConfigs, syncerConfig)
 	}
-	upstreamConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: options.FromKubeconfig},
-		kcpConfigOverrides).ClientConfig()
-	if err != nil {
-		return err
+
+	if reloader != nil {
+		go reloader.Start(ctx)
+	}
+
+	if options.MetricsBindAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", syncermetrics.Handler())
+		if err := serve(ctx, "metrics", options.MetricsBindAddress, mux); err != nil {
+			return err
+		}
+	}
+	if options.HealthBindAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", livez)
+		mux.Handle("/livez", livez)
+		mux.Handle("/readyz", readyz)
+		mux.Handle("/debug/syncer/queues", syncermetrics.DebugHandler())
+		if err := serve(ctx, "health", options.HealthBindAddress, mux); err != nil {
+			return err
+		}
+	}
+
+	startSyncers := func(ctx context.Context) error {
+		return startSyncers(ctx, syncerConfigs, options.APIImportPollInterval)
 	}
 
+	if options.LeaderElect {
+		// The Lease is in the -to cluster of the flags, i.e. the management cluster when serving several SyncTargets.
+		leaderElectionConfig, err := loadConfig(options.ToKubeconfig, options.ToContext)
+		if err != nil {
+			return err
+		}
+		return runWithLeaderElection(ctx, options, leaderElectionConfig, livez, startSyncers)
+	}
+	return startSyncers(ctx)
+}
+
+// newSyncerConfig returns the syncer configuration of a SyncTarget served by the process. With a syncer
+// configuration file, the resources and the rate limits are the ones of the reloader, unless the resources
+// of the SyncTarget are set in the SyncTargets config file. The upstream kubeconfig is only used to request
+// short-lived tokens, unless their expiration is set to zero or the kubeconfig doesn't hold a token.
+func newSyncerConfig(options *synceroptions.Options, target synceroptions.SyncTargetConfig, reloader *configReloader) (*syncer.SyncerConfig, error) {
+	resources := target.Resources
+	if len(resources) == 0 {
+		resources = options.SyncedResourceTypes
+	}
+	klog.Infof("Syncing the following resource types to SyncTarget %s|%s: %s", target.FromCluster, target.Name, resources)
+
+	upstreamConfig, err := loadConfig(target.FromKubeconfig, target.FromContext)
+	if err != nil {
+		return nil, err
+	}
 	upstreamConfig.QPS = options.QPS
 	upstreamConfig.Burst = options.Burst
 
-	downstreamConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: options.ToKubeconfig},
+	downstreamConfig, err := loadConfig(target.ToKubeconfig, target.ToContext)
+	if err != nil {
+		return nil, err
+	}
+	downstreamConfig.QPS = options.QPS
+	downstreamConfig.Burst = options.Burst
+
+	var resourcesToSyncFunc func() sets.String
+	if reloader != nil {
+		reloader.rateLimits.Apply(upstreamConfig)
+		reloader.rateLimits.Apply(downstreamConfig)
+		if len(target.Resources) == 0 {
+			resourcesToSyncFunc = reloader.Resources
+		}
+	}
+
+	var upstreamCredentials *credentials.Rotator
+	if options.UpstreamTokenExpiration > 0 && upstreamConfig.BearerToken != "" {
+		upstreamCredentials, err = credentials.NewRotator(logicalcluster.New(target.FromCluster), target.Name, options.UpstreamTokenExpiration, func() (*rest.Config, error) {
+			return loadConfig(target.FromKubeconfig, target.FromContext)
+		})
+		if err != nil {
+			return nil, err
+		}
+		upstreamCredentials.Apply(upstreamConfig)
+	}
+
+	return &syncer.SyncerConfig{
+		UpstreamConfig:      upstreamConfig,
+		DownstreamConfig:    downstreamConfig,
+		ResourcesToSync:     sets.NewString(resources...),
+		ResourcesToSyncFunc: resourcesToSyncFunc,
+		SyncTargetWorkspace: logicalcluster.New(target.FromCluster),
+		SyncTargetName:      target.Name,
+		SyncTargetUID:       target.UID,
+
+		ServiceAccountTokenMode: shared.ServiceAccountTokenMode(options.ServiceAccountTokenMode),
+		DryRun:                  options.DryRun,
+		PropagateEvents:         options.PropagateEvents,
+		DriftPreservedResources: sets.NewString(options.DriftPreservedResources...),
+		OrphanMode:              shared.OrphanMode(options.OrphanMode),
+		UpstreamCredentials:     upstreamCredentials,
+		InstallCRDs:             options.InstallCRDs,
+	}, nil
+}
+
+// loadConfig loads the client configuration of the context of the kubeconfig file, or the InCluster
+// configuration if the kubeconfig file is not set.
+func loadConfig(kubeconfig, contextName string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
 		&clientcmd.ConfigOverrides{
-			CurrentContext: options.ToContext,
+			CurrentContext: contextName,
 		}).ClientConfig()
+}
+
+// startSyncers starts the syncers of all the SyncTargets served by the process concurrently, so that a
+// SyncTarget that cannot be retrieved yet doesn't delay the others. It fails if any of them fails to start.
+func startSyncers(ctx context.Context, syncerConfigs []*syncer.SyncerConfig, importPollInterval time.Duration) error {
+	if len(syncerConfigs) == 1 {
+		return syncer.StartSyncer(ctx, syncerConfigs[0], numThreads, importPollInterval)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(syncerConfigs))
+	for i, syncerConfig := range syncerConfigs {
+		wg.Add(1)
+		go func(i int, syncerConfig *syncer.SyncerConfig) {
+			defer wg.Done()
+			if err := syncer.StartSyncer(ctx, syncerConfig, numThreads, importPollInterval); err != nil {
+				errs[i] = fmt.Errorf("failed to start the syncer of SyncTarget %s|%s: %w", syncerConfig.SyncTargetWorkspace, syncerConfig.SyncTargetName, err)
+			}
+		}(i, syncerConfig)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+// runWithLeaderElection starts the syncer once this replica is elected leader with a Lease in the
+// downstream cluster. The process exits when the leadership is lost, so that it restarts as a standby.
+// The liveness check fails if the leader keeps failing to renew its Lease.
+func runWithLeaderElection(ctx context.Context, options *synceroptions.Options, downstreamConfig *rest.Config, livez *health.Checks, startSyncer func(ctx context.Context) error) error {
+	kubeClient, err := kubernetesclient.NewForConfig(rest.AddUserAgent(rest.CopyConfig(downstreamConfig), "kcp#syncer-leader-election"))
 	if err != nil {
 		return err
 	}
 
-	downstreamConfig.QPS = options.QPS
-	downstreamConfig.Burst = options.Burst
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	// Add a unique suffix so that two replicas on the same host don't have the same identity.
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, options.LeaderElectionNamespace, options.LeaderElectionID,
+		kubeClient.CoreV1(), kubeClient.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return err
+	}
+
+	watchDog := leaderelection.NewLeaderHealthzAdaptor(leaderElectionHealthzTimeout)
+	livez.Add("leader-election", func() error {
+		return watchDog.Check(nil)
+	})
 
-	if err := syncer.StartSyncer(
-		ctx,
-		&syncer.SyncerConfig{
-			UpstreamConfig:      upstreamConfig,
-			DownstreamConfig:    downstreamConfig,
-			ResourcesToSync:     sets.NewString(options.SyncedResourceTypes...),
-			SyncTargetWorkspace: logicalcluster.New(options.FromClusterName),
-			SyncTargetName:      options.SyncTargetName,
-			SyncTargetUID:       options.SyncTargetUID,
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   options.LeaderElectionLeaseDuration,
+		RenewDeadline:   options.LeaderElectionRenewDeadline,
+		RetryPeriod:     options.LeaderElectionRetryPeriod,
+		ReleaseOnCancel: true,
+		WatchDog:        watchDog,
+		Name:            options.LeaderElectionID,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Started leading as %s, starting the syncer", identity)
+				if err := startSyncer(ctx); err != nil {
+					klog.Errorf("Failed to start the syncer: %v", err)
+					klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+				}
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					// Shutting down, the lease has been released.
+					return
+				}
+				klog.Errorf("Lost the leadership of %s/%s, exiting", options.LeaderElectionNamespace, options.LeaderElectionID)
+				klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("Standing by, the leader is %s", leader)
+				}
+			},
 		},
-		numThreads,
-		options.APIImportPollInterval,
-	); err != nil {
+	})
+	if err != nil {
 		return err
 	}
 
+	klog.Infof("Waiting for the leadership of %s/%s", options.LeaderElectionNamespace, options.LeaderElectionID)
+	go elector.Run(ctx)
+	return nil
+}
+
+// serve serves the endpoints of the mux on the address until the context is done.
+func serve(ctx context.Context, what, address string, mux *http.ServeMux) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s address %s: %w", what, address, err)
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		klog.Infof("Serving %s on %s", what, listener.Addr())
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("Failed to serve %s: %v", what, err)
+		}
+	}()
+
 	return nil
 }
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+	"os"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/config"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SyncerConfigurationAPIVersion is the API version of the syncer configuration file.
+	SyncerConfigurationAPIVersion = "config.workload.kcp.dev/v1alpha1"
+	// SyncerConfigurationKind is the kind of the syncer configuration file.
+	SyncerConfigurationKind = "SyncerConfiguration"
+)
+
+// SyncerConfiguration is the versioned syncer configuration file, passed with --config. Its fields override
+// the corresponding flags when set. The resources, the rate limits and the log verbosity are applied at runtime
+// when the file changes, the other fields only on restart.
+type SyncerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// QPS and Burst are the rate limits of the clients, as --qps and --burst.
+	// +optional
+	QPS *float32 `json:"qps,omitempty"`
+	// +optional
+	Burst *int `json:"burst,omitempty"`
+	// Verbosity is the log verbosity, as -v.
+	// +optional
+	Verbosity *int32 `json:"verbosity,omitempty"`
+	// Resources are the resources to sync, as --resources.
+	// +optional
+	Resources []string `json:"resources,omitempty"`
+	// APIImportPollInterval is the polling interval of the API import, as --api-import-poll-interval.
+	// +optional
+	APIImportPollInterval *metav1.Duration `json:"apiImportPollInterval,omitempty"`
+	// FeatureGates are the feature gates to set, as --feature-gates.
+	// +optional
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// LoadSyncerConfiguration reads and validates the syncer configuration file.
+func LoadSyncerConfiguration(path string) (*SyncerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configuration SyncerConfiguration
+	if err := yaml.UnmarshalStrict(data, &configuration); err != nil {
+		return nil, fmt.Errorf("invalid syncer configuration file %s: %w", path, err)
+	}
+	if configuration.APIVersion != SyncerConfigurationAPIVersion || configuration.Kind != SyncerConfigurationKind {
+		return nil, fmt.Errorf("invalid syncer configuration file %s: expected apiVersion %s and kind %s, got %q and %q",
+			path, SyncerConfigurationAPIVersion, SyncerConfigurationKind, configuration.APIVersion, configuration.Kind)
+	}
+	if configuration.QPS != nil && *configuration.QPS <= 0 {
+		return nil, fmt.Errorf("invalid syncer configuration file %s: qps must be positive", path)
+	}
+	if configuration.Burst != nil && *configuration.Burst <= 0 {
+		return nil, fmt.Errorf("invalid syncer configuration file %s: burst must be positive", path)
+	}
+	if configuration.Verbosity != nil && *configuration.Verbosity < 0 {
+		return nil, fmt.Errorf("invalid syncer configuration file %s: verbosity must not be negative", path)
+	}
+	return &configuration, nil
+}
+
+// ReloadableSettings are the settings applied at runtime when the syncer configuration file changes.
+type ReloadableSettings struct {
+	QPS       float32
+	Burst     int
+	Verbosity int32
+	Resources []string
+}
+
+// ReloadableSettings returns the settings of the flags, overridden with the fields set in the configuration file.
+func (options *Options) ReloadableSettings(configuration *SyncerConfiguration) ReloadableSettings {
+	settings := options.flagSettings
+	if configuration.QPS != nil {
+		settings.QPS = *configuration.QPS
+	}
+	if configuration.Burst != nil {
+		settings.Burst = *configuration.Burst
+	}
+	if configuration.Verbosity != nil {
+		settings.Verbosity = *configuration.Verbosity
+	}
+	if configuration.Resources != nil {
+		settings.Resources = configuration.Resources
+	}
+	return settings
+}
+
+// applyConfiguration overrides the options with the fields set in the configuration file. The settings of
+// the flags are kept, so that the fields removed from the file on reload are reverted to them.
+func (options *Options) applyConfiguration(configuration *SyncerConfiguration) error {
+	options.flagSettings = ReloadableSettings{
+		QPS:       options.QPS,
+		Burst:     options.Burst,
+		Verbosity: int32(options.Logs.Config.Verbosity),
+		Resources: options.SyncedResourceTypes,
+	}
+	settings := options.ReloadableSettings(configuration)
+	options.QPS = settings.QPS
+	options.Burst = settings.Burst
+	options.Logs.Config.Verbosity = config.VerbosityLevel(settings.Verbosity)
+	options.SyncedResourceTypes = settings.Resources
+
+	if configuration.APIImportPollInterval != nil {
+		options.APIImportPollInterval = configuration.APIImportPollInterval.Duration
+	}
+	if err := utilfeature.DefaultMutableFeatureGate.SetFromMap(configuration.FeatureGates); err != nil {
+		return fmt.Errorf("invalid featureGates in syncer configuration file %s: %w", options.Config, err)
+	}
+	options.Configuration = configuration
+	return nil
+}
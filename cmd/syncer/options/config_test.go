@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncerConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syncer-config.yaml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	write(`
+apiVersion: config.workload.kcp.dev/v1alpha1
+kind: SyncerConfiguration
+qps: 50
+verbosity: 4
+resources: [deployments.apps, services]
+apiImportPollInterval: 5m
+`)
+	options := NewOptions()
+	options.Config = path
+	options.Burst = 40
+	options.SyncedResourceTypes = []string{"configmaps"}
+	require.NoError(t, options.Complete())
+
+	require.Equal(t, float32(50), options.QPS, "the file overrides the flags")
+	require.Equal(t, 40, options.Burst, "the flags are kept when not set in the file")
+	require.Equal(t, 4, int(options.Logs.Config.Verbosity))
+	require.Equal(t, []string{"deployments.apps", "services"}, options.SyncedResourceTypes)
+	require.Equal(t, 5*time.Minute, options.APIImportPollInterval)
+
+	// On reload, the fields removed from the file revert to the flags.
+	write(`
+apiVersion: config.workload.kcp.dev/v1alpha1
+kind: SyncerConfiguration
+burst: 100
+`)
+	configuration, err := LoadSyncerConfiguration(path)
+	require.NoError(t, err)
+	require.Equal(t, ReloadableSettings{
+		QPS:       30,
+		Burst:     100,
+		Verbosity: 2,
+		Resources: []string{"configmaps"},
+	}, options.ReloadableSettings(configuration))
+
+	for name, content := range map[string]string{
+		"wrong kind":    "apiVersion: config.workload.kcp.dev/v1alpha1\nkind: KubeletConfiguration\n",
+		"unknown field": "apiVersion: config.workload.kcp.dev/v1alpha1\nkind: SyncerConfiguration\nresource: [pods]\n",
+		"invalid qps":   "apiVersion: config.workload.kcp.dev/v1alpha1\nkind: SyncerConfiguration\nqps: 0\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			write(content)
+			_, err := LoadSyncerConfiguration(path)
+			require.Error(t, err)
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	kcpfeatures "github.com/kcp-dev/kcp/pkg/features"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
 type Options struct {
@@ -44,7 +45,34 @@ type Options struct {
 	Logs                *logs.Options
 	SyncedResourceTypes []string
 
-	APIImportPollInterval time.Duration
+	// SyncTargetsConfig is the path of the SyncTargets config file, listing the SyncTargets served by the
+	// process. SyncTargets are loaded from it on Complete.
+	SyncTargetsConfig string
+	SyncTargets       []SyncTargetConfig
+
+	// Config is the path of the syncer configuration file. Configuration is loaded from it on Complete,
+	// and overrides the flags. flagSettings are the settings of the flags it overrides.
+	Config        string
+	Configuration *SyncerConfiguration
+	flagSettings  ReloadableSettings
+
+	APIImportPollInterval   time.Duration
+	ServiceAccountTokenMode string
+	DryRun                  bool
+	MetricsBindAddress      string
+	HealthBindAddress       string
+	PropagateEvents         bool
+	DriftPreservedResources []string
+	OrphanMode              string
+	UpstreamTokenExpiration time.Duration
+	InstallCRDs             bool
+
+	LeaderElect                 bool
+	LeaderElectionNamespace     string
+	LeaderElectionID            string
+	LeaderElectionLeaseDuration time.Duration
+	LeaderElectionRenewDeadline time.Duration
+	LeaderElectionRetryPeriod   time.Duration
 }
 
 func NewOptions() *Options {
@@ -53,11 +81,19 @@ func NewOptions() *Options {
 	logs.Config.Verbosity = config.VerbosityLevel(2)
 
 	return &Options{
-		QPS:                   30,
-		Burst:                 20,
-		SyncedResourceTypes:   []string{},
-		Logs:                  logs,
-		APIImportPollInterval: 1 * time.Minute,
+		QPS:                     30,
+		Burst:                   20,
+		SyncedResourceTypes:     []string{},
+		Logs:                    logs,
+		APIImportPollInterval:   1 * time.Minute,
+		ServiceAccountTokenMode: string(shared.ServiceAccountTokenModeSecret),
+		HealthBindAddress:       ":8081",
+		DriftPreservedResources: []string{},
+		OrphanMode:              string(shared.OrphanModeDelete),
+
+		LeaderElectionLeaseDuration: 15 * time.Second,
+		LeaderElectionRenewDeadline: 10 * time.Second,
+		LeaderElectionRetryPeriod:   2 * time.Second,
 	}
 }
 
@@ -72,8 +108,29 @@ func (options *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&options.SyncTargetName, "sync-target-name", options.SyncTargetName,
 		fmt.Sprintf("ID of the -to cluster. Resources with this ID set in the '%s' label will be synced.", workloadv1alpha1.ClusterResourceStateLabelPrefix+"<ClusterID>"))
 	fs.StringVar(&options.SyncTargetUID, "sync-target-uid", options.SyncTargetUID, "The UID from the SyncTarget resource in KCP.")
-	fs.StringArrayVarP(&options.SyncedResourceTypes, "resources", "r", options.SyncedResourceTypes, "Resources to be synchronized in kcp.")
+	fs.StringVar(&options.Config, "config", options.Config, fmt.Sprintf("Syncer configuration file, of kind %s in %s. The fields set in the file override the flags. Changes to the resources, the rate limits and the log verbosity are applied at runtime, the other ones on restart.", SyncerConfigurationKind, SyncerConfigurationAPIVersion))
+	fs.StringVar(&options.SyncTargetsConfig, "sync-targets-config", options.SyncTargetsConfig, "Config file listing several SyncTargets and their -to clusters to serve in this process, instead of the single one of --sync-target-name. The --from-*, --to-* and --resources flags are the defaults of the SyncTargets of the file.")
+	fs.StringArrayVarP(&options.SyncedResourceTypes, "resources", "r", options.SyncedResourceTypes, "Resources to be synchronized in kcp. The resources accepted in the SyncTarget status, e.g. the ones of newly supported APIExports, are synchronized too.")
 	fs.DurationVar(&options.APIImportPollInterval, "api-import-poll-interval", options.APIImportPollInterval, "Polling interval for API import.")
+	fs.StringVar(&options.ServiceAccountTokenMode, "service-account-token-mode", options.ServiceAccountTokenMode,
+		fmt.Sprintf("How synced workloads get service account tokens to talk to kcp: %q mounts the legacy token Secrets synced from kcp, %q requests bound tokens through the TokenRequest API and refreshes them before expiry.",
+			shared.ServiceAccountTokenModeSecret, shared.ServiceAccountTokenModeProjected))
+	fs.StringVar(&options.MetricsBindAddress, "metrics-bind-address", options.MetricsBindAddress, "The address the Prometheus metrics endpoint binds to, e.g. :8080. Disabled if empty.")
+	fs.StringVar(&options.HealthBindAddress, "health-bind-address", options.HealthBindAddress, "The address the /healthz, /livez and /readyz endpoints, and the /debug/syncer/queues endpoint dumping the controller queues, bind to, e.g. :8081. Set to empty to disable them.")
+	fs.BoolVar(&options.PropagateEvents, "propagate-events", options.PropagateEvents, "Create Events in the workspaces for the Events of the synced objects on the physical cluster. Disabled by default.")
+	fs.StringSliceVar(&options.DriftPreservedResources, "drift-preserved-resources", options.DriftPreservedResources, "Resources, as <resource>.<group>, whose changes made directly on the physical cluster are preserved instead of reverted. The changes are recorded on the upstream objects in any case. The upstream changes conflicting with preserved changes are not applied, and retried, until the preserved changes are reverted.")
+	fs.StringVar(&options.OrphanMode, "orphan-mode", options.OrphanMode,
+		fmt.Sprintf("What to do with the synced objects of the physical cluster whose object in kcp was deleted while the syncer was not watching: %q deletes them, %q only logs them and counts them in the metrics.",
+			shared.OrphanModeDelete, shared.OrphanModeReport))
+	fs.DurationVar(&options.UpstreamTokenExpiration, "upstream-token-expiration", options.UpstreamTokenExpiration, "Expiration of the short-lived tokens the syncer requests for its service account in kcp with the token of the --from-kubeconfig, and renews before they expire, e.g. 1h. If 0, the token of the --from-kubeconfig is used directly.")
+	fs.BoolVar(&options.InstallCRDs, "install-crds", options.InstallCRDs, "Create and update the CRDs of the resources to sync on the physical cluster, from the APIResourceSchemas of the APIExports supported by the SyncTarget in its workspace. The APIExports of other workspaces are skipped. The updates not compatible with the installed CRDs are refused, and the resources reported as incompatible.")
+	fs.BoolVar(&options.DryRun, "dry-run", options.DryRun, "Compute the changes to apply to the physical cluster without applying them. The changes are logged, and summarized in the DownstreamInSync condition of the SyncTarget.")
+	fs.BoolVar(&options.LeaderElect, "leader-elect", options.LeaderElect, "Elect a leader among the syncer replicas with a Lease in the physical cluster. Only the leader syncs, the other replicas stand by to take over.")
+	fs.StringVar(&options.LeaderElectionNamespace, "leader-election-namespace", options.LeaderElectionNamespace, "Namespace of the leader election Lease in the physical cluster. Required with --leader-elect.")
+	fs.StringVar(&options.LeaderElectionID, "leader-election-id", options.LeaderElectionID, "Name of the leader election Lease. Defaults to kcp-syncer-<sync-target-name>.")
+	fs.DurationVar(&options.LeaderElectionLeaseDuration, "leader-election-lease-duration", options.LeaderElectionLeaseDuration, "Duration the standby replicas wait before taking over a lease that was not renewed.")
+	fs.DurationVar(&options.LeaderElectionRenewDeadline, "leader-election-renew-deadline", options.LeaderElectionRenewDeadline, "Duration the leader retries renewing its lease before giving up leadership.")
+	fs.DurationVar(&options.LeaderElectionRetryPeriod, "leader-election-retry-period", options.LeaderElectionRetryPeriod, "Duration between attempts to acquire or renew the lease.")
 	fs.Var(kcpfeatures.NewFlagValue(), "feature-gates", ""+
 		"A set of key=value pairs that describe feature gates for alpha/experimental features. "+
 		"Options are:\n"+strings.Join(kcpfeatures.KnownFeatures(), "\n")) // hide kube-only gates
@@ -82,18 +139,74 @@ func (options *Options) AddFlags(fs *pflag.FlagSet) {
 }
 
 func (options *Options) Complete() error {
+	if options.Config != "" {
+		configuration, err := LoadSyncerConfiguration(options.Config)
+		if err != nil {
+			return err
+		}
+		if err := options.applyConfiguration(configuration); err != nil {
+			return err
+		}
+	}
+	if options.SyncTargetsConfig != "" {
+		return options.loadSyncTargetsConfig()
+	}
+	if options.LeaderElectionID == "" {
+		options.LeaderElectionID = "kcp-syncer-" + options.SyncTargetName
+	}
 	return nil
 }
 
 func (options *Options) Validate() error {
-	if options.FromClusterName == "" {
-		return errors.New("--from-cluster is required")
+	if options.SyncTargetsConfig != "" {
+		if options.SyncTargetName != "" {
+			return errors.New("--sync-target-name and --sync-targets-config are mutually exclusive")
+		}
+		if err := options.validateSyncTargets(); err != nil {
+			return err
+		}
+	} else {
+		if options.FromClusterName == "" {
+			return errors.New("--from-cluster is required")
+		}
+		if options.FromKubeconfig == "" {
+			return errors.New("--from-kubeconfig is required")
+		}
+		if options.SyncTargetUID == "" {
+			return errors.New("--sync-target-uid is required")
+		}
+	}
+	validMode := false
+	for _, mode := range shared.ServiceAccountTokenModes {
+		if options.ServiceAccountTokenMode == string(mode) {
+			validMode = true
+		}
+	}
+	if !validMode {
+		return fmt.Errorf("--service-account-token-mode must be one of %v", shared.ServiceAccountTokenModes)
+	}
+	validOrphanMode := false
+	for _, mode := range shared.OrphanModes {
+		if options.OrphanMode == string(mode) {
+			validOrphanMode = true
+		}
+	}
+	if !validOrphanMode {
+		return fmt.Errorf("--orphan-mode must be one of %v", shared.OrphanModes)
 	}
-	if options.FromKubeconfig == "" {
-		return errors.New("--from-kubeconfig is required")
+	if options.UpstreamTokenExpiration != 0 && options.UpstreamTokenExpiration < 10*time.Minute {
+		return errors.New("--upstream-token-expiration must be 0 or at least 10m")
 	}
-	if options.SyncTargetUID == "" {
-		return errors.New("--sync-target-uid is required")
+	if options.LeaderElect {
+		if options.LeaderElectionNamespace == "" {
+			return errors.New("--leader-election-namespace is required with --leader-elect")
+		}
+		if options.LeaderElectionLeaseDuration <= options.LeaderElectionRenewDeadline {
+			return errors.New("--leader-election-lease-duration must be greater than --leader-election-renew-deadline")
+		}
+		if options.LeaderElectionRenewDeadline <= options.LeaderElectionRetryPeriod {
+			return errors.New("--leader-election-renew-deadline must be greater than --leader-election-retry-period")
+		}
 	}
 	return nil
 }
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// SyncTargetsConfig lists the SyncTargets served by a single syncer process, and their downstream clusters.
+type SyncTargetsConfig struct {
+	SyncTargets []SyncTargetConfig `json:"syncTargets"`
+}
+
+// SyncTargetConfig is a SyncTarget served by the syncer process, and its downstream cluster. The empty
+// fields default to the values of the corresponding flags.
+type SyncTargetConfig struct {
+	// Name is the name of the SyncTarget, as --sync-target-name.
+	Name string `json:"name"`
+	// UID is the UID of the SyncTarget, as --sync-target-uid.
+	UID string `json:"uid"`
+	// FromCluster is the logical cluster of the SyncTarget, as --from-cluster.
+	FromCluster string `json:"fromCluster"`
+	// FromKubeconfig and FromContext select the kcp kubeconfig, as --from-kubeconfig and --from-context.
+	FromKubeconfig string `json:"fromKubeconfig,omitempty"`
+	FromContext    string `json:"fromContext,omitempty"`
+	// ToKubeconfig and ToContext select the downstream kubeconfig, as --to-kubeconfig and --to-context.
+	// The InCluster configuration is used if both the field and the flag are empty.
+	ToKubeconfig string `json:"toKubeconfig,omitempty"`
+	ToContext    string `json:"toContext,omitempty"`
+	// Resources are the resources to sync, as --resources. If empty, the resources of the flags, or of the
+	// syncer configuration file, are synced.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// loadSyncTargetsConfig reads the SyncTargets config file, and defaults the empty kubeconfig fields of the
+// SyncTargets with the flags.
+func (options *Options) loadSyncTargetsConfig() error {
+	data, err := os.ReadFile(options.SyncTargetsConfig)
+	if err != nil {
+		return err
+	}
+	var config SyncTargetsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return fmt.Errorf("invalid SyncTargets config file %s: %w", options.SyncTargetsConfig, err)
+	}
+
+	for i := range config.SyncTargets {
+		target := &config.SyncTargets[i]
+		if target.FromKubeconfig == "" {
+			target.FromKubeconfig = options.FromKubeconfig
+		}
+		if target.FromContext == "" {
+			target.FromContext = options.FromContext
+		}
+		if target.ToKubeconfig == "" {
+			target.ToKubeconfig = options.ToKubeconfig
+		}
+		if target.ToContext == "" {
+			target.ToContext = options.ToContext
+		}
+	}
+	options.SyncTargets = config.SyncTargets
+	return nil
+}
+
+// SyncTargetConfigs returns the SyncTargets served by the syncer process: the ones of the SyncTargets
+// config file if set, or the one of the flags otherwise. Their resources are empty unless set in the
+// SyncTargets config file.
+func (options *Options) SyncTargetConfigs() []SyncTargetConfig {
+	if options.SyncTargetsConfig != "" {
+		return options.SyncTargets
+	}
+	return []SyncTargetConfig{{
+		Name:           options.SyncTargetName,
+		UID:            options.SyncTargetUID,
+		FromCluster:    options.FromClusterName,
+		FromKubeconfig: options.FromKubeconfig,
+		FromContext:    options.FromContext,
+		ToKubeconfig:   options.ToKubeconfig,
+		ToContext:      options.ToContext,
+	}}
+}
+
+// validateSyncTargets validates the SyncTargets of the SyncTargets config file. A SyncTarget can only be
+// served once, since two syncers of the same SyncTarget would compete for the same objects.
+func (options *Options) validateSyncTargets() error {
+	if len(options.SyncTargets) == 0 {
+		return fmt.Errorf("no SyncTarget in the SyncTargets config file %s", options.SyncTargetsConfig)
+	}
+	seen := sets.NewString()
+	for i, target := range options.SyncTargets {
+		switch {
+		case target.Name == "":
+			return fmt.Errorf("syncTargets[%d].name is required", i)
+		case target.UID == "":
+			return fmt.Errorf("syncTargets[%d].uid is required", i)
+		case target.FromCluster == "":
+			return fmt.Errorf("syncTargets[%d].fromCluster is required", i)
+		case target.FromKubeconfig == "":
+			return fmt.Errorf("syncTargets[%d].fromKubeconfig is required, unless --from-kubeconfig is set", i)
+		}
+		key := target.FromCluster + "|" + target.Name
+		if seen.Has(key) {
+			return fmt.Errorf("syncTargets[%d]: SyncTarget %s is listed more than once", i, key)
+		}
+		seen.Insert(key)
+	}
+	if options.LeaderElect && options.LeaderElectionID == "" {
+		return errors.New("--leader-election-id is required with --leader-elect and --sync-targets-config")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTargetsConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  string
+		flags   func(options *Options)
+		want    []SyncTargetConfig
+		wantErr string
+	}{
+		"the empty kubeconfig fields default to the flags": {
+			config: `
+syncTargets:
+- name: east
+  uid: east-uid
+  fromCluster: root:org:ws
+  toKubeconfig: /east.kubeconfig
+- name: west
+  uid: west-uid
+  fromCluster: root:org:ws
+  fromKubeconfig: /other-kcp.kubeconfig
+  toKubeconfig: /west.kubeconfig
+  resources: [deployments.apps]
+`,
+			flags: func(options *Options) {
+				options.FromKubeconfig = "/kcp.kubeconfig"
+			},
+			want: []SyncTargetConfig{
+				{Name: "east", UID: "east-uid", FromCluster: "root:org:ws", FromKubeconfig: "/kcp.kubeconfig", ToKubeconfig: "/east.kubeconfig"},
+				{Name: "west", UID: "west-uid", FromCluster: "root:org:ws", FromKubeconfig: "/other-kcp.kubeconfig", ToKubeconfig: "/west.kubeconfig", Resources: []string{"deployments.apps"}},
+			},
+		},
+		"unknown fields are rejected": {
+			config:  "syncTargets:\n- name: east\n  uuid: east-uid\n",
+			wantErr: `unknown field "uuid"`,
+		},
+		"a SyncTarget can only be listed once": {
+			config: `
+syncTargets:
+- {name: east, uid: east-uid, fromCluster: root:org:ws, fromKubeconfig: /kcp.kubeconfig}
+- {name: east, uid: east-uid, fromCluster: root:org:ws, fromKubeconfig: /kcp.kubeconfig, toKubeconfig: /other.kubeconfig}
+`,
+			wantErr: "SyncTarget root:org:ws|east is listed more than once",
+		},
+		"the upstream kubeconfig is required": {
+			config:  "syncTargets:\n- {name: east, uid: east-uid, fromCluster: root:org:ws}\n",
+			wantErr: "syncTargets[0].fromKubeconfig is required",
+		},
+		"the leader election ID is required with leader election": {
+			config: "syncTargets:\n- {name: east, uid: east-uid, fromCluster: root:org:ws, fromKubeconfig: /kcp.kubeconfig}\n",
+			flags: func(options *Options) {
+				options.LeaderElect = true
+				options.LeaderElectionNamespace = "kcp-syncer"
+			},
+			wantErr: "--leader-election-id is required",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sync-targets.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0600))
+
+			options := NewOptions()
+			options.SyncTargetsConfig = path
+			if tc.flags != nil {
+				tc.flags(options)
+			}
+
+			err := options.Complete()
+			if err == nil {
+				err = options.Validate()
+			}
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, options.SyncTargetConfigs())
+		})
+	}
+}
@@ -19,10 +19,13 @@ package v1alpha1
 import (
 	"crypto/sha256"
 	"math/big"
+	"strings"
 
 	"github.com/kcp-dev/logicalcluster/v2"
 )
 
+const internalLabelPrefix = "internal.workload.kcp.dev/"
+
 // ToSyncTargetKey hashes the SyncTarget workspace and the SyncTarget name to a string that is used to identify
 // in a unique way the synctarget in annotations/labels/finalizers.
 func ToSyncTargetKey(syncTargetWorkspace logicalcluster.Name, syncTargetName string) string {
@@ -31,6 +34,19 @@ func ToSyncTargetKey(syncTargetWorkspace logicalcluster.Name, syncTargetName str
 	return base62hash
 }
 
+// IsForeignWorkloadLabel returns whether the label key is a state.workload.kcp.dev/*,
+// deletion.internal.workload.kcp.dev/* or internal.workload.kcp.dev/* label, other than the
+// state.workload.kcp.dev/<sync-target-key> label of the given SyncTarget. Such labels are set by kcp
+// and the syncers of other SyncTargets, and must not be copied from a SyncTarget cluster into a workspace.
+func IsForeignWorkloadLabel(key, syncTargetKey string) bool {
+	if key == ClusterResourceStateLabelPrefix+syncTargetKey {
+		return false
+	}
+	return strings.HasPrefix(key, ClusterResourceStateLabelPrefix) ||
+		strings.HasPrefix(key, InternalClusterDeletionTimestampAnnotationPrefix) ||
+		strings.HasPrefix(key, internalLabelPrefix)
+}
+
 func toBase62(hash [28]byte) string {
 	var i big.Int
 	i.SetBytes(hash[:])
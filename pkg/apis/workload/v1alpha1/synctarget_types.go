@@ -80,6 +80,142 @@ type SyncTargetSpec struct {
 	// they are in the same physical cluster. Each key/value pair in the cells should be added and updated by service providers
 	// (i.e. a network provider updates one key/value, while the storage provider updates another.)
 	Cells map[string]string `json:"cells,omitempty"`
+
+	// namespaceNaming defines how the namespaces created on the SyncTarget cluster for the synced
+	// namespaces are named. By default, they are named "kcp-<hash>", from a hash of the workspace
+	// and namespace they are synced from.
+	// +optional
+	NamespaceNaming *NamespaceNaming `json:"namespaceNaming,omitempty"`
+
+	// networkIsolation makes the syncer create a NetworkPolicy in every namespace it syncs to the
+	// SyncTarget cluster, so that workloads only receive traffic from the namespaces synced from the same
+	// workspace. It is disabled when not set.
+	// +optional
+	NetworkIsolation *NetworkIsolation `json:"networkIsolation,omitempty"`
+
+	// workloadMappings defines how the synced workloads are adapted to the SyncTarget cluster, e.g. to pull
+	// their images from a local registry mirror.
+	// +optional
+	WorkloadMappings *WorkloadMappings `json:"workloadMappings,omitempty"`
+
+	// resourceQuotaScaling defines how the hard limits of the ResourceQuotas synced to the SyncTarget
+	// cluster are scaled from the hard limits of the ResourceQuotas of their workspace. By default, they
+	// are not scaled.
+	// +optional
+	ResourceQuotaScaling *ResourceQuotaScaling `json:"resourceQuotaScaling,omitempty"`
+}
+
+// ResourceQuotaScalingPolicy is the policy scaling the hard limits of the synced ResourceQuotas.
+type ResourceQuotaScalingPolicy string
+
+const (
+	// ResourceQuotaScalingNone keeps the hard limits of the ResourceQuotas as they are.
+	ResourceQuotaScalingNone ResourceQuotaScalingPolicy = "None"
+	// ResourceQuotaScalingDivide divides the hard limits of the ResourceQuotas by the number of
+	// SyncTargets they are scheduled to.
+	ResourceQuotaScalingDivide ResourceQuotaScalingPolicy = "Divide"
+	// ResourceQuotaScalingPercent scales the hard limits of the ResourceQuotas by a percentage.
+	ResourceQuotaScalingPercent ResourceQuotaScalingPolicy = "Percent"
+)
+
+// ResourceQuotaScaling defines how the hard limits of the ResourceQuotas synced to the SyncTarget
+// cluster are scaled. The scaled limits are rounded down, to the millicore for CPU resources, and to
+// integers for the other resources.
+type ResourceQuotaScaling struct {
+	// policy is the scaling policy, either None, Divide or Percent.
+	// +kubebuilder:validation:Enum=None;Divide;Percent
+	// +kubebuilder:default=None
+	// +optional
+	Policy ResourceQuotaScalingPolicy `json:"policy,omitempty"`
+
+	// percent is the percentage of the hard limits synced with the Percent policy.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Percent int32 `json:"percent,omitempty"`
+}
+
+// WorkloadMappings defines the rewrites applied by the syncer to the workloads synced to the SyncTarget cluster.
+type WorkloadMappings struct {
+	// images are the rewrites of the container images of the synced pods and pod templates. The prefix
+	// of the longest matching rewrite is replaced.
+	// +optional
+	Images []ImageMapping `json:"images,omitempty"`
+
+	// storageClasses maps the StorageClass names of the synced PersistentVolumeClaims, and of the
+	// volumeClaimTemplates of the synced StatefulSets, to StorageClass names of the SyncTarget cluster.
+	// The empty name maps the claims without StorageClass name.
+	// +optional
+	StorageClasses map[string]string `json:"storageClasses,omitempty"`
+}
+
+// ImageMapping is a rewrite of the prefix of container images.
+type ImageMapping struct {
+	// from is the image prefix to replace, e.g. docker.io/library/.
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	From string `json:"from"`
+
+	// to is the image prefix replacing it, e.g. registry.local:5000/library/.
+	// +required
+	// +kubebuilder:validation:Required
+	To string `json:"to"`
+}
+
+// NetworkIsolation defines the NetworkPolicy created by the syncer in the namespaces of the SyncTarget cluster.
+type NetworkIsolation struct {
+	// policyTemplate is the Go template of the spec of the NetworkPolicy, in YAML. It is executed with the fields:
+	//
+	// - Workspace: the logical cluster name of the workspace, e.g. root:org:ws.
+	// - Namespace: the upstream namespace name.
+	// - SyncTargetName: the name of the SyncTarget.
+	// - WorkspaceLabel: the key of the label the syncer sets on the namespaces synced from the workspace.
+	// - WorkspaceLabelValue: the value of that label for the workspace.
+	//
+	// By default, the policy allows the ingress traffic from the namespaces synced from the same workspace only.
+	//
+	// +optional
+	PolicyTemplate string `json:"policyTemplate,omitempty"`
+}
+
+// NamespaceNamingStrategy is a strategy to name the namespaces created on the SyncTarget cluster.
+//
+// +kubebuilder:validation:Enum=Hash;Template
+type NamespaceNamingStrategy string
+
+const (
+	// NamespaceNamingStrategyHash names the namespaces "kcp-<hash>", from a hash of the workspace
+	// and namespace they are synced from.
+	NamespaceNamingStrategyHash NamespaceNamingStrategy = "Hash"
+
+	// NamespaceNamingStrategyTemplate names the namespaces from a template over the workspace and
+	// namespace they are synced from, falling back to the Hash strategy when the name is taken.
+	NamespaceNamingStrategyTemplate NamespaceNamingStrategy = "Template"
+)
+
+// NamespaceNaming defines how the namespaces created on the SyncTarget cluster are named. Changing it
+// only affects the namespaces created afterwards: the existing namespaces keep their names.
+type NamespaceNaming struct {
+	// strategy is the naming strategy, either Hash or Template.
+	//
+	// +optional
+	// +kubebuilder:default=Hash
+	Strategy NamespaceNamingStrategy `json:"strategy,omitempty"`
+
+	// template is the Go template of the namespace names of the Template strategy, e.g.
+	// "{{.WorkspaceName}}-{{.Namespace}}". It is executed with the fields:
+	//
+	// - Workspace: the logical cluster name of the workspace, e.g. root:org:ws.
+	// - WorkspaceName: the last segment of the logical cluster name of the workspace, e.g. ws.
+	// - Namespace: the namespace name.
+	// - SyncTargetName: the name of the SyncTarget.
+	//
+	// The result is lower-cased, and the characters not allowed in namespace names are replaced with "-".
+	// The Hash strategy is used when it is not a valid namespace name.
+	//
+	// +optional
+	Template string `json:"template,omitempty"`
 }
 
 // SyncTargetStatus communicates the observed state of the SyncTarget (from the controller).
@@ -109,6 +245,72 @@ type SyncTargetStatus struct {
 	// VirtualWorkspaces contains all syncer virtual workspace URLs.
 	// +optional
 	VirtualWorkspaces []VirtualWorkspace `json:"virtualWorkspaces,omitempty"`
+
+	// Syncer is the state of the syncer, as reported by its last heartbeat.
+	// +optional
+	Syncer *SyncerStatus `json:"syncer,omitempty"`
+}
+
+// SyncerStatus is the state of a syncer, as reported by its heartbeats.
+type SyncerStatus struct {
+	// version is the build version of the syncer.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// featureGates are the feature gates enabled in the syncer, e.g. SyncerTunnel.
+	// +optional
+	FeatureGates []string `json:"featureGates,omitempty"`
+
+	// resources are the resources the syncer is actively syncing.
+	// +optional
+	Resources []SyncerResource `json:"resources,omitempty"`
+
+	// informersSynced is true when the syncers of all the syncer virtual workspaces are started,
+	// and the informers of all the resources are synced.
+	// +optional
+	InformersSynced bool `json:"informersSynced,omitempty"`
+
+	// refusedCRDUpdates are the resources whose CRD, installed by the syncer on the SyncTarget cluster,
+	// is not updated because the schema of their APIResourceSchema is not compatible with it.
+	// +optional
+	RefusedCRDUpdates []RefusedCRDUpdate `json:"refusedCRDUpdates,omitempty"`
+}
+
+// RefusedCRDUpdate is a resource whose CRD the syncer refuses to update on the SyncTarget cluster.
+type RefusedCRDUpdate struct {
+	// group is the API group of the resource. It is empty for the core group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// resource is the plural name of the resource.
+	// +required
+	// +kubebuilder:validation:Required
+	Resource string `json:"resource"`
+
+	// message is the reason why the update is refused.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// SyncerResource is a resource a syncer is actively syncing.
+type SyncerResource struct {
+	// group is the API group of the resource. It is empty for the core group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// version is the API version of the resource.
+	// +required
+	// +kubebuilder:validation:Required
+	Version string `json:"version"`
+
+	// resource is the plural name of the resource.
+	// +required
+	// +kubebuilder:validation:Required
+	Resource string `json:"resource"`
+
+	// informersSynced is true when the upstream and downstream informers of the resource are synced.
+	// +optional
+	InformersSynced bool `json:"informersSynced,omitempty"`
 }
 
 type ResourceToSync struct {
@@ -180,6 +382,35 @@ const (
 
 	// ErrorHeartbeatMissedReason indicates that a heartbeat update was not received within the configured threshold.
 	ErrorHeartbeatMissedReason = "ErrorHeartbeat"
+
+	// SyncerVersionCompatible means the syncer has the same major and minor version as kcp.
+	SyncerVersionCompatible conditionsv1alpha1.ConditionType = "SyncerVersionCompatible"
+
+	// SyncerVersionSkewReason indicates that the syncer version differs from the kcp version.
+	SyncerVersionSkewReason = "VersionSkew"
+
+	// UnknownSyncerVersionReason indicates that the syncer or kcp version could not be parsed.
+	UnknownSyncerVersionReason = "UnknownVersion"
+
+	// SyncerStarted means the syncer has started syncing all its resources, i.e. its informers are synced.
+	SyncerStarted conditionsv1alpha1.ConditionType = "SyncerStarted"
+
+	// SyncerPartiallyStartedReason indicates that some syncer informers are not synced yet.
+	SyncerPartiallyStartedReason = "PartiallyStarted"
+
+	// DownstreamInSync is only set by a syncer running in dry-run mode. It is false when the syncer would have
+	// changed objects on the SyncTarget cluster, and its message then summarizes the changes.
+	DownstreamInSync conditionsv1alpha1.ConditionType = "DownstreamInSync"
+
+	// DryRunChangesPendingReason indicates that a syncer in dry-run mode would have changed objects on the SyncTarget cluster.
+	DryRunChangesPendingReason = "DryRunChangesPending"
+
+	// DownstreamNamespacesCollisionFree is set by the syncer. It is false when downstream namespaces are quarantined
+	// because they collided with downstream namespaces synced from the same upstream namespace.
+	DownstreamNamespacesCollisionFree conditionsv1alpha1.ConditionType = "DownstreamNamespacesCollisionFree"
+
+	// NamespacesQuarantinedReason indicates that downstream namespaces are quarantined after a namespace collision.
+	NamespacesQuarantinedReason = "NamespacesQuarantined"
 )
 
 func (in *SyncTarget) SetConditions(conditions conditionsv1alpha1.Conditions) {
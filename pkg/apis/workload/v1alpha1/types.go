@@ -27,6 +27,10 @@ const (
 	// This includes the deletion process until the resource is deleted downstream and the
 	// syncer removes the state.workload.kcp.dev/<sync-target-name> label.
 	ResourceStateSync ResourceState = "Sync"
+	// ResourceStateUpsync is the state of a resource created on the sync target, that is mirrored
+	// into a workspace by the syncer. The syncer owns the upstream resource: it creates it, reverts
+	// changes made to it, and deletes it when the resource is deleted on the sync target.
+	ResourceStateUpsync ResourceState = "Upsync"
 )
 
 const (
@@ -68,6 +72,8 @@ const (
 	//       controller will have to set the value to "Sync" after initializion in order to
 	//       start the sync process.
 	// - "Sync": the object is assigned and the syncer will start the sync process.
+	// - "Upsync": the object is created on the sync target, with the same label, and the syncer
+	//             mirrors it into the workspace, including its spec. Placement ignores such objects.
 	//
 	// While being in "Sync" state, a deletion timestamp in deletion.internal.workload.kcp.dev/<sync-target-name>
 	// will signal the start of the deletion process of the object. During the deletion process
@@ -105,6 +111,62 @@ const (
 	// The format for the value of this annotation is: JSON Patch (https://tools.ietf.org/html/rfc6902).
 	ClusterSpecDiffAnnotationPrefix = "experimental.spec-diff.workload.kcp.dev/"
 
+	// ClusterDriftAnnotationPrefix is the prefix of the annotation
+	//
+	//   drift.workload.kcp.dev/<sync-target-key>
+	//
+	// on upstream resources recording the last changes made directly on the sync target to the
+	// fields synced from upstream, i.e. changes not made by the syncer. The syncer either reverts
+	// those changes, or preserves them for the resources it is configured to.
+	//
+	// The format for the value of this annotation is a JSON object with the field managers that
+	// made the changes, the changed field paths, whether the changes were reverted, whether they block
+	// conflicting upstream changes, and when they were detected.
+	ClusterDriftAnnotationPrefix = "drift.workload.kcp.dev/"
+
+	// UpsyncWorkspaceAnnotation is the annotation on cluster-scoped resources of the sync target, in
+	// "Upsync" state, holding the logical cluster name of the workspace they are upsynced to. Namespaced
+	// resources are upsynced to the workspace and namespace their namespace is synced from.
+	UpsyncWorkspaceAnnotation = "workload.kcp.dev/upsync-workspace"
+
+	// AdoptionLabel is the label on downstream namespaces to adopt into a workspace, holding the sync
+	// target key of the syncer adopting them. The syncer removes it once the namespace is adopted.
+	AdoptionLabel = "workload.kcp.dev/adopt"
+
+	// AdoptionWorkspaceAnnotation is the annotation on downstream namespaces to adopt, holding the
+	// logical cluster name of the workspace they are adopted into.
+	AdoptionWorkspaceAnnotation = "workload.kcp.dev/adopt-workspace"
+
+	// AdoptionNamespaceAnnotation is the optional annotation on downstream namespaces to adopt, holding
+	// the name of the upstream namespace they are adopted into. It defaults to the downstream namespace name.
+	AdoptionNamespaceAnnotation = "workload.kcp.dev/adopt-namespace"
+
+	// AdoptionSelectorAnnotation is the optional annotation on downstream namespaces to adopt, holding a
+	// label selector of the objects to adopt with the namespace. All the objects of the synced resource
+	// types are adopted by default.
+	AdoptionSelectorAnnotation = "workload.kcp.dev/adopt-selector"
+
+	// QuarantinedNamespaceLabel is the label on the downstream namespaces quarantined by a syncer, holding its
+	// sync target key. A downstream namespace is quarantined when another downstream namespace, created earlier,
+	// is synced from the same upstream namespace. Quarantined namespaces are not synced anymore, and are deleted
+	// when their upstream namespace is.
+	QuarantinedNamespaceLabel = "workload.kcp.dev/quarantined"
+
+	// QuarantineReasonAnnotation is the annotation on quarantined downstream namespaces, explaining why they
+	// were quarantined.
+	QuarantineReasonAnnotation = "workload.kcp.dev/quarantine-reason"
+
+	// RewriteServiceDNSAnnotation is the annotation on upstream ConfigMaps holding a comma-separated list of the
+	// keys whose values reference Services by their in-cluster DNS names, e.g. db.my-namespace.svc. The syncer
+	// rewrites the namespaces of those names into the downstream namespaces they are synced to. The env vars,
+	// args and commands of the containers of workloads are always rewritten.
+	RewriteServiceDNSAnnotation = "workload.kcp.dev/rewrite-service-dns"
+
+	// InternalDownstreamWorkspaceLabel is the label on the downstream namespaces isolated by a NetworkPolicy,
+	// holding a hash of the logical cluster name of the workspace they are synced from. The NetworkPolicy
+	// selects the namespaces of the same workspace with it.
+	InternalDownstreamWorkspaceLabel = "internal.workload.kcp.dev/workspace"
+
 	// InternalDownstreamClusterLabel is a label with the upstream cluster name applied on the downstream cluster
 	// instead of state.workload.kcp.dev/<sync-target-name> which is used upstream.
 	InternalDownstreamClusterLabel = "internal.workload.kcp.dev/cluster"
@@ -22,14 +22,93 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
 	v1 "k8s.io/api/core/v1"
 	resource "k8s.io/apimachinery/pkg/api/resource"
 	runtime "k8s.io/apimachinery/pkg/runtime"
-
-	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
-	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageMapping) DeepCopyInto(out *ImageMapping) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageMapping.
+func (in *ImageMapping) DeepCopy() *ImageMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceNaming) DeepCopyInto(out *NamespaceNaming) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceNaming.
+func (in *NamespaceNaming) DeepCopy() *NamespaceNaming {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceNaming)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkIsolation) DeepCopyInto(out *NetworkIsolation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkIsolation.
+func (in *NetworkIsolation) DeepCopy() *NetworkIsolation {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkIsolation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RefusedCRDUpdate) DeepCopyInto(out *RefusedCRDUpdate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RefusedCRDUpdate.
+func (in *RefusedCRDUpdate) DeepCopy() *RefusedCRDUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(RefusedCRDUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceQuotaScaling) DeepCopyInto(out *ResourceQuotaScaling) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceQuotaScaling.
+func (in *ResourceQuotaScaling) DeepCopy() *ResourceQuotaScaling {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceQuotaScaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceToSync) DeepCopyInto(out *ResourceToSync) {
 	*out = *in
@@ -134,6 +213,26 @@ func (in *SyncTargetSpec) DeepCopyInto(out *SyncTargetSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.NamespaceNaming != nil {
+		in, out := &in.NamespaceNaming, &out.NamespaceNaming
+		*out = new(NamespaceNaming)
+		**out = **in
+	}
+	if in.NetworkIsolation != nil {
+		in, out := &in.NetworkIsolation, &out.NetworkIsolation
+		*out = new(NetworkIsolation)
+		**out = **in
+	}
+	if in.WorkloadMappings != nil {
+		in, out := &in.WorkloadMappings, &out.WorkloadMappings
+		*out = new(WorkloadMappings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceQuotaScaling != nil {
+		in, out := &in.ResourceQuotaScaling, &out.ResourceQuotaScaling
+		*out = new(ResourceQuotaScaling)
+		**out = **in
+	}
 	return
 }
 
@@ -195,6 +294,11 @@ func (in *SyncTargetStatus) DeepCopyInto(out *SyncTargetStatus) {
 		*out = make([]VirtualWorkspace, len(*in))
 		copy(*out, *in)
 	}
+	if in.Syncer != nil {
+		in, out := &in.Syncer, &out.Syncer
+		*out = new(SyncerStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -208,6 +312,53 @@ func (in *SyncTargetStatus) DeepCopy() *SyncTargetStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncerResource) DeepCopyInto(out *SyncerResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncerResource.
+func (in *SyncerResource) DeepCopy() *SyncerResource {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncerResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncerStatus) DeepCopyInto(out *SyncerStatus) {
+	*out = *in
+	if in.FeatureGates != nil {
+		in, out := &in.FeatureGates, &out.FeatureGates
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]SyncerResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.RefusedCRDUpdates != nil {
+		in, out := &in.RefusedCRDUpdates, &out.RefusedCRDUpdates
+		*out = make([]RefusedCRDUpdate, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncerStatus.
+func (in *SyncerStatus) DeepCopy() *SyncerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualWorkspace) DeepCopyInto(out *VirtualWorkspace) {
 	*out = *in
@@ -223,3 +374,31 @@ func (in *VirtualWorkspace) DeepCopy() *VirtualWorkspace {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadMappings) DeepCopyInto(out *WorkloadMappings) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]ImageMapping, len(*in))
+		copy(*out, *in)
+	}
+	if in.StorageClasses != nil {
+		in, out := &in.StorageClasses, &out.StorageClasses
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadMappings.
+func (in *WorkloadMappings) DeepCopy() *WorkloadMappings {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadMappings)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -46,6 +46,11 @@ var (
 	drainExample = `
 	# Start draining a sync target in preparation for maintenance.
 	%[1]s workload drain <sync-target-name>
+`
+	rotateCredentialsExample = `
+	# Rotate the credential of the syncer of a sync target, and apply it to the physical cluster.
+	%[1]s workload rotate-credentials <sync-target-name> -o credentials.yaml
+	KUBECONFIG=<pcluster-config> kubectl apply -f credentials.yaml
 `
 )
 
@@ -176,5 +181,33 @@ func New(streams genericclioptions.IOStreams) (*cobra.Command, error) {
 	drainOpts.BindFlags(drainCmd)
 	cmd.AddCommand(drainCmd)
 
+	// Rotate credentials command
+	rotateCredentialsOpts := plugin.NewRotateCredentialsOptions(streams)
+
+	rotateCredentialsCmd := &cobra.Command{
+		Use:          "rotate-credentials <sync-target-name> -o <output-file>",
+		Short:        "Issue a new credential for the syncer of a sync target and revoke the previous ones. Output a manifest of the new credential to apply in the physical cluster.",
+		Example:      fmt.Sprintf(rotateCredentialsExample, "kubectl kcp"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return c.Help()
+			}
+
+			if err := rotateCredentialsOpts.Complete(args); err != nil {
+				return err
+			}
+
+			if err := rotateCredentialsOpts.Validate(); err != nil {
+				return err
+			}
+
+			return rotateCredentialsOpts.Run(c.Context())
+		},
+	}
+
+	rotateCredentialsOpts.BindFlags(rotateCredentialsCmd)
+	cmd.AddCommand(rotateCredentialsCmd)
+
 	return cmd, nil
 }
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/cliplugins/base"
+)
+
+// RotateCredentialsOptions contains options for rotating the bootstrap credential of the syncer of a SyncTarget.
+type RotateCredentialsOptions struct {
+	*base.Options
+
+	// SyncTargetName is the name of the SyncTarget in the kcp workspace.
+	SyncTargetName string
+	// KCPNamespace is the name of the namespace in the kcp workspace of the syncer's service account.
+	KCPNamespace string
+	// DownstreamNamespace is the name of the namespace in the physical cluster where the syncer is deployed.
+	DownstreamNamespace string
+	// OutputFile is the path to a file where the YAML of the new syncer credential should be written.
+	OutputFile string
+}
+
+// NewRotateCredentialsOptions returns a new RotateCredentialsOptions.
+func NewRotateCredentialsOptions(streams genericclioptions.IOStreams) *RotateCredentialsOptions {
+	return &RotateCredentialsOptions{
+		Options: base.NewOptions(streams),
+
+		KCPNamespace: "default",
+	}
+}
+
+// BindFlags binds fields RotateCredentialsOptions as command line flags to cmd's flagset.
+func (o *RotateCredentialsOptions) BindFlags(cmd *cobra.Command) {
+	o.Options.BindFlags(cmd)
+
+	cmd.Flags().StringVar(&o.KCPNamespace, "kcp-namespace", o.KCPNamespace, "The name of the kcp namespace of the syncer's service account.")
+	cmd.Flags().StringVarP(&o.OutputFile, "output-file", "o", o.OutputFile, "The manifest file of the new credential to be created and applied to the physical cluster. Use - for stdout.")
+	cmd.Flags().StringVarP(&o.DownstreamNamespace, "namespace", "n", o.DownstreamNamespace, "The namespace of the syncer in the physical cluster. By default this is \"kcp-syncer-<synctarget-name>-<uid>\".")
+}
+
+// Complete ensures all dynamically populated fields are initialized.
+func (o *RotateCredentialsOptions) Complete(args []string) error {
+	if err := o.Options.Complete(); err != nil {
+		return err
+	}
+
+	o.SyncTargetName = args[0]
+
+	return nil
+}
+
+// Validate validates the RotateCredentialsOptions are complete and usable.
+func (o *RotateCredentialsOptions) Validate() error {
+	var errs []error
+
+	if err := o.Options.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if o.KCPNamespace == "" {
+		errs = append(errs, errors.New("--kcp-namespace is required"))
+	}
+
+	if o.OutputFile == "" {
+		errs = append(errs, errors.New("--output-file is required"))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// Run issues a new token for the service account of the syncer, revokes its previous tokens, and outputs the
+// manifest of the Secret holding the syncer's kubeconfig with the new token, to be applied to the pcluster.
+func (o *RotateCredentialsOptions) Run(ctx context.Context) error {
+	config, err := o.ClientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	serverURL, _, err := syncerServerURL(config)
+	if err != nil {
+		return err
+	}
+
+	kcpClient, err := kcpclient.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kcp client: %w", err)
+	}
+	syncTarget, err := kcpClient.WorkloadV1alpha1().SyncTargets().Get(ctx, o.SyncTargetName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get synctarget %q: %w", o.SyncTargetName, err)
+	}
+	syncerID := getSyncerID(syncTarget)
+
+	if o.DownstreamNamespace == "" {
+		o.DownstreamNamespace = syncerID
+	}
+
+	kubeClient, err := kubernetesclient.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	token, err := o.rotateServiceAccountToken(ctx, kubeClient, syncTarget, syncerID)
+	if err != nil {
+		return err
+	}
+
+	resources, err := renderTemplate("syncer-credentials.yaml", templateArgs{
+		templateInput: templateInput{
+			ServerURL:    serverURL,
+			CAData:       base64.StdEncoding.EncodeToString(config.CAData),
+			Token:        token,
+			KCPNamespace: o.KCPNamespace,
+			Namespace:    o.DownstreamNamespace,
+		},
+		Secret:          syncerID,
+		SecretConfigKey: SyncerSecretConfigKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.OutputFile == "-" {
+		_, err = o.Out.Write(resources)
+		return err
+	}
+	if err := os.WriteFile(o.OutputFile, resources, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.ErrOut, "\nWrote the new syncer credential to %s for namespace %q. Use\n\n  KUBECONFIG=<pcluster-config> kubectl apply -f %q\n\nto apply it. "+
+		"The syncer picks it up without a restart.\n", o.OutputFile, o.DownstreamNamespace, o.OutputFile)
+	return nil
+}
+
+// rotateServiceAccountToken creates a new token Secret for the service account of the syncer, references it
+// from the service account, and deletes the other token Secrets of the service account, revoking their tokens.
+// It returns the new token.
+func (o *RotateCredentialsOptions) rotateServiceAccountToken(ctx context.Context, kubeClient kubernetesclient.Interface, syncTarget *workloadv1alpha1.SyncTarget, syncerID string) (string, error) {
+	namespace := o.KCPNamespace
+
+	if _, err := kubeClient.CoreV1().ServiceAccounts(namespace).Get(ctx, syncerID, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("ServiceAccount %s/%s of synctarget %q not found, use `kubectl kcp workload sync` to create it", namespace, syncerID, o.SyncTargetName)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get the ServiceAccount %s/%s: %w", namespace, syncerID, err)
+	}
+
+	fmt.Fprintf(o.ErrOut, "Creating a new token for service account %q\n", syncerID)
+	tokenSecret, err := kubeClient.CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: syncerID + "-token-",
+			Annotations: map[string]string{
+				corev1.ServiceAccountNameKey: syncerID,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: workloadv1alpha1.SchemeGroupVersion.String(),
+				Kind:       "SyncTarget",
+				Name:       syncTarget.Name,
+				UID:        syncTarget.UID,
+			}},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create a token Secret for ServiceAccount %s/%s: %w", namespace, syncerID, err)
+	}
+
+	// Wait for the token to be populated
+	var token string
+	err = wait.PollImmediateWithContext(ctx, 100*time.Millisecond, 20*time.Second, func(ctx context.Context) (bool, error) {
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, tokenSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.V(5).Infof("failed to retrieve Secret: %v", err)
+			return false, nil
+		}
+		token = string(secret.Data[corev1.ServiceAccountTokenKey])
+		return token != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("timed out waiting for the token of Secret %s/%s", namespace, tokenSecret.Name)
+	}
+
+	// Reference the new token Secret from the service account, so that `kubectl kcp workload sync` uses it too.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sa, err := kubeClient.CoreV1().ServiceAccounts(namespace).Get(ctx, syncerID, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		sa.Secrets = []corev1.ObjectReference{{Name: tokenSecret.Name}}
+		_, err = kubeClient.CoreV1().ServiceAccounts(namespace).Update(ctx, sa, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update ServiceAccount %s/%s: %w", namespace, syncerID, err)
+	}
+
+	secrets, err := kubeClient.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the Secrets of namespace %s: %w", namespace, err)
+	}
+	for _, secret := range secrets.Items {
+		if secret.Type != corev1.SecretTypeServiceAccountToken || secret.Annotations[corev1.ServiceAccountNameKey] != syncerID || secret.Name == tokenSecret.Name {
+			continue
+		}
+		fmt.Fprintf(o.ErrOut, "Revoking the token of Secret %q\n", secret.Name)
+		if err := kubeClient.CoreV1().Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return "", fmt.Errorf("failed to delete the token Secret %s/%s: %w", namespace, secret.Name, err)
+		}
+	}
+
+	return token, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestRotateServiceAccountToken(t *testing.T) {
+	syncerID := "kcp-syncer-sync-target-name-34b23c4k"
+	tokenSecret := func(name, serviceAccount string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{corev1.ServiceAccountNameKey: serviceAccount},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+			Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte(name)},
+		}
+	}
+
+	kubeClient := kubefake.NewSimpleClientset(
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: syncerID, Namespace: "default"},
+			Secrets:    []corev1.ObjectReference{{Name: syncerID + "-token-old"}},
+		},
+		tokenSecret(syncerID+"-token-old", syncerID),
+		tokenSecret("other-token", "other"),
+	)
+	// Issue the tokens of the created token Secrets, as the token controller would.
+	kubeClient.PrependReactor("create", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		secret := action.(clienttesting.CreateAction).GetObject().(*corev1.Secret)
+		secret.Name = secret.GenerateName + "new"
+		secret.Data = map[string][]byte{corev1.ServiceAccountTokenKey: []byte("new-token")}
+		return false, nil, nil
+	})
+
+	o := NewRotateCredentialsOptions(genericclioptions.NewTestIOStreamsDiscard())
+	o.SyncTargetName = "sync-target-name"
+	token, err := o.rotateServiceAccountToken(context.Background(), kubeClient, &workloadv1alpha1.SyncTarget{
+		ObjectMeta: metav1.ObjectMeta{Name: "sync-target-name", UID: "uid"},
+	}, syncerID)
+	require.NoError(t, err)
+	require.Equal(t, "new-token", token)
+
+	sa, err := kubeClient.CoreV1().ServiceAccounts("default").Get(context.Background(), syncerID, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []corev1.ObjectReference{{Name: syncerID + "-token-new"}}, sa.Secrets)
+
+	secrets, err := kubeClient.CoreV1().Secrets("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	require.ElementsMatch(t, []string{syncerID + "-token-new", "other-token"}, names, "the previous token of the syncer should be revoked")
+}
+
+func TestRotateServiceAccountTokenWithoutServiceAccount(t *testing.T) {
+	o := NewRotateCredentialsOptions(genericclioptions.NewTestIOStreamsDiscard())
+	o.SyncTargetName = "sync-target-name"
+	_, err := o.rotateServiceAccountToken(context.Background(), kubefake.NewSimpleClientset(), &workloadv1alpha1.SyncTarget{}, "kcp-syncer-sync-target-name-34b23c4k")
+	require.ErrorContains(t, err, "use `kubectl kcp workload sync` to create it")
+}
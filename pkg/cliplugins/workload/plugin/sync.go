@@ -32,6 +32,7 @@ import (
 	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/kcp-dev/logicalcluster/v2"
 	"github.com/martinlindhe/base36"
 	"github.com/spf13/cobra"
 
@@ -50,6 +51,7 @@ import (
 	"k8s.io/klog/v2"
 
 	apiresourcev1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apiresource/v1alpha1"
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	"github.com/kcp-dev/kcp/pkg/cliplugins/base"
@@ -91,6 +93,8 @@ type SyncOptions struct {
 	SyncTargetName string
 	// FeatureGates is used to configure which feature gates are enabled.
 	FeatureGates string
+	// InstallCRDs makes the syncer install the CRDs of the resources to sync on the physical cluster.
+	InstallCRDs bool
 }
 
 // NewSyncOptions returns a new SyncOptions.
@@ -111,7 +115,7 @@ func (o *SyncOptions) BindFlags(cmd *cobra.Command) {
 
 	cmd.Flags().StringSliceVar(&o.ResourcesToSync, "resources", o.ResourcesToSync, "Resources to synchronize with kcp.")
 	cmd.Flags().StringVar(&o.SyncerImage, "syncer-image", o.SyncerImage, "The syncer image to use in the syncer's deployment YAML. Images are published at https://github.com/kcp-dev/kcp/pkgs/container/kcp%2Fsyncer.")
-	cmd.Flags().IntVar(&o.Replicas, "replicas", o.Replicas, "Number of replicas of the syncer deployment.")
+	cmd.Flags().IntVar(&o.Replicas, "replicas", o.Replicas, "Number of replicas of the syncer deployment. The replicas elect a leader that syncs, the others stand by to take over.")
 	cmd.Flags().StringVar(&o.KCPNamespace, "kcp-namespace", o.KCPNamespace, "The name of the kcp namespace to create a service account in.")
 	cmd.Flags().StringVarP(&o.OutputFile, "output-file", "o", o.OutputFile, "The manifest file to be created and applied to the physical cluster. Use - for stdout.")
 	cmd.Flags().StringVarP(&o.DownstreamNamespace, "namespace", "n", o.DownstreamNamespace, "The namespace to create the syncer in in the physical cluster. By default this is \"kcp-syncer-<synctarget-name>-<uid>\".")
@@ -120,6 +124,7 @@ func (o *SyncOptions) BindFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&o.FeatureGates, "feature-gates", o.FeatureGates,
 		"A set of key=value pairs that describe feature gates for alpha/experimental features. "+
 			"Options are:\n"+strings.Join(kcpfeatures.KnownFeatures(), "\n")) // hide kube-only gates
+	cmd.Flags().BoolVar(&o.InstallCRDs, "install-crds", o.InstallCRDs, "Make the syncer create and update the CRDs of the resources to sync on the physical cluster, from the APIResourceSchemas of the APIExports supported by the SyncTarget in its workspace.")
 }
 
 // Complete ensures all dynamically populated fields are initialized.
@@ -152,10 +157,6 @@ func (o *SyncOptions) Validate() error {
 	if o.Replicas < 0 {
 		errs = append(errs, errors.New("--replicas cannot be negative"))
 	}
-	if o.Replicas > 1 {
-		// TODO: relax when we have leader-election in the syncer
-		errs = append(errs, errors.New("only 0 and 1 are valid values for --replicas"))
-	}
 
 	if o.OutputFile == "" {
 		errs = append(errs, errors.New("--output-file is required"))
@@ -200,22 +201,15 @@ func (o *SyncOptions) Run(ctx context.Context) error {
 		return err
 	}
 
-	configURL, currentClusterName, err := helpers.ParseClusterURL(config.Host)
+	serverURL, currentClusterName, err := syncerServerURL(config)
 	if err != nil {
-		return fmt.Errorf("current URL %q does not point to cluster workspace", config.Host)
+		return err
 	}
 
 	if o.DownstreamNamespace == "" {
 		o.DownstreamNamespace = syncerID
 	}
 
-	// Compose the syncer's upstream configuration server URL without any path. This is
-	// required so long as the API importer and syncer expect to require cluster clients.
-	//
-	// TODO(marun) It's probably preferable that the syncer and importer are provided a
-	// cluster configuration since they only operate against a single workspace.
-	serverURL := configURL.Scheme + "://" + configURL.Host
-
 	input := templateInput{
 		ServerURL:          serverURL,
 		CAData:             base64.StdEncoding.EncodeToString(config.CAData),
@@ -231,6 +225,7 @@ func (o *SyncOptions) Run(ctx context.Context) error {
 		QPS:                o.QPS,
 		Burst:              o.Burst,
 		FeatureGatesString: o.FeatureGates,
+		InstallCRDs:        o.InstallCRDs,
 	}
 
 	resources, err := renderSyncerResources(input, syncerID)
@@ -246,6 +241,22 @@ func (o *SyncOptions) Run(ctx context.Context) error {
 	return err
 }
 
+// syncerServerURL returns the server URL of the syncer's upstream configuration, and the logical cluster
+// of the current workspace.
+func syncerServerURL(config *rest.Config) (string, logicalcluster.Name, error) {
+	configURL, currentClusterName, err := helpers.ParseClusterURL(config.Host)
+	if err != nil {
+		return "", logicalcluster.Name{}, fmt.Errorf("current URL %q does not point to cluster workspace", config.Host)
+	}
+
+	// Compose the syncer's upstream configuration server URL without any path. This is
+	// required so long as the API importer and syncer expect to require cluster clients.
+	//
+	// TODO(marun) It's probably preferable that the syncer and importer are provided a
+	// cluster configuration since they only operate against a single workspace.
+	return configURL.Scheme + "://" + configURL.Host, currentClusterName, nil
+}
+
 // getSyncerID returns a unique ID for a syncer derived from the name and its UID. It's
 // a valid DNS segment and can be used as namespace or object names.
 func getSyncerID(syncTarget *workloadv1alpha1.SyncTarget) string {
@@ -375,6 +386,23 @@ func (o *SyncOptions) enableSyncerForWorkspace(ctx context.Context, config *rest
 			APIGroups: []string{apiresourcev1alpha1.SchemeGroupVersion.Group},
 			Resources: []string{"apiresourceimports"},
 		},
+		{
+			Verbs:         []string{"create"},
+			APIGroups:     []string{""},
+			ResourceNames: []string{syncerID},
+			Resources:     []string{"serviceaccounts/token"},
+		},
+	}
+	permissions := " 1. write and sync access to the synctarget %[1]q\n 2. write access to apiresourceimports\n 3. short-lived tokens for its service account"
+	if o.InstallCRDs {
+		// The syncer installs the CRDs from the APIResourceSchemas of the supported APIExports of the
+		// workspace of the SyncTarget only.
+		rules = append(rules, rbacv1.PolicyRule{
+			Verbs:     []string{"get"},
+			APIGroups: []string{apisv1alpha1.SchemeGroupVersion.Group},
+			Resources: []string{"apiexports", "apiresourceschemas"},
+		})
+		permissions += "\n 4. read access to apiexports and apiresourceschemas, to install their CRDs"
 	}
 
 	cr, err := kubeClient.RbacV1().ClusterRoles().Get(ctx,
@@ -382,7 +410,7 @@ func (o *SyncOptions) enableSyncerForWorkspace(ctx context.Context, config *rest
 		metav1.GetOptions{})
 	switch {
 	case apierrors.IsNotFound(err):
-		fmt.Fprintf(o.ErrOut, "Creating cluster role %q to give service account %q\n\n 1. write and sync access to the synctarget %q\n 2. write access to apiresourceimports.\n\n", syncerID, syncerID, syncerID)
+		fmt.Fprintf(o.ErrOut, "Creating cluster role %[1]q to give service account %[1]q\n\n"+permissions+".\n\n", syncerID)
 		if _, err = kubeClient.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:            syncerID,
@@ -420,7 +448,7 @@ func (o *SyncOptions) enableSyncerForWorkspace(ctx context.Context, config *rest
 			return "", "", "", fmt.Errorf("failed to create patch for ClusterRole %s|%s: %w", syncTargetName, syncerID, err)
 		}
 
-		fmt.Fprintf(o.ErrOut, "Updating cluster role %q with\n\n 1. write and sync access to the synctarget %q\n 2. write access to apiresourceimports.\n\n", syncerID, syncerID)
+		fmt.Fprintf(o.ErrOut, "Updating cluster role %[1]q with\n\n"+permissions+".\n\n", syncerID)
 		if _, err = kubeClient.RbacV1().ClusterRoles().Patch(ctx, cr.Name, types.MergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
 			return "", "", "", fmt.Errorf("failed to patch ClusterRole %s|%s/%s: %w", syncTargetName, syncerID, namespace, err)
 		}
@@ -548,7 +576,7 @@ type templateInput struct {
 	ResourcesToSync []string
 	// Image is the name of the container image that the syncer deployment will use
 	Image string
-	// Replicas is the number of syncer pods to run (should be 0 or 1).
+	// Replicas is the number of syncer pods to run. A single one syncs at a time, the others stand by.
 	Replicas int
 	// QPS is the qps the syncer uses when talking to an apiserver.
 	QPS float32
@@ -556,6 +584,9 @@ type templateInput struct {
 	Burst int
 	// FeatureGatesString is the set of features gates.
 	FeatureGatesString string
+	// InstallCRDs makes the syncer install the CRDs of the resources to sync, and grants it the
+	// permission to create and update CRDs on the pcluster.
+	InstallCRDs bool
 }
 
 // templateArgs represents the full set of arguments required to render the resources
@@ -574,6 +605,12 @@ type templateArgs struct {
 	// ClusterRoleBinding is the name of the cluster role binding to create for the
 	// syncer on the pcluster.
 	ClusterRoleBinding string
+	// Role is the name of the role to create in the syncer namespace on the pcluster,
+	// giving the syncer access to its leader election lease.
+	Role string
+	// RoleBinding is the name of the role binding to create for the syncer in the
+	// syncer namespace on the pcluster.
+	RoleBinding string
 	// GroupMappings is the mapping of api group to resources that will be used to
 	// define the cluster role rules for the syncer in the pcluster. The syncer will be
 	// granted full permissions for the resources it will synchronize.
@@ -604,6 +641,8 @@ func renderSyncerResources(input templateInput, syncerID string) ([]byte, error)
 		ServiceAccount:          syncerID,
 		ClusterRole:             syncerID,
 		ClusterRoleBinding:      syncerID,
+		Role:                    syncerID,
+		RoleBinding:             syncerID,
 		GroupMappings:           getGroupMappings(input.ResourcesToSync),
 		Secret:                  syncerID,
 		SecretConfigKey:         SyncerSecretConfigKey,
@@ -611,16 +650,17 @@ func renderSyncerResources(input templateInput, syncerID string) ([]byte, error)
 		DeploymentApp:           syncerID,
 	}
 
-	syncerTemplate, err := embeddedResources.ReadFile("syncer.yaml")
-	if err != nil {
-		return nil, err
-	}
-	tmpl, err := template.New("syncerTemplate").Parse(string(syncerTemplate))
+	return renderTemplate("syncer.yaml", tmplArgs)
+}
+
+// renderTemplate renders one of the embedded templates, which can include the others.
+func renderTemplate(name string, tmplArgs templateArgs) ([]byte, error) {
+	tmpl, err := template.ParseFS(embeddedResources, "*.yaml")
 	if err != nil {
 		return nil, err
 	}
 	buffer := bytes.NewBuffer([]byte{})
-	err = tmpl.Execute(buffer, tmplArgs)
+	err = tmpl.ExecuteTemplate(buffer, name, tmplArgs)
 	if err != nil {
 		return nil, err
 	}
@@ -59,9 +59,27 @@ rules:
   - namespaces
   verbs:
   - "create"
+  - "get"
   - "list"
   - "watch"
+  - "patch"
   - "delete"
+- apiGroups:
+  - "networking.k8s.io"
+  resources:
+  - networkpolicies
+  verbs:
+  - "create"
+  - "patch"
+  - "delete"
+- apiGroups:
+  - ""
+  resources:
+  - events
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
 - apiGroups:
   - "apiextensions.k8s.io"
   resources:
@@ -91,6 +109,35 @@ subjects:
   name: kcp-syncer-sync-target-name-34b23c4k
   namespace: kcp-syncer-sync-target-name-34b23c4k
 ---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+rules:
+- apiGroups:
+  - "coordination.k8s.io"
+  resources:
+  - leases
+  verbs:
+  - "get"
+  - "create"
+  - "update"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: kcp-syncer-sync-target-name-34b23c4k
+subjects:
+- kind: ServiceAccount
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+---
 apiVersion: v1
 kind: Secret
 metadata:
@@ -147,9 +194,30 @@ spec:
         - --resources=resource2
         - --qps=123.4
         - --burst=456
+        - --leader-elect
+        - --leader-election-namespace=kcp-syncer-sync-target-name-34b23c4k
+        - --leader-election-id=kcp-syncer-sync-target-name-34b23c4k
+        - --metrics-bind-address=:8080
+        - --upstream-token-expiration=1h
         image: image
         imagePullPolicy: IfNotPresent
         terminationMessagePolicy: FallbackToLogsOnError
+        ports:
+        - name: metrics
+          containerPort: 8080
+        - name: health
+          containerPort: 8081
+        livenessProbe:
+          httpGet:
+            path: /livez
+            port: health
+          initialDelaySeconds: 10
+          periodSeconds: 10
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: health
+          periodSeconds: 10
         volumeMounts:
         - name: kcp-config
           mountPath: /kcp/
@@ -216,9 +284,27 @@ rules:
   - namespaces
   verbs:
   - "create"
+  - "get"
   - "list"
   - "watch"
+  - "patch"
   - "delete"
+- apiGroups:
+  - "networking.k8s.io"
+  resources:
+  - networkpolicies
+  verbs:
+  - "create"
+  - "patch"
+  - "delete"
+- apiGroups:
+  - ""
+  resources:
+  - events
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
 - apiGroups:
   - "apiextensions.k8s.io"
   resources:
@@ -248,6 +334,35 @@ subjects:
   name: kcp-syncer-sync-target-name-34b23c4k
   namespace: kcp-syncer-sync-target-name-34b23c4k
 ---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+rules:
+- apiGroups:
+  - "coordination.k8s.io"
+  resources:
+  - leases
+  verbs:
+  - "get"
+  - "create"
+  - "update"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: kcp-syncer-sync-target-name-34b23c4k
+subjects:
+- kind: ServiceAccount
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+---
 apiVersion: v1
 kind: Secret
 metadata:
@@ -304,10 +419,31 @@ spec:
         - --resources=resource2
         - --qps=123.4
         - --burst=456
+        - --leader-elect
+        - --leader-election-namespace=kcp-syncer-sync-target-name-34b23c4k
+        - --leader-election-id=kcp-syncer-sync-target-name-34b23c4k
+        - --metrics-bind-address=:8080
+        - --upstream-token-expiration=1h
         - --feature-gates=myfeature=true
         image: image
         imagePullPolicy: IfNotPresent
         terminationMessagePolicy: FallbackToLogsOnError
+        ports:
+        - name: metrics
+          containerPort: 8080
+        - name: health
+          containerPort: 8081
+        livenessProbe:
+          httpGet:
+            path: /livez
+            port: health
+          initialDelaySeconds: 10
+          periodSeconds: 10
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: health
+          periodSeconds: 10
         volumeMounts:
         - name: kcp-config
           mountPath: /kcp/
@@ -339,6 +475,235 @@ spec:
 	require.Empty(t, cmp.Diff(expectedYAML, string(actualYAML)))
 }
 
+func TestNewSyncerYAMLWithInstallCRDs(t *testing.T) {
+	expectedYAML := `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  labels:
+    workload.kcp.io/logical-cluster: root_default_foo
+    workload.kcp.io/sync-target: sync-target-name
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k-token
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+  annotations:
+    kubernetes.io/service-account.name: kcp-syncer-sync-target-name-34b23c4k
+type: kubernetes.io/service-account-token
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - namespaces
+  verbs:
+  - "create"
+  - "get"
+  - "list"
+  - "watch"
+  - "patch"
+  - "delete"
+- apiGroups:
+  - "networking.k8s.io"
+  resources:
+  - networkpolicies
+  verbs:
+  - "create"
+  - "patch"
+  - "delete"
+- apiGroups:
+  - ""
+  resources:
+  - events
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
+- apiGroups:
+  - "apiextensions.k8s.io"
+  resources:
+  - customresourcedefinitions
+  verbs:
+  - "get"
+  - "watch"
+  - "list"
+  - "create"
+  - "update"
+- apiGroups:
+  - ""
+  resources:
+  - resource1
+  - resource2
+  verbs:
+  - "*"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: kcp-syncer-sync-target-name-34b23c4k
+subjects:
+- kind: ServiceAccount
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+rules:
+- apiGroups:
+  - "coordination.k8s.io"
+  resources:
+  - leases
+  verbs:
+  - "get"
+  - "create"
+  - "update"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: kcp-syncer-sync-target-name-34b23c4k
+subjects:
+- kind: ServiceAccount
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+stringData:
+  kubeconfig: |
+    apiVersion: v1
+    kind: Config
+    clusters:
+    - name: default-cluster
+      cluster:
+        certificate-authority-data: ca-data
+        server: server-url
+    contexts:
+    - name: default-context
+      context:
+        cluster: default-cluster
+        namespace: kcp-namespace
+        user: default-user
+    current-context: default-context
+    users:
+    - name: default-user
+      user:
+        token: token
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kcp-syncer-sync-target-name-34b23c4k
+  namespace: kcp-syncer-sync-target-name-34b23c4k
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app: kcp-syncer-sync-target-name-34b23c4k
+  template:
+    metadata:
+      labels:
+        app: kcp-syncer-sync-target-name-34b23c4k
+    spec:
+      containers:
+      - name: kcp-syncer
+        command:
+        - /ko-app/syncer
+        args:
+        - --from-kubeconfig=/kcp/kubeconfig
+        - --sync-target-name=sync-target-name
+        - --sync-target-uid=sync-target-uid
+        - --from-cluster=root:default:foo
+        - --resources=resource1
+        - --resources=resource2
+        - --qps=123.4
+        - --burst=456
+        - --leader-elect
+        - --leader-election-namespace=kcp-syncer-sync-target-name-34b23c4k
+        - --leader-election-id=kcp-syncer-sync-target-name-34b23c4k
+        - --metrics-bind-address=:8080
+        - --upstream-token-expiration=1h
+        - --install-crds
+        image: image
+        imagePullPolicy: IfNotPresent
+        terminationMessagePolicy: FallbackToLogsOnError
+        ports:
+        - name: metrics
+          containerPort: 8080
+        - name: health
+          containerPort: 8081
+        livenessProbe:
+          httpGet:
+            path: /livez
+            port: health
+          initialDelaySeconds: 10
+          periodSeconds: 10
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: health
+          periodSeconds: 10
+        volumeMounts:
+        - name: kcp-config
+          mountPath: /kcp/
+          readOnly: true
+      serviceAccountName: kcp-syncer-sync-target-name-34b23c4k
+      volumes:
+        - name: kcp-config
+          secret:
+            secretName: kcp-syncer-sync-target-name-34b23c4k
+            optional: false
+`
+	actualYAML, err := renderSyncerResources(templateInput{
+		ServerURL:       "server-url",
+		Token:           "token",
+		CAData:          "ca-data",
+		KCPNamespace:    "kcp-namespace",
+		Namespace:       "kcp-syncer-sync-target-name-34b23c4k",
+		LogicalCluster:  "root:default:foo",
+		SyncTarget:      "sync-target-name",
+		SyncTargetUID:   "sync-target-uid",
+		Image:           "image",
+		Replicas:        1,
+		ResourcesToSync: []string{"resource1", "resource2"},
+		QPS:             123.4,
+		Burst:           456,
+		InstallCRDs:     true,
+	}, "kcp-syncer-sync-target-name-34b23c4k")
+	require.NoError(t, err)
+	require.Empty(t, cmp.Diff(expectedYAML, string(actualYAML)))
+}
+
 func TestGetGroupMappings(t *testing.T) {
 	testCases := []struct {
 		name     string
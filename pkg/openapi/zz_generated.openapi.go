@@ -103,12 +103,20 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1.WorkspaceSpec":                             schema_pkg_apis_tenancy_v1beta1_WorkspaceSpec(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/tenancy/v1beta1.WorkspaceStatus":                           schema_pkg_apis_tenancy_v1beta1_WorkspaceStatus(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1.Condition": schema_conditions_apis_conditions_v1alpha1_Condition(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ImageMapping":                            schema_pkg_apis_workload_v1alpha1_ImageMapping(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NamespaceNaming":                         schema_pkg_apis_workload_v1alpha1_NamespaceNaming(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NetworkIsolation":                        schema_pkg_apis_workload_v1alpha1_NetworkIsolation(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.RefusedCRDUpdate":                        schema_pkg_apis_workload_v1alpha1_RefusedCRDUpdate(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceQuotaScaling":                    schema_pkg_apis_workload_v1alpha1_ResourceQuotaScaling(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceToSync":                          schema_pkg_apis_workload_v1alpha1_ResourceToSync(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncTarget":                              schema_pkg_apis_workload_v1alpha1_SyncTarget(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncTargetList":                          schema_pkg_apis_workload_v1alpha1_SyncTargetList(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncTargetSpec":                          schema_pkg_apis_workload_v1alpha1_SyncTargetSpec(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncTargetStatus":                        schema_pkg_apis_workload_v1alpha1_SyncTargetStatus(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerResource":                          schema_pkg_apis_workload_v1alpha1_SyncerResource(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerStatus":                            schema_pkg_apis_workload_v1alpha1_SyncerStatus(ref),
 		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.VirtualWorkspace":                        schema_pkg_apis_workload_v1alpha1_VirtualWorkspace(ref),
+		"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.WorkloadMappings":                        schema_pkg_apis_workload_v1alpha1_WorkloadMappings(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIGroup":                                             schema_pkg_apis_meta_v1_APIGroup(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIGroupList":                                         schema_pkg_apis_meta_v1_APIGroupList(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIResource":                                          schema_pkg_apis_meta_v1_APIResource(ref),
@@ -3566,6 +3574,146 @@ func schema_conditions_apis_conditions_v1alpha1_Condition(ref common.ReferenceCa
 	}
 }
 
+func schema_pkg_apis_workload_v1alpha1_ImageMapping(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ImageMapping is a rewrite of the prefix of container images.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"from": {
+						SchemaProps: spec.SchemaProps{
+							Description: "from is the image prefix to replace, e.g. docker.io/library/.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"to": {
+						SchemaProps: spec.SchemaProps{
+							Description: "to is the image prefix replacing it, e.g. registry.local:5000/library/.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"from", "to"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_NamespaceNaming(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NamespaceNaming defines how the namespaces created on the SyncTarget cluster are named. Changing it only affects the namespaces created afterwards: the existing namespaces keep their names.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"strategy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "strategy is the naming strategy, either Hash or Template.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"template": {
+						SchemaProps: spec.SchemaProps{
+							Description: "template is the Go template of the namespace names of the Template strategy, e.g. \"{{.WorkspaceName}}-{{.Namespace}}\". It is executed with the fields:\n\n- Workspace: the logical cluster name of the workspace, e.g. root:org:ws. - WorkspaceName: the last segment of the logical cluster name of the workspace, e.g. ws. - Namespace: the namespace name. - SyncTargetName: the name of the SyncTarget.\n\nThe result is lower-cased, and the characters not allowed in namespace names are replaced with \"-\". The Hash strategy is used when it is not a valid namespace name.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_NetworkIsolation(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NetworkIsolation defines the NetworkPolicy created by the syncer in the namespaces of the SyncTarget cluster.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"policyTemplate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "policyTemplate is the Go template of the spec of the NetworkPolicy, in YAML. It is executed with the fields:\n\n- Workspace: the logical cluster name of the workspace, e.g. root:org:ws. - Namespace: the upstream namespace name. - SyncTargetName: the name of the SyncTarget. - WorkspaceLabel: the key of the label the syncer sets on the namespaces synced from the workspace. - WorkspaceLabelValue: the value of that label for the workspace.\n\nBy default, the policy allows the ingress traffic from the namespaces synced from the same workspace only.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_RefusedCRDUpdate(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RefusedCRDUpdate is a resource whose CRD the syncer refuses to update on the SyncTarget cluster.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"group": {
+						SchemaProps: spec.SchemaProps{
+							Description: "group is the API group of the resource. It is empty for the core group.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resource": {
+						SchemaProps: spec.SchemaProps{
+							Description: "resource is the plural name of the resource.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "message is the reason why the update is refused.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"resource"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_ResourceQuotaScaling(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ResourceQuotaScaling defines how the hard limits of the ResourceQuotas synced to the SyncTarget cluster are scaled. The scaled limits are rounded down, to the millicore for CPU resources, and to integers for the other resources.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"policy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "policy is the scaling policy, either None, Divide or Percent.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"percent": {
+						SchemaProps: spec.SchemaProps{
+							Description: "percent is the percentage of the hard limits synced with the Percent policy.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_workload_v1alpha1_ResourceToSync(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -3758,11 +3906,35 @@ func schema_pkg_apis_workload_v1alpha1_SyncTargetSpec(ref common.ReferenceCallba
 							},
 						},
 					},
+					"namespaceNaming": {
+						SchemaProps: spec.SchemaProps{
+							Description: "namespaceNaming defines how the namespaces created on the SyncTarget cluster for the synced namespaces are named. By default, they are named \"kcp-<hash>\", from a hash of the workspace and namespace they are synced from.",
+							Ref:         ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NamespaceNaming"),
+						},
+					},
+					"networkIsolation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "networkIsolation makes the syncer create a NetworkPolicy in every namespace it syncs to the SyncTarget cluster, so that workloads only receive traffic from the namespaces synced from the same workspace. It is disabled when not set.",
+							Ref:         ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NetworkIsolation"),
+						},
+					},
+					"workloadMappings": {
+						SchemaProps: spec.SchemaProps{
+							Description: "workloadMappings defines how the synced workloads are adapted to the SyncTarget cluster, e.g. to pull their images from a local registry mirror.",
+							Ref:         ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.WorkloadMappings"),
+						},
+					},
+					"resourceQuotaScaling": {
+						SchemaProps: spec.SchemaProps{
+							Description: "resourceQuotaScaling defines how the hard limits of the ResourceQuotas synced to the SyncTarget cluster are scaled from the hard limits of the ResourceQuotas of their workspace. By default, they are not scaled.",
+							Ref:         ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceQuotaScaling"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1.ExportReference", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+			"github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1.ExportReference", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NamespaceNaming", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.NetworkIsolation", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceQuotaScaling", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.WorkloadMappings", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
@@ -3851,11 +4023,133 @@ func schema_pkg_apis_workload_v1alpha1_SyncTargetStatus(ref common.ReferenceCall
 							},
 						},
 					},
+					"syncer": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Syncer is the state of the syncer, as reported by its last heartbeat.",
+							Ref:         ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1.Condition", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceToSync", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerStatus", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.VirtualWorkspace", "k8s.io/apimachinery/pkg/api/resource.Quantity", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_SyncerResource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SyncerResource is a resource a syncer is actively syncing.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"group": {
+						SchemaProps: spec.SchemaProps{
+							Description: "group is the API group of the resource. It is empty for the core group.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"version": {
+						SchemaProps: spec.SchemaProps{
+							Description: "version is the API version of the resource.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resource": {
+						SchemaProps: spec.SchemaProps{
+							Description: "resource is the plural name of the resource.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"informersSynced": {
+						SchemaProps: spec.SchemaProps{
+							Description: "informersSynced is true when the upstream and downstream informers of the resource are synced.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"version", "resource"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_workload_v1alpha1_SyncerStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "SyncerStatus is the state of a syncer, as reported by its heartbeats.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"version": {
+						SchemaProps: spec.SchemaProps{
+							Description: "version is the build version of the syncer.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"featureGates": {
+						SchemaProps: spec.SchemaProps{
+							Description: "featureGates are the feature gates enabled in the syncer, e.g. SyncerTunnel.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"resources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "resources are the resources the syncer is actively syncing.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerResource"),
+									},
+								},
+							},
+						},
+					},
+					"informersSynced": {
+						SchemaProps: spec.SchemaProps{
+							Description: "informersSynced is true when the syncers of all the syncer virtual workspaces are started, and the informers of all the resources are synced.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"refusedCRDUpdates": {
+						SchemaProps: spec.SchemaProps{
+							Description: "refusedCRDUpdates are the resources whose CRD, installed by the syncer on the SyncTarget cluster, is not updated because the schema of their APIResourceSchema is not compatible with it.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.RefusedCRDUpdate"),
+									},
+								},
+							},
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1.Condition", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ResourceToSync", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.VirtualWorkspace", "k8s.io/apimachinery/pkg/api/resource.Quantity", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+			"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.RefusedCRDUpdate", "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.SyncerResource"},
 	}
 }
 
@@ -3880,6 +4174,51 @@ func schema_pkg_apis_workload_v1alpha1_VirtualWorkspace(ref common.ReferenceCall
 	}
 }
 
+func schema_pkg_apis_workload_v1alpha1_WorkloadMappings(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "WorkloadMappings defines the rewrites applied by the syncer to the workloads synced to the SyncTarget cluster.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"images": {
+						SchemaProps: spec.SchemaProps{
+							Description: "images are the rewrites of the container images of the synced pods and pod templates. The prefix of the longest matching rewrite is replaced.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ImageMapping"),
+									},
+								},
+							},
+						},
+					},
+					"storageClasses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "storageClasses maps the StorageClass names of the synced PersistentVolumeClaims, and of the volumeClaimTemplates of the synced StatefulSets, to StorageClass names of the SyncTarget cluster. The empty name maps the claims without StorageClass name.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1.ImageMapping"},
+	}
+}
+
 func schema_pkg_apis_meta_v1_APIGroup(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
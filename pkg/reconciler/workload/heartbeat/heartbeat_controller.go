@@ -19,6 +19,8 @@ package heartbeat
 import (
 	"time"
 
+	"k8s.io/component-base/version"
+
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
 	apiresourceinformer "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/apiresource/v1alpha1"
 	workloadinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions/workload/v1alpha1"
@@ -33,6 +35,7 @@ func NewController(
 ) (*basecontroller.ClusterReconciler, error) {
 	cm := &clusterManager{
 		heartbeatThreshold: heartbeatThreshold,
+		kcpVersion:         version.Get().GitVersion,
 	}
 
 	r, queue, err := basecontroller.NewClusterReconciler(
@@ -18,8 +18,12 @@ package heartbeat
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/klog/v2"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
@@ -32,6 +36,7 @@ var _ basecontroller.ClusterReconcileImpl = (*clusterManager)(nil)
 
 type clusterManager struct {
 	heartbeatThreshold  time.Duration
+	kcpVersion          string
 	enqueueClusterAfter func(*workloadv1alpha1.SyncTarget, time.Duration)
 }
 
@@ -73,8 +78,77 @@ func (c *clusterManager) Reconcile(ctx context.Context, cluster *workloadv1alpha
 		c.enqueueClusterAfter(cluster, dur)
 	}
 
+	c.reconcileSyncerStatus(ctx, cluster)
+
 	return nil
 }
 
+// reconcileSyncerStatus sets the conditions derived from the syncer status reported by the heartbeats.
+// They are removed when the syncer does not report its status, e.g. an older syncer.
+func (c *clusterManager) reconcileSyncerStatus(ctx context.Context, cluster *workloadv1alpha1.SyncTarget) {
+	logger := klog.FromContext(ctx)
+
+	syncer := cluster.Status.Syncer
+	if syncer == nil {
+		conditions.Delete(cluster, workloadv1alpha1.SyncerVersionCompatible)
+		conditions.Delete(cluster, workloadv1alpha1.SyncerStarted)
+		return
+	}
+
+	syncerVersion, syncerErr := releaseVersion(syncer.Version)
+	kcpVersion, kcpErr := releaseVersion(c.kcpVersion)
+	switch {
+	case syncerErr != nil:
+		conditions.MarkUnknown(cluster,
+			workloadv1alpha1.SyncerVersionCompatible,
+			workloadv1alpha1.UnknownSyncerVersionReason,
+			"Syncer version %q cannot be parsed: %v", syncer.Version, syncerErr)
+	case kcpErr != nil:
+		conditions.MarkUnknown(cluster,
+			workloadv1alpha1.SyncerVersionCompatible,
+			workloadv1alpha1.UnknownSyncerVersionReason,
+			"kcp version %q cannot be parsed: %v", c.kcpVersion, kcpErr)
+	case syncerVersion.Major() != kcpVersion.Major() || syncerVersion.Minor() != kcpVersion.Minor():
+		logger.V(5).Info("marking SyncerVersionCompatible false for SyncTarget due to a version skew", "syncerVersion", syncer.Version, "kcpVersion", c.kcpVersion)
+		conditions.MarkFalse(cluster,
+			workloadv1alpha1.SyncerVersionCompatible,
+			workloadv1alpha1.SyncerVersionSkewReason,
+			conditionsv1alpha1.ConditionSeverityWarning,
+			"Syncer version %s differs from kcp version %s", syncer.Version, c.kcpVersion)
+	default:
+		conditions.MarkTrue(cluster, workloadv1alpha1.SyncerVersionCompatible)
+	}
+
+	if syncer.InformersSynced {
+		conditions.MarkTrue(cluster, workloadv1alpha1.SyncerStarted)
+		return
+	}
+	var notSynced []string
+	for _, resource := range syncer.Resources {
+		if !resource.InformersSynced {
+			notSynced = append(notSynced, schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}.String())
+		}
+	}
+	message := "Syncer is starting"
+	if len(notSynced) > 0 {
+		message = fmt.Sprintf("Informers of %s are not synced yet", strings.Join(notSynced, ", "))
+	}
+	logger.V(5).Info("marking SyncerStarted false for SyncTarget", "notSynced", notSynced)
+	conditions.MarkFalse(cluster,
+		workloadv1alpha1.SyncerStarted,
+		workloadv1alpha1.SyncerPartiallyStartedReason,
+		conditionsv1alpha1.ConditionSeverityInfo,
+		message)
+}
+
+// releaseVersion parses the kcp release of a build version. kcp build versions look like
+// v1.24.3+kcp-v0.9.0, i.e. the Kubernetes version the build is based on, followed by the kcp release.
+func releaseVersion(gitVersion string) (*version.Version, error) {
+	if i := strings.Index(gitVersion, "+kcp-"); i >= 0 {
+		gitVersion = gitVersion[i+len("+kcp-"):]
+	}
+	return version.ParseGeneric(gitVersion)
+}
+
 func (c *clusterManager) Cleanup(ctx context.Context, deletedCluster *workloadv1alpha1.SyncTarget) {
 }
@@ -21,10 +21,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/util/conditions"
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 )
 
@@ -84,3 +87,98 @@ func TestManager(t *testing.T) {
 		})
 	}
 }
+
+func TestManagerSyncerStatus(t *testing.T) {
+	for _, c := range []struct {
+		desc              string
+		syncer            *workloadv1alpha1.SyncerStatus
+		wantVersion       *conditionsv1alpha1.Condition
+		wantStarted       *conditionsv1alpha1.Condition
+		wantStartedReason string
+	}{{
+		desc: "no syncer status",
+	}, {
+		desc: "same version, informers synced",
+		syncer: &workloadv1alpha1.SyncerStatus{
+			Version:         "v1.24.3+kcp-v0.9.1",
+			InformersSynced: true,
+		},
+		wantVersion: &conditionsv1alpha1.Condition{Type: workloadv1alpha1.SyncerVersionCompatible, Status: corev1.ConditionTrue},
+		wantStarted: &conditionsv1alpha1.Condition{Type: workloadv1alpha1.SyncerStarted, Status: corev1.ConditionTrue},
+	}, {
+		desc: "version skew, partially started",
+		syncer: &workloadv1alpha1.SyncerStatus{
+			Version: "v1.24.3+kcp-v0.8.0",
+			Resources: []workloadv1alpha1.SyncerResource{
+				{Version: "v1", Resource: "configmaps", InformersSynced: true},
+				{Group: "apps", Version: "v1", Resource: "deployments"},
+			},
+		},
+		wantVersion: &conditionsv1alpha1.Condition{
+			Type:     workloadv1alpha1.SyncerVersionCompatible,
+			Status:   corev1.ConditionFalse,
+			Severity: conditionsv1alpha1.ConditionSeverityWarning,
+			Reason:   workloadv1alpha1.SyncerVersionSkewReason,
+			Message:  "Syncer version v1.24.3+kcp-v0.8.0 differs from kcp version v1.24.3+kcp-v0.9.0",
+		},
+		wantStarted: &conditionsv1alpha1.Condition{
+			Type:     workloadv1alpha1.SyncerStarted,
+			Status:   corev1.ConditionFalse,
+			Severity: conditionsv1alpha1.ConditionSeverityInfo,
+			Reason:   workloadv1alpha1.SyncerPartiallyStartedReason,
+			Message:  "Informers of apps/v1, Resource=deployments are not synced yet",
+		},
+	}, {
+		desc: "unknown version",
+		syncer: &workloadv1alpha1.SyncerStatus{
+			Version:         "unknown",
+			InformersSynced: true,
+		},
+		wantVersion: &conditionsv1alpha1.Condition{
+			Type:    workloadv1alpha1.SyncerVersionCompatible,
+			Status:  corev1.ConditionUnknown,
+			Reason:  workloadv1alpha1.UnknownSyncerVersionReason,
+			Message: `Syncer version "unknown" cannot be parsed: could not parse "unknown" as version`,
+		},
+		wantStarted: &conditionsv1alpha1.Condition{Type: workloadv1alpha1.SyncerStarted, Status: corev1.ConditionTrue},
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			mgr := clusterManager{
+				heartbeatThreshold:  time.Minute,
+				kcpVersion:          "v1.24.3+kcp-v0.9.0",
+				enqueueClusterAfter: func(*workloadv1alpha1.SyncTarget, time.Duration) {},
+			}
+			heartbeat := metav1.NewTime(time.Now())
+			cl := &workloadv1alpha1.SyncTarget{
+				Status: workloadv1alpha1.SyncTargetStatus{
+					Conditions: []conditionsv1alpha1.Condition{
+						{Type: workloadv1alpha1.SyncerVersionCompatible, Status: corev1.ConditionTrue},
+						{Type: workloadv1alpha1.SyncerStarted, Status: corev1.ConditionTrue},
+					},
+					LastSyncerHeartbeatTime: &heartbeat,
+					Syncer:                  c.syncer,
+				},
+			}
+			if err := mgr.Reconcile(context.Background(), cl); err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+
+			for _, want := range []struct {
+				conditionType conditionsv1alpha1.ConditionType
+				condition     *conditionsv1alpha1.Condition
+			}{
+				{workloadv1alpha1.SyncerVersionCompatible, c.wantVersion},
+				{workloadv1alpha1.SyncerStarted, c.wantStarted},
+			} {
+				got := conditions.Get(cl, want.conditionType)
+				if got != nil {
+					got = got.DeepCopy()
+					got.LastTransitionTime = metav1.Time{}
+				}
+				if diff := cmp.Diff(want.condition, got); diff != "" {
+					t.Errorf("unexpected %s condition (-want +got):\n%s", want.conditionType, diff)
+				}
+			}
+		})
+	}
+}
@@ -166,6 +166,11 @@ func propagateDeletionTimestamp(logger logr.Logger, obj metav1.Object) map[strin
 
 // computePlacement computes the patch against annotations and labels. Nil means to remove the key.
 func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch map[string]interface{}, labelPatch map[string]interface{}) {
+	if isUpsynced(obj.GetLabels()) {
+		// upsynced objects are owned by the syncer, not placed.
+		return
+	}
+
 	nsLocations, nsDeleting := locations(ns.Annotations, ns.Labels, true)
 	objLocations, objDeleting := locations(obj.GetAnnotations(), obj.GetLabels(), false)
 	if objLocations.Equal(nsLocations) && objDeleting.Equal(nsDeleting) {
@@ -223,6 +228,16 @@ func computePlacement(ns *corev1.Namespace, obj metav1.Object) (annotationPatch
 	return
 }
 
+// isUpsynced returns whether the object is upsynced from a sync target.
+func isUpsynced(labels map[string]string) bool {
+	for k, v := range labels {
+		if strings.HasPrefix(k, workloadv1alpha1.ClusterResourceStateLabelPrefix) && v == string(workloadv1alpha1.ResourceStateUpsync) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Controller) reconcileGVR(gvr schema.GroupVersionResource) error {
 	inf, err := c.ddsif.ForResource(gvr)
 	if err != nil {
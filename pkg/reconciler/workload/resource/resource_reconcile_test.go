@@ -80,6 +80,15 @@ func TestComputePlacement(t *testing.T) {
 				"state.workload.kcp.dev/cluster-1": "Sync",
 			},
 		},
+		{name: "syncing namespace, upsynced object, expect no patches",
+			ns: namespace(nil, map[string]string{
+				"state.workload.kcp.dev/cluster-1": "Sync",
+				"state.workload.kcp.dev/cluster-2": "Sync",
+			}),
+			obj: object(nil, map[string]string{
+				"state.workload.kcp.dev/cluster-1": "Upsync",
+			}, nil, nil),
+		},
 		{name: "new location on namespace",
 			ns: namespace(nil, map[string]string{
 				"state.workload.kcp.dev/cluster-1": "Sync",
@@ -103,7 +103,20 @@ func (e *apiCompatibleReconciler) reconcile(ctx context.Context, syncTarget *wor
 		}] = jsonSchema
 	}
 
+	// The resources whose CRD the syncer refuses to update on the SyncTarget cluster are incompatible, since
+	// their downstream CRD does not match their APIResourceSchema anymore.
+	refusedCRDUpdates := map[apisv1alpha1.GroupResource]bool{}
+	if syncTarget.Status.Syncer != nil {
+		for _, refused := range syncTarget.Status.Syncer.RefusedCRDUpdates {
+			refusedCRDUpdates[apisv1alpha1.GroupResource{Group: refused.Group, Resource: refused.Resource}] = true
+		}
+	}
+
 	for i, syncedRsesource := range syncTarget.Status.SyncedResources {
+		if refusedCRDUpdates[syncedRsesource.GroupResource] {
+			syncTarget.Status.SyncedResources[i].State = workloadv1alpha1.ResourceSchemaIncompatibleState
+			continue
+		}
 		for _, v := range syncedRsesource.Versions {
 			gvr := schema.GroupVersionResource{Group: syncedRsesource.Group, Resource: syncedRsesource.Resource, Version: v}
 			upstreamSchema, ok := schemaMap[gvr]
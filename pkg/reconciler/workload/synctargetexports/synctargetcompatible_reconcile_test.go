@@ -138,6 +138,39 @@ func TestSyncTargetCompatibleReconcile(t *testing.T) {
 				{GroupResource: apisv1alpha1.GroupResource{Group: "apps", Resource: "deployments"}, Versions: []string{"v1"}, State: workloadv1alpha1.ResourceSchemaIncompatibleState},
 			},
 		},
+		{
+			name: "incompatible when the syncer refuses to update the CRD",
+			syncTarget: func() *workloadv1alpha1.SyncTarget {
+				syncTarget := newSyncTarget([]apisv1alpha1.ExportReference{
+					{
+						Workspace: &apisv1alpha1.WorkspaceExportReference{ExportName: "kubernetes"},
+					}},
+					[]workloadv1alpha1.ResourceToSync{
+						{GroupResource: apisv1alpha1.GroupResource{Group: "apps", Resource: "deployments"}, Versions: []string{"v1"}, State: workloadv1alpha1.ResourceSchemaAcceptedState},
+					},
+				)
+				syncTarget.Status.Syncer = &workloadv1alpha1.SyncerStatus{
+					RefusedCRDUpdates: []workloadv1alpha1.RefusedCRDUpdate{{Group: "apps", Resource: "deployments", Message: "the stored versions v1beta1 are removed"}},
+				}
+				return syncTarget
+			}(),
+			export: newAPIExport("kubernetes", []string{"apps.v1.deployment"}, ""),
+			schemas: []*apisv1alpha1.APIResourceSchema{
+				newResourceSchema("apps.v1.deployment", "apps", "deployments", []apisv1alpha1.APIResourceVersion{
+					{
+						Name:   "v1",
+						Served: true,
+						Schema: runtime.RawExtension{Raw: []byte(`{"type":"string"}`)},
+					},
+				}),
+			},
+			apiResourceImport: []*apiresourcev1alpha1.APIResourceImport{
+				newAPIResourceImport("apps.v1.deployment", "apps", "deployments", "v1", `{"type":"string"}`),
+			},
+			wantSyncedResources: []workloadv1alpha1.ResourceToSync{
+				{GroupResource: apisv1alpha1.GroupResource{Group: "apps", Resource: "deployments"}, Versions: []string{"v1"}, State: workloadv1alpha1.ResourceSchemaIncompatibleState},
+			},
+		},
 		{
 			name: "only take care latest version",
 			syncTarget: newSyncTarget([]apisv1alpha1.ExportReference{
@@ -0,0 +1,198 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/third_party/keyfunctions"
+)
+
+const (
+	controllerName = "kcp-workload-syncer-adoption"
+)
+
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
+// Controller adopts pre-existing downstream namespaces labelled with workload.kcp.dev/adopt=<sync-target-key>
+// into the workspace of their workload.kcp.dev/adopt-workspace annotation, as long as the workspace is placed on the
+// SyncTarget. The downstream namespace gets the namespace locator of the upstream namespace, and once the upstream
+// namespace is synced to the SyncTarget, the objects of the synced resource types the downstream namespace contains
+// are created in it in the Sync state, through the syncer virtual workspace serving it. From then on, the adopted
+// objects are synced by the spec and status syncers, in place: nothing is deleted and recreated downstream.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	downstreamClient dynamic.Interface
+
+	getDownstreamNamespace   func(name string) (*unstructured.Unstructured, error)
+	listDownstreamNamespaces func() ([]*unstructured.Unstructured, error)
+	syncedResources          func() ([]schema.GroupVersionResource, bool)
+	workspacePlaced          func(clusterName logicalcluster.Name) (bool, error)
+	upstreamNamespaceClient  func(clusterName logicalcluster.Name, name string) (dynamic.Interface, error)
+
+	syncTargetName      string
+	syncTargetWorkspace logicalcluster.Name
+	syncTargetUID       types.UID
+	syncTargetKey       string
+}
+
+// NewController returns an adoption controller. adoptedNamespaceInformers must only watch the downstream
+// namespaces to adopt, while syncedNamespaceInformers watch the downstream namespaces synced to the SyncTarget.
+// syncedResources returns the synced resource types, and whether their informers are synced. workspacePlaced checks
+// whether any namespace of the workspace is synced to the SyncTarget, and upstreamNamespaceClient returns the client of the syncer virtual workspace serving the upstream namespace, or a NotFound error if the
+// namespace is not synced to the SyncTarget.
+func NewController(syncTargetWorkspace logicalcluster.Name, syncTargetName, syncTargetKey string, syncTargetUID types.UID,
+	downstreamClient dynamic.Interface,
+	adoptedNamespaceInformers, syncedNamespaceInformers dynamicinformer.DynamicSharedInformerFactory,
+	syncedResources func() ([]schema.GroupVersionResource, bool),
+	workspacePlaced func(clusterName logicalcluster.Name) (bool, error),
+	upstreamNamespaceClient func(clusterName logicalcluster.Name, name string) (dynamic.Interface, error)) (*Controller, error) {
+	c := &Controller{
+		queue: syncermetrics.NewQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName), func(interface{}) schema.GroupVersionResource {
+			return namespaceGVR
+		}),
+
+		downstreamClient: downstreamClient,
+
+		getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+			obj, err := adoptedNamespaceInformers.ForResource(namespaceGVR).Lister().Get(name)
+			if err != nil {
+				return nil, err
+			}
+			unstr, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return nil, fmt.Errorf("namespace %q expected to be *unstructured.Unstructured, got %T", name, obj)
+			}
+			return unstr, nil
+		},
+		listDownstreamNamespaces: func() ([]*unstructured.Unstructured, error) {
+			var namespaces []*unstructured.Unstructured
+			for _, obj := range syncedNamespaceInformers.ForResource(namespaceGVR).Informer().GetStore().List() {
+				unstr, ok := obj.(*unstructured.Unstructured)
+				if !ok {
+					return nil, fmt.Errorf("namespace expected to be *unstructured.Unstructured, got %T", obj)
+				}
+				namespaces = append(namespaces, unstr)
+			}
+			return namespaces, nil
+		},
+		syncedResources:         syncedResources,
+		workspacePlaced:         workspacePlaced,
+		upstreamNamespaceClient: upstreamNamespaceClient,
+
+		syncTargetName:      syncTargetName,
+		syncTargetWorkspace: syncTargetWorkspace,
+		syncTargetUID:       syncTargetUID,
+		syncTargetKey:       syncTargetKey,
+	}
+
+	logger := logging.WithReconciler(klog.Background(), controllerName)
+
+	adoptedNamespaceInformers.ForResource(namespaceGVR).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueue(obj, logger)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(newObj, logger)
+		},
+	})
+
+	return c, nil
+}
+
+func (c *Controller) enqueue(obj interface{}, logger logr.Logger) {
+	key, err := keyfunctions.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	logger.V(4).Info("queueing namespace to adopt", "key", key)
+	c.queue.Add(key)
+}
+
+// Start starts N worker processes processing work items.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := logging.WithReconciler(klog.FromContext(ctx), controllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// startWorker processes work items until stopCh is closed.
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	namespaceKey := key.(string)
+
+	logger := logging.WithQueueKey(klog.FromContext(ctx), namespaceKey)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(4).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	err := c.process(ctx, namespaceKey)
+	syncermetrics.ObserveProcessing(controllerName, namespaceGVR, key, start, err)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+
+	return true
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+var (
+	configMapsGVR      = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretsGVR         = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	serviceAccountsGVR = schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+)
+
+func (c *Controller) process(ctx context.Context, key string) error {
+	logger := klog.FromContext(ctx)
+	_, namespaceName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Error(err, "invalid key")
+		return nil
+	}
+
+	downstreamNamespace, err := c.getDownstreamNamespace(namespaceName)
+	if apierrors.IsNotFound(err) {
+		logger.V(4).Info("downstream namespace not found, ignoring key")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logger = logging.WithObject(logger, downstreamNamespace)
+
+	if downstreamNamespace.GetLabels()[workloadv1alpha1.AdoptionLabel] != c.syncTargetKey || downstreamNamespace.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	annotations := downstreamNamespace.GetAnnotations()
+	workspace := annotations[workloadv1alpha1.AdoptionWorkspaceAnnotation]
+	if workspace == "" {
+		logger.Error(nil, "downstream namespace to adopt has no workspace annotation", "annotation", workloadv1alpha1.AdoptionWorkspaceAnnotation)
+		return nil
+	}
+	clusterName := logicalcluster.New(workspace)
+	upstreamNamespace := annotations[workloadv1alpha1.AdoptionNamespaceAnnotation]
+	if upstreamNamespace == "" {
+		upstreamNamespace = downstreamNamespace.GetName()
+	}
+	selector := labels.Everything()
+	if s := annotations[workloadv1alpha1.AdoptionSelectorAnnotation]; s != "" {
+		if selector, err = labels.Parse(s); err != nil {
+			logger.Error(err, "invalid selector of the objects to adopt", "annotation", workloadv1alpha1.AdoptionSelectorAnnotation)
+			return nil
+		}
+	}
+	logger = logger.WithValues("upstreamWorkspace", clusterName, "upstreamNamespace", upstreamNamespace)
+
+	gvrs, synced := c.syncedResources()
+	if !synced {
+		return fmt.Errorf("the informers of the synced resource types are not synced yet")
+	}
+
+	// The syncer only writes to the workspaces placed on the SyncTarget.
+	placed, err := c.workspacePlaced(clusterName)
+	if err != nil {
+		return err
+	}
+	if !placed {
+		return fmt.Errorf("workspace %s is not placed on the SyncTarget", clusterName)
+	}
+
+	// The downstream namespace is bound to the upstream namespace first, so that the spec syncer applies
+	// the adopted objects to it, instead of creating a new downstream namespace for the upstream namespace.
+	locator := shared.NewNamespaceLocator(clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, upstreamNamespace)
+	if ok, err := c.ensureDownstreamNamespaceLocator(ctx, downstreamNamespace, locator); err != nil || !ok {
+		return err
+	}
+
+	// The adopted objects are created through the syncer virtual workspace serving the upstream namespace, once
+	// the placements of the workspace sync it to the SyncTarget. The downstream namespace is deleted when its
+	// upstream namespace does not exist, as long as it is not being adopted.
+	upstreamClient, err := c.upstreamNamespaceClient(clusterName, upstreamNamespace)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("upstream namespace %s|%s is not synced to the SyncTarget yet", clusterName, upstreamNamespace)
+	} else if err != nil {
+		return err
+	}
+
+	adopted := 0
+	for _, gvr := range gvrs {
+		if gvr == namespaceGVR {
+			continue
+		}
+		list, err := c.downstreamClient.Resource(gvr).Namespace(downstreamNamespace.GetName()).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if apierrors.IsNotFound(err) {
+			// The resource type is cluster-scoped.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			downstreamObj := &list.Items[i]
+			if !adoptable(gvr, downstreamObj) {
+				continue
+			}
+			if err := c.adoptObject(ctx, upstreamClient, gvr, clusterName, upstreamNamespace, downstreamObj); err != nil {
+				return err
+			}
+			adopted++
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				workloadv1alpha1.AdoptionLabel: nil,
+			},
+			"annotations": map[string]interface{}{
+				workloadv1alpha1.AdoptionWorkspaceAnnotation: nil,
+				workloadv1alpha1.AdoptionNamespaceAnnotation: nil,
+				workloadv1alpha1.AdoptionSelectorAnnotation:  nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.downstreamClient.Resource(namespaceGVR).Patch(ctx, downstreamNamespace.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		syncermetrics.RecordWriteError(controllerName, namespaceGVR, "patch")
+		return err
+	}
+	logger.Info("Adopted downstream namespace", "objects", adopted)
+	return nil
+}
+
+// ensureDownstreamNamespaceLocator sets the namespace locator of the upstream namespace on the downstream
+// namespace. It returns false if the downstream namespace cannot be adopted into the upstream namespace.
+func (c *Controller) ensureDownstreamNamespaceLocator(ctx context.Context, downstreamNamespace *unstructured.Unstructured, locator shared.NamespaceLocator) (bool, error) {
+	logger := klog.FromContext(ctx)
+
+	existing, found, err := shared.LocatorFromAnnotations(downstreamNamespace.GetAnnotations())
+	if err != nil {
+		logger.Error(err, "failed to decode the namespace locator of the downstream namespace")
+		return false, nil
+	}
+	if found && !reflect.DeepEqual(*existing, locator) {
+		logger.Error(nil, "downstream namespace is already synced from another upstream namespace", "namespaceLocator", existing)
+		return false, nil
+	}
+
+	namespaces, err := c.listDownstreamNamespaces()
+	if err != nil {
+		return false, err
+	}
+	for _, namespace := range namespaces {
+		if namespace.GetName() == downstreamNamespace.GetName() {
+			continue
+		}
+		if other, found, err := shared.LocatorFromAnnotations(namespace.GetAnnotations()); err == nil && found && reflect.DeepEqual(*other, locator) {
+			logger.Error(nil, "upstream namespace is already synced to another downstream namespace", "downstreamNamespace", namespace.GetName())
+			return false, nil
+		}
+	}
+
+	if found && downstreamNamespace.GetLabels()[workloadv1alpha1.InternalDownstreamClusterLabel] == c.syncTargetKey {
+		return true, nil
+	}
+
+	locatorJSON, err := json.Marshal(locator)
+	if err != nil {
+		return false, err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				workloadv1alpha1.InternalDownstreamClusterLabel: c.syncTargetKey,
+			},
+			"annotations": map[string]interface{}{
+				shared.NamespaceLocatorAnnotation: string(locatorJSON),
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if _, err := c.downstreamClient.Resource(namespaceGVR).Patch(ctx, downstreamNamespace.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		syncermetrics.RecordWriteError(controllerName, namespaceGVR, "patch")
+		return false, err
+	}
+	logger.V(2).Info("Set the namespace locator of the downstream namespace")
+	return true, nil
+}
+
+// adoptObject creates the upstream object of the downstream object, and labels the downstream object
+// as synced to the SyncTarget. Upstream objects that already exist are only adopted if they are synced
+// to the SyncTarget, e.g. when a previous adoption attempt failed midway.
+func (c *Controller) adoptObject(ctx context.Context, upstreamClient dynamic.Interface, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, upstreamNamespace string, downstreamObj *unstructured.Unstructured) error {
+	logger := klog.FromContext(ctx).WithValues("gvr", gvr.String(), "name", downstreamObj.GetName())
+	upstreamResourceClient := upstreamClient.Resource(gvr).Namespace(upstreamNamespace)
+
+	if _, err := upstreamResourceClient.Create(ctx, adoptedObject(downstreamObj, upstreamNamespace, c.syncTargetKey), metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+		// The syncer virtual workspace does not serve the upstream objects that are not synced to the SyncTarget.
+		existing, err := upstreamResourceClient.Get(ctx, downstreamObj.GetName(), metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err != nil || existing.GetLabels()[workloadv1alpha1.ClusterResourceStateLabelPrefix+c.syncTargetKey] != string(workloadv1alpha1.ResourceStateSync) {
+			return fmt.Errorf("%s %s|%s/%s already exists and is not synced to the SyncTarget", gvr.Resource, clusterName, upstreamNamespace, downstreamObj.GetName())
+		}
+	} else if err != nil {
+		syncermetrics.RecordWriteError(controllerName, gvr, "create")
+		return err
+	} else {
+		logger.V(2).Info("Created upstream object of the adopted downstream object")
+	}
+
+	if downstreamObj.GetLabels()[workloadv1alpha1.InternalDownstreamClusterLabel] == c.syncTargetKey {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				workloadv1alpha1.InternalDownstreamClusterLabel: c.syncTargetKey,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.downstreamClient.Resource(gvr).Namespace(downstreamObj.GetNamespace()).Patch(ctx, downstreamObj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		syncermetrics.RecordWriteError(controllerName, gvr, "patch")
+		return err
+	}
+	return nil
+}
+
+// adoptable returns whether the downstream object is adopted with its namespace. The objects managed
+// by other objects, and the ones Kubernetes creates in every namespace, are not.
+func adoptable(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) bool {
+	if len(obj.GetOwnerReferences()) > 0 {
+		return false
+	}
+	switch gvr {
+	case configMapsGVR:
+		return obj.GetName() != "kube-root-ca.crt"
+	case serviceAccountsGVR:
+		return obj.GetName() != "default"
+	case secretsGVR:
+		secretType, _, _ := unstructured.NestedString(obj.Object, "type")
+		return secretType != string(corev1.SecretTypeServiceAccountToken)
+	}
+	return true
+}
+
+// adoptedObject returns the upstream object of the adopted downstream object, in the Sync state and without
+// its status. The downstream metadata, the annotations set by Kubernetes on the SyncTarget cluster, e.g. the
+// deployment revision, and the workload labels of other SyncTargets, are dropped.
+func adoptedObject(downstreamObj *unstructured.Unstructured, upstreamNamespace, syncTargetKey string) *unstructured.Unstructured {
+	upstreamObj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range downstreamObj.Object {
+		if k == "metadata" || k == "status" {
+			continue
+		}
+		upstreamObj.Object[k] = runtime.DeepCopyJSONValue(v)
+	}
+
+	upstreamObj.SetName(downstreamObj.GetName())
+	upstreamObj.SetNamespace(upstreamNamespace)
+
+	labels := shared.WithoutForeignWorkloadLabels(downstreamObj.GetLabels(), syncTargetKey)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[workloadv1alpha1.ClusterResourceStateLabelPrefix+syncTargetKey] = string(workloadv1alpha1.ResourceStateSync)
+	upstreamObj.SetLabels(labels)
+
+	annotations := map[string]string{}
+	for k, v := range downstreamObj.GetAnnotations() {
+		if prefix, _, found := strings.Cut(k, "/"); found && (prefix == "kubernetes.io" || strings.HasSuffix(prefix, ".kubernetes.io")) {
+			continue
+		}
+		annotations[k] = v
+	}
+	if len(annotations) > 0 {
+		upstreamObj.SetAnnotations(annotations)
+	}
+
+	return upstreamObj
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+func TestAdoptionProcess(t *testing.T) {
+	syncTargetWorkspace := logicalcluster.New("root:org:ws")
+	syncTargetName := "us-west1"
+	syncTargetUID := types.UID("syncTargetUID")
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(syncTargetWorkspace, syncTargetName)
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	locator := `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:app","namespace":"my-app"}`
+	otherLocator := `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:other","namespace":"my-app"}`
+
+	namespace := func(name string, labels, annotations map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Namespace")
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	configMap := func(namespace, name string, labels, annotations map[string]string, ownerReferences ...metav1.OwnerReference) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       map[string]interface{}{"foo": "bar"},
+		}}
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		obj.SetAnnotations(annotations)
+		obj.SetOwnerReferences(ownerReferences)
+		return obj
+	}
+	adoptionAnnotations := map[string]string{
+		workloadv1alpha1.AdoptionWorkspaceAnnotation: "root:org:app",
+	}
+
+	tests := map[string]struct {
+		downstreamNamespace     *unstructured.Unstructured
+		syncedNamespaces        []*unstructured.Unstructured
+		downstreamObjects       []runtime.Object
+		upstreamObjects         []runtime.Object
+		upstreamNamespaceSynced bool
+		workspaceNotPlaced      bool
+
+		wantError             bool
+		wantUpstreamActions   []clienttesting.Action
+		wantDownstreamActions []clienttesting.Action
+	}{
+		"namespace and its objects are adopted": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", map[string]string{"app": "my-app"}, map[string]string{"a": "b", "kubectl.kubernetes.io/last-applied-configuration": "{}"}),
+				configMap("my-app", "kube-root-ca.crt", nil, nil),
+				configMap("my-app", "owned", nil, nil, metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "pod", UID: "uid"}),
+			},
+			upstreamNamespaceSynced: true,
+			wantUpstreamActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "my-app", configMap("my-app", "cm", map[string]string{"app": "my-app", stateLabel: "Sync"}, map[string]string{"a": "b"})),
+			},
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"kcp.dev/namespace-locator":`+quote(locator)+`},"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewPatchAction(configMapsGVR, "my-app", "cm", types.MergePatchType,
+					[]byte(`{"metadata":{"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"workload.kcp.dev/adopt-namespace":null,"workload.kcp.dev/adopt-selector":null,"workload.kcp.dev/adopt-workspace":null},"labels":{"workload.kcp.dev/adopt":null}}}`)),
+			},
+		},
+		"only the selected objects are adopted, into the upstream namespace of the annotation": {
+			downstreamNamespace: namespace("legacy", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, map[string]string{
+				workloadv1alpha1.AdoptionWorkspaceAnnotation: "root:org:app",
+				workloadv1alpha1.AdoptionNamespaceAnnotation: "my-app",
+				workloadv1alpha1.AdoptionSelectorAnnotation:  "app=my-app",
+			}),
+			downstreamObjects: []runtime.Object{
+				configMap("legacy", "cm", map[string]string{"app": "my-app"}, nil),
+				configMap("legacy", "other", map[string]string{"app": "other"}, nil),
+			},
+			upstreamNamespaceSynced: true,
+			wantUpstreamActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "my-app", configMap("my-app", "cm", map[string]string{"app": "my-app", stateLabel: "Sync"}, nil)),
+			},
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "legacy", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"kcp.dev/namespace-locator":`+quote(locator)+`},"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewPatchAction(configMapsGVR, "legacy", "cm", types.MergePatchType,
+					[]byte(`{"metadata":{"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewRootPatchAction(namespaceGVR, "legacy", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"workload.kcp.dev/adopt-namespace":null,"workload.kcp.dev/adopt-selector":null,"workload.kcp.dev/adopt-workspace":null},"labels":{"workload.kcp.dev/adopt":null}}}`)),
+			},
+		},
+		"workload labels of other SyncTargets are not adopted": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", map[string]string{
+					"app": "my-app",
+					workloadv1alpha1.ClusterResourceStateLabelPrefix + "other":                  "Sync",
+					workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix + "other": "true",
+					workloadv1alpha1.InternalDownstreamWorkspaceLabel:                           "hash",
+				}, nil),
+			},
+			upstreamNamespaceSynced: true,
+			wantUpstreamActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "my-app", configMap("my-app", "cm", map[string]string{"app": "my-app", stateLabel: "Sync"}, nil)),
+			},
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"kcp.dev/namespace-locator":`+quote(locator)+`},"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewPatchAction(configMapsGVR, "my-app", "cm", types.MergePatchType,
+					[]byte(`{"metadata":{"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"workload.kcp.dev/adopt-namespace":null,"workload.kcp.dev/adopt-selector":null,"workload.kcp.dev/adopt-workspace":null},"labels":{"workload.kcp.dev/adopt":null}}}`)),
+			},
+		},
+		"namespace is bound, but its objects are not adopted until the upstream namespace is synced": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", nil, nil),
+			},
+			wantError: true,
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"kcp.dev/namespace-locator":`+quote(locator)+`},"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+			},
+		},
+		"namespace is not adopted into a workspace not placed on the SyncTarget": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", nil, nil),
+			},
+			workspaceNotPlaced: true,
+			wantError:          true,
+		},
+		"objects adopted by a previous attempt are not recreated": {
+			downstreamNamespace: namespace("my-app", map[string]string{
+				workloadv1alpha1.AdoptionLabel:                  syncTargetKey,
+				workloadv1alpha1.InternalDownstreamClusterLabel: syncTargetKey,
+			}, map[string]string{
+				workloadv1alpha1.AdoptionWorkspaceAnnotation: "root:org:app",
+				shared.NamespaceLocatorAnnotation:            locator,
+			}),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", map[string]string{workloadv1alpha1.InternalDownstreamClusterLabel: syncTargetKey}, nil),
+			},
+			upstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", map[string]string{stateLabel: "Sync"}, nil),
+			},
+			upstreamNamespaceSynced: true,
+			wantUpstreamActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "my-app", configMap("my-app", "cm", map[string]string{stateLabel: "Sync"}, nil)),
+				clienttesting.NewGetAction(configMapsGVR, "my-app", "cm"),
+			},
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"workload.kcp.dev/adopt-namespace":null,"workload.kcp.dev/adopt-selector":null,"workload.kcp.dev/adopt-workspace":null},"labels":{"workload.kcp.dev/adopt":null}}}`)),
+			},
+		},
+		"upstream object that is not synced to the SyncTarget is not overwritten": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			downstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", nil, nil),
+			},
+			upstreamObjects: []runtime.Object{
+				configMap("my-app", "cm", nil, nil),
+			},
+			upstreamNamespaceSynced: true,
+			wantError:               true,
+			wantUpstreamActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "my-app", configMap("my-app", "cm", map[string]string{stateLabel: "Sync"}, nil)),
+				clienttesting.NewGetAction(configMapsGVR, "my-app", "cm"),
+			},
+			wantDownstreamActions: []clienttesting.Action{
+				clienttesting.NewRootPatchAction(namespaceGVR, "my-app", types.MergePatchType,
+					[]byte(`{"metadata":{"annotations":{"kcp.dev/namespace-locator":`+quote(locator)+`},"labels":{"internal.workload.kcp.dev/cluster":"`+syncTargetKey+`"}}}`)),
+			},
+		},
+		"namespace synced from another upstream namespace is not adopted": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, map[string]string{
+				workloadv1alpha1.AdoptionWorkspaceAnnotation: "root:org:app",
+				shared.NamespaceLocatorAnnotation:            otherLocator,
+			}),
+			upstreamNamespaceSynced: true,
+		},
+		"namespace is not adopted into an upstream namespace synced to another downstream namespace": {
+			downstreamNamespace: namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, adoptionAnnotations),
+			syncedNamespaces: []*unstructured.Unstructured{
+				namespace("kcp-01c0zzvlqsi7n", map[string]string{workloadv1alpha1.InternalDownstreamClusterLabel: syncTargetKey}, map[string]string{shared.NamespaceLocatorAnnotation: locator}),
+			},
+			upstreamNamespaceSynced: true,
+		},
+		"namespace without workspace is not adopted": {
+			downstreamNamespace:     namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey}, nil),
+			upstreamNamespaceSynced: true,
+		},
+		"namespace adopted by another SyncTarget is ignored": {
+			downstreamNamespace:     namespace("my-app", map[string]string{workloadv1alpha1.AdoptionLabel: "other"}, adoptionAnnotations),
+			upstreamNamespaceSynced: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listKinds := map[schema.GroupVersionResource]string{
+				namespaceGVR:  "NamespaceList",
+				configMapsGVR: "ConfigMapList",
+			}
+			downstreamClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, append(tc.downstreamObjects, tc.downstreamNamespace)...)
+			upstreamClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, tc.upstreamObjects...)
+
+			c := &Controller{
+				downstreamClient: downstreamClient,
+				getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+					return tc.downstreamNamespace, nil
+				},
+				listDownstreamNamespaces: func() ([]*unstructured.Unstructured, error) {
+					return tc.syncedNamespaces, nil
+				},
+				syncedResources: func() ([]schema.GroupVersionResource, bool) {
+					return []schema.GroupVersionResource{namespaceGVR, configMapsGVR}, true
+				},
+				workspacePlaced: func(clusterName logicalcluster.Name) (bool, error) {
+					return !tc.workspaceNotPlaced, nil
+				},
+				upstreamNamespaceClient: func(clusterName logicalcluster.Name, name string) (dynamic.Interface, error) {
+					if !tc.upstreamNamespaceSynced {
+						return nil, apierrors.NewNotFound(namespaceGVR.GroupResource(), name)
+					}
+					return upstreamClient, nil
+				},
+				syncTargetName:      syncTargetName,
+				syncTargetWorkspace: syncTargetWorkspace,
+				syncTargetUID:       syncTargetUID,
+				syncTargetKey:       syncTargetKey,
+			}
+
+			err := c.process(ctx, tc.downstreamNamespace.GetName())
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Empty(t, cmp.Diff(tc.wantUpstreamActions, withoutReads(upstreamClient.Actions())), "upstream actions")
+			require.Empty(t, cmp.Diff(tc.wantDownstreamActions, withoutReads(downstreamClient.Actions())), "downstream actions")
+		})
+	}
+}
+
+func withoutReads(actions []clienttesting.Action) []clienttesting.Action {
+	var filtered []clienttesting.Action
+	for _, action := range actions {
+		if action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			filtered = append(filtered, action)
+		}
+	}
+	return filtered
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -42,6 +42,7 @@ import (
 	"github.com/kcp-dev/kcp/pkg/crdpuller"
 	"github.com/kcp-dev/kcp/pkg/logging"
 	clusterctl "github.com/kcp-dev/kcp/pkg/reconciler/workload/basecontroller"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 )
 
 var clusterKind = reflect.TypeOf(workloadv1alpha1.SyncTarget{}).Name()
@@ -58,7 +59,7 @@ func clusterAsOwnerReference(obj *workloadv1alpha1.SyncTarget, controller bool)
 
 func NewAPIImporter(
 	upstreamConfig, downstreamConfig *rest.Config,
-	resourcesToSync []string,
+	resourcesToSync func() []string,
 	logicalClusterName logicalcluster.Name,
 	location string,
 ) (*APIImporter, error) {
@@ -122,7 +123,7 @@ func NewAPIImporter(
 type APIImporter struct {
 	kcpInformerFactory       kcpinformers.SharedInformerFactory
 	kcpClusterClient         *kcpclient.Cluster
-	resourcesToSync          []string
+	resourcesToSync          func() []string
 	apiresourceImportIndexer cache.Indexer
 	clusterIndexer           cache.Indexer
 
@@ -173,10 +174,12 @@ func (i *APIImporter) Stop(ctx context.Context) {
 
 func (i *APIImporter) ImportAPIs(ctx context.Context) {
 	logger := klog.FromContext(ctx)
-	logger.Info("importing APIs", "resources", i.resourcesToSync)
-	crds, err := i.schemaPuller.PullCRDs(ctx, i.resourcesToSync...)
+	resourcesToSync := i.resourcesToSync()
+	logger.Info("importing APIs", "resources", resourcesToSync)
+	crds, err := i.schemaPuller.PullCRDs(ctx, resourcesToSync...)
 	if err != nil {
 		logger.Error(err, "error pulling CRDs")
+		syncermetrics.RecordAPIImportPoll(0, err)
 		return
 	}
 
@@ -298,6 +301,7 @@ func (i *APIImporter) ImportAPIs(ctx context.Context) {
 		}
 		gvrsToSync[gvr.String()] = gvr
 	}
+	syncermetrics.RecordAPIImportPoll(len(gvrsToSync), nil)
 
 	gvrsToRemove := sets.StringKeySet(i.SyncedGVRs).Difference(sets.StringKeySet(gvrsToSync))
 	for _, gvrToRemove := range gvrsToRemove.UnsortedList() {
@@ -0,0 +1,411 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	reconcilerapiexport "github.com/kcp-dev/kcp/pkg/reconciler/workload/apiexport"
+	"github.com/kcp-dev/kcp/pkg/schemacompat"
+)
+
+const (
+	installerName = "kcp-workload-syncer-crds"
+
+	// InstalledByLabel is set on the CRDs installed by the syncer on the SyncTarget cluster, to the key of
+	// the SyncTarget. Only these CRDs are updated by the syncer.
+	InstalledByLabel = "workload.kcp.dev/installed-by"
+)
+
+// Installer creates and updates the CRDs of the resources to sync on the SyncTarget cluster, from the
+// APIResourceSchemas of the APIExports supported by the SyncTarget in its workspace. The resources already served by the
+// SyncTarget cluster without a CRD, e.g. the built-in ones, and the CRDs not installed by the syncer of the
+// SyncTarget are left alone. An update is refused when some objects valid against the installed CRD would
+// not be valid against the updated one.
+type Installer struct {
+	// lock prevents concurrent installs.
+	lock sync.Mutex
+
+	getSyncTarget        func() (*workloadv1alpha1.SyncTarget, error)
+	resourcesToSync      func() sets.String
+	getAPIExport         func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIExport, error)
+	getAPIResourceSchema func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIResourceSchema, error)
+	getDownstreamCRD     func(ctx context.Context, name string) (*apiextensionsv1.CustomResourceDefinition, error)
+	createDownstreamCRD  func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error
+	updateDownstreamCRD  func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error
+	servedDownstream     func(gvr schema.GroupVersionResource) (bool, error)
+
+	syncTargetKey string
+
+	refusedLock sync.RWMutex
+	refused     []workloadv1alpha1.RefusedCRDUpdate
+}
+
+// NewInstaller returns a CRD installer for the SyncTarget. resourcesToSync returns the resources requested
+// in the syncer configuration, only their CRDs are installed.
+func NewInstaller(
+	syncTargetUID types.UID,
+	syncTargetKey string,
+	getSyncTarget func() (*workloadv1alpha1.SyncTarget, error),
+	resourcesToSync func() sets.String,
+	kcpClusterClient kcpclient.ClusterInterface,
+	downstreamCRDClient apiextensionsv1client.CustomResourceDefinitionsGetter,
+	downstreamDiscoveryClient discovery.DiscoveryInterface,
+) *Installer {
+	return &Installer{
+		getSyncTarget: func() (*workloadv1alpha1.SyncTarget, error) {
+			syncTarget, err := getSyncTarget()
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if syncTarget.UID != syncTargetUID {
+				return nil, nil
+			}
+			return syncTarget, nil
+		},
+		resourcesToSync: resourcesToSync,
+		getAPIExport: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIExport, error) {
+			return kcpClusterClient.Cluster(clusterName).ApisV1alpha1().APIExports().Get(ctx, name, metav1.GetOptions{})
+		},
+		getAPIResourceSchema: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIResourceSchema, error) {
+			return kcpClusterClient.Cluster(clusterName).ApisV1alpha1().APIResourceSchemas().Get(ctx, name, metav1.GetOptions{})
+		},
+		getDownstreamCRD: func(ctx context.Context, name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+			return downstreamCRDClient.CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+		},
+		createDownstreamCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error {
+			_, err := downstreamCRDClient.CustomResourceDefinitions().Create(ctx, crd, metav1.CreateOptions{})
+			return err
+		},
+		updateDownstreamCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error {
+			_, err := downstreamCRDClient.CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{})
+			return err
+		},
+		servedDownstream: func(gvr schema.GroupVersionResource) (bool, error) {
+			resources, err := downstreamDiscoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			for _, resource := range resources.APIResources {
+				if resource.Name == gvr.Resource {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+
+		syncTargetKey: syncTargetKey,
+	}
+}
+
+// RefusedUpdates returns the resources whose CRD update was refused by the last install.
+func (i *Installer) RefusedUpdates() []workloadv1alpha1.RefusedCRDUpdate {
+	i.refusedLock.RLock()
+	defer i.refusedLock.RUnlock()
+
+	return append([]workloadv1alpha1.RefusedCRDUpdate(nil), i.refused...)
+}
+
+// Install creates or updates the CRDs of the resources to sync, from the APIResourceSchemas of the APIExports
+// supported by the SyncTarget. It does nothing while another install is running.
+func (i *Installer) Install(ctx context.Context) error {
+	logger := logging.WithReconciler(klog.FromContext(ctx), installerName)
+	ctx = klog.NewContext(ctx, logger)
+
+	if !i.lock.TryLock() {
+		logger.V(4).Info("another CRD install is running, skipping")
+		return nil
+	}
+	defer i.lock.Unlock()
+
+	syncTarget, err := i.getSyncTarget()
+	if err != nil {
+		return err
+	}
+	if syncTarget == nil {
+		return nil
+	}
+
+	schemas, errs := i.resourceSchemas(ctx, syncTarget)
+	var refused []workloadv1alpha1.RefusedCRDUpdate
+	for _, resourceSchema := range schemas {
+		gr := schema.GroupResource{Group: resourceSchema.Spec.Group, Resource: resourceSchema.Spec.Names.Plural}
+		message, err := i.installCRD(ctx, resourceSchema)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to install the CRD of %s: %w", gr, err))
+		}
+		if message != "" {
+			logger.Info("refusing to update the CRD of the SyncTarget cluster", "resource", gr.String(), "reason", message)
+			refused = append(refused, workloadv1alpha1.RefusedCRDUpdate{Group: gr.Group, Resource: gr.Resource, Message: message})
+		}
+	}
+
+	i.refusedLock.Lock()
+	i.refused = refused
+	i.refusedLock.Unlock()
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// resourceSchemas returns the latest APIResourceSchemas of the APIExports supported by the SyncTarget, for the
+// resources to sync which are synced by the SyncTarget, sorted by name.
+func (i *Installer) resourceSchemas(ctx context.Context, syncTarget *workloadv1alpha1.SyncTarget) ([]*apisv1alpha1.APIResourceSchema, []error) {
+	requested := i.resourcesToSync()
+	synced := sets.NewString()
+	for _, resource := range syncTarget.Status.SyncedResources {
+		gr := schema.GroupResource{Group: resource.Group, Resource: resource.Resource}
+		if gr.Group == "" || !requested.Has(gr.String()) {
+			continue
+		}
+		synced.Insert(gr.String())
+	}
+	if synced.Len() == 0 {
+		return nil, nil
+	}
+
+	logger := klog.FromContext(ctx)
+	syncTargetClusterName := logicalcluster.From(syncTarget)
+
+	var schemas []*apisv1alpha1.APIResourceSchema
+	var errs []error
+	for _, export := range exportReferences(syncTarget) {
+		// The syncer reads the APIExports and APIResourceSchemas with the permissions of its service account,
+		// which are only granted in the workspace of the SyncTarget.
+		if export.clusterName != syncTargetClusterName {
+			logger.V(4).Info("skipping APIExport of another workspace than the SyncTarget's", "apiExport", export.clusterName.String()+"|"+export.name)
+			continue
+		}
+		apiExport, err := i.getAPIExport(ctx, export.clusterName, export.name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get APIExport %s|%s: %w", export.clusterName, export.name, err))
+			continue
+		}
+		for _, schemaName := range apiExport.Spec.LatestResourceSchemas {
+			resourceSchema, err := i.getAPIResourceSchema(ctx, export.clusterName, schemaName)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get APIResourceSchema %s|%s: %w", export.clusterName, schemaName, err))
+				continue
+			}
+			gr := schema.GroupResource{Group: resourceSchema.Spec.Group, Resource: resourceSchema.Spec.Names.Plural}
+			if !synced.Has(gr.String()) {
+				continue
+			}
+			// A resource exported by several APIExports is installed from the first one.
+			synced.Delete(gr.String())
+			schemas = append(schemas, resourceSchema)
+		}
+	}
+	sort.Slice(schemas, func(a, b int) bool {
+		return schemas[a].Name < schemas[b].Name
+	})
+	return schemas, errs
+}
+
+// installCRD creates or updates the CRD of the APIResourceSchema. It returns the reason why the update of the
+// CRD is refused, if any.
+func (i *Installer) installCRD(ctx context.Context, resourceSchema *apisv1alpha1.APIResourceSchema) (string, error) {
+	logger := klog.FromContext(ctx)
+
+	desired, err := crdForResourceSchema(resourceSchema, i.syncTargetKey)
+	if err != nil {
+		return "", err
+	}
+	logger = logger.WithValues("crd", desired.Name)
+
+	existing, err := i.getDownstreamCRD(ctx, desired.Name)
+	if apierrors.IsNotFound(err) {
+		served, err := i.servedDownstream(schema.GroupVersionResource{Group: desired.Spec.Group, Version: desired.Spec.Versions[0].Name, Resource: desired.Spec.Names.Plural})
+		if err != nil {
+			return "", err
+		}
+		if served {
+			logger.V(4).Info("resource is served by the SyncTarget cluster without a CRD, skipping")
+			return "", nil
+		}
+		logger.Info("creating CRD on the SyncTarget cluster")
+		return "", i.createDownstreamCRD(ctx, desired)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if existing.Labels[InstalledByLabel] != i.syncTargetKey {
+		logger.V(4).Info("CRD was not installed by the syncer, skipping")
+		return "", nil
+	}
+	if equality.Semantic.DeepEqual(existing.Spec, desired.Spec) {
+		return "", nil
+	}
+	if err := ensureCompatibleUpdate(existing, desired); err != nil {
+		return err.Error(), nil
+	}
+
+	updated := existing.DeepCopy()
+	updated.Spec = desired.Spec
+	logger.Info("updating CRD on the SyncTarget cluster")
+	return "", i.updateDownstreamCRD(ctx, updated)
+}
+
+// ensureCompatibleUpdate checks that all the objects stored for the existing CRD remain valid once it is updated
+// to the desired one: the scope is unchanged, the stored versions are kept, and the schemas of the versions are
+// compatible.
+func ensureCompatibleUpdate(existing, desired *apiextensionsv1.CustomResourceDefinition) error {
+	if existing.Spec.Scope != desired.Spec.Scope {
+		return fmt.Errorf("the scope changes from %s to %s", existing.Spec.Scope, desired.Spec.Scope)
+	}
+
+	desiredVersions := map[string]*apiextensionsv1.CustomResourceDefinitionVersion{}
+	for i := range desired.Spec.Versions {
+		desiredVersions[desired.Spec.Versions[i].Name] = &desired.Spec.Versions[i]
+	}
+	var removed []string
+	for _, version := range existing.Status.StoredVersions {
+		if _, ok := desiredVersions[version]; !ok {
+			removed = append(removed, version)
+		}
+	}
+	if len(removed) > 0 {
+		return fmt.Errorf("the stored versions %s are removed", strings.Join(removed, ", "))
+	}
+
+	var errs []error
+	for _, existingVersion := range existing.Spec.Versions {
+		desiredVersion, ok := desiredVersions[existingVersion.Name]
+		if !ok || existingVersion.Schema == nil || desiredVersion.Schema == nil {
+			continue
+		}
+		if _, err := schemacompat.EnsureStructuralSchemaCompatibility(field.NewPath(existing.Name, existingVersion.Name),
+			existingVersion.Schema.OpenAPIV3Schema, desiredVersion.Schema.OpenAPIV3Schema, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// crdForResourceSchema returns the CRD of the APIResourceSchema, labelled as installed by the syncer. The fields
+// defaulted by the API server are set, so that the CRD is only updated when the APIResourceSchema changes.
+func crdForResourceSchema(resourceSchema *apisv1alpha1.APIResourceSchema, syncTargetKey string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	names := resourceSchema.Spec.Names
+	if names.Singular == "" {
+		names.Singular = strings.ToLower(names.Kind)
+	}
+	if names.ListKind == "" {
+		names.ListKind = names.Kind + "List"
+	}
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: names.Plural + "." + resourceSchema.Spec.Group,
+			Labels: map[string]string{
+				InstalledByLabel: syncTargetKey,
+			},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: resourceSchema.Spec.Group,
+			Names: names,
+			Scope: resourceSchema.Spec.Scope,
+			Conversion: &apiextensionsv1.CustomResourceConversion{
+				Strategy: apiextensionsv1.NoneConverter,
+			},
+		},
+	}
+	for _, version := range resourceSchema.Spec.Versions {
+		openAPIV3Schema, err := version.GetSchema()
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of version %s of APIResourceSchema %s: %w", version.Name, resourceSchema.Name, err)
+		}
+		crdVersion := apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:                     version.Name,
+			Served:                   version.Served,
+			Storage:                  version.Storage,
+			Deprecated:               version.Deprecated,
+			DeprecationWarning:       version.DeprecationWarning,
+			Schema:                   &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: openAPIV3Schema},
+			AdditionalPrinterColumns: version.AdditionalPrinterColumns,
+		}
+		if version.Subresources.Status != nil || version.Subresources.Scale != nil {
+			crdVersion.Subresources = version.Subresources.DeepCopy()
+		}
+		crd.Spec.Versions = append(crd.Spec.Versions, crdVersion)
+	}
+	if len(crd.Spec.Versions) == 0 {
+		return nil, fmt.Errorf("APIResourceSchema %s has no version", resourceSchema.Name)
+	}
+	return crd, nil
+}
+
+type exportReference struct {
+	clusterName logicalcluster.Name
+	name        string
+}
+
+// exportReferences returns the APIExports supported by the SyncTarget. As for the resources synced by the
+// SyncTarget, the compute service APIExport of the workspace of the SyncTarget is supported by default.
+func exportReferences(syncTarget *workloadv1alpha1.SyncTarget) []exportReference {
+	clusterName := logicalcluster.From(syncTarget)
+	if len(syncTarget.Spec.SupportedAPIExports) == 0 {
+		return []exportReference{{clusterName: clusterName, name: reconcilerapiexport.TemporaryComputeServiceExportName}}
+	}
+
+	var references []exportReference
+	for _, export := range syncTarget.Spec.SupportedAPIExports {
+		if export.Workspace == nil {
+			continue
+		}
+		if len(export.Workspace.Path) == 0 {
+			references = append(references, exportReference{clusterName: clusterName, name: export.Workspace.ExportName})
+			continue
+		}
+		references = append(references, exportReference{clusterName: logicalcluster.New(export.Workspace.Path), name: export.Workspace.ExportName})
+	}
+	return references
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crds
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+const widgetSchema = `{"type":"object","properties":{"spec":{"type":"object","properties":{"size":{"type":"integer"}}}}}`
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		name             string
+		resourcesToSync  []string
+		schema           string
+		existing         *apiextensionsv1.CustomResourceDefinition
+		servedDownstream bool
+
+		wantCreated bool
+		wantUpdated bool
+		wantRefused []string
+	}{
+		{
+			name:            "creates the missing CRD",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          widgetSchema,
+			wantCreated:     true,
+		},
+		{
+			name:            "ignores the resources not to sync",
+			resourcesToSync: []string{"deployments.apps"},
+			schema:          widgetSchema,
+		},
+		{
+			name:             "skips the resources served without a CRD",
+			resourcesToSync:  []string{"widgets.example.dev"},
+			schema:           widgetSchema,
+			servedDownstream: true,
+		},
+		{
+			name:            "leaves alone the CRDs not installed by the syncer",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          `{"type":"object"}`,
+			existing:        withLabel(installedCRD(t, widgetSchema), "someone-else"),
+		},
+		{
+			name:            "does not update an up-to-date CRD",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          widgetSchema,
+			existing:        installedCRD(t, widgetSchema),
+		},
+		{
+			name:            "updates a CRD with a compatible schema",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          `{"type":"object","properties":{"spec":{"type":"object","properties":{"size":{"type":"integer"},"color":{"type":"string"}}}}}`,
+			existing:        installedCRD(t, widgetSchema),
+			wantUpdated:     true,
+		},
+		{
+			name:            "refuses to update a CRD with an incompatible schema",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          `{"type":"object","properties":{"spec":{"type":"object","properties":{"size":{"type":"string"}}}}}`,
+			existing:        installedCRD(t, widgetSchema),
+			wantRefused:     []string{"widgets.example.dev"},
+		},
+		{
+			name:            "refuses to remove a stored version",
+			resourcesToSync: []string{"widgets.example.dev"},
+			schema:          widgetSchema,
+			existing: func() *apiextensionsv1.CustomResourceDefinition {
+				crd := installedCRD(t, widgetSchema)
+				v1alpha1 := *crd.Spec.Versions[0].DeepCopy()
+				v1alpha1.Name, v1alpha1.Storage = "v1alpha1", false
+				crd.Spec.Versions = append(crd.Spec.Versions, v1alpha1)
+				crd.Status.StoredVersions = []string{"v1alpha1", "v1"}
+				return crd
+			}(),
+			wantRefused: []string{"widgets.example.dev"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			syncTarget := &workloadv1alpha1.SyncTarget{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "target",
+					Annotations: map[string]string{logicalcluster.AnnotationKey: "root:org:ws"},
+				},
+				Status: workloadv1alpha1.SyncTargetStatus{
+					SyncedResources: []workloadv1alpha1.ResourceToSync{
+						{GroupResource: apisv1alpha1.GroupResource{Group: "example.dev", Resource: "widgets"}, Versions: []string{"v1"}},
+					},
+				},
+			}
+			resourceSchema := newResourceSchema(tc.schema)
+
+			var created, updated *apiextensionsv1.CustomResourceDefinition
+			installer := &Installer{
+				getSyncTarget: func() (*workloadv1alpha1.SyncTarget, error) {
+					return syncTarget, nil
+				},
+				resourcesToSync: func() sets.String {
+					return sets.NewString(tc.resourcesToSync...)
+				},
+				getAPIExport: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIExport, error) {
+					require.Equal(t, logicalcluster.New("root:org:ws"), clusterName)
+					require.Equal(t, "kubernetes", name)
+					return &apisv1alpha1.APIExport{Spec: apisv1alpha1.APIExportSpec{LatestResourceSchemas: []string{resourceSchema.Name}}}, nil
+				},
+				getAPIResourceSchema: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIResourceSchema, error) {
+					return resourceSchema, nil
+				},
+				getDownstreamCRD: func(ctx context.Context, name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					if tc.existing == nil {
+						return nil, apierrors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+					}
+					return tc.existing.DeepCopy(), nil
+				},
+				createDownstreamCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error {
+					created = crd
+					return nil
+				},
+				updateDownstreamCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) error {
+					updated = crd
+					return nil
+				},
+				servedDownstream: func(gvr schema.GroupVersionResource) (bool, error) {
+					return tc.servedDownstream, nil
+				},
+				syncTargetKey: "key",
+			}
+
+			require.NoError(t, installer.Install(context.Background()))
+
+			require.Equal(t, tc.wantCreated, created != nil, "created")
+			if created != nil {
+				require.Equal(t, "widgets.example.dev", created.Name)
+				require.Equal(t, "key", created.Labels[InstalledByLabel])
+				require.Equal(t, "WidgetList", created.Spec.Names.ListKind)
+			}
+			require.Equal(t, tc.wantUpdated, updated != nil, "updated")
+			if updated != nil {
+				require.Equal(t, tc.existing.ResourceVersion, updated.ResourceVersion)
+			}
+			var refused []string
+			for _, r := range installer.RefusedUpdates() {
+				require.NotEmpty(t, r.Message)
+				refused = append(refused, schema.GroupResource{Group: r.Group, Resource: r.Resource}.String())
+			}
+			require.Equal(t, tc.wantRefused, refused)
+		})
+	}
+}
+
+func TestInstallSkipsOtherWorkspaces(t *testing.T) {
+	syncTarget := &workloadv1alpha1.SyncTarget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "target",
+			Annotations: map[string]string{logicalcluster.AnnotationKey: "root:org:ws"},
+		},
+		Spec: workloadv1alpha1.SyncTargetSpec{
+			SupportedAPIExports: []apisv1alpha1.ExportReference{
+				{Workspace: &apisv1alpha1.WorkspaceExportReference{Path: "root:org:other", ExportName: "widgets"}},
+				{Workspace: &apisv1alpha1.WorkspaceExportReference{ExportName: "kubernetes"}},
+			},
+		},
+		Status: workloadv1alpha1.SyncTargetStatus{
+			SyncedResources: []workloadv1alpha1.ResourceToSync{
+				{GroupResource: apisv1alpha1.GroupResource{Group: "example.dev", Resource: "widgets"}, Versions: []string{"v1"}},
+			},
+		},
+	}
+
+	var exports []string
+	installer := &Installer{
+		resourcesToSync: func() sets.String {
+			return sets.NewString("widgets.example.dev")
+		},
+		getAPIExport: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*apisv1alpha1.APIExport, error) {
+			exports = append(exports, clusterName.String()+"|"+name)
+			return &apisv1alpha1.APIExport{}, nil
+		},
+	}
+
+	schemas, errs := installer.resourceSchemas(context.Background(), syncTarget)
+	require.Empty(t, errs)
+	require.Empty(t, schemas)
+	require.Equal(t, []string{"root:org:ws|kubernetes"}, exports)
+}
+
+func newResourceSchema(jsonSchema string) *apisv1alpha1.APIResourceSchema {
+	return &apisv1alpha1.APIResourceSchema{
+		ObjectMeta: metav1.ObjectMeta{Name: "v1.widgets.example.dev"},
+		Spec: apisv1alpha1.APIResourceSchemaSpec{
+			Group: "example.dev",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Singular: "widget", Kind: "Widget"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apisv1alpha1.APIResourceVersion{
+				{Name: "v1", Served: true, Storage: true, Schema: runtime.RawExtension{Raw: []byte(jsonSchema)}},
+			},
+		},
+	}
+}
+
+func installedCRD(t *testing.T, jsonSchema string) *apiextensionsv1.CustomResourceDefinition {
+	t.Helper()
+
+	crd, err := crdForResourceSchema(newResourceSchema(jsonSchema), "key")
+	require.NoError(t, err)
+	crd.ResourceVersion = "42"
+	crd.Status.StoredVersions = []string{"v1"}
+	return crd
+}
+
+func withLabel(crd *apiextensionsv1.CustomResourceDefinition, syncTargetKey string) *apiextensionsv1.CustomResourceDefinition {
+	crd.Labels[InstalledByLabel] = syncTargetKey
+	return crd
+}
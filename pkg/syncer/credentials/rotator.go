@@ -0,0 +1,217 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+)
+
+// rotationRetryInterval is the interval at which a failed rotation is retried.
+const rotationRetryInterval = 30 * time.Second
+
+// Rotator provides the upstream clients of the syncer with short-lived tokens, requested through the TokenRequest
+// API for the service account of the bootstrap credential, i.e. the token of the kubeconfig created by
+// `kubectl kcp workload sync`. The tokens are renewed when 80% of their lifetime has passed.
+//
+// The bootstrap credential is reloaded on every rotation, so that a bootstrap credential rotated with
+// `kubectl kcp workload rotate-credentials` is picked up without a restart. Until a token is issued, or once it
+// is expired, e.g. when the service account is not allowed to request its own tokens, the clients use the
+// bootstrap credential.
+type Rotator struct {
+	expiration time.Duration
+	// syncTarget is the value of the sync_target label of the metrics.
+	syncTarget string
+
+	loadBootstrapConfig func() (*rest.Config, error)
+	requestToken        func(ctx context.Context, bootstrapConfig *rest.Config, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error)
+	now                 func() time.Time
+
+	lock           sync.RWMutex
+	bootstrapToken string
+	token          string
+	expiresAt      time.Time
+}
+
+// NewRotator returns a Rotator of the upstream tokens of the syncer of the SyncTarget with the given name in the
+// given logical cluster, requesting tokens valid for the given duration. The bootstrap configuration must
+// authenticate with a service account token of the logical cluster.
+func NewRotator(clusterName logicalcluster.Name, syncTargetName string, expiration time.Duration, loadBootstrapConfig func() (*rest.Config, error)) (*Rotator, error) {
+	bootstrapConfig, err := loadBootstrapConfig()
+	if err != nil {
+		return nil, err
+	}
+	if bootstrapConfig.BearerToken == "" {
+		return nil, errors.New("the upstream kubeconfig does not authenticate with a token")
+	}
+
+	return &Rotator{
+		expiration:          expiration,
+		syncTarget:          syncermetrics.SyncTargetLabel(clusterName, syncTargetName),
+		loadBootstrapConfig: loadBootstrapConfig,
+		requestToken: func(ctx context.Context, bootstrapConfig *rest.Config, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error) {
+			kubeClusterClient, err := kubernetesclient.NewClusterForConfig(rest.AddUserAgent(rest.CopyConfig(bootstrapConfig), "kcp#syncer-credentials"))
+			if err != nil {
+				return nil, err
+			}
+			return kubeClusterClient.Cluster(clusterName).CoreV1().ServiceAccounts(namespace).CreateToken(ctx, serviceAccountName, &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					ExpirationSeconds: &expirationSeconds,
+				},
+			}, metav1.CreateOptions{})
+		},
+		now: time.Now,
+
+		bootstrapToken: bootstrapConfig.BearerToken,
+	}, nil
+}
+
+// Apply makes the clients created from the configuration authenticate with the current token.
+func (r *Rotator) Apply(config *rest.Config) {
+	config.BearerToken = ""
+	config.BearerTokenFile = ""
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &bearerTokenRoundTripper{rotator: r, delegate: rt}
+	})
+}
+
+// Start rotates the token until the context is done, retrying the failed rotations.
+func (r *Rotator) Start(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	for {
+		rotateIn, err := r.Rotate(ctx)
+		if err != nil {
+			logger.Error(err, "failed to rotate the upstream credentials, retrying", "retryIn", rotationRetryInterval)
+			rotateIn = rotationRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rotateIn):
+		}
+	}
+}
+
+// Rotate reloads the bootstrap credential, and requests a new token for its service account. It returns the
+// duration after which the token must be rotated again.
+func (r *Rotator) Rotate(ctx context.Context) (time.Duration, error) {
+	bootstrapConfig, err := r.loadBootstrapConfig()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load the upstream kubeconfig: %w", err)
+	}
+	if bootstrapConfig.BearerToken == "" {
+		return 0, errors.New("the upstream kubeconfig does not authenticate with a token")
+	}
+	r.lock.Lock()
+	r.bootstrapToken = bootstrapConfig.BearerToken
+	r.lock.Unlock()
+
+	namespace, name, err := serviceAccountOf(bootstrapConfig.BearerToken)
+	if err != nil {
+		return 0, err
+	}
+	tokenRequest, err := r.requestToken(ctx, bootstrapConfig, namespace, name, int64(r.expiration.Seconds()))
+	if err == nil && tokenRequest.Status.Token == "" {
+		err = fmt.Errorf("no token issued for ServiceAccount %s/%s", namespace, name)
+	}
+	if err != nil {
+		syncermetrics.RecordCredentialRotation(r.syncTarget, time.Time{}, err)
+		return 0, fmt.Errorf("failed to request a token for ServiceAccount %s/%s: %w", namespace, name, err)
+	}
+
+	expiresAt := tokenRequest.Status.ExpirationTimestamp.Time
+	r.lock.Lock()
+	r.token = tokenRequest.Status.Token
+	r.expiresAt = expiresAt
+	r.lock.Unlock()
+	syncermetrics.RecordCredentialRotation(r.syncTarget, expiresAt, nil)
+	klog.FromContext(ctx).Info("rotated the upstream credentials", "serviceAccount", namespace+"/"+name, "expiration", expiresAt)
+
+	return expiresAt.Sub(r.now()) * 4 / 5, nil
+}
+
+// currentToken returns the last issued token if it is not expired, or the bootstrap token otherwise.
+func (r *Rotator) currentToken() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.token != "" && r.now().Before(r.expiresAt) {
+		return r.token
+	}
+	return r.bootstrapToken
+}
+
+// serviceAccountOf returns the namespace and the name of the service account of a service account token, from the
+// subject of its unverified claims. The token is only used to request tokens of the same service account.
+func serviceAccountOf(token string) (string, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", errors.New("the upstream token is not a service account token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid upstream token: %w", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", "", fmt.Errorf("invalid upstream token: %w", err)
+	}
+	namespace, name, err := serviceaccount.SplitUsername(claims.Subject)
+	if err != nil {
+		return "", "", fmt.Errorf("the upstream token is not a service account token: %w", err)
+	}
+	return namespace, name, nil
+}
+
+type bearerTokenRoundTripper struct {
+	rotator  *Rotator
+	delegate http.RoundTripper
+}
+
+func (rt *bearerTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return rt.delegate.RoundTrip(req)
+	}
+	req = utilnet.CloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+rt.rotator.currentToken())
+	return rt.delegate.RoundTrip(req)
+}
+
+func (rt *bearerTokenRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.delegate
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// serviceAccountToken returns an unsigned token with the subject of the given service account.
+func serviceAccountToken(namespace, name string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"system:serviceaccount:` + namespace + `:` + name + `"}`))
+	return "header." + payload + ".signature"
+}
+
+func TestServiceAccountOf(t *testing.T) {
+	namespace, name, err := serviceAccountOf(serviceAccountToken("default", "kcp-syncer-us-east1-1234abcd"))
+	require.NoError(t, err)
+	require.Equal(t, "default", namespace)
+	require.Equal(t, "kcp-syncer-us-east1-1234abcd", name)
+
+	_, _, err = serviceAccountOf("opaque-token")
+	require.Error(t, err)
+
+	_, _, err = serviceAccountOf("header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + ".signature")
+	require.Error(t, err)
+}
+
+func TestRotate(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	bootstrapToken := serviceAccountToken("default", "kcp-syncer-us-east1-1234abcd")
+	var requestErr error
+	var requested []string
+
+	r := &Rotator{
+		expiration: time.Hour,
+		loadBootstrapConfig: func() (*rest.Config, error) {
+			return &rest.Config{BearerToken: bootstrapToken}, nil
+		},
+		requestToken: func(ctx context.Context, bootstrapConfig *rest.Config, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error) {
+			if requestErr != nil {
+				return nil, requestErr
+			}
+			require.Equal(t, int64(3600), expirationSeconds)
+			requested = append(requested, namespace+"/"+serviceAccountName)
+			return &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{
+					Token:               "issued-" + bootstrapConfig.BearerToken,
+					ExpirationTimestamp: metav1.NewTime(now.Add(time.Hour)),
+				},
+			}, nil
+		},
+		now: func() time.Time { return now },
+	}
+
+	// The bootstrap token is used until a token is issued.
+	requestErr = errors.New("forbidden")
+	_, err := r.Rotate(context.Background())
+	require.Error(t, err)
+	require.Equal(t, bootstrapToken, r.currentToken())
+
+	requestErr = nil
+	rotateIn, err := r.Rotate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 48*time.Minute, rotateIn, "the token should be rotated at 80% of its lifetime")
+	require.Equal(t, []string{"default/kcp-syncer-us-east1-1234abcd"}, requested)
+	require.Equal(t, "issued-"+bootstrapToken, r.currentToken())
+
+	// A rotated bootstrap credential is used for the next rotations.
+	bootstrapToken = serviceAccountToken("default", "kcp-syncer-us-east1-1234abcd") + "-rotated"
+	_, err = r.Rotate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "issued-"+bootstrapToken, r.currentToken())
+
+	// An expired token falls back to the bootstrap token.
+	now = now.Add(2 * time.Hour)
+	require.Equal(t, bootstrapToken, r.currentToken())
+}
+
+func TestApply(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	r := &Rotator{
+		bootstrapToken: "bootstrap",
+		token:          "issued",
+		expiresAt:      time.Now().Add(time.Hour),
+		now:            time.Now,
+	}
+	config := &rest.Config{Host: server.URL, BearerToken: "bootstrap"}
+	r.Apply(config)
+	require.Empty(t, config.BearerToken)
+
+	client, err := rest.HTTPClientFor(config)
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "Bearer issued", authorization)
+
+	r.lock.Lock()
+	r.token = "renewed"
+	r.lock.Unlock()
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "Bearer renewed", authorization, "existing clients should use the renewed token")
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+)
+
+const (
+	controllerName = "kcp-workload-syncer-events"
+
+	// eventsQPS and eventsBurst limit the rate at which events are created or updated upstream,
+	// so that a flood of downstream events doesn't overload kcp.
+	eventsQPS   = 5
+	eventsBurst = 25
+)
+
+var (
+	eventsGVR    = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "events"}
+	namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+)
+
+// Controller propagates the downstream Events of the objects synced by the syncer, or of the objects
+// they own, e.g. the Pods of a Deployment, to the workspace the synced objects come from. The upstream
+// Events reference the upstream objects, so that they show up when describing them in the workspace.
+// They are written through the syncer virtual workspaces, in the Upsync state.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	getDownstreamEvent     func(namespace, name string) (*corev1.Event, error)
+	getDownstreamNamespace func(name string) (*unstructured.Unstructured, error)
+	getDownstreamObject    func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (schema.GroupVersionResource, *unstructured.Unstructured, error)
+	getUpstreamObject      func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error)
+	getUpstreamEvent       func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string) (*corev1.Event, error)
+	createUpstreamEvent    func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error
+	updateUpstreamEvent    func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error
+
+	rateLimiter flowcontrol.RateLimiter
+	// startTime is the time the controller was created at. Older downstream events are not propagated,
+	// to avoid flooding the workspaces with the backlog of events when the syncer starts.
+	startTime time.Time
+
+	syncTargetName string
+	syncTargetKey  string
+}
+
+// NewController returns an events controller. getUpstreamObject gets the upstream objects through the syncer virtual
+// workspaces, and upstreamNamespaceClient returns the client of the syncer virtual workspace serving an upstream namespace.
+func NewController(
+	syncTargetName, syncTargetKey string,
+	getUpstreamObject func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error),
+	upstreamNamespaceClient func(clusterName logicalcluster.Name, namespace string) (dynamic.Interface, error),
+	downstreamDynamicClient dynamic.Interface,
+	downstreamDiscoveryClient discovery.DiscoveryInterface,
+	downstreamEventInformer coreinformers.EventInformer,
+	downstreamNamespaceInformers dynamicinformer.DynamicSharedInformerFactory,
+) (*Controller, error) {
+	logger := logging.WithReconciler(klog.Background(), controllerName)
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(downstreamDiscoveryClient))
+
+	c := &Controller{
+		queue: syncermetrics.NewQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName), func(interface{}) schema.GroupVersionResource {
+			return eventsGVR
+		}),
+
+		getDownstreamEvent: func(namespace, name string) (*corev1.Event, error) {
+			return downstreamEventInformer.Lister().Events(namespace).Get(name)
+		},
+		getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+			obj, exists, err := downstreamNamespaceInformers.ForResource(namespaceGVR).Informer().GetIndexer().GetByKey(name)
+			if err != nil || !exists {
+				return nil, err
+			}
+			return obj.(*unstructured.Unstructured), nil
+		},
+		getDownstreamObject: func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
+			mapping, err := restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if meta.IsNoMatchError(err) {
+				// The type might have been installed since discovery was cached.
+				restMapper.Reset()
+				mapping, err = restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			}
+			if err != nil {
+				return schema.GroupVersionResource{}, nil, err
+			}
+			obj, err := downstreamDynamicClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+			return mapping.Resource, obj, err
+		},
+		getUpstreamObject: getUpstreamObject,
+		getUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string) (*corev1.Event, error) {
+			client, err := upstreamNamespaceClient(clusterName, namespace)
+			if err != nil {
+				return nil, err
+			}
+			obj, err := client.Resource(eventsGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			event := &corev1.Event{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), event); err != nil {
+				return nil, err
+			}
+			return event, nil
+		},
+		createUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+			client, err := upstreamNamespaceClient(clusterName, event.Namespace)
+			if err != nil {
+				return err
+			}
+			obj, err := toUnstructured(event)
+			if err != nil {
+				return err
+			}
+			_, err = client.Resource(eventsGVR).Namespace(event.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+			return err
+		},
+		updateUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+			client, err := upstreamNamespaceClient(clusterName, event.Namespace)
+			if err != nil {
+				return err
+			}
+			obj, err := toUnstructured(event)
+			if err != nil {
+				return err
+			}
+			_, err = client.Resource(eventsGVR).Namespace(event.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
+			return err
+		},
+
+		rateLimiter: flowcontrol.NewTokenBucketRateLimiter(eventsQPS, eventsBurst),
+		startTime:   time.Now(),
+
+		syncTargetName: syncTargetName,
+		syncTargetKey:  syncTargetKey,
+	}
+
+	downstreamEventInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.AddToQueue(obj, logger)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.AddToQueue(newObj, logger)
+		},
+	})
+
+	return c, nil
+}
+
+func (c *Controller) AddToQueue(obj interface{}, logger logr.Logger) {
+	event, ok := obj.(*corev1.Event)
+	if !ok {
+		return
+	}
+	// Only events in the namespaces managed by the syncer are propagated.
+	if namespace, err := c.getDownstreamNamespace(event.Namespace); err != nil || namespace == nil {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(event)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	logger.V(4).Info("queueing event", "key", key)
+	c.queue.Add(key)
+}
+
+// Start starts N worker processes processing work items.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := logging.WithReconciler(klog.FromContext(ctx), controllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// startWorker processes work items until stopCh is closed.
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	eventKey := key.(string)
+
+	logger := logging.WithQueueKey(klog.FromContext(ctx), eventKey)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(4).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	requeueAfter, err := c.process(ctx, eventKey)
+	syncermetrics.ObserveProcessing(controllerName, eventsGVR, key, start, err)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+
+	return true
+}
+
+// upstreamEventName returns a stable name for the upstream event of a downstream event, such that
+// updates of the downstream event, e.g. of its count, update the same upstream event.
+func upstreamEventName(upstreamObjectName string, downstreamEventUID types.UID) string {
+	return fmt.Sprintf("%s.%s", upstreamObjectName, shortHash(string(downstreamEventUID)))
+}
+
+// toUnstructured converts the event to be written through the dynamic client of a syncer virtual workspace.
+func toUnstructured(event *corev1.Event) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Event")
+	return obj, nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	// maxOwnerDepth is the maximum number of owner references followed from the object of an event
+	// to find the synced object it belongs to, e.g. Pod -> ReplicaSet -> Deployment.
+	maxOwnerDepth = 3
+
+	// rateLimitedRetryDelay is the delay after which an event is retried when the rate limit is reached.
+	rateLimitedRetryDelay = 1 * time.Second
+
+	eventsReportingController = "kcp.dev/syncer"
+)
+
+// process propagates the downstream event of the given key upstream, if it relates to a synced object.
+// It returns the duration after which the event must be processed again, if rate-limited.
+func (c *Controller) process(ctx context.Context, key string) (time.Duration, error) {
+	logger := klog.FromContext(ctx)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Error(err, "Invalid key")
+		return 0, nil
+	}
+
+	event, err := c.getDownstreamEvent(namespace, name)
+	if apierrors.IsNotFound(err) {
+		// Upstream events expire on their own.
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if eventTime(event).Before(c.startTime) {
+		return 0, nil
+	}
+
+	downstreamNamespace, err := c.getDownstreamNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	if downstreamNamespace == nil {
+		return 0, nil
+	}
+	locator, found, err := shared.LocatorFromAnnotations(downstreamNamespace.GetAnnotations())
+	if err != nil || !found {
+		logger.V(4).Info("downstream namespace has no valid namespace locator, ignoring event", "err", err)
+		return 0, nil
+	}
+
+	gvr, syncedObject, err := c.findSyncedObject(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+	if syncedObject == nil {
+		logger.V(5).Info("event doesn't relate to a synced object, ignoring")
+		return 0, nil
+	}
+
+	upstreamObject, err := c.getUpstreamObject(ctx, gvr, locator.Workspace, locator.Namespace, shared.GetUpstreamResourceName(gvr, syncedObject.GetName()))
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if !c.rateLimiter.TryAccept() {
+		logger.V(4).Info("rate limit reached, delaying event propagation")
+		return rateLimitedRetryDelay, nil
+	}
+
+	message := event.Message
+	if event.InvolvedObject.UID != syncedObject.GetUID() {
+		// Say which downstream object the event is about, e.g. a Pod of the Deployment.
+		message = event.InvolvedObject.Kind + " " + event.InvolvedObject.Name + ": " + message
+	}
+
+	upstreamEvent := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upstreamEventName(upstreamObject.GetName(), event.UID),
+			Namespace: locator.Namespace,
+			// The syncer virtual workspace only allows creating upsynced objects, and serves them.
+			Labels: map[string]string{
+				workloadv1alpha1.ClusterResourceStateLabelPrefix + c.syncTargetKey: string(workloadv1alpha1.ResourceStateUpsync),
+			},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: upstreamObject.GetAPIVersion(),
+			Kind:       upstreamObject.GetKind(),
+			Namespace:  locator.Namespace,
+			Name:       upstreamObject.GetName(),
+			UID:        upstreamObject.GetUID(),
+		},
+		Reason:              event.Reason,
+		Message:             message,
+		Type:                event.Type,
+		Count:               event.Count,
+		FirstTimestamp:      event.FirstTimestamp,
+		LastTimestamp:       event.LastTimestamp,
+		Source:              corev1.EventSource{Component: eventsReportingController, Host: c.syncTargetName},
+		ReportingController: eventsReportingController,
+		ReportingInstance:   c.syncTargetName,
+	}
+
+	existing, err := c.getUpstreamEvent(ctx, locator.Workspace, upstreamEvent.Namespace, upstreamEvent.Name)
+	if apierrors.IsNotFound(err) {
+		logger.V(2).Info("creating upstream event", "upstreamEvent", locator.Workspace.String()+"|"+upstreamEvent.Namespace+"/"+upstreamEvent.Name, "reason", event.Reason)
+		if err := c.createUpstreamEvent(ctx, locator.Workspace, upstreamEvent); apierrors.IsAlreadyExists(err) {
+			// An upstream event with the same name exists, but is not served by the syncer virtual workspace.
+			logger.V(2).Info("upstream event already exists and is not upsynced, ignoring event")
+			return 0, nil
+		} else if err != nil {
+			syncermetrics.RecordWriteError(controllerName, eventsGVR, "create")
+			return 0, err
+		}
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	if existing.Count == upstreamEvent.Count && existing.LastTimestamp.Equal(&upstreamEvent.LastTimestamp) && existing.Message == upstreamEvent.Message {
+		return 0, nil
+	}
+	existing = existing.DeepCopy()
+	existing.Count = upstreamEvent.Count
+	existing.LastTimestamp = upstreamEvent.LastTimestamp
+	existing.Message = upstreamEvent.Message
+	logger.V(2).Info("updating upstream event", "upstreamEvent", locator.Workspace.String()+"|"+existing.Namespace+"/"+existing.Name, "reason", event.Reason, "count", existing.Count)
+	if err := c.updateUpstreamEvent(ctx, locator.Workspace, existing); err != nil {
+		syncermetrics.RecordWriteError(controllerName, eventsGVR, "update")
+		return 0, err
+	}
+	return 0, nil
+}
+
+// findSyncedObject returns the synced object the event is about, either directly or through the
+// controller owner references of the object of the event. It returns nil if there is none.
+func (c *Controller) findSyncedObject(ctx context.Context, event *corev1.Event) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
+	gvk := schema.FromAPIVersionAndKind(event.InvolvedObject.APIVersion, event.InvolvedObject.Kind)
+	name := event.InvolvedObject.Name
+
+	for i := 0; i <= maxOwnerDepth; i++ {
+		gvr, obj, err := c.getDownstreamObject(ctx, gvk, event.Namespace, name)
+		if apierrors.IsNotFound(err) {
+			return schema.GroupVersionResource{}, nil, nil
+		} else if err != nil {
+			return schema.GroupVersionResource{}, nil, err
+		}
+		if obj.GetLabels()[workloadv1alpha1.InternalDownstreamClusterLabel] == c.syncTargetKey {
+			return gvr, obj, nil
+		}
+
+		owner := metav1.GetControllerOfNoCopy(obj)
+		if owner == nil {
+			break
+		}
+		gvk = schema.FromAPIVersionAndKind(owner.APIVersion, owner.Kind)
+		name = owner.Name
+	}
+	return schema.GroupVersionResource{}, nil, nil
+}
+
+// eventTime returns the last time the event was seen.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
+
+func shortHash(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:8])
+}
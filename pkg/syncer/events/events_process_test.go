@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestEventsProcess(t *testing.T) {
+	startTime := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	deployment := downstreamObject("apps/v1", "Deployment", "theDeployment", "deploymentUID", nil)
+	deployment.SetLabels(map[string]string{workloadv1alpha1.InternalDownstreamClusterLabel: syncTargetKey})
+	replicaSet := downstreamObject("apps/v1", "ReplicaSet", "theReplicaSet", "replicaSetUID", deployment)
+	pod := downstreamObject("v1", "Pod", "thePod", "podUID", replicaSet)
+	unsynced := downstreamObject("v1", "Pod", "unsyncedPod", "unsyncedUID", nil)
+
+	tests := map[string]struct {
+		involvedObject *unstructured.Unstructured
+		lastTimestamp  time.Time
+		existingCount  int32
+		rateLimited    bool
+
+		expectCreated      bool
+		expectUpdated      bool
+		expectMessage      string
+		expectRequeueAfter time.Duration
+	}{
+		"event of a synced object, expect an upstream event to be created": {
+			involvedObject: deployment,
+			lastTimestamp:  startTime.Add(time.Minute),
+			expectCreated:  true,
+			expectMessage:  "Scaled up replica set theReplicaSet to 1",
+		},
+		"event of an object owned by a synced object, expect an upstream event to be created for the synced object": {
+			involvedObject: pod,
+			lastTimestamp:  startTime.Add(time.Minute),
+			expectCreated:  true,
+			expectMessage:  "Pod thePod: Scaled up replica set theReplicaSet to 1",
+		},
+		"event of an object not synced, expect nothing": {
+			involvedObject: unsynced,
+			lastTimestamp:  startTime.Add(time.Minute),
+		},
+		"event older than the controller, expect nothing": {
+			involvedObject: deployment,
+			lastTimestamp:  startTime.Add(-time.Minute),
+		},
+		"upstream event up to date, expect nothing": {
+			involvedObject: deployment,
+			lastTimestamp:  startTime.Add(time.Minute),
+			existingCount:  2,
+		},
+		"upstream event with an older count, expect it to be updated": {
+			involvedObject: deployment,
+			lastTimestamp:  startTime.Add(time.Minute),
+			existingCount:  1,
+			expectUpdated:  true,
+			expectMessage:  "Scaled up replica set theReplicaSet to 1",
+		},
+		"rate limit reached, expect a requeue": {
+			involvedObject:     deployment,
+			lastTimestamp:      startTime.Add(time.Minute),
+			rateLimited:        true,
+			expectRequeueAfter: rateLimitedRetryDelay,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var created, updated *corev1.Event
+
+			downstreamEvent := &corev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      tc.involvedObject.GetName() + ".123",
+					Namespace: "kcp-hcbsa8z6c2er",
+					UID:       "eventUID",
+				},
+				InvolvedObject: corev1.ObjectReference{
+					APIVersion: tc.involvedObject.GetAPIVersion(),
+					Kind:       tc.involvedObject.GetKind(),
+					Namespace:  "kcp-hcbsa8z6c2er",
+					Name:       tc.involvedObject.GetName(),
+					UID:        tc.involvedObject.GetUID(),
+				},
+				Reason:        "ScalingReplicaSet",
+				Message:       "Scaled up replica set theReplicaSet to 1",
+				Type:          corev1.EventTypeNormal,
+				Count:         2,
+				LastTimestamp: metav1.NewTime(tc.lastTimestamp),
+			}
+			upstreamName := upstreamEventName("theDeployment", "eventUID")
+
+			rateLimiter := flowcontrol.NewFakeAlwaysRateLimiter()
+			if tc.rateLimited {
+				rateLimiter = flowcontrol.NewFakeNeverRateLimiter()
+			}
+
+			c := &Controller{
+				getDownstreamEvent: func(namespace, name string) (*corev1.Event, error) {
+					return downstreamEvent, nil
+				},
+				getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+					ns := &unstructured.Unstructured{}
+					ns.SetName(name)
+					ns.SetAnnotations(map[string]string{
+						"kcp.dev/namespace-locator": `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+					})
+					return ns, nil
+				},
+				getDownstreamObject: func(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
+					for _, obj := range []*unstructured.Unstructured{deployment, replicaSet, pod, unsynced} {
+						if obj.GroupVersionKind() == gvk && obj.GetName() == name {
+							gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+							return gvr, obj, nil
+						}
+					}
+					return schema.GroupVersionResource{}, nil, apierrors.NewNotFound(schema.GroupResource{}, name)
+				},
+				getUpstreamObject: func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error) {
+					require.Equal(t, logicalcluster.New("root:org:ws"), clusterName)
+					require.Equal(t, deploymentsGVR, gvr)
+					require.Equal(t, "test", namespace)
+					obj := downstreamObject("apps/v1", "Deployment", name, "upstreamDeploymentUID", nil)
+					obj.SetNamespace(namespace)
+					return obj, nil
+				},
+				getUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string) (*corev1.Event, error) {
+					require.Equal(t, upstreamName, name)
+					if tc.existingCount == 0 {
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "events"}, name)
+					}
+					return &corev1.Event{
+						ObjectMeta:    metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: "1"},
+						Message:       "Scaled up replica set theReplicaSet to 1",
+						Count:         tc.existingCount,
+						LastTimestamp: downstreamEvent.LastTimestamp,
+					}, nil
+				},
+				createUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+					created = event
+					return nil
+				},
+				updateUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+					updated = event
+					return nil
+				},
+
+				rateLimiter: rateLimiter,
+				startTime:   startTime,
+
+				syncTargetName: "us-west1",
+				syncTargetKey:  syncTargetKey,
+			}
+
+			requeueAfter, err := c.process(context.Background(), "kcp-hcbsa8z6c2er/"+downstreamEvent.Name)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectRequeueAfter, requeueAfter)
+			require.Equal(t, tc.expectCreated, created != nil, "upstream event created")
+			require.Equal(t, tc.expectUpdated, updated != nil, "upstream event updated")
+
+			if created != nil {
+				require.Equal(t, upstreamName, created.Name)
+				require.Equal(t, "test", created.Namespace)
+				require.Equal(t, corev1.ObjectReference{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Namespace:  "test",
+					Name:       "theDeployment",
+					UID:        "upstreamDeploymentUID",
+				}, created.InvolvedObject)
+				require.Equal(t, tc.expectMessage, created.Message)
+				require.Equal(t, int32(2), created.Count)
+				require.Equal(t, "us-west1", created.Source.Host)
+				require.Equal(t, map[string]string{workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey: "Upsync"}, created.Labels)
+			}
+			if updated != nil {
+				require.Equal(t, "1", updated.ResourceVersion)
+				require.Equal(t, tc.expectMessage, updated.Message)
+				require.Equal(t, int32(2), updated.Count)
+			}
+		})
+	}
+}
+
+func downstreamObject(apiVersion, kind, name string, uid types.UID, owner *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace("kcp-hcbsa8z6c2er")
+	obj.SetUID(uid)
+	if owner != nil {
+		obj.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(owner, owner.GroupVersionKind())})
+	}
+	return obj
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Checks are named health checks, served in the format of the Kubernetes healthz endpoints: a line per check,
+// and a 500 status code if any check fails. Checks can be added and removed at runtime, e.g. when the syncers
+// of a syncer virtual workspace are started and stopped. Without any check, the endpoint reports success.
+type Checks struct {
+	name string
+
+	lock   sync.RWMutex
+	checks map[string]func() error
+}
+
+// NewChecks returns empty checks, reported as the given endpoint name, e.g. readyz.
+func NewChecks(name string) *Checks {
+	return &Checks{name: name, checks: map[string]func() error{}}
+}
+
+// Add adds a check, replacing the check of the same name, if any.
+func (c *Checks) Add(name string, check func() error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checks[name] = check
+}
+
+// Set adds a check failing with the given error, e.g. the last error of a poll, or passing if it is nil.
+func (c *Checks) Set(name string, err error) {
+	c.Add(name, func() error { return err })
+}
+
+// Remove removes the check of the given name.
+func (c *Checks) Remove(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.checks, name)
+}
+
+// Result is the result of a check.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Check runs the checks, and returns their results sorted by name.
+func (c *Checks) Check() []Result {
+	c.lock.RLock()
+	results := make([]Result, 0, len(c.checks))
+	checks := make([]func() error, 0, len(c.checks))
+	for name, check := range c.checks {
+		results = append(results, Result{Name: name})
+		checks = append(checks, check)
+	}
+	c.lock.RUnlock()
+
+	for i := range results {
+		results[i].Err = checks[i]()
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// ServeHTTP serves the results of the checks.
+func (c *Checks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var out bytes.Buffer
+	failed := false
+	for _, result := range c.Check() {
+		if result.Err != nil {
+			fmt.Fprintf(&out, "[-]%s failed: %v\n", result.Name, result.Err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(&out, "[+]%s ok\n", result.Name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if failed {
+		fmt.Fprintf(&out, "%s check failed\n", c.name)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		fmt.Fprintf(&out, "%s check passed\n", c.name)
+	}
+	_, _ = out.WriteTo(w)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecks(t *testing.T) {
+	checks := NewChecks("readyz")
+
+	serve := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		checks.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := serve()
+	require.Equal(t, http.StatusOK, code, "no check should be a success")
+	require.Equal(t, "readyz check passed\n", body)
+
+	checks.Set("synctarget", errors.New("not found"))
+	checks.Add("informers", func() error { return nil })
+	code, body = serve()
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "[+]informers ok\n[-]synctarget failed: not found\nreadyz check failed\n", body)
+
+	checks.Set("synctarget", nil)
+	code, body = serve()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "[+]informers ok\n[+]synctarget ok\nreadyz check passed\n", body)
+
+	checks.Set("discovery", errors.New("timeout"))
+	checks.Remove("discovery")
+	code, _ = serve()
+	require.Equal(t, http.StatusOK, code, "a removed check should not be run")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueuesDump is the content of the controller queues of the syncer, and the last processing error of
+// the keys that are still retried.
+type QueuesDump struct {
+	Queues     []QueueDump `json:"queues"`
+	LastErrors []KeyError  `json:"lastErrors"`
+}
+
+// QueueDump is the content of a controller queue: the keys waiting to be processed, including the ones
+// waiting for a retry. The keys being processed are not listed.
+type QueueDump struct {
+	Controller string   `json:"controller"`
+	Pending    []string `json:"pending"`
+}
+
+// KeyError is the last error of the processing of a key by a controller.
+type KeyError struct {
+	Controller string    `json:"controller"`
+	Key        string    `json:"key"`
+	Error      string    `json:"error"`
+	Time       time.Time `json:"time"`
+}
+
+// debugState holds the live controller queues, and the last error per controller and key. The error
+// of a key is forgotten once the key is processed successfully, or dropped.
+var debugState = struct {
+	lock       sync.Mutex
+	queues     map[*queueWithDepth]bool
+	lastErrors map[string]map[string]KeyError
+}{
+	queues:     map[*queueWithDepth]bool{},
+	lastErrors: map[string]map[string]KeyError{},
+}
+
+func registerQueue(q *queueWithDepth) {
+	debugState.lock.Lock()
+	defer debugState.lock.Unlock()
+	debugState.queues[q] = true
+}
+
+func unregisterQueue(q *queueWithDepth) {
+	debugState.lock.Lock()
+	defer debugState.lock.Unlock()
+	delete(debugState.queues, q)
+}
+
+func recordKeyError(controller string, key interface{}, err error) {
+	debugState.lock.Lock()
+	defer debugState.lock.Unlock()
+	errs, ok := debugState.lastErrors[controller]
+	if !ok {
+		errs = map[string]KeyError{}
+		debugState.lastErrors[controller] = errs
+	}
+	errs[keyString(key)] = KeyError{Controller: controller, Key: keyString(key), Error: err.Error(), Time: time.Now()}
+}
+
+func forgetKeyError(controller string, key interface{}) {
+	debugState.lock.Lock()
+	defer debugState.lock.Unlock()
+	delete(debugState.lastErrors[controller], keyString(key))
+}
+
+func keyString(key interface{}) string {
+	if s, ok := key.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+// DumpQueues returns the content of the live controller queues, and the last errors of their keys,
+// sorted by controller and key.
+func DumpQueues() QueuesDump {
+	debugState.lock.Lock()
+	queues := make([]*queueWithDepth, 0, len(debugState.queues))
+	for q := range debugState.queues {
+		queues = append(queues, q)
+	}
+	dump := QueuesDump{Queues: []QueueDump{}, LastErrors: []KeyError{}}
+	for _, errs := range debugState.lastErrors {
+		for _, keyErr := range errs {
+			dump.LastErrors = append(dump.LastErrors, keyErr)
+		}
+	}
+	debugState.lock.Unlock()
+
+	for _, q := range queues {
+		dump.Queues = append(dump.Queues, QueueDump{Controller: q.controller, Pending: q.pendingKeys()})
+	}
+	sort.SliceStable(dump.Queues, func(i, j int) bool {
+		return dump.Queues[i].Controller < dump.Queues[j].Controller
+	})
+	sort.Slice(dump.LastErrors, func(i, j int) bool {
+		if dump.LastErrors[i].Controller != dump.LastErrors[j].Controller {
+			return dump.LastErrors[i].Controller < dump.LastErrors[j].Controller
+		}
+		return dump.LastErrors[i].Key < dump.LastErrors[j].Key
+	})
+	return dump
+}
+
+// DebugHandler returns the HTTP handler serving the dump of the controller queues as JSON.
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(DumpQueues()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestDumpQueues(t *testing.T) {
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	queue := NewQueue("debug-controller", workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(i interface{}) schema.GroupVersionResource {
+		return secrets
+	})
+
+	dumpOf := func() (*QueueDump, []KeyError) {
+		dump := DumpQueues()
+		var queueDump *QueueDump
+		for i := range dump.Queues {
+			if dump.Queues[i].Controller == "debug-controller" {
+				queueDump = &dump.Queues[i]
+			}
+		}
+		var keyErrors []KeyError
+		for _, keyErr := range dump.LastErrors {
+			if keyErr.Controller == "debug-controller" {
+				keyErrors = append(keyErrors, keyErr)
+			}
+		}
+		return queueDump, keyErrors
+	}
+
+	queue.Add("ns/b")
+	queue.Add("ns/a")
+	queueDump, keyErrors := dumpOf()
+	require.NotNil(t, queueDump)
+	require.Equal(t, []string{"ns/a", "ns/b"}, queueDump.Pending)
+	require.Empty(t, keyErrors)
+
+	key, _ := queue.Get()
+	ObserveProcessing("debug-controller", secrets, key, time.Now(), errors.New("boom"))
+	queue.AddRateLimited(key)
+	queue.Done(key)
+	_, keyErrors = dumpOf()
+	require.Len(t, keyErrors, 1)
+	require.Equal(t, "ns/b", keyErrors[0].Key)
+	require.Equal(t, "boom", keyErrors[0].Error)
+
+	queue.Forget(key)
+	_, keyErrors = dumpOf()
+	require.Empty(t, keyErrors, "the error of a forgotten key should be dropped")
+
+	queue.ShutDown()
+	queueDump, _ = dumpOf()
+	require.Nil(t, queueDump, "a queue shut down should not be listed")
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the Prometheus metrics of the syncer. They are registered in the
+// legacy registry of k8s.io/component-base, along with the workqueue metrics of the
+// syncer controllers, and served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	_ "k8s.io/component-base/metrics/prometheus/workqueue" // for workqueue metric registration
+)
+
+const (
+	namespace = "kcp"
+	subsystem = "syncer"
+
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+var (
+	queueDepth = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "queue_depth",
+			Help:           "Number of keys waiting to be processed by a syncer controller, including the ones waiting for a retry, per resource.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"controller", "resource"},
+	)
+
+	processingDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "processing_duration_seconds",
+			Help:           "Duration of the processing of a key by a syncer controller, per resource and result.",
+			Buckets:        metrics.ExponentialBuckets(0.001, 2, 15),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"controller", "resource", "result"},
+	)
+
+	writeErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "write_errors_total",
+			Help:           "Number of failed writes by a syncer controller, upstream or downstream, per resource and verb.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"controller", "resource", "verb"},
+	)
+
+	finalizerUpdates = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "finalizer_updates_total",
+			Help:           "Number of additions and removals of the syncer finalizer on upstream objects, per resource and result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "operation", "result"},
+	)
+
+	drifts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "drifts_total",
+			Help:           "Number of downstream objects found changed outside of the syncer, per resource and action (reverted, preserved, or blocked when preserved changes conflict with upstream changes).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource", "action"},
+	)
+
+	heartbeats = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "heartbeats_total",
+			Help:           "Number of heartbeats sent to the SyncTarget, per result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	apiImportPolls = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "api_import_polls_total",
+			Help:           "Number of polls of the physical cluster APIs by the API importer, per result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	orphans = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "orphans",
+			Help:           "Number of orphaned downstream objects found by the last orphan sweep, per SyncTarget, resource and action (deleted or reported).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"sync_target", "resource", "action"},
+	)
+	orphansLock sync.Mutex
+	// orphansLabels holds the label values of the orphans series recorded by the last sweep of each SyncTarget.
+	orphansLabels = map[string][]map[string]string{}
+
+	credentialRotations = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "credential_rotations_total",
+			Help:           "Number of rotations of the short-lived upstream tokens, per result.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	credentialExpiration = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "credential_expiration_timestamp_seconds",
+			Help:           "Expiration time, in seconds since the epoch, of the last short-lived upstream token issued, per SyncTarget.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"sync_target"},
+	)
+
+	apiImportResources = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "api_import_resources",
+			Help:           "Number of resources imported by the last successful poll of the API importer.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+)
+
+func init() {
+	for _, m := range []metrics.Registerable{
+		queueDepth,
+		processingDuration,
+		writeErrors,
+		finalizerUpdates,
+		drifts,
+		heartbeats,
+		apiImportPolls,
+		apiImportResources,
+		orphans,
+		credentialRotations,
+		credentialExpiration,
+	} {
+		legacyregistry.MustRegister(m)
+	}
+}
+
+// Handler returns the HTTP handler serving the syncer metrics.
+func Handler() http.Handler {
+	return legacyregistry.Handler()
+}
+
+// ObserveProcessing records the processing of a key of the given resource by a controller,
+// started at the given time. The error, if any, is kept as the last error of the key until
+// the key is forgotten by the controller queue.
+func ObserveProcessing(controller string, gvr schema.GroupVersionResource, key interface{}, start time.Time, err error) {
+	processingDuration.WithLabelValues(controller, resourceLabel(gvr), result(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		recordKeyError(controller, key, err)
+	}
+}
+
+// RecordWriteError records a failed write of the given resource by a controller, with the given verb,
+// e.g. apply, create, update or delete.
+func RecordWriteError(controller string, gvr schema.GroupVersionResource, verb string) {
+	writeErrors.WithLabelValues(controller, resourceLabel(gvr), verb).Inc()
+}
+
+// RecordFinalizerAdded records the addition of the syncer finalizer to an upstream object.
+func RecordFinalizerAdded(gvr schema.GroupVersionResource, err error) {
+	finalizerUpdates.WithLabelValues(resourceLabel(gvr), "add", result(err)).Inc()
+}
+
+// RecordFinalizerRemoved records the removal of the syncer finalizer from an upstream object.
+func RecordFinalizerRemoved(gvr schema.GroupVersionResource, err error) {
+	finalizerUpdates.WithLabelValues(resourceLabel(gvr), "remove", result(err)).Inc()
+}
+
+// RecordDrift records a downstream object found changed outside of the syncer, and whether
+// the change is reverted or preserved.
+func RecordDrift(gvr schema.GroupVersionResource, reverted bool) {
+	action := "preserved"
+	if reverted {
+		action = "reverted"
+	}
+	drifts.WithLabelValues(resourceLabel(gvr), action).Inc()
+}
+
+// RecordDriftBlocked records upstream changes to a downstream object not applied because they conflict
+// with changes preserved downstream.
+func RecordDriftBlocked(gvr schema.GroupVersionResource) {
+	drifts.WithLabelValues(resourceLabel(gvr), "blocked").Inc()
+}
+
+// RecordHeartbeat records a heartbeat attempt.
+func RecordHeartbeat(err error) {
+	heartbeats.WithLabelValues(result(err)).Inc()
+}
+
+// RecordAPIImportPoll records a poll of the API importer, and the number of resources it imported.
+func RecordAPIImportPoll(importedResources int, err error) {
+	apiImportPolls.WithLabelValues(result(err)).Inc()
+	if err == nil {
+		apiImportResources.Set(float64(importedResources))
+	}
+}
+
+// RecordOrphans records the number of orphaned downstream objects found by an orphan sweep of a SyncTarget, per
+// resource, replacing the numbers recorded by the previous sweep of the same SyncTarget. The action is either deleted
+// or reported.
+func RecordOrphans(syncTarget string, counts map[schema.GroupVersionResource]int, action string) {
+	orphansLock.Lock()
+	defer orphansLock.Unlock()
+
+	for _, labels := range orphansLabels[syncTarget] {
+		orphans.Delete(labels)
+	}
+	recorded := make([]map[string]string, 0, len(counts))
+	for gvr, count := range counts {
+		labels := map[string]string{"sync_target": syncTarget, "resource": resourceLabel(gvr), "action": action}
+		orphans.With(labels).Set(float64(count))
+		recorded = append(recorded, labels)
+	}
+	orphansLabels[syncTarget] = recorded
+}
+
+// RecordCredentialRotation records a rotation of the short-lived upstream token of a SyncTarget, and the
+// expiration of the issued token.
+func RecordCredentialRotation(syncTarget string, expiration time.Time, err error) {
+	credentialRotations.WithLabelValues(result(err)).Inc()
+	if err == nil {
+		credentialExpiration.WithLabelValues(syncTarget).Set(float64(expiration.Unix()))
+	}
+}
+
+// SyncTargetLabel returns the value of the sync_target label of the metrics of a SyncTarget.
+func SyncTargetLabel(syncTargetWorkspace logicalcluster.Name, syncTargetName string) string {
+	return syncTargetWorkspace.String() + "|" + syncTargetName
+}
+
+func resourceLabel(gvr schema.GroupVersionResource) string {
+	return gvr.GroupResource().String()
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+	return resultSuccess
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// gauges returns the values of the series of the gauge, keyed by the values of the given labels joined with "|".
+func gauges(t *testing.T, name string, labels ...string) map[string]float64 {
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labelValues := map[string]string{}
+			for _, pair := range m.GetLabel() {
+				labelValues[pair.GetName()] = pair.GetValue()
+			}
+			key := ""
+			for i, label := range labels {
+				if i > 0 {
+					key += "|"
+				}
+				key += labelValues[label]
+			}
+			values[key] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestRecordOrphans(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	RecordOrphans("east", map[schema.GroupVersionResource]int{deployments: 2, secrets: 1}, "deleted")
+	RecordOrphans("west", map[schema.GroupVersionResource]int{secrets: 3}, "reported")
+	require.Equal(t, map[string]float64{
+		"east|deployments.apps|deleted": 2,
+		"east|secrets|deleted":          1,
+		"west|secrets|reported":         3,
+	}, gauges(t, "kcp_syncer_orphans", "sync_target", "resource", "action"))
+
+	RecordOrphans("east", map[schema.GroupVersionResource]int{secrets: 4}, "deleted")
+	require.Equal(t, map[string]float64{
+		"east|secrets|deleted":  4,
+		"west|secrets|reported": 3,
+	}, gauges(t, "kcp_syncer_orphans", "sync_target", "resource", "action"), "a sweep should only replace the numbers of its SyncTarget")
+}
+
+func TestRecordCredentialRotation(t *testing.T) {
+	east := time.Date(2022, 9, 1, 13, 0, 0, 0, time.UTC)
+	west := time.Date(2022, 9, 1, 12, 30, 0, 0, time.UTC)
+
+	RecordCredentialRotation("east", east, nil)
+	RecordCredentialRotation("west", west, nil)
+	RecordCredentialRotation("east", time.Time{}, errors.New("forbidden"))
+	require.Equal(t, map[string]float64{
+		"east": float64(east.Unix()),
+		"west": float64(west.Unix()),
+	}, gauges(t, "kcp_syncer_credential_expiration_timestamp_seconds", "sync_target"), "each SyncTarget should keep the expiration of its last issued token")
+}
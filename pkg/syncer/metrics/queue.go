@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// NewQueue wraps a controller queue to report its depth per resource. The workqueue
+// metrics only report the depth of the whole queue, which holds keys of all the synced
+// resources in the spec and status syncers. The queue is listed by DumpQueues until it
+// is shut down.
+func NewQueue(controller string, queue workqueue.RateLimitingInterface, gvrOf func(item interface{}) schema.GroupVersionResource) workqueue.RateLimitingInterface {
+	q := &queueWithDepth{
+		RateLimitingInterface: queue,
+		controller:            controller,
+		gvrOf:                 gvrOf,
+		pending:               map[interface{}]bool{},
+	}
+	registerQueue(q)
+	return q
+}
+
+// queueWithDepth tracks the items added to the queue until they are picked up by a worker.
+// Items added for a later retry are counted as soon as they are added.
+type queueWithDepth struct {
+	workqueue.RateLimitingInterface
+
+	controller string
+	gvrOf      func(item interface{}) schema.GroupVersionResource
+
+	lock    sync.Mutex
+	pending map[interface{}]bool
+}
+
+func (q *queueWithDepth) Add(item interface{}) {
+	q.markPending(item)
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *queueWithDepth) AddAfter(item interface{}, duration time.Duration) {
+	q.markPending(item)
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *queueWithDepth) AddRateLimited(item interface{}) {
+	q.markPending(item)
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+func (q *queueWithDepth) Get() (interface{}, bool) {
+	item, shutdown := q.RateLimitingInterface.Get()
+	if !shutdown {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		if q.pending[item] {
+			delete(q.pending, item)
+			queueDepth.WithLabelValues(q.controller, resourceLabel(q.gvrOf(item))).Dec()
+		}
+	}
+	return item, shutdown
+}
+
+// Forget also forgets the last processing error of the item.
+func (q *queueWithDepth) Forget(item interface{}) {
+	forgetKeyError(q.controller, item)
+	q.RateLimitingInterface.Forget(item)
+}
+
+func (q *queueWithDepth) pendingKeys() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	keys := make([]string, 0, len(q.pending))
+	for item := range q.pending {
+		keys = append(keys, keyString(item))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (q *queueWithDepth) markPending(item interface{}) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.pending[item] {
+		q.pending[item] = true
+		queueDepth.WithLabelValues(q.controller, resourceLabel(q.gvrOf(item))).Inc()
+	}
+}
+
+func (q *queueWithDepth) ShutDown() {
+	q.lock.Lock()
+	for item := range q.pending {
+		queueDepth.WithLabelValues(q.controller, resourceLabel(q.gvrOf(item))).Dec()
+	}
+	q.pending = map[interface{}]bool{}
+	q.lock.Unlock()
+	unregisterQueue(q)
+
+	q.RateLimitingInterface.ShutDown()
+}
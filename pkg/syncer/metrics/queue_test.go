@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestQueueDepth(t *testing.T) {
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	type item struct {
+		gvr schema.GroupVersionResource
+		key string
+	}
+	queue := NewQueue("test-controller", workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), func(i interface{}) schema.GroupVersionResource {
+		return i.(item).gvr
+	})
+
+	depth := func(gvr schema.GroupVersionResource) float64 {
+		value, err := testutil.GetGaugeMetricValue(queueDepth.WithLabelValues("test-controller", resourceLabel(gvr)))
+		require.NoError(t, err)
+		return value
+	}
+
+	queue.Add(item{deployments, "a"})
+	queue.Add(item{deployments, "a"})
+	queue.Add(item{deployments, "b"})
+	queue.Add(item{secrets, "c"})
+	require.Equal(t, float64(2), depth(deployments), "duplicate keys should be counted once")
+	require.Equal(t, float64(1), depth(secrets))
+
+	i, _ := queue.Get()
+	require.Equal(t, item{deployments, "a"}, i)
+	require.Equal(t, float64(1), depth(deployments))
+
+	queue.AddRateLimited(i)
+	queue.Done(i)
+	require.Equal(t, float64(2), depth(deployments), "keys waiting for a retry should be counted")
+
+	queue.ShutDown()
+	require.Equal(t, float64(0), depth(deployments))
+	require.Equal(t, float64(0), depth(secrets))
+}
@@ -18,6 +18,7 @@ package namespace
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/kcp-dev/logicalcluster/v2"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -33,25 +35,36 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clusters"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/third_party/keyfunctions"
 )
 
 const (
 	controllerNameRoot       = "kcp-workload-syncer-namespace"
 	downstreamControllerName = controllerNameRoot + "-downstream"
+
+	syncerApplyManager = "syncer"
 )
 
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
 type DownstreamController struct {
 	queue workqueue.RateLimitingInterface
 
 	deleteDownstreamNamespace func(ctx context.Context, namespace string) error
 	upstreamNamespaceExists   func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error)
 	getDownstreamNamespace    func(name string) (runtime.Object, error)
+	patchDownstreamNamespace  func(ctx context.Context, name string, patch []byte) error
+
+	networkIsolation    func() *workloadv1alpha1.NetworkIsolation
+	applyNetworkPolicy  func(ctx context.Context, policy *unstructured.Unstructured) error
+	deleteNetworkPolicy func(ctx context.Context, namespace string) error
 
 	syncTargetName      string
 	syncTargetWorkspace logicalcluster.Name
@@ -64,25 +77,41 @@ func NewDownstreamController(
 	syncTargetName, syncTargetKey string,
 	syncTargetUID types.UID,
 	downstreamClient dynamic.Interface,
-	upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory,
+	upstreamNamespaceExists func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error),
+	networkIsolation func() *workloadv1alpha1.NetworkIsolation,
+	downstreamInformers dynamicinformer.DynamicSharedInformerFactory,
 ) (*DownstreamController, error) {
-	namespaceGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
 	logger := logging.WithReconciler(klog.Background(), downstreamControllerName)
 
 	c := DownstreamController{
-		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), downstreamControllerName),
+		queue: syncermetrics.NewQueue(downstreamControllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), downstreamControllerName), func(interface{}) schema.GroupVersionResource {
+			return namespaceGVR
+		}),
 
 		deleteDownstreamNamespace: func(ctx context.Context, namespace string) error {
 			return downstreamClient.Resource(namespaceGVR).Delete(ctx, namespace, metav1.DeleteOptions{})
 		},
-		upstreamNamespaceExists: func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error) {
-			upstreamNamespaceKey := clusters.ToClusterAwareKey(clusterName, upstreamNamespaceName)
-			_, exists, err := upstreamInformers.ForResource(namespaceGVR).Informer().GetIndexer().GetByKey(upstreamNamespaceKey)
-			return exists, err
-		},
+		upstreamNamespaceExists: upstreamNamespaceExists,
 		getDownstreamNamespace: func(downstreamNamespaceName string) (runtime.Object, error) {
 			return downstreamInformers.ForResource(namespaceGVR).Lister().Get(downstreamNamespaceName)
 		},
+		patchDownstreamNamespace: func(ctx context.Context, name string, patch []byte) error {
+			_, err := downstreamClient.Resource(namespaceGVR).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		},
+
+		networkIsolation: networkIsolation,
+		applyNetworkPolicy: func(ctx context.Context, policy *unstructured.Unstructured) error {
+			data, err := json.Marshal(policy)
+			if err != nil {
+				return err
+			}
+			_, err = downstreamClient.Resource(networkPolicyGVR).Namespace(policy.GetNamespace()).Patch(ctx, policy.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true)})
+			return err
+		},
+		deleteNetworkPolicy: func(ctx context.Context, namespace string) error {
+			return downstreamClient.Resource(networkPolicyGVR).Namespace(namespace).Delete(ctx, networkPolicyName, metav1.DeleteOptions{})
+		},
 
 		syncTargetName:      syncTargetName,
 		syncTargetWorkspace: syncTargetWorkspace,
@@ -156,7 +185,10 @@ func (c *DownstreamController) processNextWorkItem(ctx context.Context) bool {
 	// other workers.
 	defer c.queue.Done(key)
 
-	if err := c.process(ctx, namespaceKey); err != nil {
+	start := time.Now()
+	err := c.process(ctx, namespaceKey)
+	syncermetrics.ObserveProcessing(downstreamControllerName, namespaceGVR, key, start, err)
+	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", downstreamControllerName, key, err))
 		c.queue.AddRateLimited(key)
 		return true
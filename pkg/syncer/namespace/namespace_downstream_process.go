@@ -25,7 +25,9 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
@@ -49,6 +51,12 @@ func (c *DownstreamController) process(ctx context.Context, key string) error {
 	downstreamNamespace := downstreamNamespaceObj.(*unstructured.Unstructured)
 	logger = logging.WithObject(logger, downstreamNamespace)
 
+	if _, adopting := downstreamNamespace.GetLabels()[workloadv1alpha1.AdoptionLabel]; adopting {
+		// The upstream namespace might not be created yet.
+		logger.V(4).Info("downstream namespace is being adopted, ignoring it")
+		return nil
+	}
+
 	namespaceLocatorJSON := downstreamNamespace.GetAnnotations()[shared.NamespaceLocatorAnnotation]
 	if namespaceLocatorJSON == "" {
 		logger.Error(nil, "downstream namespace has no namespaceLocator annotation")
@@ -68,8 +76,71 @@ func (c *DownstreamController) process(ctx context.Context, key string) error {
 	}
 	if !exists {
 		logger.Info("deleting downstream namespace because the upstream namespace doesn't exist")
-		return c.deleteDownstreamNamespace(ctx, namespaceName)
+		if err := c.deleteDownstreamNamespace(ctx, namespaceName); err != nil {
+			syncermetrics.RecordWriteError(downstreamControllerName, namespaceGVR, "delete")
+			return err
+		}
+		return nil
+	}
+	// The upstream namespace still exists.
+	return c.ensureNetworkIsolation(ctx, downstreamNamespace, nsLocator)
+}
+
+// ensureNetworkIsolation creates or updates the NetworkPolicy of the downstream namespace, and labels it with its
+// workspace, when network isolation is enabled on the SyncTarget. It removes both otherwise. The workspace label
+// marks the namespaces the syncer manages a NetworkPolicy in.
+func (c *DownstreamController) ensureNetworkIsolation(ctx context.Context, downstreamNamespace *unstructured.Unstructured, nsLocator shared.NamespaceLocator) error {
+	logger := klog.FromContext(ctx)
+
+	var isolation *workloadv1alpha1.NetworkIsolation
+	if c.networkIsolation != nil {
+		isolation = c.networkIsolation()
+	}
+	labelValue, isolated := downstreamNamespace.GetLabels()[workloadv1alpha1.InternalDownstreamWorkspaceLabel]
+
+	if isolation == nil {
+		if !isolated {
+			return nil
+		}
+		logger.Info("removing the network isolation of the downstream namespace")
+		if err := c.deleteNetworkPolicy(ctx, downstreamNamespace.GetName()); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(downstreamControllerName, networkPolicyGVR, "delete")
+			return err
+		}
+		return c.patchWorkspaceLabel(ctx, downstreamNamespace.GetName(), nil)
+	}
+
+	policy, err := networkPolicy(isolation, downstreamNamespace.GetName(), nsLocator)
+	if err != nil {
+		return err
+	}
+	if desired := shared.WorkspaceLabelValue(nsLocator.Workspace); labelValue != desired {
+		if err := c.patchWorkspaceLabel(ctx, downstreamNamespace.GetName(), desired); err != nil {
+			return err
+		}
+	}
+	if err := c.applyNetworkPolicy(ctx, policy); err != nil {
+		syncermetrics.RecordWriteError(downstreamControllerName, networkPolicyGVR, "apply")
+		return err
+	}
+	logger.V(4).Info("applied the network policy of the downstream namespace")
+	return nil
+}
+
+func (c *DownstreamController) patchWorkspaceLabel(ctx context.Context, namespace string, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				workloadv1alpha1.InternalDownstreamWorkspaceLabel: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.patchDownstreamNamespace(ctx, namespace, patch); err != nil {
+		syncermetrics.RecordWriteError(downstreamControllerName, namespaceGVR, "patch")
+		return err
 	}
-	// The upstream namespace still exists, nothing to do.
 	return nil
 }
@@ -41,6 +41,7 @@ func TestSyncerNamespaceProcess(t *testing.T) {
 	tests := map[string]struct {
 		upstreamNamespaceExists bool
 		deletedNamespace        string
+		adopting                bool
 
 		upstreamNamespaceExistsError                    error
 		getDownstreamNamespaceError                     error
@@ -73,6 +74,12 @@ func TestSyncerNamespaceProcess(t *testing.T) {
 			deletedNamespace:            "",
 			eventOrigin:                 "downstream",
 		},
+		"NamespaceSyncer, downstream event, no matching upstream namespace but the namespace is being adopted, expect no namespace deletion": {
+			upstreamNamespaceExists: false,
+			adopting:                true,
+			deletedNamespace:        "",
+			eventOrigin:             "downstream",
+		},
 	}
 
 	for name, tc := range tests {
@@ -88,6 +95,9 @@ func TestSyncerNamespaceProcess(t *testing.T) {
 			syncTargetWorkspace := logicalcluster.New("root:org:ws")
 			syncTargetName := "us-west1"
 			syncTargetKey := workloadv1alpha1.ToSyncTargetKey(syncTargetWorkspace, syncTargetName)
+			if tc.adopting {
+				downstreamNamespace.Labels[workloadv1alpha1.AdoptionLabel] = syncTargetKey
+			}
 			deletedNamespace := ""
 
 			nsController := DownstreamController{
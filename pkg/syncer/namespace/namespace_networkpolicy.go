@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	// networkPolicyName is the name of the NetworkPolicy isolating the downstream namespaces.
+	networkPolicyName = "kcp-network-isolation"
+
+	// defaultNetworkPolicyTemplate allows the ingress traffic from the namespaces synced from the same workspace only.
+	defaultNetworkPolicyTemplate = `
+podSelector: {}
+policyTypes:
+- Ingress
+ingress:
+- from:
+  - namespaceSelector:
+      matchLabels:
+        {{.WorkspaceLabel}}: {{.WorkspaceLabelValue}}
+`
+)
+
+var networkPolicyGVR = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}
+
+// networkPolicy returns the NetworkPolicy isolating the downstream namespace synced from the upstream namespace
+// of the namespace locator, from the policy template of the SyncTarget.
+func networkPolicy(isolation *workloadv1alpha1.NetworkIsolation, downstreamNamespace string, l shared.NamespaceLocator) (*unstructured.Unstructured, error) {
+	policyTemplate := isolation.PolicyTemplate
+	if policyTemplate == "" {
+		policyTemplate = defaultNetworkPolicyTemplate
+	}
+	tmpl, err := template.New("networkpolicy").Option("missingkey=error").Parse(policyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network policy template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{
+		"Workspace":           l.Workspace.String(),
+		"Namespace":           l.Namespace,
+		"SyncTargetName":      l.SyncTarget.Name,
+		"WorkspaceLabel":      workloadv1alpha1.InternalDownstreamWorkspaceLabel,
+		"WorkspaceLabelValue": shared.WorkspaceLabelValue(l.Workspace),
+	}); err != nil {
+		return nil, fmt.Errorf("invalid network policy template: %w", err)
+	}
+
+	var spec networkingv1.NetworkPolicySpec
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &spec); err != nil {
+		return nil, fmt.Errorf("invalid network policy template: %w", err)
+	}
+	policy := &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      networkPolicyName,
+			Namespace: downstreamNamespace,
+		},
+		Spec: spec,
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	locator := shared.NewNamespaceLocator(logicalcluster.New("root:org:ws"), logicalcluster.New("root:org"), "syncTargetUID", "us-west1", "test")
+	workspaceLabelValue := shared.WorkspaceLabelValue(logicalcluster.New("root:org:ws"))
+
+	tests := map[string]struct {
+		template string
+		wantSpec map[string]interface{}
+		wantErr  bool
+	}{
+		"default template": {
+			wantSpec: map[string]interface{}{
+				"podSelector": map[string]interface{}{},
+				"policyTypes": []interface{}{"Ingress"},
+				"ingress": []interface{}{
+					map[string]interface{}{
+						"from": []interface{}{
+							map[string]interface{}{
+								"namespaceSelector": map[string]interface{}{
+									"matchLabels": map[string]interface{}{
+										workloadv1alpha1.InternalDownstreamWorkspaceLabel: workspaceLabelValue,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"custom template": {
+			template: `
+podSelector:
+  matchLabels:
+    app: {{.Namespace}}
+policyTypes:
+- Egress
+`,
+			wantSpec: map[string]interface{}{
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"app": "test"},
+				},
+				"policyTypes": []interface{}{"Egress"},
+			},
+		},
+		"template with an unknown field": {
+			template: `podSelectr: {}`,
+			wantErr:  true,
+		},
+		"template with an unknown key": {
+			template: `podSelector: {matchLabels: {app: {{.Unknown}}}}`,
+			wantErr:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			policy, err := networkPolicy(&workloadv1alpha1.NetworkIsolation{PolicyTemplate: tc.template}, "kcp-hcbsa8z6c2er", locator)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "networking.k8s.io/v1", policy.GetAPIVersion())
+			require.Equal(t, "NetworkPolicy", policy.GetKind())
+			require.Equal(t, networkPolicyName, policy.GetName())
+			require.Equal(t, "kcp-hcbsa8z6c2er", policy.GetNamespace())
+			require.Equal(t, tc.wantSpec, policy.Object["spec"])
+		})
+	}
+}
+
+func TestNetworkIsolation(t *testing.T) {
+	workspaceLabelValue := shared.WorkspaceLabelValue(logicalcluster.New("root:org:ws"))
+
+	tests := map[string]struct {
+		isolation       *workloadv1alpha1.NetworkIsolation
+		namespaceLabels map[string]string
+
+		wantLabelPatch    string
+		wantAppliedPolicy bool
+		wantDeletedPolicy bool
+	}{
+		"isolation disabled, namespace not isolated, expect nothing": {},
+		"isolation enabled, namespace not isolated, expect the label and the policy": {
+			isolation:         &workloadv1alpha1.NetworkIsolation{},
+			wantLabelPatch:    `{"metadata":{"labels":{"internal.workload.kcp.dev/workspace":"` + workspaceLabelValue + `"}}}`,
+			wantAppliedPolicy: true,
+		},
+		"isolation enabled, namespace isolated, expect the policy only": {
+			isolation:         &workloadv1alpha1.NetworkIsolation{},
+			namespaceLabels:   map[string]string{workloadv1alpha1.InternalDownstreamWorkspaceLabel: workspaceLabelValue},
+			wantAppliedPolicy: true,
+		},
+		"isolation disabled, namespace isolated, expect the label and the policy removed": {
+			namespaceLabels:   map[string]string{workloadv1alpha1.InternalDownstreamWorkspaceLabel: workspaceLabelValue},
+			wantLabelPatch:    `{"metadata":{"labels":{"internal.workload.kcp.dev/workspace":null}}}`,
+			wantDeletedPolicy: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			labels := map[string]string{
+				"internal.workload.kcp.dev/cluster": "2gzO8uuQmIoZ2FE95zoOPKtrtGGXzzjAvtl6q5",
+			}
+			for k, v := range tc.namespaceLabels {
+				labels[k] = v
+			}
+			downstreamNamespace := namespace(logicalcluster.New(""), "kcp-hcbsa8z6c2er", labels, map[string]string{
+				"kcp.dev/namespace-locator": `{"syncTarget":{"workspace":"root:org","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+			})
+
+			var labelPatch string
+			var appliedPolicy *unstructured.Unstructured
+			deletedPolicy := false
+			c := DownstreamController{
+				upstreamNamespaceExists: func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error) {
+					return true, nil
+				},
+				getDownstreamNamespace: func(name string) (runtime.Object, error) {
+					nsJSON, _ := json.Marshal(downstreamNamespace)
+					unstructured := &unstructured.Unstructured{}
+					_ = json.Unmarshal(nsJSON, unstructured)
+					return unstructured, nil
+				},
+				patchDownstreamNamespace: func(ctx context.Context, name string, patch []byte) error {
+					labelPatch = string(patch)
+					return nil
+				},
+				networkIsolation: func() *workloadv1alpha1.NetworkIsolation {
+					return tc.isolation
+				},
+				applyNetworkPolicy: func(ctx context.Context, policy *unstructured.Unstructured) error {
+					appliedPolicy = policy
+					return nil
+				},
+				deleteNetworkPolicy: func(ctx context.Context, namespace string) error {
+					deletedPolicy = true
+					return nil
+				},
+			}
+
+			err := c.process(context.Background(), downstreamNamespace.Name)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantLabelPatch, labelPatch)
+			require.Equal(t, tc.wantAppliedPolicy, appliedPolicy != nil)
+			if appliedPolicy != nil {
+				require.Equal(t, "kcp-hcbsa8z6c2er", appliedPolicy.GetNamespace())
+			}
+			require.Equal(t, tc.wantDeletedPolicy, deletedPolicy)
+		})
+	}
+}
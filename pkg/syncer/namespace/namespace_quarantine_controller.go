@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/third_party/keyfunctions"
+)
+
+const (
+	quarantineControllerName = controllerNameRoot + "-quarantine"
+)
+
+var eventsGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "events"}
+
+// QuarantineController handles the downstream namespaces quarantined by the spec syncer after a namespace
+// collision: it reports the collision with an Event on the upstream namespace, and deletes the quarantined
+// namespace once the upstream namespace is deleted. The upstream namespace is read, and the Event written in
+// the Upsync state, through the syncer virtual workspaces.
+type QuarantineController struct {
+	queue workqueue.RateLimitingInterface
+
+	getQuarantinedNamespace   func(name string) (*unstructured.Unstructured, error)
+	deleteDownstreamNamespace func(ctx context.Context, namespace string) error
+	upstreamNamespaceExists   func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error)
+	getUpstreamNamespace      func(ctx context.Context, clusterName logicalcluster.Name, name string) (*unstructured.Unstructured, error)
+	createUpstreamEvent       func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error
+
+	syncTargetName string
+	syncTargetKey  string
+}
+
+func NewQuarantineController(
+	syncTargetName, syncTargetKey string,
+	downstreamClient dynamic.Interface,
+	upstreamNamespaceExists func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error),
+	getUpstreamObject func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error),
+	upstreamNamespaceClient func(clusterName logicalcluster.Name, namespace string) (dynamic.Interface, error),
+	quarantinedNamespaceInformers dynamicinformer.DynamicSharedInformerFactory,
+) (*QuarantineController, error) {
+	logger := logging.WithReconciler(klog.Background(), quarantineControllerName)
+
+	c := QuarantineController{
+		queue: syncermetrics.NewQueue(quarantineControllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), quarantineControllerName), func(interface{}) schema.GroupVersionResource {
+			return namespaceGVR
+		}),
+
+		getQuarantinedNamespace: func(name string) (*unstructured.Unstructured, error) {
+			obj, err := quarantinedNamespaceInformers.ForResource(namespaceGVR).Lister().Get(name)
+			if err != nil {
+				return nil, err
+			}
+			return obj.(*unstructured.Unstructured), nil
+		},
+		deleteDownstreamNamespace: func(ctx context.Context, namespace string) error {
+			return downstreamClient.Resource(namespaceGVR).Delete(ctx, namespace, metav1.DeleteOptions{})
+		},
+		upstreamNamespaceExists: upstreamNamespaceExists,
+		getUpstreamNamespace: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*unstructured.Unstructured, error) {
+			return getUpstreamObject(ctx, namespaceGVR, clusterName, "", name)
+		},
+		createUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+			client, err := upstreamNamespaceClient(clusterName, event.Namespace)
+			if err != nil {
+				return err
+			}
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+			if err != nil {
+				return err
+			}
+			obj := &unstructured.Unstructured{Object: content}
+			obj.SetAPIVersion("v1")
+			obj.SetKind("Event")
+			_, err = client.Resource(eventsGVR).Namespace(event.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+			return err
+		},
+
+		syncTargetName: syncTargetName,
+		syncTargetKey:  syncTargetKey,
+	}
+
+	quarantinedNamespaceInformers.ForResource(namespaceGVR).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.AddToQueue(obj, logger)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.AddToQueue(newObj, logger)
+		},
+	})
+
+	return &c, nil
+}
+
+func (c *QuarantineController) AddToQueue(obj interface{}, logger logr.Logger) {
+	key, err := keyfunctions.DeletionHandlingMetaNamespaceKeyFunc(obj) // note: this is *not* a cluster-aware key
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	logger.V(4).Info("queueing namespace", "key", key)
+	c.queue.Add(key)
+}
+
+// Start starts N worker processes processing work items.
+func (c *QuarantineController) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := logging.WithReconciler(klog.FromContext(ctx), quarantineControllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// startWorker processes work items until stopCh is closed.
+func (c *QuarantineController) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *QuarantineController) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	namespaceKey := key.(string)
+
+	logger := logging.WithQueueKey(klog.FromContext(ctx), namespaceKey)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(1).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	start := time.Now()
+	err := c.process(ctx, namespaceKey)
+	syncermetrics.ObserveProcessing(quarantineControllerName, namespaceGVR, key, start, err)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", quarantineControllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+
+	return true
+}
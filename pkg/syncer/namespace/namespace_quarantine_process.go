@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	namespaceCollisionEventReason = "NamespaceCollision"
+	quarantineReportingController = "kcp.dev/syncer"
+)
+
+func (c *QuarantineController) process(ctx context.Context, key string) error {
+	logger := klog.FromContext(ctx)
+	_, namespaceName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Error(err, "invalid key")
+		return nil
+	}
+
+	downstreamNamespace, err := c.getQuarantinedNamespace(namespaceName)
+	if apierrors.IsNotFound(err) {
+		logger.V(4).Info("quarantined namespace not found, ignoring key", "namespace", namespaceName)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	logger = logging.WithObject(logger, downstreamNamespace)
+
+	namespaceLocatorJSON := downstreamNamespace.GetAnnotations()[shared.NamespaceLocatorAnnotation]
+	if namespaceLocatorJSON == "" {
+		logger.Error(nil, "quarantined namespace has no namespaceLocator annotation")
+		return nil
+	}
+	nsLocator := shared.NamespaceLocator{}
+	if err := json.Unmarshal([]byte(namespaceLocatorJSON), &nsLocator); err != nil {
+		logger.Error(err, "failed to unmarshal namespace locator", "namespaceLocator", namespaceLocatorJSON)
+		return nil
+	}
+	logger = logger.WithValues("upstreamWorkspace", nsLocator.Workspace, "upstreamNamespace", nsLocator.Namespace)
+
+	exists, err := c.upstreamNamespaceExists(nsLocator.Workspace, nsLocator.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to check if upstream namespace exists")
+		return nil
+	}
+	if !exists {
+		logger.Info("deleting quarantined namespace because the upstream namespace doesn't exist")
+		if err := c.deleteDownstreamNamespace(ctx, namespaceName); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(quarantineControllerName, namespaceGVR, "delete")
+			return err
+		}
+		return nil
+	}
+
+	// The upstream namespace still exists: report the collision on it, once per quarantined namespace.
+	upstreamNamespace, err := c.getUpstreamNamespace(ctx, nsLocator.Workspace, nsLocator.Namespace)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Downstream namespace %s on SyncTarget %s is quarantined", namespaceName, c.syncTargetName)
+	if reason := downstreamNamespace.GetAnnotations()[workloadv1alpha1.QuarantineReasonAnnotation]; reason != "" {
+		message += ": " + reason
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upstreamNamespace.GetName() + ".quarantined." + namespaceName,
+			Namespace: upstreamNamespace.GetName(),
+			// The syncer virtual workspace only allows creating upsynced objects.
+			Labels: map[string]string{
+				workloadv1alpha1.ClusterResourceStateLabelPrefix + c.syncTargetKey: string(workloadv1alpha1.ResourceStateUpsync),
+			},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       upstreamNamespace.GetName(),
+			UID:        upstreamNamespace.GetUID(),
+		},
+		Reason:              namespaceCollisionEventReason,
+		Message:             message,
+		Type:                corev1.EventTypeWarning,
+		Count:               1,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Source:              corev1.EventSource{Component: quarantineReportingController, Host: c.syncTargetName},
+		ReportingController: quarantineReportingController,
+		ReportingInstance:   c.syncTargetName,
+	}
+	if err := c.createUpstreamEvent(ctx, nsLocator.Workspace, event); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestQuarantineProcess(t *testing.T) {
+	tests := map[string]struct {
+		upstreamNamespaceExists bool
+		eventAlreadyExists      bool
+
+		wantDeletedNamespace string
+		wantEvent            bool
+	}{
+		"the upstream namespace is deleted, expect the quarantined namespace deletion": {
+			upstreamNamespaceExists: false,
+			wantDeletedNamespace:    "kcp-quarantined",
+		},
+		"the upstream namespace exists, expect an event on the upstream namespace": {
+			upstreamNamespaceExists: true,
+			wantEvent:               true,
+		},
+		"the upstream namespace exists and the event was already created, expect no error": {
+			upstreamNamespaceExists: true,
+			eventAlreadyExists:      true,
+			wantEvent:               true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+			quarantinedNamespace := namespace(logicalcluster.New(""), "kcp-quarantined", map[string]string{
+				workloadv1alpha1.QuarantinedNamespaceLabel: syncTargetKey,
+			}, map[string]string{
+				"kcp.dev/namespace-locator":                 `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+				workloadv1alpha1.QuarantineReasonAnnotation: "downstream namespace kcp-winner was created earlier",
+			})
+
+			deletedNamespace := ""
+			var createdEvent *corev1.Event
+			var eventWorkspace logicalcluster.Name
+			c := QuarantineController{
+				getQuarantinedNamespace: func(name string) (*unstructured.Unstructured, error) {
+					if name != quarantinedNamespace.Name {
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, name)
+					}
+					nsJSON, _ := json.Marshal(quarantinedNamespace)
+					unstructured := &unstructured.Unstructured{}
+					_ = json.Unmarshal(nsJSON, unstructured)
+					return unstructured, nil
+				},
+				deleteDownstreamNamespace: func(ctx context.Context, downstreamNamespaceName string) error {
+					deletedNamespace = downstreamNamespaceName
+					return nil
+				},
+				upstreamNamespaceExists: func(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error) {
+					return tc.upstreamNamespaceExists, nil
+				},
+				getUpstreamNamespace: func(ctx context.Context, clusterName logicalcluster.Name, name string) (*unstructured.Unstructured, error) {
+					ns := &unstructured.Unstructured{}
+					ns.SetName(name)
+					ns.SetUID("upstreamUID")
+					return ns, nil
+				},
+				createUpstreamEvent: func(ctx context.Context, clusterName logicalcluster.Name, event *corev1.Event) error {
+					createdEvent = event
+					eventWorkspace = clusterName
+					if tc.eventAlreadyExists {
+						return apierrors.NewAlreadyExists(schema.GroupResource{Resource: "events"}, event.Name)
+					}
+					return nil
+				},
+				syncTargetName: "us-west1",
+				syncTargetKey:  syncTargetKey,
+			}
+
+			err := c.process(ctx, quarantinedNamespace.Name)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantDeletedNamespace, deletedNamespace)
+			if !tc.wantEvent {
+				require.Nil(t, createdEvent)
+				return
+			}
+			require.NotNil(t, createdEvent)
+			require.Equal(t, logicalcluster.New("root:org:ws"), eventWorkspace)
+			require.Equal(t, "test", createdEvent.Namespace)
+			require.Equal(t, "test.quarantined.kcp-quarantined", createdEvent.Name)
+			require.Equal(t, corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "test", UID: "upstreamUID"}, createdEvent.InvolvedObject)
+			require.Equal(t, namespaceCollisionEventReason, createdEvent.Reason)
+			require.Equal(t, map[string]string{workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey: "Upsync"}, createdEvent.Labels)
+			require.Contains(t, createdEvent.Message, "kcp-winner")
+		})
+	}
+}
@@ -41,6 +41,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
@@ -69,11 +70,12 @@ func NewUpstreamController(
 	downstreamClient dynamic.Interface,
 	upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory,
 ) (*UpstreamController, error) {
-	namespaceGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
 	logger := logging.WithReconciler(klog.Background(), upstreamControllerName)
 
 	c := UpstreamController{
-		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), upstreamControllerName),
+		queue: syncermetrics.NewQueue(upstreamControllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), upstreamControllerName), func(interface{}) schema.GroupVersionResource {
+			return namespaceGVR
+		}),
 
 		deleteDownstreamNamespace: func(ctx context.Context, namespace string) error {
 			return downstreamClient.Resource(namespaceGVR).Delete(ctx, namespace, metav1.DeleteOptions{})
@@ -114,7 +116,7 @@ func NewUpstreamController(
 
 	logger.V(2).Info("Set up upstream namespace informer", "syncTargetWorkspace", syncTargetWorkspace, "syncTargetName", syncTargetName, "syncTargetKey", syncTargetKey)
 
-	err := downstreamInformers.ForResource(namespaceGVR).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: indexByNamespaceLocator})
+	err := downstreamInformers.ForResource(namespaceGVR).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: shared.IndexByNamespaceLocator})
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +176,10 @@ func (c *UpstreamController) processNextWorkItem(ctx context.Context) bool {
 	// other workers.
 	defer c.queue.Done(key)
 
-	if err := c.process(ctx, namespaceKey); err != nil {
+	start := time.Now()
+	err := c.process(ctx, namespaceKey)
+	syncermetrics.ObserveProcessing(upstreamControllerName, namespaceGVR, key, start, err)
+	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", upstreamControllerName, key, err))
 		c.queue.AddRateLimited(key)
 		return true
@@ -184,22 +189,3 @@ func (c *UpstreamController) processNextWorkItem(ctx context.Context) bool {
 
 	return true
 }
-
-// indexByNamespaceLocator is a cache.IndexFunc that indexes namespaces by the namespaceLocator annotation.
-func indexByNamespaceLocator(obj interface{}) ([]string, error) {
-	metaObj, ok := obj.(metav1.Object)
-	if !ok {
-		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
-	}
-	if loc, found, err := shared.LocatorFromAnnotations(metaObj.GetAnnotations()); err != nil {
-		return []string{}, fmt.Errorf("failed to get locator from annotations: %w", err)
-	} else if !found {
-		return []string{}, nil
-	} else {
-		bs, err := json.Marshal(loc)
-		if err != nil {
-			return []string{}, fmt.Errorf("failed to marshal locator %#v: %w", loc, err)
-		}
-		return []string{string(bs)}, nil
-	}
-}
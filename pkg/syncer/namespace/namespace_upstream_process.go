@@ -25,6 +25,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/klog/v2"
 
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
@@ -73,5 +74,9 @@ func (c *UpstreamController) process(ctx context.Context, key string) error {
 
 	downstreamNamespaceName := downstreamNamespace.(*unstructured.Unstructured).GetName()
 	logger.V(2).Info("deleting downstream namespace because the upstream namespace doesn't exist", "downstreamNamespace", downstreamNamespaceName, "upstreamWorkspace", clusterName, "upstreamNamespace", namespaceName)
-	return c.deleteDownstreamNamespace(ctx, downstreamNamespaceName)
+	if err := c.deleteDownstreamNamespace(ctx, downstreamNamespaceName); err != nil {
+		syncermetrics.RecordWriteError(upstreamControllerName, namespaceGVR, "delete")
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	sweeperName = "kcp-workload-syncer-orphans"
+)
+
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
+// Sweeper garbage-collects the orphaned downstream objects, i.e. the synced downstream objects whose upstream
+// object was deleted, or removed from the SyncTarget, while the syncer was not watching, e.g. while it was down.
+// The spec syncer only deletes downstream objects on the upstream events it sees, so they would survive otherwise.
+type Sweeper struct {
+	// lock prevents concurrent sweeps.
+	lock sync.Mutex
+
+	syncedResources        func() ([]schema.GroupVersionResource, bool)
+	listDownstreamObjects  func(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error)
+	getDownstreamNamespace func(name string) (*unstructured.Unstructured, error)
+	upstreamObjectExists   func(gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (bool, error)
+	getUpstreamObject      func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error)
+	deleteDownstreamObject func(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error
+
+	mode          shared.OrphanMode
+	syncTarget    string
+	syncTargetKey string
+}
+
+// NewSweeper returns an orphan sweeper. The orphans are deleted, unless mode is OrphanModeReport, in which case
+// they are only logged and counted in the syncer metrics. syncedResources returns the synced resource types,
+// and whether their informers are synced. upstreamObjectExists checks the upstream informers of all the syncer
+// virtual workspaces, and getUpstreamObject gets the upstream object through them.
+func NewSweeper(
+	syncTargetWorkspace logicalcluster.Name,
+	syncTargetName string,
+	syncTargetKey string,
+	mode shared.OrphanMode,
+	downstreamClient dynamic.Interface,
+	downstreamNamespaceInformers dynamicinformer.DynamicSharedInformerFactory,
+	syncedResources func() ([]schema.GroupVersionResource, bool),
+	upstreamObjectExists func(gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (bool, error),
+	getUpstreamObject func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error),
+) *Sweeper {
+	return &Sweeper{
+		syncedResources: syncedResources,
+		listDownstreamObjects: func(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+			list, err := downstreamClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+				LabelSelector: workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return list.Items, nil
+		},
+		getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+			obj, err := downstreamNamespaceInformers.ForResource(namespaceGVR).Lister().Get(name)
+			if err != nil {
+				return nil, err
+			}
+			return obj.(*unstructured.Unstructured), nil
+		},
+		upstreamObjectExists: upstreamObjectExists,
+		getUpstreamObject:    getUpstreamObject,
+		deleteDownstreamObject: func(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+			// The precondition makes sure an object recreated in the meantime is not deleted.
+			uid := obj.GetUID()
+			return downstreamClient.Resource(gvr).Namespace(obj.GetNamespace()).Delete(ctx, obj.GetName(), metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &uid},
+			})
+		},
+
+		mode:          mode,
+		syncTarget:    syncermetrics.SyncTargetLabel(syncTargetWorkspace, syncTargetName),
+		syncTargetKey: syncTargetKey,
+	}
+}
+
+// Sweep lists the synced downstream objects of all the synced resource types, and deletes or reports the ones
+// whose upstream object does not exist anymore. It does nothing while the informers are not synced, or while
+// another sweep is running.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	logger := logging.WithReconciler(klog.FromContext(ctx), sweeperName)
+	ctx = klog.NewContext(ctx, logger)
+
+	if !s.lock.TryLock() {
+		logger.V(4).Info("another orphan sweep is running, skipping")
+		return nil
+	}
+	defer s.lock.Unlock()
+
+	gvrs, synced := s.syncedResources()
+	if !synced {
+		logger.V(4).Info("informers are not synced yet, skipping the orphan sweep")
+		return nil
+	}
+
+	action := "deleted"
+	if s.mode == shared.OrphanModeReport {
+		action = "reported"
+	}
+
+	logger.V(2).Info("sweeping orphaned downstream objects")
+	counts := map[schema.GroupVersionResource]int{}
+	var errs []error
+	for _, gvr := range gvrs {
+		if gvr == namespaceGVR {
+			// The downstream namespaces are garbage-collected by the downstream namespace controller.
+			continue
+		}
+		objs, err := s.listDownstreamObjects(ctx, gvr)
+		if apierrors.IsNotFound(err) {
+			// The resource type is not served downstream, e.g. its CRD is not installed.
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list downstream %s: %w", gvr, err))
+			continue
+		}
+		for i := range objs {
+			obj := &objs[i]
+			orphan, err := s.isOrphan(ctx, gvr, obj)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !orphan {
+				continue
+			}
+			counts[gvr]++
+
+			objLogger := logging.WithObject(logger, obj).WithValues("gvr", gvr)
+			if s.mode == shared.OrphanModeReport {
+				objLogger.Info("found orphaned downstream object, not deleting it in report mode")
+				continue
+			}
+			objLogger.Info("deleting orphaned downstream object")
+			if err := s.deleteDownstreamObject(ctx, gvr, obj); err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				syncermetrics.RecordWriteError(sweeperName, gvr, "delete")
+				errs = append(errs, err)
+			}
+		}
+	}
+	syncermetrics.RecordOrphans(s.syncTarget, counts, action)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// isOrphan checks whether the upstream object of the downstream object does not exist anymore, or is not
+// synced to the SyncTarget anymore. The upstream object is checked in the informers of all the syncer virtual
+// workspaces first, and then through the syncer virtual workspaces, so that a lagging informer doesn't cause a
+// deletion.
+func (s *Sweeper) isOrphan(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) (bool, error) {
+	if obj.GetDeletionTimestamp() != nil {
+		return false, nil
+	}
+	if obj.GetLabels()[workloadv1alpha1.ClusterResourceStateLabelPrefix+s.syncTargetKey] == string(workloadv1alpha1.ResourceStateUpsync) {
+		// Upsynced objects are owned by the SyncTarget cluster.
+		return false, nil
+	}
+
+	if obj.GetNamespace() == "" {
+		// Cluster-scoped objects hold the locator of the workspace they are synced from.
+		locator, found, err := shared.LocatorFromAnnotations(obj.GetAnnotations())
+		if err != nil || !found {
+			// Not an object synced by the syncer.
+			return false, nil //nolint:nilerr
+		}
+		return s.isUpstreamObjectGone(ctx, gvr, locator.Workspace, "", shared.UpstreamClusterScopedName(gvr.GroupResource(), locator.Workspace, obj.GetName()))
+	}
+
+	// Only the objects of the synced namespaces are checked: the namespaces being adopted or quarantined
+	// are left alone.
+	namespace, err := s.getDownstreamNamespace(obj.GetNamespace())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if _, adopting := namespace.GetLabels()[workloadv1alpha1.AdoptionLabel]; adopting {
+		return false, nil
+	}
+	nsLocator, found, err := shared.LocatorFromAnnotations(namespace.GetAnnotations())
+	if err != nil || !found {
+		// Not a namespace synced by the syncer.
+		return false, nil //nolint:nilerr
+	}
+
+	return s.isUpstreamObjectGone(ctx, gvr, nsLocator.Workspace, nsLocator.Namespace, shared.GetUpstreamResourceName(gvr, obj.GetName()))
+}
+
+// isUpstreamObjectGone checks whether the upstream object does not exist anymore, or is not synced to the
+// SyncTarget anymore. Only a NotFound error means the object is gone: any other error, e.g. a Forbidden one,
+// is returned, so that nothing is deleted.
+func (s *Sweeper) isUpstreamObjectGone(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, upstreamName string) (bool, error) {
+	exists, err := s.upstreamObjectExists(gvr, clusterName, namespace, upstreamName)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	upstreamObj, err := s.getUpstreamObject(ctx, gvr, clusterName, namespace, upstreamName)
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	_, assigned := upstreamObj.GetLabels()[workloadv1alpha1.ClusterResourceStateLabelPrefix+s.syncTargetKey]
+	return !assigned, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+var configMapGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
+
+func TestSweep(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	tests := map[string]struct {
+		informersNotSynced    bool
+		mode                  shared.OrphanMode
+		downstreamLabels      map[string]string
+		namespaceLabels       map[string]string
+		namespaceNotFound     bool
+		upstreamInInformer    bool
+		upstreamInformerError error
+		upstreamObject        *unstructured.Unstructured
+		upstreamError         error
+
+		wantDeleted bool
+		wantError   bool
+	}{
+		"upstream object deleted, expect deletion": {
+			wantDeleted: true,
+		},
+		"upstream object deleted in report mode, expect no deletion": {
+			mode: shared.OrphanModeReport,
+		},
+		"upstream object in the informer, expect no deletion": {
+			upstreamInInformer: true,
+		},
+		"upstream object not in the informer yet, but assigned to the sync target, expect no deletion": {
+			upstreamObject: object("test", "cm", map[string]string{stateLabel: "Sync"}),
+		},
+		"upstream object not assigned to the sync target anymore, expect deletion": {
+			upstreamObject: object("test", "cm", nil),
+			wantDeleted:    true,
+		},
+		"upstream informer not synced, expect no deletion and an error": {
+			upstreamInformerError: errors.New("upstream informer is not synced yet"),
+			wantError:             true,
+		},
+		"upstream object not readable, expect no deletion and an error": {
+			upstreamError: apierrors.NewForbidden(configMapGVR.GroupResource(), "cm", errors.New("forbidden")),
+			wantError:     true,
+		},
+		"informers not synced, expect no sweep": {
+			informersNotSynced: true,
+		},
+		"upsynced downstream object, expect no deletion": {
+			downstreamLabels: map[string]string{stateLabel: string(workloadv1alpha1.ResourceStateUpsync)},
+		},
+		"namespace not synced, expect no deletion": {
+			namespaceNotFound: true,
+		},
+		"namespace being adopted, expect no deletion": {
+			namespaceLabels: map[string]string{workloadv1alpha1.AdoptionLabel: syncTargetKey},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			downstreamLabels := map[string]string{workloadv1alpha1.InternalDownstreamClusterLabel: syncTargetKey}
+			for k, v := range tc.downstreamLabels {
+				downstreamLabels[k] = v
+			}
+			downstreamObject := object("kcp-hcbsa8z6c2er", "cm", downstreamLabels)
+			namespace := object("", "kcp-hcbsa8z6c2er", tc.namespaceLabels)
+			namespace.SetAnnotations(map[string]string{
+				shared.NamespaceLocatorAnnotation: `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+			})
+
+			var checkedUpstream string
+			var deleted []string
+			s := &Sweeper{
+				syncedResources: func() ([]schema.GroupVersionResource, bool) {
+					return []schema.GroupVersionResource{namespaceGVR, configMapGVR}, !tc.informersNotSynced
+				},
+				listDownstreamObjects: func(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+					require.Equal(t, configMapGVR, gvr)
+					return []unstructured.Unstructured{*downstreamObject}, nil
+				},
+				getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+					if tc.namespaceNotFound {
+						return nil, apierrors.NewNotFound(namespaceGVR.GroupResource(), name)
+					}
+					return namespace, nil
+				},
+				upstreamObjectExists: func(gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (bool, error) {
+					checkedUpstream = clusterName.String() + "|" + namespace + "/" + name
+					return tc.upstreamInInformer, tc.upstreamInformerError
+				},
+				getUpstreamObject: func(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error) {
+					if tc.upstreamError != nil {
+						return nil, tc.upstreamError
+					}
+					if tc.upstreamObject == nil {
+						return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+					}
+					return tc.upstreamObject, nil
+				},
+				deleteDownstreamObject: func(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+					deleted = append(deleted, obj.GetNamespace()+"/"+obj.GetName())
+					return nil
+				},
+				mode:          tc.mode,
+				syncTargetKey: syncTargetKey,
+			}
+			if s.mode == "" {
+				s.mode = shared.OrphanModeDelete
+			}
+
+			err := s.Sweep(ctx)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.wantDeleted {
+				require.Equal(t, []string{"kcp-hcbsa8z6c2er/cm"}, deleted)
+				require.Equal(t, "root:org:ws|test/cm", checkedUpstream)
+			} else {
+				require.Empty(t, deleted)
+			}
+		})
+	}
+}
+
+func object(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	obj.SetCreationTimestamp(metav1.Now())
+	return obj
+}
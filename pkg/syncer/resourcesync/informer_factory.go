@@ -0,0 +1,262 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcesync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubernetesinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+)
+
+// SyncerInformerFactory is a dynamicinformer.DynamicSharedInformerFactory that allows
+// adding and removing the synced resource types while the syncer is running.
+type SyncerInformerFactory interface {
+	dynamicinformer.DynamicSharedInformerFactory
+
+	// AddEventHandler registers the handler on the informers of all the synced
+	// resource types, including the ones added later with AddGVRs.
+	AddEventHandler(handler informer.GVREventHandler)
+	// AddGVRs adds resource types to the synced resource types. Their informers
+	// are only started by the next call to Start.
+	AddGVRs(gvrs ...schema.GroupVersionResource)
+	// RemoveGVRs removes resource types from the synced resource types, and
+	// stops their informers.
+	RemoveGVRs(gvrs ...schema.GroupVersionResource)
+	// GVRs returns the synced resource types.
+	GVRs() []schema.GroupVersionResource
+	// Has returns whether the resource type is synced.
+	Has(gvr schema.GroupVersionResource) bool
+	// HasSynced returns whether the informer of the resource type is started and
+	// its cache is synced.
+	HasSynced(gvr schema.GroupVersionResource) bool
+	// SyncedInformer returns the informer of a synced resource type. Unlike ForResource,
+	// it returns an error for a resource type that is not synced, e.g. because it was
+	// removed, rather than an informer whose empty cache would look like all the objects
+	// were deleted.
+	SyncedInformer(gvr schema.GroupVersionResource) (kubernetesinformers.GenericInformer, error)
+}
+
+var _ SyncerInformerFactory = (*DynamicInformerFactory)(nil)
+
+// DynamicInformerFactory implements SyncerInformerFactory by using one underlying
+// dynamicinformer.DynamicSharedInformerFactory per resource type, so that the informer
+// of every resource type can be stopped independently.
+type DynamicInformerFactory struct {
+	newFactory func() dynamicinformer.DynamicSharedInformerFactory
+
+	lock      sync.RWMutex
+	handlers  []informer.GVREventHandler
+	factories map[schema.GroupVersionResource]dynamicinformer.DynamicSharedInformerFactory
+	started   map[schema.GroupVersionResource]context.CancelFunc
+	gvrs      map[schema.GroupVersionResource]bool
+	removed   map[schema.GroupVersionResource]bool
+}
+
+// NewDynamicInformerFactory returns a DynamicInformerFactory. newFactory is called
+// for every resource type, and must return a new factory each time.
+func NewDynamicInformerFactory(newFactory func() dynamicinformer.DynamicSharedInformerFactory) *DynamicInformerFactory {
+	return &DynamicInformerFactory{
+		newFactory: newFactory,
+		factories:  map[schema.GroupVersionResource]dynamicinformer.DynamicSharedInformerFactory{},
+		started:    map[schema.GroupVersionResource]context.CancelFunc{},
+		gvrs:       map[schema.GroupVersionResource]bool{},
+		removed:    map[schema.GroupVersionResource]bool{},
+	}
+}
+
+// ForResource returns the GenericInformer for gvr, creating it if needed. It is not
+// started until the next call to Start. The informer of a resource type removed with
+// RemoveGVRs, and not added back, is never started, use SyncedInformer for the
+// synced resource types.
+func (f *DynamicInformerFactory) ForResource(gvr schema.GroupVersionResource) kubernetesinformers.GenericInformer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.forResourceLockHeld(gvr)
+}
+
+func (f *DynamicInformerFactory) forResourceLockHeld(gvr schema.GroupVersionResource) kubernetesinformers.GenericInformer {
+	factory, ok := f.factories[gvr]
+	if !ok {
+		factory = f.newFactory()
+		if f.removed[gvr] {
+			// Don't keep it, so that the next call to Start doesn't start an informer nothing stops.
+			klog.V(2).InfoS("Informer requested for a removed resource type, it is not started", "gvr", gvr.String())
+			return factory.ForResource(gvr)
+		}
+		f.factories[gvr] = factory
+	}
+	return factory.ForResource(gvr)
+}
+
+func (f *DynamicInformerFactory) SyncedInformer(gvr schema.GroupVersionResource) (kubernetesinformers.GenericInformer, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if !f.gvrs[gvr] {
+		return nil, fmt.Errorf("resource type %s is not synced", gvr)
+	}
+	return f.forResourceLockHeld(gvr), nil
+}
+
+// Start starts the informers that are not started yet. They are stopped when stopCh
+// is closed, or when their resource type is removed.
+func (f *DynamicInformerFactory) Start(stopCh <-chan struct{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for gvr, factory := range f.factories {
+		if _, ok := f.started[gvr]; ok {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-stopCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		factory.Start(ctx.Done())
+		f.started[gvr] = cancel
+	}
+}
+
+// WaitForCacheSync waits for all started informers' cache to be synced.
+func (f *DynamicInformerFactory) WaitForCacheSync(stopCh <-chan struct{}) map[schema.GroupVersionResource]bool {
+	f.lock.RLock()
+	factories := make([]dynamicinformer.DynamicSharedInformerFactory, 0, len(f.factories))
+	for _, factory := range f.factories {
+		factories = append(factories, factory)
+	}
+	f.lock.RUnlock()
+
+	res := map[schema.GroupVersionResource]bool{}
+	for _, factory := range factories {
+		for gvr, synced := range factory.WaitForCacheSync(stopCh) {
+			res[gvr] = synced
+		}
+	}
+	return res
+}
+
+func (f *DynamicInformerFactory) AddEventHandler(handler informer.GVREventHandler) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.handlers = append(f.handlers, handler)
+	for gvr := range f.gvrs {
+		f.forResourceLockHeld(gvr).Informer().AddEventHandler(toResourceEventHandler(gvr, handler))
+	}
+}
+
+func (f *DynamicInformerFactory) AddGVRs(gvrs ...schema.GroupVersionResource) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, gvr := range gvrs {
+		if f.gvrs[gvr] {
+			continue
+		}
+		klog.V(2).InfoS("Adding informer", "gvr", gvr.String())
+
+		f.gvrs[gvr] = true
+		delete(f.removed, gvr)
+		inf := f.forResourceLockHeld(gvr).Informer()
+		for _, handler := range f.handlers {
+			inf.AddEventHandler(toResourceEventHandler(gvr, handler))
+		}
+	}
+}
+
+func (f *DynamicInformerFactory) RemoveGVRs(gvrs ...schema.GroupVersionResource) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, gvr := range gvrs {
+		if !f.gvrs[gvr] {
+			continue
+		}
+		klog.V(2).InfoS("Removing informer", "gvr", gvr.String())
+
+		if cancel, ok := f.started[gvr]; ok {
+			cancel()
+		}
+		delete(f.started, gvr)
+		delete(f.factories, gvr)
+		delete(f.gvrs, gvr)
+		f.removed[gvr] = true
+	}
+}
+
+func (f *DynamicInformerFactory) GVRs() []schema.GroupVersionResource {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	gvrs := make([]schema.GroupVersionResource, 0, len(f.gvrs))
+	for gvr := range f.gvrs {
+		gvrs = append(gvrs, gvr)
+	}
+	sort.Slice(gvrs, func(i, j int) bool {
+		return gvrs[i].String() < gvrs[j].String()
+	})
+	return gvrs
+}
+
+func (f *DynamicInformerFactory) Has(gvr schema.GroupVersionResource) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.gvrs[gvr]
+}
+
+func toResourceEventHandler(gvr schema.GroupVersionResource, handler informer.GVREventHandler) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handler.OnAdd(gvr, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			handler.OnUpdate(gvr, oldObj, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			handler.OnDelete(gvr, obj)
+		},
+	}
+}
+
+func (f *DynamicInformerFactory) HasSynced(gvr schema.GroupVersionResource) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if !f.gvrs[gvr] {
+		return false
+	}
+	if _, ok := f.started[gvr]; !ok {
+		return false
+	}
+	return f.factories[gvr].ForResource(gvr).Informer().HasSynced()
+}
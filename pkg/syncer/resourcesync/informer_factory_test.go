@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcesync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+)
+
+func TestDynamicInformerFactory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configMapsGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretsGVR := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	newObject := func(kind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind(kind)
+		obj.SetNamespace("test")
+		obj.SetName(name)
+		return obj
+	}
+
+	scheme := runtime.NewScheme()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		configMapsGVR: "ConfigMapList",
+		secretsGVR:    "SecretList",
+	}, newObject("ConfigMap", "cm"), newObject("Secret", "secret"))
+
+	factory := NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+		return dynamicinformer.NewDynamicSharedInformerFactory(client, time.Hour)
+	})
+
+	var lock sync.Mutex
+	added := map[schema.GroupVersionResource][]string{}
+	factory.AddEventHandler(informer.GVREventHandlerFuncs{
+		AddFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			lock.Lock()
+			defer lock.Unlock()
+			added[gvr] = append(added[gvr], obj.(metav1.Object).GetName())
+		},
+	})
+	addedFor := func(gvr schema.GroupVersionResource) []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return added[gvr]
+	}
+
+	factory.AddGVRs(configMapsGVR)
+	require.False(t, factory.HasSynced(configMapsGVR), "informer should not be synced before being started")
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	require.True(t, factory.Has(configMapsGVR))
+	require.True(t, factory.HasSynced(configMapsGVR))
+	require.False(t, factory.Has(secretsGVR))
+	require.False(t, factory.HasSynced(secretsGVR))
+	require.Eventually(t, func() bool { return len(addedFor(configMapsGVR)) == 1 }, wait.ForeverTestTimeout, 100*time.Millisecond)
+	require.Empty(t, addedFor(secretsGVR))
+
+	factory.AddGVRs(secretsGVR)
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	require.Equal(t, []schema.GroupVersionResource{configMapsGVR, secretsGVR}, factory.GVRs())
+	require.Eventually(t, func() bool { return len(addedFor(secretsGVR)) == 1 }, wait.ForeverTestTimeout, 100*time.Millisecond)
+	require.Equal(t, []string{"cm"}, addedFor(configMapsGVR), "existing informers should not be restarted")
+
+	factory.RemoveGVRs(configMapsGVR)
+
+	require.False(t, factory.Has(configMapsGVR))
+	require.False(t, factory.HasSynced(configMapsGVR))
+	require.Equal(t, []schema.GroupVersionResource{secretsGVR}, factory.GVRs())
+
+	_, err := factory.SyncedInformer(configMapsGVR)
+	require.Error(t, err, "removed resource types should not be served")
+	secretsInformer, err := factory.SyncedInformer(secretsGVR)
+	require.NoError(t, err)
+	require.True(t, secretsInformer.Informer().HasSynced())
+
+	// An informer requested for a removed resource type is not kept, to not be started.
+	factory.ForResource(configMapsGVR)
+	factory.Start(ctx.Done())
+	require.False(t, factory.HasSynced(configMapsGVR))
+	require.Empty(t, factory.WaitForCacheSync(ctx.Done())[configMapsGVR])
+
+	factory.AddGVRs(configMapsGVR)
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	require.True(t, factory.HasSynced(configMapsGVR), "resource types added back should be synced again")
+	_, err = factory.SyncedInformer(configMapsGVR)
+	require.NoError(t, err)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+import (
+	"strings"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// unqualifiedClusterScopedResources are the cluster-scoped resources whose downstream objects keep the
+// names of their upstream objects, since their names are meaningful, e.g. <plural>.<group> for CRDs.
+var unqualifiedClusterScopedResources = sets.NewString(
+	"customresourcedefinitions.apiextensions.k8s.io",
+)
+
+// clusterScopedNamePrefix returns the prefix of the names of the downstream cluster-scoped objects synced
+// from the workspace.
+func clusterScopedNamePrefix(workspace logicalcluster.Name) string {
+	return "kcp-" + WorkspaceLabelValue(workspace)[:8] + "-"
+}
+
+// DownstreamClusterScopedName returns the name of the downstream object of a cluster-scoped upstream object
+// of the workspace. It is qualified with a hash of the workspace, so that the objects synced from different
+// workspaces do not clash, except for the resources whose names are meaningful, like CRDs.
+func DownstreamClusterScopedName(gr schema.GroupResource, workspace logicalcluster.Name, name string) string {
+	if unqualifiedClusterScopedResources.Has(gr.String()) {
+		return name
+	}
+	return clusterScopedNamePrefix(workspace) + name
+}
+
+// UpstreamClusterScopedName returns the name of the upstream object of a downstream cluster-scoped object
+// synced from the workspace.
+func UpstreamClusterScopedName(gr schema.GroupResource, workspace logicalcluster.Name, downstreamName string) string {
+	if unqualifiedClusterScopedResources.Has(gr.String()) {
+		return downstreamName
+	}
+	return strings.TrimPrefix(downstreamName, clusterScopedNamePrefix(workspace))
+}
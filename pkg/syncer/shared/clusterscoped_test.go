@@ -0,0 +1,43 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClusterScopedName(t *testing.T) {
+	priorityClasses := schema.GroupResource{Group: "scheduling.k8s.io", Resource: "priorityclasses"}
+	crds := schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+	ws1, ws2 := logicalcluster.New("root:org:ws1"), logicalcluster.New("root:org:ws2")
+
+	name1 := DownstreamClusterScopedName(priorityClasses, ws1, "high")
+	name2 := DownstreamClusterScopedName(priorityClasses, ws2, "high")
+	require.True(t, strings.HasPrefix(name1, "kcp-"), "downstream name %q should be qualified", name1)
+	require.True(t, strings.HasSuffix(name1, "-high"), "downstream name %q should end with the upstream name", name1)
+	require.NotEqual(t, name1, name2, "the objects of different workspaces should not clash")
+	require.Equal(t, "high", UpstreamClusterScopedName(priorityClasses, ws1, name1))
+
+	require.Equal(t, "widgets.example.com", DownstreamClusterScopedName(crds, ws1, "widgets.example.com"), "CRD names should not be qualified")
+	require.Equal(t, "widgets.example.com", UpstreamClusterScopedName(crds, ws1, "widgets.example.com"))
+}
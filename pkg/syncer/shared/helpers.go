@@ -37,6 +37,22 @@ func DeprecatedGetAssignedSyncTarget(labels map[string]string) string {
 	return ""
 }
 
+// WithoutForeignWorkloadLabels returns a copy of the labels of a downstream object without the workload labels
+// of other SyncTargets and the internal ones, see workloadv1alpha1.IsForeignWorkloadLabel, or nil if none is left.
+func WithoutForeignWorkloadLabels(labels map[string]string, syncTargetKey string) map[string]string {
+	var filtered map[string]string
+	for k, v := range labels {
+		if workloadv1alpha1.IsForeignWorkloadLabel(k, syncTargetKey) {
+			continue
+		}
+		if filtered == nil {
+			filtered = map[string]string{}
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
+
 // GetUpstreamResourceName returns the name with which the resource is known upstream.
 func GetUpstreamResourceName(downstreamResourceGVR schema.GroupVersionResource, downstreamResourceName string) string {
 	configMapGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"}
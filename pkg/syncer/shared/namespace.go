@@ -17,15 +17,21 @@ limitations under the License.
 package shared
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"text/template"
 
 	"github.com/kcp-dev/logicalcluster/v2"
 	"github.com/martinlindhe/base36"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 )
 
 const (
@@ -90,6 +96,25 @@ func LocatorFromAnnotations(annotations map[string]string) (*NamespaceLocator, b
 	return &locator, true, nil
 }
 
+// IndexByNamespaceLocator is a cache.IndexFunc that indexes namespaces by the namespaceLocator annotation.
+func IndexByNamespaceLocator(obj interface{}) ([]string, error) {
+	metaObj, ok := obj.(metav1.Object)
+	if !ok {
+		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
+	}
+	if loc, found, err := LocatorFromAnnotations(metaObj.GetAnnotations()); err != nil {
+		return []string{}, fmt.Errorf("failed to get locator from annotations: %w", err)
+	} else if !found {
+		return []string{}, nil
+	} else {
+		bs, err := json.Marshal(loc)
+		if err != nil {
+			return []string{}, fmt.Errorf("failed to marshal locator %#v: %w", loc, err)
+		}
+		return []string{string(bs)}, nil
+	}
+}
+
 // PhysicalClusterNamespaceName encodes the NamespaceLocator into a new
 // namespace name for use on a physical cluster. The encoding is repeatable.
 func PhysicalClusterNamespaceName(l NamespaceLocator) (string, error) {
@@ -105,3 +130,60 @@ func PhysicalClusterNamespaceName(l NamespaceLocator) (string, error) {
 	// keep the namespaces short enough.
 	return fmt.Sprintf("kcp-%s", base36hash[:12]), nil
 }
+
+// WorkspaceLabelValue returns the value of the InternalDownstreamWorkspaceLabel label of the downstream
+// namespaces synced from the workspace: a hash of its logical cluster name, which is not a valid label value.
+func WorkspaceLabelValue(workspace logicalcluster.Name) string {
+	hash := sha256.Sum224([]byte(workspace.String()))
+	return strings.ToLower(base36.EncodeBytes(hash[:]))
+}
+
+// NamespaceNamer returns the names a new downstream namespace of the NamespaceLocator can be given,
+// in order of preference.
+type NamespaceNamer func(l NamespaceLocator) ([]string, error)
+
+// DownstreamNamespaceNames returns the names a new downstream namespace of the NamespaceLocator can be
+// given with the naming strategy of a SyncTarget, in order of preference. The last one is always the name
+// of PhysicalClusterNamespaceName, to fall back on when the names of the Template strategy are taken.
+func DownstreamNamespaceNames(naming *workloadv1alpha1.NamespaceNaming, l NamespaceLocator) ([]string, error) {
+	hashName, err := PhysicalClusterNamespaceName(l)
+	if err != nil {
+		return nil, err
+	}
+	if naming == nil || naming.Strategy != workloadv1alpha1.NamespaceNamingStrategyTemplate {
+		return []string{hashName}, nil
+	}
+
+	tmpl, err := template.New("namespace").Option("missingkey=error").Parse(naming.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace name template %q: %w", naming.Template, err)
+	}
+	_, workspaceName := l.Workspace.Split()
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{
+		"Workspace":      l.Workspace.String(),
+		"WorkspaceName":  workspaceName,
+		"Namespace":      l.Namespace,
+		"SyncTargetName": l.SyncTarget.Name,
+	}); err != nil {
+		return nil, fmt.Errorf("invalid namespace name template %q: %w", naming.Template, err)
+	}
+
+	name := sanitizeNamespaceName(buf.String())
+	if len(validation.IsDNS1123Label(name)) > 0 || name == hashName {
+		return []string{hashName}, nil
+	}
+	return []string{name, hashName}, nil
+}
+
+// sanitizeNamespaceName lower-cases the name, and replaces the characters not allowed in namespace
+// names with "-".
+func sanitizeNamespaceName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	return strings.Trim(name, "-")
+}
@@ -22,6 +22,8 @@ import (
 	"testing"
 
 	"github.com/kcp-dev/logicalcluster/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 )
 
 func TestLocatorFromAnnotations(t *testing.T) {
@@ -99,3 +101,77 @@ func TestLocatorFromAnnotations(t *testing.T) {
 		})
 	}
 }
+
+func TestDownstreamNamespaceNames(t *testing.T) {
+	locator := NewNamespaceLocator(logicalcluster.New("root:org:My_Team"), logicalcluster.New("root:org:ws"), "test-uid", "us-west1", "default")
+	hashName, err := PhysicalClusterNamespaceName(locator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		naming   *workloadv1alpha1.NamespaceNaming
+		want     []string
+		wantErrs []string
+	}{
+		{
+			name: "no naming strategy",
+			want: []string{hashName},
+		},
+		{
+			name:   "hash strategy",
+			naming: &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyHash, Template: "{{.Namespace}}"},
+			want:   []string{hashName},
+		},
+		{
+			name:   "template strategy",
+			naming: &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.WorkspaceName}}-{{.Namespace}}"},
+			want:   []string{"my-team-default", hashName},
+		},
+		{
+			name:   "template strategy with full workspace and sync target names",
+			naming: &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.SyncTargetName}}:{{.Workspace}}:{{.Namespace}}"},
+			want:   []string{"us-west1-root-org-my-team-default", hashName},
+		},
+		{
+			name:   "template strategy with a name too long",
+			naming: &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.Namespace}}-" + strings.Repeat("x", 63)},
+			want:   []string{hashName},
+		},
+		{
+			name:   "template strategy with an empty name",
+			naming: &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{/* empty */}}"},
+			want:   []string{hashName},
+		},
+		{
+			name:     "template strategy with an unknown field",
+			naming:   &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.Cluster}}"},
+			wantErrs: []string{"invalid namespace name template"},
+		},
+		{
+			name:     "template strategy with an invalid template",
+			naming:   &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.Namespace"},
+			wantErrs: []string{"invalid namespace name template"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DownstreamNamespaceNames(tt.naming, locator)
+			if (err != nil) != (len(tt.wantErrs) > 0) {
+				t.Errorf("DownstreamNamespaceNames() error = %v, wantErrs %v", err, tt.wantErrs)
+				return
+			} else if err != nil {
+				for _, wantErr := range tt.wantErrs {
+					if !strings.Contains(err.Error(), wantErr) {
+						t.Errorf("DownstreamNamespaceNames() error = %q, wantErrs %q", err.Error(), wantErr)
+						return
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DownstreamNamespaceNames() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+// OrphanMode defines what the syncer does with the orphaned downstream objects, i.e. the
+// synced downstream objects whose upstream object does not exist anymore.
+type OrphanMode string
+
+const (
+	// OrphanModeDelete deletes the orphaned downstream objects.
+	OrphanModeDelete OrphanMode = "delete"
+	// OrphanModeReport only logs the orphaned downstream objects, and counts them in the
+	// syncer metrics, leaving their deletion to the administrator of the SyncTarget cluster.
+	OrphanModeReport OrphanMode = "report"
+)
+
+// OrphanModes are the supported OrphanMode values.
+var OrphanModes = []OrphanMode{
+	OrphanModeDelete,
+	OrphanModeReport,
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// RateLimits are the client-side rate limits of the clients of the syncer, which can be changed at runtime,
+// e.g. when the syncer configuration file is reloaded. As with the QPS and Burst of a rest.Config, every
+// client created from a configuration has its own rate limiter.
+type RateLimits struct {
+	lock       sync.RWMutex
+	qps        float32
+	burst      int
+	generation int64
+}
+
+func NewRateLimits(qps float32, burst int) *RateLimits {
+	return &RateLimits{qps: qps, burst: burst}
+}
+
+// Set changes the rate limits of all the clients.
+func (l *RateLimits) Set(qps float32, burst int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.qps == qps && l.burst == burst {
+		return
+	}
+	l.qps, l.burst = qps, burst
+	l.generation++
+}
+
+func (l *RateLimits) get() (float32, int, int64) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.qps, l.burst, l.generation
+}
+
+// Apply makes the clients created from the configuration use the rate limits. The client-go rate limiter
+// of the configuration is disabled in favor of a rate limiter per client transport.
+func (l *RateLimits) Apply(config *rest.Config) {
+	config.QPS = -1
+	config.RateLimiter = nil
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &rateLimitedRoundTripper{limiter: &rateLimiter{limits: l}, delegate: rt}
+	})
+}
+
+// rateLimiter is a token bucket rate limiter, recreated when the rate limits change.
+type rateLimiter struct {
+	limits *RateLimits
+
+	lock       sync.Mutex
+	generation int64
+	limiter    flowcontrol.RateLimiter
+}
+
+func (r *rateLimiter) current() flowcontrol.RateLimiter {
+	qps, burst, generation := r.limits.get()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.limiter == nil || r.generation != generation {
+		r.limiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+		r.generation = generation
+	}
+	return r.limiter
+}
+
+type rateLimitedRoundTripper struct {
+	limiter  *rateLimiter
+	delegate http.RoundTripper
+}
+
+func (rt *rateLimitedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := rt.limiter.current().Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return rt.delegate.RoundTrip(req)
+}
+
+func (rt *rateLimitedRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.delegate
+}
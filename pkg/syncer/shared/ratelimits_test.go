@@ -0,0 +1,45 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimits(t *testing.T) {
+	limits := NewRateLimits(1, 2)
+	limiter := &rateLimiter{limits: limits}
+
+	// The burst is available right away, and exhausted afterwards.
+	require.True(t, limiter.current().TryAccept())
+	require.True(t, limiter.current().TryAccept())
+	require.False(t, limiter.current().TryAccept())
+
+	// Setting the same limits keeps the exhausted limiter.
+	limits.Set(1, 2)
+	require.False(t, limiter.current().TryAccept())
+
+	// New limits apply to the existing clients.
+	limits.Set(1, 3)
+	require.Equal(t, float32(1), limiter.current().QPS())
+	for i := 0; i < 3; i++ {
+		require.True(t, limiter.current().TryAccept())
+	}
+	require.False(t, limiter.current().TryAccept())
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shared
+
+// ServiceAccountTokenMode defines how the syncer provides service account tokens
+// to the pods of the synced workloads, so that they can talk to kcp.
+type ServiceAccountTokenMode string
+
+const (
+	// ServiceAccountTokenModeSecret mounts the legacy kubernetes.io/service-account-token
+	// Secrets of the upstream service accounts, synced downstream like any other Secret.
+	ServiceAccountTokenModeSecret ServiceAccountTokenMode = "secret"
+	// ServiceAccountTokenModeProjected mounts a downstream Secret holding a bound, expiring
+	// token requested from kcp through the TokenRequest API. The syncer refreshes the token
+	// before it expires.
+	ServiceAccountTokenModeProjected ServiceAccountTokenMode = "projected"
+)
+
+// ServiceAccountTokenModes are the supported ServiceAccountTokenMode values.
+var ServiceAccountTokenModes = []ServiceAccountTokenMode{
+	ServiceAccountTokenModeSecret,
+	ServiceAccountTokenModeProjected,
+}
+
+const (
+	// ServiceAccountTokenExpirationAnnotation is the annotation on downstream projected token
+	// Secrets storing the expiration timestamp of the token, in RFC3339 format.
+	ServiceAccountTokenExpirationAnnotation = "workload.kcp.dev/token-expiration"
+)
+
+// ProjectedServiceAccountTokenSecretName returns the name of the downstream Secret holding
+// the token requested for the given upstream service account in projected mode.
+func ProjectedServiceAccountTokenSecretName(serviceAccountName string) string {
+	return "kcp-" + serviceAccountName + "-projected-token"
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DownstreamClusterScopedNameFunc returns the name of the downstream object of the cluster-scoped upstream object
+// of the workspace, and false if the upstream object is not synced to the SyncTarget.
+type DownstreamClusterScopedNameFunc func(gr schema.GroupResource, clusterName logicalcluster.Name, name string) (string, bool, error)
+
+var (
+	priorityClassesGR = schedulingv1.SchemeGroupVersion.WithResource("priorityclasses").GroupResource()
+	ingressClassesGR  = networkingv1.SchemeGroupVersion.WithResource("ingressclasses").GroupResource()
+)
+
+// ClassReferencesMutator rewrites the references to the PriorityClasses and IngressClasses synced from the workspace
+// with the names of their downstream objects: the priorityClassName of Pods and of the workload resources with a pod
+// template, and the ingressClassName of Ingresses. References to classes that are not synced are left alone, since
+// they may exist in the SyncTarget cluster.
+type ClassReferencesMutator struct {
+	gvr schema.GroupVersionResource
+	// path is the path of the class name field in the objects of the resource.
+	path []string
+	// classes is the cluster-scoped resource of the referenced classes.
+	classes schema.GroupResource
+
+	downstreamName DownstreamClusterScopedNameFunc
+}
+
+// NewClassReferencesMutators returns the class references mutators of Ingresses, Pods, and all the known workload
+// resources with a pod template.
+func NewClassReferencesMutators(downstreamName DownstreamClusterScopedNameFunc) []*ClassReferencesMutator {
+	mutators := []*ClassReferencesMutator{
+		{gvr: networkingv1.SchemeGroupVersion.WithResource("ingresses"), path: []string{"spec", "ingressClassName"}, classes: ingressClassesGR, downstreamName: downstreamName},
+	}
+	for gvr, podSpecPath := range PodSpecPaths {
+		path := append(append([]string{}, podSpecPath...), "priorityClassName")
+		mutators = append(mutators, &ClassReferencesMutator{gvr: gvr, path: path, classes: priorityClassesGR, downstreamName: downstreamName})
+	}
+	return mutators
+}
+
+func (m *ClassReferencesMutator) GVR() schema.GroupVersionResource {
+	return m.gvr
+}
+
+// Mutate applies the mutator changes to the object.
+func (m *ClassReferencesMutator) Mutate(obj *unstructured.Unstructured) error {
+	className, found, err := unstructured.NestedString(obj.Object, m.path...)
+	if err != nil || !found || className == "" {
+		return err
+	}
+	downstreamName, synced, err := m.downstreamName(m.classes, logicalcluster.From(obj), className)
+	if err != nil || !synced {
+		return err
+	}
+	return unstructured.SetNestedField(obj.Object, downstreamName, m.path...)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilspointer "k8s.io/utils/pointer"
+)
+
+func TestClassReferencesMutate(t *testing.T) {
+	// Only the "high" PriorityClass and the "public" IngressClass are synced from the workspace.
+	downstreamName := func(gr schema.GroupResource, clusterName logicalcluster.Name, name string) (string, bool, error) {
+		require.Equal(t, logicalcluster.New("root:org:ws"), clusterName)
+		if (gr == priorityClassesGR && name == "high") || (gr == ingressClassesGR && name == "public") {
+			return "kcp-12345678-" + name, true, nil
+		}
+		return "", false, nil
+	}
+	mutators := map[schema.GroupVersionResource]*ClassReferencesMutator{}
+	for _, mutator := range NewClassReferencesMutators(downstreamName) {
+		mutators[mutator.GVR()] = mutator
+	}
+	objectMeta := metav1.ObjectMeta{
+		Name:        "test",
+		Namespace:   "test",
+		Annotations: map[string]string{logicalcluster.AnnotationKey: "root:org:ws"},
+	}
+	deployment := func(priorityClassName string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: objectMeta,
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{PriorityClassName: priorityClassName},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		gvr      schema.GroupVersionResource
+		original runtime.Object
+		expected runtime.Object
+	}{
+		{
+			name:     "deployment: the synced PriorityClass is referenced with its downstream name",
+			gvr:      appsv1.SchemeGroupVersion.WithResource("deployments"),
+			original: deployment("high"),
+			expected: deployment("kcp-12345678-high"),
+		},
+		{
+			name:     "deployment: a PriorityClass that is not synced is left alone",
+			gvr:      appsv1.SchemeGroupVersion.WithResource("deployments"),
+			original: deployment("system-cluster-critical"),
+			expected: deployment("system-cluster-critical"),
+		},
+		{
+			name: "ingress: the synced IngressClass is referenced with its downstream name",
+			gvr:  networkingv1.SchemeGroupVersion.WithResource("ingresses"),
+			original: &networkingv1.Ingress{
+				ObjectMeta: objectMeta,
+				Spec:       networkingv1.IngressSpec{IngressClassName: utilspointer.String("public")},
+			},
+			expected: &networkingv1.Ingress{
+				ObjectMeta: objectMeta,
+				Spec:       networkingv1.IngressSpec{IngressClassName: utilspointer.String("kcp-12345678-public")},
+			},
+		},
+		{
+			name:     "ingress: an Ingress without IngressClass is left alone",
+			gvr:      networkingv1.SchemeGroupVersion.WithResource("ingresses"),
+			original: &networkingv1.Ingress{ObjectMeta: objectMeta},
+			expected: &networkingv1.Ingress{ObjectMeta: objectMeta},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.original)
+			require.NoError(t, err)
+			obj := &unstructured.Unstructured{Object: content}
+
+			require.NoError(t, mutators[tc.gvr].Mutate(obj))
+
+			expected, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.expected)
+			require.NoError(t, err)
+			require.Equal(t, expected, obj.Object)
+		})
+	}
+}
@@ -769,7 +769,7 @@ func TestDeploymentMutate(t *testing.T) {
 				upstreamURL, err := url.Parse(c.config.Host)
 				require.NoError(t, err)
 
-				dm := NewDeploymentMutator(upstreamURL, func(upstreamLogicalCluster logicalcluster.Name, namespace string) ([]*unstructured.Unstructured, error) {
+				dm := NewDeploymentMutator(upstreamURL, LegacyServiceAccountTokenSecret(func(upstreamLogicalCluster logicalcluster.Name, namespace string) ([]*unstructured.Unstructured, error) {
 					unstructuredObjects := make([]*unstructured.Unstructured, 0, len(c.upstreamSecrets))
 					for _, obj := range c.upstreamSecrets {
 						unstObj, err := toUnstructured(obj)
@@ -777,7 +777,7 @@ func TestDeploymentMutate(t *testing.T) {
 						unstructuredObjects = append(unstructuredObjects, unstObj)
 					}
 					return unstructuredObjects, nil
-				})
+				}))
 
 				unstrOriginalDeployment, err := toUnstructured(c.originalDeployment)
 				require.NoError(t, err, "toRuntimeObject() = %v", err)
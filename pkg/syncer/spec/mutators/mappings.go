@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+// WorkloadMappingsFunc returns the workload mappings of the SyncTarget, or nil if it has none.
+type WorkloadMappingsFunc func() *workloadv1alpha1.WorkloadMappings
+
+// WorkloadMappingsMutator applies the workload mappings of the SyncTarget: it rewrites the container
+// images of Pods and of the workload resources with a pod template, and the StorageClass names of
+// PersistentVolumeClaims and of the volumeClaimTemplates of StatefulSets.
+type WorkloadMappingsMutator struct {
+	gvr schema.GroupVersionResource
+	// podSpecPath is the path of the pod spec in the objects of workload resources, empty for PersistentVolumeClaims.
+	podSpecPath []string
+
+	mappings WorkloadMappingsFunc
+}
+
+// NewWorkloadMappingsMutators returns the workload mappings mutators of PersistentVolumeClaims, Pods,
+// and all the known workload resources with a pod template.
+func NewWorkloadMappingsMutators(mappings WorkloadMappingsFunc) []*WorkloadMappingsMutator {
+	mutators := []*WorkloadMappingsMutator{
+		{gvr: corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"), mappings: mappings},
+	}
+	for gvr, podSpecPath := range PodSpecPaths {
+		mutators = append(mutators, &WorkloadMappingsMutator{gvr: gvr, podSpecPath: podSpecPath, mappings: mappings})
+	}
+	return mutators
+}
+
+func (m *WorkloadMappingsMutator) GVR() schema.GroupVersionResource {
+	return m.gvr
+}
+
+// Mutate applies the mutator changes to the object.
+func (m *WorkloadMappingsMutator) Mutate(obj *unstructured.Unstructured) error {
+	mappings := m.mappings()
+	if mappings == nil {
+		return nil
+	}
+
+	if m.podSpecPath == nil {
+		return mapStorageClassName(obj.Object, mappings.StorageClasses)
+	}
+
+	if len(mappings.Images) > 0 {
+		if err := mutateContainers(obj, m.podSpecPath, func(container map[string]interface{}) error {
+			image, ok := container["image"].(string)
+			if !ok {
+				return nil
+			}
+			container["image"] = mapImage(image, mappings.Images)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if m.gvr == appsv1.SchemeGroupVersion.WithResource("statefulsets") && len(mappings.StorageClasses) > 0 {
+		claimTemplates, found, err := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		if err != nil || !found {
+			return err
+		}
+		for _, claimTemplate := range claimTemplates {
+			claimTemplate, ok := claimTemplate.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("volumeClaimTemplates of StatefulSet %s/%s must be objects", obj.GetNamespace(), obj.GetName())
+			}
+			if err := mapStorageClassName(claimTemplate, mappings.StorageClasses); err != nil {
+				return err
+			}
+		}
+		return unstructured.SetNestedSlice(obj.Object, claimTemplates, "spec", "volumeClaimTemplates")
+	}
+
+	return nil
+}
+
+// mapImage replaces the prefix of the longest image mapping matching the image.
+func mapImage(image string, mappings []workloadv1alpha1.ImageMapping) string {
+	var longest *workloadv1alpha1.ImageMapping
+	for i := range mappings {
+		if mappings[i].From == "" || !strings.HasPrefix(image, mappings[i].From) {
+			continue
+		}
+		if longest == nil || len(mappings[i].From) > len(longest.From) {
+			longest = &mappings[i]
+		}
+	}
+	if longest == nil {
+		return image
+	}
+	return longest.To + strings.TrimPrefix(image, longest.From)
+}
+
+// mapStorageClassName maps the StorageClass name of the given PersistentVolumeClaim object.
+func mapStorageClassName(claim map[string]interface{}, storageClasses map[string]string) error {
+	if len(storageClasses) == 0 {
+		return nil
+	}
+	spec, ok := claim["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	storageClassName, ok := spec["storageClassName"].(string)
+	if !ok && spec["storageClassName"] != nil {
+		return fmt.Errorf("storageClassName must be a string, got %T", spec["storageClassName"])
+	}
+	mapped, ok := storageClasses[storageClassName]
+	if !ok {
+		return nil
+	}
+	spec["storageClassName"] = mapped
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilspointer "k8s.io/utils/pointer"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestMapImage(t *testing.T) {
+	mappings := []workloadv1alpha1.ImageMapping{
+		{From: "docker.io/", To: "mirror.local/docker/"},
+		{From: "docker.io/library/", To: "mirror.local/library/"},
+		{From: "quay.io/app", To: "registry.local/app"},
+	}
+	for _, tc := range []struct {
+		image, want string
+	}{
+		{image: "docker.io/library/nginx:1.23", want: "mirror.local/library/nginx:1.23"},
+		{image: "docker.io/bitnami/redis", want: "mirror.local/docker/bitnami/redis"},
+		{image: "quay.io/app@sha256:abc", want: "registry.local/app@sha256:abc"},
+		{image: "ghcr.io/org/app", want: "ghcr.io/org/app"},
+	} {
+		t.Run(tc.image, func(t *testing.T) {
+			require.Equal(t, tc.want, mapImage(tc.image, mappings))
+		})
+	}
+}
+
+func TestWorkloadMappingsMutate(t *testing.T) {
+	mappings := &workloadv1alpha1.WorkloadMappings{
+		Images: []workloadv1alpha1.ImageMapping{
+			{From: "docker.io/library/", To: "mirror.local/library/"},
+		},
+		StorageClasses: map[string]string{
+			"gp2": "local-path",
+			"":    "local-path",
+		},
+	}
+	mutators := map[schema.GroupVersionResource]*WorkloadMappingsMutator{}
+	for _, mutator := range NewWorkloadMappingsMutators(func() *workloadv1alpha1.WorkloadMappings { return mappings }) {
+		mutators[mutator.GVR()] = mutator
+	}
+	objectMeta := metav1.ObjectMeta{Name: "test", Namespace: "test"}
+
+	tests := []struct {
+		name     string
+		gvr      schema.GroupVersionResource
+		original runtime.Object
+		expected runtime.Object
+	}{
+		{
+			name: "statefulset: the images and the StorageClass names of the claim templates are mapped",
+			gvr:  appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+			original: &appsv1.StatefulSet{
+				ObjectMeta: objectMeta,
+				Spec: appsv1.StatefulSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							InitContainers: []corev1.Container{{Name: "init", Image: "docker.io/library/busybox"}},
+							Containers:     []corev1.Container{{Name: "db", Image: "quay.io/org/postgres:15"}},
+						},
+					},
+					VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+						{ObjectMeta: metav1.ObjectMeta{Name: "data"}, Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: utilspointer.String("gp2")}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "logs"}, Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: utilspointer.String("fast")}},
+					},
+				},
+			},
+			expected: &appsv1.StatefulSet{
+				ObjectMeta: objectMeta,
+				Spec: appsv1.StatefulSetSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							InitContainers: []corev1.Container{{Name: "init", Image: "mirror.local/library/busybox"}},
+							Containers:     []corev1.Container{{Name: "db", Image: "quay.io/org/postgres:15"}},
+						},
+					},
+					VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+						{ObjectMeta: metav1.ObjectMeta{Name: "data"}, Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: utilspointer.String("local-path")}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "logs"}, Spec: corev1.PersistentVolumeClaimSpec{StorageClassName: utilspointer.String("fast")}},
+					},
+				},
+			},
+		},
+		{
+			name: "pvc: a claim without StorageClass name is mapped with the empty name",
+			gvr:  corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"),
+			original: &corev1.PersistentVolumeClaim{
+				ObjectMeta: objectMeta,
+			},
+			expected: &corev1.PersistentVolumeClaim{
+				ObjectMeta: objectMeta,
+				Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: utilspointer.String("local-path")},
+			},
+		},
+		{
+			name: "pod: the images of the containers are mapped",
+			gvr:  corev1.SchemeGroupVersion.WithResource("pods"),
+			original: &corev1.Pod{
+				ObjectMeta: objectMeta,
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "docker.io/library/nginx"}}},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: objectMeta,
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "mirror.local/library/nginx"}}},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.original)
+			require.NoError(t, err)
+			obj := &unstructured.Unstructured{Object: content}
+
+			require.NoError(t, mutators[tc.gvr].Mutate(obj))
+
+			expected, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.expected)
+			require.NoError(t, err)
+			require.Equal(t, expected, obj.Object)
+		})
+	}
+}
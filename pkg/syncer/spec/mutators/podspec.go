@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PodSpecPaths are the paths of the pod specs in the objects of Pods and of the known workload
+// resources with a pod template.
+var PodSpecPaths = map[schema.GroupVersionResource][]string{
+	corev1.SchemeGroupVersion.WithResource("pods"):         {"spec"},
+	appsv1.SchemeGroupVersion.WithResource("deployments"):  {"spec", "template", "spec"},
+	appsv1.SchemeGroupVersion.WithResource("statefulsets"): {"spec", "template", "spec"},
+	appsv1.SchemeGroupVersion.WithResource("daemonsets"):   {"spec", "template", "spec"},
+	batchv1.SchemeGroupVersion.WithResource("jobs"):        {"spec", "template", "spec"},
+	batchv1.SchemeGroupVersion.WithResource("cronjobs"):    {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// mutateContainers calls mutate with the init, regular and ephemeral containers of the pod spec
+// of the unstructured object at the given path.
+func mutateContainers(obj *unstructured.Unstructured, podSpecPath []string, mutate func(container map[string]interface{}) error) error {
+	podSpec, found, err := unstructured.NestedMap(obj.Object, podSpecPath...)
+	if err != nil || !found {
+		return err
+	}
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		if podSpec[field] == nil {
+			continue
+		}
+		containers, _, err := unstructured.NestedSlice(podSpec, field)
+		if err != nil {
+			return err
+		}
+		for _, container := range containers {
+			container, ok := container.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s of %s %s/%s must be objects", field, obj.GetKind(), obj.GetNamespace(), obj.GetName())
+			}
+			if err := mutate(container); err != nil {
+				return err
+			}
+		}
+		podSpec[field] = containers
+	}
+	return unstructured.SetNestedMap(obj.Object, podSpec, podSpecPath...)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilspointer "k8s.io/utils/pointer"
+)
+
+func TestPodTemplateMutate(t *testing.T) {
+	objectMeta := metav1.ObjectMeta{
+		Name:      "test-workload",
+		Namespace: "namespace",
+		Annotations: map[string]string{
+			logicalcluster.AnnotationKey: "root:default:testing",
+		},
+	}
+	originalPodTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test-container",
+					Image: "test-image",
+					Env: []corev1.EnvVar{
+						{
+							Name: "NAMESPACE",
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	expectedPodTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			AutomountServiceAccountToken: utilspointer.BoolPtr(false),
+			Containers: []corev1.Container{
+				{
+					Name:  "test-container",
+					Image: "test-image",
+					Env: []corev1.EnvVar{
+						{Name: "NAMESPACE", Value: "namespace"},
+						{Name: "KUBERNETES_SERVICE_PORT", Value: "12345"},
+						{Name: "KUBERNETES_SERVICE_PORT_HTTPS", Value: "12345"},
+						{Name: "KUBERNETES_SERVICE_HOST", Value: "4.5.6.7"},
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						kcpApiAccessVolumeMount,
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				kcpApiAccessVolume,
+			},
+		},
+	}
+
+	for _, c := range []struct {
+		desc                     string
+		newMutator               func(upstreamURL *url.URL, serviceAccountTokenSecret ServiceAccountTokenSecretFunc) *PodTemplateMutator
+		expectedGVR              schema.GroupVersionResource
+		original, expected, into runtime.Object
+	}{{
+		desc:        "StatefulSet is mutated",
+		newMutator:  NewStatefulSetMutator,
+		expectedGVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"},
+		original: &appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       appsv1.StatefulSetSpec{Template: *originalPodTemplate.DeepCopy()},
+		},
+		expected: &appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       appsv1.StatefulSetSpec{Template: *expectedPodTemplate.DeepCopy()},
+		},
+		into: &appsv1.StatefulSet{},
+	}, {
+		desc:        "DaemonSet is mutated",
+		newMutator:  NewDaemonSetMutator,
+		expectedGVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"},
+		original: &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       appsv1.DaemonSetSpec{Template: *originalPodTemplate.DeepCopy()},
+		},
+		expected: &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       appsv1.DaemonSetSpec{Template: *expectedPodTemplate.DeepCopy()},
+		},
+		into: &appsv1.DaemonSet{},
+	}, {
+		desc:        "Job is mutated",
+		newMutator:  NewJobMutator,
+		expectedGVR: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"},
+		original: &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       batchv1.JobSpec{Template: *originalPodTemplate.DeepCopy()},
+		},
+		expected: &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"},
+			ObjectMeta: objectMeta,
+			Spec:       batchv1.JobSpec{Template: *expectedPodTemplate.DeepCopy()},
+		},
+		into: &batchv1.Job{},
+	}, {
+		desc:        "CronJob job template is mutated",
+		newMutator:  NewCronJobMutator,
+		expectedGVR: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		original: &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{Kind: "CronJob", APIVersion: "batch/v1"},
+			ObjectMeta: objectMeta,
+			Spec: batchv1.CronJobSpec{
+				Schedule:    "* * * * *",
+				JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: *originalPodTemplate.DeepCopy()}},
+			},
+		},
+		expected: &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{Kind: "CronJob", APIVersion: "batch/v1"},
+			ObjectMeta: objectMeta,
+			Spec: batchv1.CronJobSpec{
+				Schedule:    "* * * * *",
+				JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: *expectedPodTemplate.DeepCopy()}},
+			},
+		},
+		into: &batchv1.CronJob{},
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			upstreamURL, err := url.Parse("https://4.5.6.7:12345")
+			require.NoError(t, err)
+
+			upstreamSecret, err := toUnstructured(&corev1.Secret{
+				TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "default-token-1234",
+					Namespace: "namespace",
+					Annotations: map[string]string{
+						logicalcluster.AnnotationKey:         "root:default:testing",
+						"kubernetes.io/service-account.name": "default",
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			m := c.newMutator(upstreamURL, LegacyServiceAccountTokenSecret(func(upstreamLogicalCluster logicalcluster.Name, namespace string) ([]*unstructured.Unstructured, error) {
+				return []*unstructured.Unstructured{upstreamSecret}, nil
+			}))
+			require.Equal(t, c.expectedGVR, m.GVR())
+
+			obj, err := toUnstructured(c.original)
+			require.NoError(t, err)
+
+			err = m.Mutate(obj)
+			require.NoError(t, err, "Mutate() = %v", err)
+
+			err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), c.into)
+			require.NoError(t, err)
+
+			if !apiequality.Semantic.DeepEqual(c.into, c.expected) {
+				t.Errorf("expected objects are not equal, got:\n %#v \n wanted:\n %#v \n", c.into, c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+// ResourceQuotaScalingFunc returns the ResourceQuota scaling of the SyncTarget, or nil if it has none.
+type ResourceQuotaScalingFunc func() *workloadv1alpha1.ResourceQuotaScaling
+
+// ResourceQuotaMutator scales the hard limits of the ResourceQuotas with the ResourceQuota scaling
+// of the SyncTarget, so that the namespaces of a workspace cannot use more than their share of the
+// SyncTarget cluster.
+type ResourceQuotaMutator struct {
+	scaling ResourceQuotaScalingFunc
+}
+
+func NewResourceQuotaMutator(scaling ResourceQuotaScalingFunc) *ResourceQuotaMutator {
+	return &ResourceQuotaMutator{
+		scaling: scaling,
+	}
+}
+
+func (m *ResourceQuotaMutator) GVR() schema.GroupVersionResource {
+	return corev1.SchemeGroupVersion.WithResource("resourcequotas")
+}
+
+// Mutate applies the mutator changes to the object.
+func (m *ResourceQuotaMutator) Mutate(obj *unstructured.Unstructured) error {
+	scaling := m.scaling()
+	if scaling == nil {
+		return nil
+	}
+
+	var numerator, denominator int64
+	switch scaling.Policy {
+	case workloadv1alpha1.ResourceQuotaScalingDivide:
+		numerator, denominator = 1, int64(scheduledSyncTargets(obj))
+	case workloadv1alpha1.ResourceQuotaScalingPercent:
+		numerator, denominator = int64(scaling.Percent), 100
+	default:
+		return nil
+	}
+	if numerator <= 0 || denominator <= 0 || numerator == denominator {
+		return nil
+	}
+
+	hard, found, err := unstructured.NestedStringMap(obj.Object, "spec", "hard")
+	if err != nil || !found {
+		return err
+	}
+	for name, value := range hard {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid hard limit %s of ResourceQuota %s/%s: %w", name, obj.GetNamespace(), obj.GetName(), err)
+		}
+		hard[name] = scaleQuantity(corev1.ResourceName(name), quantity, numerator, denominator).String()
+	}
+	return unstructured.SetNestedStringMap(obj.Object, hard, "spec", "hard")
+}
+
+// scheduledSyncTargets returns the number of SyncTargets the upstream object is scheduled to.
+func scheduledSyncTargets(obj *unstructured.Unstructured) int {
+	count := 0
+	for key, value := range obj.GetLabels() {
+		if strings.HasPrefix(key, workloadv1alpha1.ClusterResourceStateLabelPrefix) && value != string(workloadv1alpha1.ResourceStateUpsync) {
+			count++
+		}
+	}
+	return count
+}
+
+// scaleQuantity returns the quantity multiplied by numerator/denominator, rounded down to the
+// millicore for CPU resources, and to integers for the other resources.
+func scaleQuantity(name corev1.ResourceName, quantity resource.Quantity, numerator, denominator int64) *resource.Quantity {
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU, corev1.ResourceLimitsCPU:
+		return resource.NewMilliQuantity(quantity.MilliValue()*numerator/denominator, quantity.Format)
+	default:
+		return resource.NewQuantity(quantity.Value()*numerator/denominator, quantity.Format)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestResourceQuotaMutate(t *testing.T) {
+	quota := func(hard corev1.ResourceList) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "quota",
+				Namespace: "test",
+				Labels: map[string]string{
+					workloadv1alpha1.ClusterResourceStateLabelPrefix + "us-east1": string(workloadv1alpha1.ResourceStateSync),
+					workloadv1alpha1.ClusterResourceStateLabelPrefix + "us-west1": string(workloadv1alpha1.ResourceStateSync),
+					workloadv1alpha1.ClusterResourceStateLabelPrefix + "eu-west1": string(workloadv1alpha1.ResourceStatePending),
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{Hard: hard},
+		}
+	}
+	original := corev1.ResourceList{
+		corev1.ResourceRequestsCPU:    resource.MustParse("2"),
+		corev1.ResourceRequestsMemory: resource.MustParse("3Gi"),
+		corev1.ResourcePods:           resource.MustParse("10"),
+	}
+
+	tests := []struct {
+		name     string
+		scaling  *workloadv1alpha1.ResourceQuotaScaling
+		expected corev1.ResourceList
+	}{
+		{
+			name:     "no scaling",
+			expected: original,
+		},
+		{
+			name:     "None policy",
+			scaling:  &workloadv1alpha1.ResourceQuotaScaling{Policy: workloadv1alpha1.ResourceQuotaScalingNone},
+			expected: original,
+		},
+		{
+			name:    "Divide policy, divided across the 3 SyncTargets the quota is scheduled to",
+			scaling: &workloadv1alpha1.ResourceQuotaScaling{Policy: workloadv1alpha1.ResourceQuotaScalingDivide},
+			expected: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    resource.MustParse("666m"),
+				corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+				corev1.ResourcePods:           resource.MustParse("3"),
+			},
+		},
+		{
+			name:    "Percent policy",
+			scaling: &workloadv1alpha1.ResourceQuotaScaling{Policy: workloadv1alpha1.ResourceQuotaScalingPercent, Percent: 25},
+			expected: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    resource.MustParse("500m"),
+				corev1.ResourceRequestsMemory: resource.MustParse("768Mi"),
+				corev1.ResourcePods:           resource.MustParse("2"),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mutator := NewResourceQuotaMutator(func() *workloadv1alpha1.ResourceQuotaScaling { return tc.scaling })
+
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(quota(original))
+			require.NoError(t, err)
+			obj := &unstructured.Unstructured{Object: content}
+
+			require.NoError(t, mutator.Mutate(obj))
+
+			mutated := &corev1.ResourceQuota{}
+			require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, mutated))
+			require.Len(t, mutated.Spec.Hard, len(tc.expected))
+			for name, want := range tc.expected {
+				got := mutated.Spec.Hard[name]
+				require.Zero(t, want.Cmp(got), "%s: expected %s, got %s", name, want.String(), got.String())
+			}
+		})
+	}
+}
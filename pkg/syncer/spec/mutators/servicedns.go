@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+// DownstreamNamespaceFunc returns the name of the downstream namespace of the given upstream namespace,
+// or false if it has none.
+type DownstreamNamespaceFunc func(clusterName logicalcluster.Name, upstreamNamespace string) (string, bool, error)
+
+// serviceDNSNameRegexp matches the in-cluster DNS names of Services and of their pods, i.e.
+// [<pod>.]<service>.<namespace>.svc[.cluster.local][.], the namespace being the second group.
+var serviceDNSNameRegexp = regexp.MustCompile(`([a-z0-9](?:[-a-z0-9]*[a-z0-9])?)\.([a-z0-9](?:[-a-z0-9]*[a-z0-9])?)\.svc(?:\.cluster\.local)?\.?`)
+
+// ServiceDNSMutator rewrites the in-cluster DNS names of the Services of the upstream namespaces,
+// e.g. db.my-namespace.svc, into the DNS names of the same Services in the downstream namespaces.
+// Workload resources get the env vars, args and commands of the containers of their pod template
+// rewritten, ConfigMaps the values of the keys listed in their workloadv1alpha1.RewriteServiceDNSAnnotation.
+type ServiceDNSMutator struct {
+	gvr schema.GroupVersionResource
+	// podSpecPath is the path of the pod spec in the objects of workload resources, empty for ConfigMaps.
+	podSpecPath []string
+
+	downstreamNamespace DownstreamNamespaceFunc
+}
+
+// NewServiceDNSMutators returns the Service DNS name mutators of ConfigMaps, Pods, and all the known
+// workload resources with a pod template.
+func NewServiceDNSMutators(downstreamNamespace DownstreamNamespaceFunc) []*ServiceDNSMutator {
+	mutators := []*ServiceDNSMutator{
+		{gvr: corev1.SchemeGroupVersion.WithResource("configmaps"), downstreamNamespace: downstreamNamespace},
+	}
+	for gvr, podSpecPath := range PodSpecPaths {
+		mutators = append(mutators, &ServiceDNSMutator{gvr: gvr, podSpecPath: podSpecPath, downstreamNamespace: downstreamNamespace})
+	}
+	return mutators
+}
+
+func (m *ServiceDNSMutator) GVR() schema.GroupVersionResource {
+	return m.gvr
+}
+
+// Mutate applies the mutator changes to the object.
+func (m *ServiceDNSMutator) Mutate(obj *unstructured.Unstructured) error {
+	clusterName := logicalcluster.From(obj)
+
+	if m.podSpecPath == nil {
+		keys := obj.GetAnnotations()[workloadv1alpha1.RewriteServiceDNSAnnotation]
+		if keys == "" || obj.Object["data"] == nil {
+			return nil
+		}
+		data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+		if err != nil {
+			return err
+		}
+		for _, key := range strings.Split(keys, ",") {
+			key = strings.TrimSpace(key)
+			value, ok := data[key]
+			if !ok {
+				continue
+			}
+			if data[key], err = m.rewrite(clusterName, value); err != nil {
+				return err
+			}
+		}
+		return unstructured.SetNestedStringMap(obj.Object, data, "data")
+	}
+
+	return mutateContainers(obj, m.podSpecPath, func(container map[string]interface{}) error {
+		return m.mutateContainer(clusterName, container)
+	})
+}
+
+func (m *ServiceDNSMutator) mutateContainer(clusterName logicalcluster.Name, container map[string]interface{}) error {
+	for _, field := range []string{"command", "args"} {
+		if container[field] == nil {
+			continue
+		}
+		values, _, err := unstructured.NestedStringSlice(container, field)
+		if err != nil {
+			return err
+		}
+		for i := range values {
+			if values[i], err = m.rewrite(clusterName, values[i]); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedStringSlice(container, values, field); err != nil {
+			return err
+		}
+	}
+
+	if container["env"] == nil {
+		return nil
+	}
+	env, _, err := unstructured.NestedSlice(container, "env")
+	if err != nil {
+		return err
+	}
+	for _, envVar := range env {
+		envVar, ok := envVar.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, ok := envVar["value"].(string)
+		if !ok {
+			continue
+		}
+		if envVar["value"], err = m.rewrite(clusterName, value); err != nil {
+			return err
+		}
+	}
+	return unstructured.SetNestedSlice(container, env, "env")
+}
+
+// rewrite replaces the upstream namespaces of the Service DNS names in s with their downstream namespaces.
+// The names of the upstream namespaces without downstream namespace are left as is.
+func (m *ServiceDNSMutator) rewrite(clusterName logicalcluster.Name, s string) (string, error) {
+	matches := serviceDNSNameRegexp.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		end, namespaceStart, namespaceEnd := match[1], match[4], match[5]
+		// The name must not go on with a longer label or domain, e.g. db.ns.svc.example.com.
+		if end < len(s) && isDNSLabelChar(s[end]) {
+			continue
+		}
+		downstreamNamespace, found, err := m.downstreamNamespace(clusterName, s[namespaceStart:namespaceEnd])
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			continue
+		}
+		b.WriteString(s[last:namespaceStart])
+		b.WriteString(downstreamNamespace)
+		last = namespaceEnd
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+func isDNSLabelChar(c byte) bool {
+	return c == '-' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
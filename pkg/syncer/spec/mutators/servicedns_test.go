@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutators
+
+import (
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+func TestServiceDNSRewrite(t *testing.T) {
+	downstreamNamespaces := map[string]string{
+		"backend": "kcp-backend",
+		"web":     "kcp-web",
+	}
+	mutator := &ServiceDNSMutator{
+		downstreamNamespace: func(clusterName logicalcluster.Name, upstreamNamespace string) (string, bool, error) {
+			require.Equal(t, logicalcluster.New("root:org:ws"), clusterName)
+			downstreamNamespace, ok := downstreamNamespaces[upstreamNamespace]
+			return downstreamNamespace, ok, nil
+		},
+	}
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{in: "http://db.backend.svc:5432/app", want: "http://db.kcp-backend.svc:5432/app"},
+		{in: "db.backend.svc.cluster.local", want: "db.kcp-backend.svc.cluster.local"},
+		{in: "db.backend.svc.cluster.local.", want: "db.kcp-backend.svc.cluster.local."},
+		{in: "db-0.db.backend.svc", want: "db-0.db.kcp-backend.svc"},
+		{in: "db.backend.svc,cache.web.svc", want: "db.kcp-backend.svc,cache.kcp-web.svc"},
+		{in: "--upstream=api.web.svc:8080", want: "--upstream=api.kcp-web.svc:8080"},
+		{in: "db.unknown.svc", want: "db.unknown.svc"},
+		{in: "db.backend.svc.example.com", want: "db.backend.svc.example.com"},
+		{in: "db.backend.svcs", want: "db.backend.svcs"},
+		{in: "db.backend", want: "db.backend"},
+		{in: "", want: ""},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := mutator.rewrite(logicalcluster.New("root:org:ws"), tc.in)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestServiceDNSMutate(t *testing.T) {
+	downstreamNamespace := func(clusterName logicalcluster.Name, upstreamNamespace string) (string, bool, error) {
+		return "kcp-" + upstreamNamespace, true, nil
+	}
+	mutators := map[schema.GroupVersionResource]*ServiceDNSMutator{}
+	for _, mutator := range NewServiceDNSMutators(downstreamNamespace) {
+		mutators[mutator.GVR()] = mutator
+	}
+	objectMeta := func(annotations map[string]string) metav1.ObjectMeta {
+		annotations[logicalcluster.AnnotationKey] = "root:org:ws"
+		return metav1.ObjectMeta{Name: "test", Namespace: "backend", Annotations: annotations}
+	}
+
+	tests := []struct {
+		name     string
+		gvr      schema.GroupVersionResource
+		original runtime.Object
+		expected runtime.Object
+	}{
+		{
+			name: "deployment: env vars, args and commands of all the containers are rewritten",
+			gvr:  appsv1.SchemeGroupVersion.WithResource("deployments"),
+			original: &appsv1.Deployment{
+				ObjectMeta: objectMeta(map[string]string{}),
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							InitContainers: []corev1.Container{{
+								Name:    "wait",
+								Command: []string{"sh", "-c", "until nslookup db.backend.svc; do sleep 1; done"},
+							}},
+							Containers: []corev1.Container{{
+								Name: "app",
+								Args: []string{"--db=db.backend.svc:5432"},
+								Env: []corev1.EnvVar{
+									{Name: "DB_URL", Value: "postgres://db.backend.svc.cluster.local/app"},
+									{Name: "NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+								},
+							}},
+						},
+					},
+				},
+			},
+			expected: &appsv1.Deployment{
+				ObjectMeta: objectMeta(map[string]string{}),
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							InitContainers: []corev1.Container{{
+								Name:    "wait",
+								Command: []string{"sh", "-c", "until nslookup db.kcp-backend.svc; do sleep 1; done"},
+							}},
+							Containers: []corev1.Container{{
+								Name: "app",
+								Args: []string{"--db=db.kcp-backend.svc:5432"},
+								Env: []corev1.EnvVar{
+									{Name: "DB_URL", Value: "postgres://db.kcp-backend.svc.cluster.local/app"},
+									{Name: "NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+								},
+							}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "configmap: only the annotated keys are rewritten",
+			gvr:  corev1.SchemeGroupVersion.WithResource("configmaps"),
+			original: &corev1.ConfigMap{
+				ObjectMeta: objectMeta(map[string]string{workloadv1alpha1.RewriteServiceDNSAnnotation: "db-url, missing"}),
+				Data: map[string]string{
+					"db-url":  "db.backend.svc",
+					"comment": "db.backend.svc",
+				},
+			},
+			expected: &corev1.ConfigMap{
+				ObjectMeta: objectMeta(map[string]string{workloadv1alpha1.RewriteServiceDNSAnnotation: "db-url, missing"}),
+				Data: map[string]string{
+					"db-url":  "db.kcp-backend.svc",
+					"comment": "db.backend.svc",
+				},
+			},
+		},
+		{
+			name: "configmap: nothing is rewritten without the annotation",
+			gvr:  corev1.SchemeGroupVersion.WithResource("configmaps"),
+			original: &corev1.ConfigMap{
+				ObjectMeta: objectMeta(map[string]string{}),
+				Data:       map[string]string{"db-url": "db.backend.svc"},
+			},
+			expected: &corev1.ConfigMap{
+				ObjectMeta: objectMeta(map[string]string{}),
+				Data:       map[string]string{"db-url": "db.backend.svc"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.original)
+			require.NoError(t, err)
+			obj := &unstructured.Unstructured{Object: content}
+
+			require.NoError(t, mutators[tc.gvr].Mutate(obj))
+
+			expected, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.expected)
+			require.NoError(t, err)
+			require.Equal(t, expected, obj.Object)
+		})
+	}
+}
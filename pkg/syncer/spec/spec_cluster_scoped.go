@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/klog/v2"
+
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+// processClusterScoped syncs a cluster-scoped upstream object. Its downstream object is named with
+// shared.DownstreamClusterScopedName, and holds the locator of the workspace it is synced from, which
+// tells which workspace owns it.
+func (c *Controller) processClusterScoped(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, name string) error {
+	downstreamName := shared.DownstreamClusterScopedName(gvr.GroupResource(), clusterName, name)
+
+	upstreamInformer, err := c.upstreamInformers.SyncedInformer(gvr)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := upstreamInformer.Informer().GetIndexer().GetByKey(clusterName.String() + "|" + name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// deleted upstream => delete downstream, unless it is owned by another workspace
+		if owned, err := c.ownsDownstreamClusterScoped(ctx, gvr, downstreamName, clusterName); err != nil || !owned {
+			return err
+		}
+		if c.dryRunReport != nil {
+			return c.dryRunDelete(ctx, gvr, "", downstreamName, upstreamKey(clusterName, "", name))
+		}
+		klog.Infof("Deleting downstream GVR %q object %s for upstream cluster %q", gvr.String(), downstreamName, clusterName)
+		if err := c.downstreamClient.Resource(gvr).Delete(ctx, downstreamName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, gvr, "delete")
+			return err
+		}
+		return nil
+	}
+
+	upstreamObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("object to synchronize is expected to be Unstructured, but is %T", obj)
+	}
+
+	if c.dryRunReport == nil {
+		if added, err := c.ensureSyncerFinalizer(ctx, gvr, upstreamObj); added {
+			// The successful update of the upstream resource finalizer will trigger a new reconcile
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return c.applyToDownstream(ctx, gvr, "", upstreamObj)
+}
+
+// clusterScopedLocator returns the locator of the downstream cluster-scoped objects synced from the workspace.
+func (c *Controller) clusterScopedLocator(clusterName logicalcluster.Name) shared.NamespaceLocator {
+	return shared.NewNamespaceLocator(clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, "")
+}
+
+// downstreamClusterScopedLocator returns the locator of the downstream cluster-scoped object, or nil if it has none,
+// and whether the object exists. The objects not synced by the syncer are only found with a live request, since the
+// downstream informers only see the synced ones.
+func (c *Controller) downstreamClusterScopedLocator(ctx context.Context, gvr schema.GroupVersionResource, downstreamName string) (*shared.NamespaceLocator, bool, error) {
+	downstreamInformer, err := c.downstreamInformers.SyncedInformer(gvr)
+	if err != nil {
+		return nil, false, err
+	}
+	var downstreamObj metav1.Object
+	if obj, err := downstreamInformer.Lister().Get(downstreamName); err == nil {
+		downstreamObj = obj.(*unstructured.Unstructured)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, false, err
+	} else if obj, err := c.downstreamClient.Resource(gvr).Get(ctx, downstreamName, metav1.GetOptions{}); err == nil {
+		downstreamObj = obj
+	} else if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	} else {
+		return nil, false, err
+	}
+
+	locator, _, err := shared.LocatorFromAnnotations(downstreamObj.GetAnnotations())
+	if err != nil {
+		return nil, true, err
+	}
+	return locator, true, nil
+}
+
+// ownsDownstreamClusterScoped returns whether the downstream cluster-scoped object exists and is synced from the workspace.
+func (c *Controller) ownsDownstreamClusterScoped(ctx context.Context, gvr schema.GroupVersionResource, downstreamName string, clusterName logicalcluster.Name) (bool, error) {
+	locator, exists, err := c.downstreamClusterScopedLocator(ctx, gvr, downstreamName)
+	if err != nil || !exists || locator == nil {
+		return false, err
+	}
+	return reflect.DeepEqual(*locator, c.clusterScopedLocator(clusterName)), nil
+}
+
+// ensureClusterScopedOwnership returns an error if the downstream cluster-scoped object exists and is not
+// synced from the workspace, so that the objects created by other workspaces or directly downstream are
+// never overwritten.
+func (c *Controller) ensureClusterScopedOwnership(ctx context.Context, gvr schema.GroupVersionResource, downstreamName string, clusterName logicalcluster.Name) error {
+	locator, exists, err := c.downstreamClusterScopedLocator(ctx, gvr, downstreamName)
+	if err != nil || !exists {
+		return err
+	}
+	if locator == nil || !reflect.DeepEqual(*locator, c.clusterScopedLocator(clusterName)) {
+		return fmt.Errorf("(name collision) downstream %s %s already exists, and is not synced from workspace %s", gvr.Resource, downstreamName, clusterName)
+	}
+	return nil
+}
+
+// setClusterScopedLocator sets the locator of the workspace on the downstream cluster-scoped object.
+func (c *Controller) setClusterScopedLocator(downstreamObj *unstructured.Unstructured, clusterName logicalcluster.Name) error {
+	locator, err := json.Marshal(c.clusterScopedLocator(clusterName))
+	if err != nil {
+		return err
+	}
+	annotations := downstreamObj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[shared.NamespaceLocatorAnnotation] = string(locator)
+	downstreamObj.SetAnnotations(annotations)
+	return nil
+}
+
+// deleteClusterScoped deletes the downstream cluster-scoped object of the upstream object removed from the SyncTarget,
+// and removes the syncer finalizer of the upstream object. Downstream objects of other workspaces are left alone.
+func (c *Controller) deleteClusterScoped(ctx context.Context, gvr schema.GroupVersionResource, upstreamObj *unstructured.Unstructured, downstreamName string) error {
+	clusterName := logicalcluster.From(upstreamObj)
+	owned, err := c.ownsDownstreamClusterScoped(ctx, gvr, downstreamName, clusterName)
+	if err != nil {
+		return err
+	}
+	if owned && c.dryRunReport != nil {
+		return c.dryRunDelete(ctx, gvr, "", downstreamName, upstreamKey(clusterName, "", upstreamObj.GetName()))
+	} else if c.dryRunReport != nil {
+		return nil
+	} else if owned {
+		if err := c.downstreamClient.Resource(gvr).Delete(ctx, downstreamName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, gvr, "delete")
+			klog.Errorf("Error deleting %s %s from downstream %s|%s: %v", gvr.Resource, upstreamObj.GetName(), clusterName, downstreamName, err)
+			return err
+		}
+		klog.V(2).Infof("Deleted %s %s from downstream %s|%s", gvr.Resource, upstreamObj.GetName(), clusterName, downstreamName)
+	}
+	// The status syncer does not handle cluster-scoped objects, so the finalizer is removed right away.
+	return shared.EnsureUpstreamFinalizerRemoved(ctx, gvr, c.upstreamInformers, c.upstreamClient, "", c.syncTargetKey, clusterName, upstreamObj.GetName())
+}
+
+// downstreamClusterScopedName returns the name of the downstream object of the cluster-scoped upstream object
+// of the workspace, if the object is synced to the SyncTarget.
+func (c *Controller) downstreamClusterScopedName(gr schema.GroupResource, clusterName logicalcluster.Name, name string) (string, bool, error) {
+	for _, gvr := range c.upstreamInformers.GVRs() {
+		if gvr.GroupResource() != gr {
+			continue
+		}
+		upstreamInformer, err := c.upstreamInformers.SyncedInformer(gvr)
+		if err != nil {
+			return "", false, err
+		}
+		if _, err := upstreamInformer.Lister().Get(clusters.ToClusterAwareKey(clusterName, name)); apierrors.IsNotFound(err) {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		return shared.DownstreamClusterScopedName(gr, clusterName, name), true, nil
+	}
+	return "", false, nil
+}
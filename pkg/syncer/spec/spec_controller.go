@@ -31,13 +31,16 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	"github.com/kcp-dev/kcp/pkg/informer"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 	specmutators "github.com/kcp-dev/kcp/pkg/syncer/spec/mutators"
 	"github.com/kcp-dev/kcp/third_party/keyfunctions"
@@ -56,31 +59,85 @@ type Controller struct {
 
 	upstreamClient                         dynamic.ClusterInterface
 	downstreamClient                       dynamic.Interface
-	upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory
+	upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory
 
 	syncTargetName            string
 	syncTargetWorkspace       logicalcluster.Name
 	syncTargetUID             types.UID
 	syncTargetKey             string
 	advancedSchedulingEnabled bool
+
+	// dryRunReport is set in dry-run mode, in which case nothing is written downstream or upstream,
+	// and the downstream changes the syncer would have made are recorded instead.
+	dryRunReport *DryRunReport
+
+	// driftPreservedResources are the group resources, e.g. deployments.apps, for which the changes made
+	// directly downstream to the synced fields are preserved. They are reverted for the other resources.
+	driftPreservedResources sets.String
+
+	// namespaceNamer names the downstream namespaces created for the upstream namespaces.
+	namespaceNamer shared.NamespaceNamer
 }
 
-func NewSpecSyncer(gvrs []schema.GroupVersionResource, syncTargetWorkspace logicalcluster.Name, syncTargetName, syncTargetKey string, upstreamURL *url.URL, advancedSchedulingEnabled bool,
-	upstreamClient dynamic.ClusterInterface, downstreamClient dynamic.Interface, upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory, syncTargetUID types.UID) (*Controller, error) {
+// SpecSyncerOptions are the options of a spec syncer.
+type SpecSyncerOptions struct {
+	SyncTargetWorkspace       logicalcluster.Name
+	SyncTargetName            string
+	SyncTargetKey             string
+	SyncTargetUID             types.UID
+	UpstreamURL               *url.URL
+	AdvancedSchedulingEnabled bool
+
+	UpstreamClient      dynamic.ClusterInterface
+	DownstreamClient    dynamic.Interface
+	UpstreamInformers   resourcesync.SyncerInformerFactory
+	DownstreamInformers resourcesync.SyncerInformerFactory
+
+	// ServiceAccountTokenSecret, if not nil, returns the downstream Secrets holding the service account tokens
+	// mounted by the pod templates of the synced workloads. Otherwise, they mount the legacy service account
+	// token Secrets synced from upstream.
+	ServiceAccountTokenSecret specmutators.ServiceAccountTokenSecretFunc
+	// DryRunReport, if not nil, makes the spec syncer run in dry-run mode and record into it the downstream
+	// changes it would have made.
+	DryRunReport *DryRunReport
+	// DriftPreservedResources are the group resources whose changes made directly downstream to the synced
+	// objects are preserved. The changes are recorded upstream, and reverted for the other resources.
+	DriftPreservedResources sets.String
+	// NamespaceNamer names the downstream namespaces. If nil, they are named after the hash of their namespace locator.
+	NamespaceNamer shared.NamespaceNamer
+	// WorkloadMappings, if not nil, returns the mappings of the images and StorageClass names of the synced objects.
+	WorkloadMappings specmutators.WorkloadMappingsFunc
+	// ResourceQuotaScaling, if not nil, returns the scaling of the hard limits of the synced ResourceQuotas.
+	ResourceQuotaScaling specmutators.ResourceQuotaScalingFunc
+}
+
+// NewSpecSyncer returns a spec syncer.
+func NewSpecSyncer(options SpecSyncerOptions) (*Controller, error) {
+	if options.NamespaceNamer == nil {
+		options.NamespaceNamer = func(l shared.NamespaceLocator) ([]string, error) {
+			return shared.DownstreamNamespaceNames(nil, l)
+		}
+	}
 
 	c := Controller{
-		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName),
-
-		upstreamClient:      upstreamClient,
-		downstreamClient:    downstreamClient,
-		upstreamInformers:   upstreamInformers,
-		downstreamInformers: downstreamInformers,
-
-		syncTargetName:            syncTargetName,
-		syncTargetWorkspace:       syncTargetWorkspace,
-		syncTargetUID:             syncTargetUID,
-		syncTargetKey:             syncTargetKey,
-		advancedSchedulingEnabled: advancedSchedulingEnabled,
+		queue: syncermetrics.NewQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName), func(item interface{}) schema.GroupVersionResource {
+			return item.(queueKey).gvr
+		}),
+
+		upstreamClient:      options.UpstreamClient,
+		downstreamClient:    options.DownstreamClient,
+		upstreamInformers:   options.UpstreamInformers,
+		downstreamInformers: options.DownstreamInformers,
+
+		syncTargetName:            options.SyncTargetName,
+		syncTargetWorkspace:       options.SyncTargetWorkspace,
+		syncTargetUID:             options.SyncTargetUID,
+		syncTargetKey:             options.SyncTargetKey,
+		advancedSchedulingEnabled: options.AdvancedSchedulingEnabled,
+
+		dryRunReport:            options.DryRunReport,
+		driftPreservedResources: options.DriftPreservedResources,
+		namespaceNamer:          options.NamespaceNamer,
 	}
 
 	namespaceGVR := schema.GroupVersionResource{
@@ -88,88 +145,130 @@ func NewSpecSyncer(gvrs []schema.GroupVersionResource, syncTargetWorkspace logic
 		Version:  "v1",
 		Resource: "namespaces",
 	}
-	namespaceLister := downstreamInformers.ForResource(namespaceGVR).Lister()
+	namespaceLister := options.DownstreamInformers.ForResource(namespaceGVR).Lister()
 
-	err := downstreamInformers.ForResource(namespaceGVR).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: indexByNamespaceLocator})
+	err := options.DownstreamInformers.ForResource(namespaceGVR).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: shared.IndexByNamespaceLocator})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, gvr := range gvrs {
-		gvr := gvr // because used in closure
+	options.UpstreamInformers.AddEventHandler(informer.GVREventHandlerFuncs{
+		AddFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.AddToQueue(gvr, obj)
+		},
+		UpdateFunc: func(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+			oldUnstrob := oldObj.(*unstructured.Unstructured)
+			newUnstrob := newObj.(*unstructured.Unstructured)
 
-		upstreamInformers.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				c.AddToQueue(gvr, obj)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				oldUnstrob := oldObj.(*unstructured.Unstructured)
-				newUnstrob := newObj.(*unstructured.Unstructured)
+			if !deepEqualApartFromStatus(oldUnstrob, newUnstrob) {
+				c.AddToQueue(gvr, newUnstrob)
+			}
+		},
+		DeleteFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.AddToQueue(gvr, obj)
+		},
+	})
+	klog.V(2).InfoS("Set up upstream informers", "syncTargetWorkspace", options.SyncTargetWorkspace, "syncTargetName", options.SyncTargetName, "syncTargetKey", options.SyncTargetKey)
 
-				if !deepEqualApartFromStatus(oldUnstrob, newUnstrob) {
-					c.AddToQueue(gvr, newUnstrob)
-				}
-			},
-			DeleteFunc: func(obj interface{}) {
-				c.AddToQueue(gvr, obj)
-			},
-		})
-
-		klog.V(2).InfoS("Set up upstream informer", "syncTargetWorkspace", syncTargetWorkspace, "syncTargetName", syncTargetName, "syncTargetKey", syncTargetKey, "gvr", gvr.String())
-
-		downstreamInformers.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			DeleteFunc: func(obj interface{}) {
-				key, err := keyfunctions.DeletionHandlingMetaNamespaceKeyFunc(obj)
-				if err != nil {
-					utilruntime.HandleError(fmt.Errorf("error getting key for type %T: %w", obj, err))
-					return
-				}
-				namespace, name, err := cache.SplitMetaNamespaceKey(key)
-				if err != nil {
-					utilruntime.HandleError(fmt.Errorf("error splitting key %q: %w", key, err))
-				}
-				klog.V(3).InfoS("processing delete event", "key", key, "gvr", gvr, "namespace", namespace, "name", name)
-
-				// Use namespace lister
-				nsObj, err := namespaceLister.Get(namespace)
-				if err != nil {
-					utilruntime.HandleError(err)
-					return
-				}
-				ns, ok := nsObj.(*unstructured.Unstructured)
-				if !ok {
-					utilruntime.HandleError(fmt.Errorf("unexpected object type: %T", nsObj))
-					return
-				}
-				locator, ok := ns.GetAnnotations()[shared.NamespaceLocatorAnnotation]
-				if !ok {
-					utilruntime.HandleError(fmt.Errorf("unable to find the locator annotation in namespace %s", namespace))
-					return
-				}
-				nsLocator := &shared.NamespaceLocator{}
-				err = json.Unmarshal([]byte(locator), nsLocator)
-				if err != nil {
-					utilruntime.HandleError(err)
-					return
-				}
-				klog.V(4).InfoS("found", "NamespaceLocator", nsLocator)
-				m := &metav1.ObjectMeta{
-					Annotations: map[string]string{
-						logicalcluster.AnnotationKey: nsLocator.Workspace.String(),
-					},
-					Namespace: nsLocator.Namespace,
-					Name:      shared.GetUpstreamResourceName(gvr, name),
-				}
-				c.AddToQueue(gvr, m)
+	addUpstreamToQueue := func(gvr schema.GroupVersionResource, obj interface{}) {
+		key, err := keyfunctions.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error getting key for type %T: %w", obj, err))
+			return
+		}
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error splitting key %q: %w", key, err))
+		}
+		klog.V(3).InfoS("processing downstream event", "key", key, "gvr", gvr, "namespace", namespace, "name", name)
+
+		if namespace == "" {
+			// Cluster-scoped objects hold the locator of the workspace they are synced from.
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			downstreamObj, ok := obj.(metav1.Object)
+			if !ok {
+				utilruntime.HandleError(fmt.Errorf("unexpected object type: %T", obj))
+				return
+			}
+			locator, found, err := shared.LocatorFromAnnotations(downstreamObj.GetAnnotations())
+			if err != nil {
+				utilruntime.HandleError(err)
+				return
+			}
+			if !found {
+				utilruntime.HandleError(fmt.Errorf("unable to find the locator annotation in %s %s", gvr.Resource, name))
+				return
+			}
+			c.AddToQueue(gvr, &metav1.ObjectMeta{
+				Annotations: map[string]string{
+					logicalcluster.AnnotationKey: locator.Workspace.String(),
+				},
+				Name: shared.UpstreamClusterScopedName(gvr.GroupResource(), locator.Workspace, name),
+			})
+			return
+		}
+
+		// Use namespace lister
+		nsObj, err := namespaceLister.Get(namespace)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		ns, ok := nsObj.(*unstructured.Unstructured)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %T", nsObj))
+			return
+		}
+		locator, ok := ns.GetAnnotations()[shared.NamespaceLocatorAnnotation]
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("unable to find the locator annotation in namespace %s", namespace))
+			return
+		}
+		nsLocator := &shared.NamespaceLocator{}
+		err = json.Unmarshal([]byte(locator), nsLocator)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		klog.V(4).InfoS("found", "NamespaceLocator", nsLocator)
+		m := &metav1.ObjectMeta{
+			Annotations: map[string]string{
+				logicalcluster.AnnotationKey: nsLocator.Workspace.String(),
 			},
-		})
-		klog.V(2).InfoS("Set up downstream informer", "SyncTarget Workspace", syncTargetWorkspace, "SyncTarget Name", syncTargetName, "gvr", gvr.String())
+			Namespace: nsLocator.Namespace,
+			Name:      shared.GetUpstreamResourceName(gvr, name),
+		}
+		c.AddToQueue(gvr, m)
 	}
 
+	options.DownstreamInformers.AddEventHandler(informer.GVREventHandlerFuncs{
+		UpdateFunc: func(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+			// A downstream object changed by another field manager than the syncer may have drifted from upstream.
+			oldUnstrob, ok := oldObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			newUnstrob, ok := newObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if foreignManagedFieldsChanged(oldUnstrob, newUnstrob) {
+				addUpstreamToQueue(gvr, newUnstrob)
+			}
+		},
+		DeleteFunc: addUpstreamToQueue,
+	})
+	klog.V(2).InfoS("Set up downstream informers", "SyncTarget Workspace", options.SyncTargetWorkspace, "SyncTarget Name", options.SyncTargetName)
+
 	secretMutator := specmutators.NewSecretMutator()
 
-	upstreamSecretIndexer := upstreamInformers.ForResource(schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}).Informer().GetIndexer()
-	deploymentMutator := specmutators.NewDeploymentMutator(upstreamURL, newSecretLister(upstreamSecretIndexer))
+	upstreamSecretIndexer := options.UpstreamInformers.ForResource(schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"}).Informer().GetIndexer()
+	if options.ServiceAccountTokenSecret == nil {
+		options.ServiceAccountTokenSecret = specmutators.LegacyServiceAccountTokenSecret(newSecretLister(upstreamSecretIndexer))
+	}
+	podTemplateMutators := specmutators.NewPodTemplateMutators(options.UpstreamURL, options.ServiceAccountTokenSecret)
 
 	if err := upstreamSecretIndexer.AddIndexers(cache.Indexers{
 		byWorkspaceAndNamespaceIndexName: indexByWorkspaceAndNamespace,
@@ -177,8 +276,26 @@ func NewSpecSyncer(gvrs []schema.GroupVersionResource, syncTargetWorkspace logic
 		return nil, err
 	}
 	c.mutators = mutatorGvrMap{
-		deploymentMutator.GVR(): deploymentMutator.Mutate,
-		secretMutator.GVR():     secretMutator.Mutate,
+		secretMutator.GVR(): {secretMutator.Mutate},
+	}
+	for _, podTemplateMutator := range podTemplateMutators {
+		c.mutators[podTemplateMutator.GVR()] = append(c.mutators[podTemplateMutator.GVR()], podTemplateMutator.Mutate)
+	}
+	// The Service DNS names, the class references and the workload mappings are applied after the pod templates are mutated.
+	for _, serviceDNSMutator := range specmutators.NewServiceDNSMutators(c.downstreamNamespaceName) {
+		c.mutators[serviceDNSMutator.GVR()] = append(c.mutators[serviceDNSMutator.GVR()], serviceDNSMutator.Mutate)
+	}
+	for _, classReferencesMutator := range specmutators.NewClassReferencesMutators(c.downstreamClusterScopedName) {
+		c.mutators[classReferencesMutator.GVR()] = append(c.mutators[classReferencesMutator.GVR()], classReferencesMutator.Mutate)
+	}
+	if options.WorkloadMappings != nil {
+		for _, mappingsMutator := range specmutators.NewWorkloadMappingsMutators(options.WorkloadMappings) {
+			c.mutators[mappingsMutator.GVR()] = append(c.mutators[mappingsMutator.GVR()], mappingsMutator.Mutate)
+		}
+	}
+	if options.ResourceQuotaScaling != nil {
+		resourceQuotaMutator := specmutators.NewResourceQuotaMutator(options.ResourceQuotaScaling)
+		c.mutators[resourceQuotaMutator.GVR()] = append(c.mutators[resourceQuotaMutator.GVR()], resourceQuotaMutator.Mutate)
 	}
 
 	return &c, nil
@@ -189,6 +306,10 @@ type queueKey struct {
 	key string // meta namespace key
 }
 
+func (k queueKey) String() string {
+	return fmt.Sprintf("%s %s", k.gvr, k.key)
+}
+
 func (c *Controller) AddToQueue(gvr schema.GroupVersionResource, obj interface{}) {
 	key, err := kcpcache.DeletionHandlingMetaClusterNamespaceKeyFunc(obj)
 	if err != nil {
@@ -237,7 +358,18 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	// other workers.
 	defer c.queue.Done(key)
 
-	if err := c.process(ctx, qk.gvr, qk.key); err != nil {
+	if !c.upstreamInformers.Has(qk.gvr) {
+		// The resource type is not synced anymore. Leave the downstream object alone,
+		// an empty upstream lister must not be mistaken for a deletion.
+		klog.V(4).InfoS("Dropping key of a resource type that is not synced anymore", "gvr", qk.gvr, "key", qk.key)
+		c.queue.Forget(key)
+		return true
+	}
+
+	start := time.Now()
+	err := c.process(ctx, qk.gvr, qk.key)
+	syncermetrics.ObserveProcessing(controllerName, qk.gvr, key, start, err)
+	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, key, err))
 		c.queue.AddRateLimited(key)
 		return true
@@ -275,22 +407,3 @@ func indexByWorkspaceAndNamespace(obj interface{}) ([]string, error) {
 func workspaceAndNamespaceIndexKey(logicalcluster logicalcluster.Name, namespace string) string {
 	return logicalcluster.String() + "/" + namespace
 }
-
-// indexByNamespaceLocator is a cache.IndexFunc that indexes namespaces by the namespaceLocator annotation.
-func indexByNamespaceLocator(obj interface{}) ([]string, error) {
-	metaObj, ok := obj.(metav1.Object)
-	if !ok {
-		return []string{}, fmt.Errorf("obj is supposed to be a metav1.Object, but is %T", obj)
-	}
-	if loc, found, err := shared.LocatorFromAnnotations(metaObj.GetAnnotations()); err != nil {
-		return []string{}, fmt.Errorf("failed to get locator from annotations: %w", err)
-	} else if !found {
-		return []string{}, nil
-	} else {
-		bs, err := json.Marshal(loc)
-		if err != nil {
-			return []string{}, fmt.Errorf("failed to marshal locator %#v: %w", loc, err)
-		}
-		return []string{string(bs)}, nil
-	}
-}
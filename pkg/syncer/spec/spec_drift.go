@@ -0,0 +1,251 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+)
+
+// Drift describes the changes made to a downstream object by other field managers than the syncer,
+// on fields the syncer applies from upstream. It is recorded in the drift annotation of the upstream object.
+type Drift struct {
+	// Managers are the field managers that made the changes, e.g. kubectl-edit.
+	Managers []string `json:"managers"`
+	// Fields are the paths of the changed fields, e.g. .spec.replicas.
+	Fields []string `json:"fields"`
+	// Reverted is true if the syncer reverted the changes, and false if it preserves them.
+	Reverted bool `json:"reverted"`
+	// Blocked is true if the preserved changes conflict with changes made upstream, which are not
+	// applied until the conflicting changes are reverted downstream.
+	Blocked bool `json:"blocked,omitempty"`
+	// DetectedAt is the time the changes were detected at.
+	DetectedAt metav1.Time `json:"detectedAt"`
+}
+
+// detectDrift returns the drift of the live downstream object from the object the syncer is about to apply,
+// or nil if there is none. Only the fields owned by other managers than the syncer, and whose value differs
+// from the applied one, are considered, so that fields set downstream by controllers or defaulting are not.
+func detectDrift(live, desired *unstructured.Unstructured) (*Drift, error) {
+	managers := sets.NewString()
+	fields := sets.NewString()
+	for _, entry := range foreignManagedFields(live) {
+		if entry.FieldsV1 == nil {
+			continue
+		}
+		set := &fieldpath.Set{}
+		if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, err
+		}
+		set.Leaves().Iterate(func(path fieldpath.Path) {
+			desiredValue, found := valueAt(desired.Object, path)
+			if !found {
+				return
+			}
+			liveValue, found := valueAt(live.Object, path)
+			if found && value.Equals(value.NewValueInterface(liveValue), value.NewValueInterface(desiredValue)) {
+				return
+			}
+			managers.Insert(entry.Manager)
+			fields.Insert(path.String())
+		})
+	}
+	if fields.Len() == 0 {
+		return nil, nil
+	}
+	return &Drift{
+		Managers: managers.List(),
+		Fields:   fields.List(),
+	}, nil
+}
+
+// foreignManagedFields returns the managed fields entries of the main resource owned by other managers than the syncer.
+func foreignManagedFields(obj *unstructured.Unstructured) []metav1.ManagedFieldsEntry {
+	var entries []metav1.ManagedFieldsEntry
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == syncerApplyManager || entry.Subresource != "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Manager < entries[j].Manager
+	})
+	return entries
+}
+
+// foreignManagedFieldsChanged returns true if the managed fields of other managers than the syncer differ between
+// the two versions of a downstream object, in which case the object may have drifted.
+func foreignManagedFieldsChanged(oldObj, newObj *unstructured.Unstructured) bool {
+	newEntries := foreignManagedFields(newObj)
+	return len(newEntries) > 0 && !reflect.DeepEqual(foreignManagedFields(oldObj), newEntries)
+}
+
+// valueAt returns the value at the given field path of an unstructured object, if any.
+func valueAt(obj interface{}, path fieldpath.Path) (interface{}, bool) {
+	for _, element := range path {
+		switch {
+		case element.FieldName != nil:
+			m, ok := obj.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if obj, ok = m[*element.FieldName]; !ok {
+				return nil, false
+			}
+		case element.Key != nil:
+			list, ok := obj.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			obj, ok = findListItem(list, func(item interface{}) bool {
+				m, ok := item.(map[string]interface{})
+				if !ok {
+					return false
+				}
+				for _, field := range *element.Key {
+					if !value.Equals(value.NewValueInterface(m[field.Name]), field.Value) {
+						return false
+					}
+				}
+				return true
+			})
+			if !ok {
+				return nil, false
+			}
+		case element.Value != nil:
+			list, ok := obj.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			obj, ok = findListItem(list, func(item interface{}) bool {
+				return value.Equals(value.NewValueInterface(item), *element.Value)
+			})
+			if !ok {
+				return nil, false
+			}
+		case element.Index != nil:
+			list, ok := obj.([]interface{})
+			if !ok || *element.Index < 0 || *element.Index >= len(list) {
+				return nil, false
+			}
+			obj = list[*element.Index]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+func findListItem(list []interface{}, matches func(item interface{}) bool) (interface{}, bool) {
+	for _, item := range list {
+		if matches(item) {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// conflictingFields returns the paths of the fields of a server-side apply conflict error.
+func conflictingFields(err error) []string {
+	var fields []string
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == metav1.CauseTypeFieldManagerConflict && cause.Field != "" {
+				fields = append(fields, cause.Field)
+			}
+		}
+	}
+	return fields
+}
+
+// recordDrift records the drift of the downstream object, if any, in the drift annotation of the upstream object.
+// A recorded drift that was reverted is kept as a record of the last reverted changes, while a preserved drift
+// is removed once the downstream object does not drift anymore.
+func (c *Controller) recordDrift(ctx context.Context, gvr schema.GroupVersionResource, upstreamObj *unstructured.Unstructured, drift *Drift) error {
+	annotation := workloadv1alpha1.ClusterDriftAnnotationPrefix + c.syncTargetKey
+	recorded, hasRecorded := upstreamObj.GetAnnotations()[annotation]
+
+	var annotationValue string
+	if drift != nil {
+		if hasRecorded {
+			var existing Drift
+			if err := json.Unmarshal([]byte(recorded), &existing); err == nil &&
+				existing.Reverted == drift.Reverted && existing.Blocked == drift.Blocked && reflect.DeepEqual(existing.Managers, drift.Managers) && reflect.DeepEqual(existing.Fields, drift.Fields) {
+				return nil
+			}
+		}
+		data, err := json.Marshal(drift)
+		if err != nil {
+			return err
+		}
+		annotationValue = string(data)
+	} else {
+		if !hasRecorded {
+			return nil
+		}
+		var existing Drift
+		if err := json.Unmarshal([]byte(recorded), &existing); err == nil && existing.Reverted {
+			return nil
+		}
+	}
+
+	upstreamObjCopy := upstreamObj.DeepCopy()
+	annotations := upstreamObjCopy.GetAnnotations()
+	if drift != nil {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[annotation] = annotationValue
+	} else {
+		delete(annotations, annotation)
+	}
+	upstreamObjCopy.SetAnnotations(annotations)
+
+	logicalCluster := logicalcluster.From(upstreamObjCopy)
+	if _, err := c.upstreamClient.Cluster(logicalCluster).Resource(gvr).Namespace(upstreamObjCopy.GetNamespace()).Update(ctx, upstreamObjCopy, metav1.UpdateOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, gvr, "update")
+		}
+		return err
+	}
+	logger := logging.WithObject(klog.FromContext(ctx), upstreamObjCopy).WithValues("gvr", gvr.String(), "syncTarget", c.syncTargetName)
+	if drift != nil {
+		logger.Info("Recorded drift of the downstream object", "fields", drift.Fields, "managers", drift.Managers, "reverted", drift.Reverted, "blocked", drift.Blocked)
+	} else {
+		logger.Info("Cleared drift of the downstream object")
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/third_party/keyfunctions"
+)
+
+func TestDetectDrift(t *testing.T) {
+	desired := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "nginx:1.23"},
+					},
+				},
+			},
+		},
+	}}
+
+	tests := map[string]struct {
+		replicas      int64
+		image         string
+		managedFields []metav1.ManagedFieldsEntry
+
+		expectDrift *Drift
+	}{
+		"only managed by the syncer, expect no drift": {
+			replicas:      2,
+			image:         "nginx:1.23",
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry(syncerApplyManager, "", `{"f:spec":{"f:replicas":{}}}`)},
+		},
+		"replicas changed by another manager, expect drift": {
+			replicas: 5,
+			image:    "nginx:1.23",
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry(syncerApplyManager, "", `{"f:spec":{"f:template":{}}}`),
+				managedFieldsEntry("kubectl-scale", "", `{"f:spec":{"f:replicas":{}}}`),
+			},
+			expectDrift: &Drift{Managers: []string{"kubectl-scale"}, Fields: []string{".spec.replicas"}},
+		},
+		"container image changed by another manager, expect drift": {
+			replicas: 2,
+			image:    "nginx:latest",
+			managedFields: []metav1.ManagedFieldsEntry{
+				managedFieldsEntry("kubectl-edit", "", `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"web\"}":{"f:image":{}}}}}}}`),
+			},
+			expectDrift: &Drift{Managers: []string{"kubectl-edit"}, Fields: []string{`.spec.template.spec.containers[name="web"].image`}},
+		},
+		"field owned by another manager with the applied value, expect no drift": {
+			replicas:      2,
+			image:         "nginx:1.23",
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry("kubectl-scale", "", `{"f:spec":{"f:replicas":{}}}`)},
+		},
+		"field not applied by the syncer, expect no drift": {
+			replicas:      2,
+			image:         "nginx:1.23",
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry("kube-controller-manager", "", `{"f:metadata":{"f:annotations":{"f:deployment.kubernetes.io/revision":{}}}}`)},
+		},
+		"status changed by another manager, expect no drift": {
+			replicas:      2,
+			image:         "nginx:1.23",
+			managedFields: []metav1.ManagedFieldsEntry{managedFieldsEntry("kube-controller-manager", "status", `{"f:spec":{"f:replicas":{}}}`)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			live := desired.DeepCopy()
+			require.NoError(t, unstructured.SetNestedField(live.Object, tc.replicas, "spec", "replicas"))
+			require.NoError(t, unstructured.SetNestedSlice(live.Object, []interface{}{
+				map[string]interface{}{"name": "web", "image": tc.image},
+			}, "spec", "template", "spec", "containers"))
+			live.SetManagedFields(tc.managedFields)
+
+			drift, err := detectDrift(live, desired)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectDrift, drift)
+		})
+	}
+}
+
+func TestSyncerProcessDrift(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	namespacesGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
+	tests := map[string]struct {
+		preserved       sets.String
+		downstreamLabel string
+		applyConflict   bool
+
+		expectError bool
+		expectDrift *Drift
+	}{
+		"no drift, expect nothing recorded": {
+			downstreamLabel: "web",
+		},
+		"drift, expect it to be recorded and reverted": {
+			downstreamLabel: "changed",
+			expectDrift:     &Drift{Managers: []string{"kubectl-label"}, Fields: []string{".metadata.labels.app"}, Reverted: true},
+		},
+		"drift of a preserved resource, expect it to be recorded and preserved": {
+			preserved:       sets.NewString("deployments.apps"),
+			downstreamLabel: "changed",
+			expectDrift:     &Drift{Managers: []string{"kubectl-label"}, Fields: []string{".metadata.labels.app"}},
+		},
+		"drift of a preserved resource conflicting with upstream changes, expect it to be recorded as blocked and retried": {
+			preserved:       sets.NewString("deployments.apps"),
+			downstreamLabel: "changed",
+			applyConflict:   true,
+			expectError:     true,
+			expectDrift:     &Drift{Managers: []string{"kubectl-label"}, Fields: []string{".metadata.labels.app", ".spec.replicas"}, Blocked: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			fromNamespace := namespace("test", "root:org:ws", map[string]string{
+				"state.workload.kcp.dev/" + syncTargetKey: "Sync",
+			}, nil)
+			upstreamDeployment := deployment("theDeployment", "test", "root:org:ws", map[string]string{
+				"state.workload.kcp.dev/" + syncTargetKey: "Sync",
+				"app": "web",
+			}, nil, []string{"workload.kcp.dev/syncer-" + syncTargetKey})
+			downstreamNamespace := namespace("kcp-hcbsa8z6c2er", "",
+				map[string]string{
+					"internal.workload.kcp.dev/cluster": syncTargetKey,
+				},
+				map[string]string{
+					"kcp.dev/namespace-locator": `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+				})
+			downstreamDeployment := deployment("theDeployment", "kcp-hcbsa8z6c2er", "", map[string]string{
+				"internal.workload.kcp.dev/cluster": syncTargetKey,
+				"app":                               tc.downstreamLabel,
+			}, nil, nil)
+			downstreamDeployment.ManagedFields = []metav1.ManagedFieldsEntry{managedFieldsEntry("kubectl-label", "", `{"f:metadata":{"f:labels":{"f:app":{}}}}`)}
+
+			upstreamSecret := secret("default-token-abc", "test", "root:org:ws",
+				map[string]string{"state.workload.kcp.dev/" + syncTargetKey: "Sync"},
+				map[string]string{"kubernetes.io/service-account.name": "default"},
+				map[string][]byte{
+					"token":     []byte("token"),
+					"namespace": []byte("namespace"),
+				})
+
+			fromClient := dynamicfake.NewSimpleDynamicClient(scheme, fromNamespace, upstreamSecret, upstreamDeployment)
+			fromClusterClient := &mockedDynamicCluster{client: fromClient}
+			toClient := dynamicfake.NewSimpleDynamicClient(scheme, downstreamNamespace, downstreamDeployment)
+
+			toClient.PrependReactor("patch", "*", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
+				patchAction := action.(clienttesting.PatchAction)
+				if patchAction.GetPatchType() != types.ApplyPatchType {
+					return false, nil, nil
+				}
+				if tc.applyConflict {
+					return true, nil, apierrors.NewApplyConflict([]metav1.StatusCause{
+						{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-scale"`, Field: ".spec.replicas"},
+					}, "Apply failed with 1 conflict")
+				}
+				var applied unstructured.Unstructured
+				if err := json.Unmarshal(patchAction.GetPatch(), &applied.Object); err != nil {
+					return true, nil, err
+				}
+				return true, &applied, nil
+			})
+
+			fromInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactory(fromClusterClient.Cluster(logicalcluster.Wildcard), time.Hour, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+				})
+			})
+			toInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(toClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey
+				}, cache.WithResyncPeriod(time.Hour), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+			})
+
+			upstreamURL, err := url.Parse("https://kcp.dev:6443")
+			require.NoError(t, err)
+			controller, err := NewSpecSyncer(SpecSyncerOptions{
+				SyncTargetWorkspace:     logicalcluster.New("root:org:ws"),
+				SyncTargetName:          "us-west1",
+				SyncTargetKey:           syncTargetKey,
+				SyncTargetUID:           "syncTargetUID",
+				UpstreamURL:             upstreamURL,
+				UpstreamClient:          fromClusterClient,
+				DownstreamClient:        toClient,
+				UpstreamInformers:       fromInformers,
+				DownstreamInformers:     toInformers,
+				DriftPreservedResources: tc.preserved,
+			})
+			require.NoError(t, err)
+
+			gvrs := []schema.GroupVersionResource{
+				namespacesGVR,
+				{Group: "", Version: "v1", Resource: "secrets"},
+				deploymentsGVR,
+			}
+			fromInformers.AddGVRs(gvrs...)
+			toInformers.AddGVRs(gvrs...)
+			fromInformers.Start(ctx.Done())
+			toInformers.Start(ctx.Done())
+			fromInformers.WaitForCacheSync(ctx.Done())
+			toInformers.WaitForCacheSync(ctx.Done())
+
+			fromClient.ClearActions()
+			toClient.ClearActions()
+
+			key := kcpcache.ToClusterAwareKey("root:org:ws", "test", "theDeployment")
+			err = controller.process(ctx, deploymentsGVR, key)
+			if tc.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tc.expectDrift == nil {
+				require.Empty(t, fromClient.Actions())
+				return
+			}
+			require.Len(t, fromClient.Actions(), 1)
+			update, ok := fromClient.Actions()[0].(clienttesting.UpdateAction)
+			require.True(t, ok, "expected an upstream update, got %v", fromClient.Actions()[0])
+			updated := update.GetObject().(*unstructured.Unstructured)
+			var drift Drift
+			require.NoError(t, json.Unmarshal([]byte(updated.GetAnnotations()[workloadv1alpha1.ClusterDriftAnnotationPrefix+syncTargetKey]), &drift))
+			require.False(t, drift.DetectedAt.IsZero())
+			drift.DetectedAt = metav1.Time{}
+			require.Equal(t, *tc.expectDrift, drift)
+		})
+	}
+}
+
+func managedFieldsEntry(manager, subresource, fields string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:     manager,
+		Operation:   metav1.ManagedFieldsOperationUpdate,
+		APIVersion:  "apps/v1",
+		FieldsType:  "FieldsV1",
+		FieldsV1:    &metav1.FieldsV1{Raw: []byte(fields)},
+		Subresource: subresource,
+	}
+}
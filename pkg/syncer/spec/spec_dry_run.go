@@ -0,0 +1,245 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+// DryRunAction is the kind of change the spec syncer would have made to a downstream object.
+type DryRunAction string
+
+const (
+	DryRunCreate DryRunAction = "Create"
+	DryRunUpdate DryRunAction = "Update"
+	DryRunDelete DryRunAction = "Delete"
+)
+
+// DryRunChange is a change the spec syncer would have made to a downstream object in dry-run mode.
+type DryRunChange struct {
+	GVR       schema.GroupVersionResource
+	Namespace string
+	Name      string
+	// Upstream is the upstream object, as <workspace>|<namespace>/<name>.
+	Upstream string
+	Action   DryRunAction
+	// Payload is the server-side apply payload that would have been sent downstream, if any.
+	Payload string
+	// Diff is the JSON merge patch from the live downstream object to the object the change
+	// would have resulted in. It is the whole object for creations, and empty for deletions.
+	Diff string
+}
+
+// DryRunReport holds the latest pending change of every downstream object the spec syncer would
+// have modified in dry-run mode. Changes are forgotten once the downstream object matches upstream.
+type DryRunReport struct {
+	lock    sync.RWMutex
+	changes map[string]DryRunChange
+}
+
+func NewDryRunReport() *DryRunReport {
+	return &DryRunReport{
+		changes: map[string]DryRunChange{},
+	}
+}
+
+// Changes returns the pending changes, sorted by resource, namespace and name.
+func (r *DryRunReport) Changes() []DryRunChange {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	keys := make([]string, 0, len(r.changes))
+	for key := range r.changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make([]DryRunChange, 0, len(keys))
+	for _, key := range keys {
+		changes = append(changes, r.changes[key])
+	}
+	return changes
+}
+
+// Summary returns a human readable summary of the pending changes, and whether there is any.
+func (r *DryRunReport) Summary() (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	counts := map[DryRunAction]int{}
+	for _, change := range r.changes {
+		counts[change.Action]++
+	}
+	return fmt.Sprintf("%d downstream objects would be created, %d updated and %d deleted",
+		counts[DryRunCreate], counts[DryRunUpdate], counts[DryRunDelete]), len(r.changes) > 0
+}
+
+func (r *DryRunReport) record(ctx context.Context, change DryRunChange) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := dryRunKey(change.GVR, change.Namespace, change.Name)
+	if existing, ok := r.changes[key]; ok && existing == change {
+		return
+	}
+	r.changes[key] = change
+
+	klog.FromContext(ctx).Info("dry-run: downstream change not applied", "action", change.Action, "gvr", change.GVR.String(),
+		"downstream", change.Namespace+"/"+change.Name, "upstream", change.Upstream, "payload", change.Payload, "diff", change.Diff)
+}
+
+func (r *DryRunReport) forget(gvr schema.GroupVersionResource, namespace, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.changes, dryRunKey(gvr, namespace, name))
+}
+
+func dryRunKey(gvr schema.GroupVersionResource, namespace, name string) string {
+	return gvr.String() + "|" + namespace + "/" + name
+}
+
+func upstreamKey(clusterName logicalcluster.Name, namespace, name string) string {
+	return clusterName.String() + "|" + namespace + "/" + name
+}
+
+// dryRunApply records the change the server-side apply of downstreamObj would make, by comparing
+// the live downstream object with the result of the same apply request sent with dry-run.
+func (c *Controller) dryRunApply(ctx context.Context, gvr schema.GroupVersionResource, downstreamObj *unstructured.Unstructured, data []byte, upstream string) error {
+	client := c.downstreamClient.Resource(gvr).Namespace(downstreamObj.GetNamespace())
+
+	live, err := client.Get(ctx, downstreamObj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		c.dryRunReport.record(ctx, DryRunChange{
+			GVR:       gvr,
+			Namespace: downstreamObj.GetNamespace(),
+			Name:      downstreamObj.GetName(),
+			Upstream:  upstream,
+			Action:    DryRunCreate,
+			Payload:   string(data),
+			Diff:      string(data),
+		})
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	applied, err := client.Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true), DryRun: []string{metav1.DryRunAll}})
+	if err != nil {
+		return err
+	}
+
+	diff, err := dryRunDiff(live, applied)
+	if err != nil {
+		return err
+	}
+	if diff == "{}" {
+		c.dryRunReport.forget(gvr, downstreamObj.GetNamespace(), downstreamObj.GetName())
+		return nil
+	}
+
+	c.dryRunReport.record(ctx, DryRunChange{
+		GVR:       gvr,
+		Namespace: downstreamObj.GetNamespace(),
+		Name:      downstreamObj.GetName(),
+		Upstream:  upstream,
+		Action:    DryRunUpdate,
+		Payload:   string(data),
+		Diff:      diff,
+	})
+	return nil
+}
+
+// dryRunDelete records the deletion of the downstream object, if it exists.
+func (c *Controller) dryRunDelete(ctx context.Context, gvr schema.GroupVersionResource, namespace, name, upstream string) error {
+	_, err := c.downstreamClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		c.dryRunReport.forget(gvr, namespace, name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.dryRunReport.record(ctx, DryRunChange{
+		GVR:       gvr,
+		Namespace: namespace,
+		Name:      name,
+		Upstream:  upstream,
+		Action:    DryRunDelete,
+	})
+	return nil
+}
+
+// dryRunCreateNamespace records the creation of the downstream namespace.
+func (c *Controller) dryRunCreateNamespace(ctx context.Context, newNamespace *unstructured.Unstructured, upstream string) error {
+	data, err := json.Marshal(newNamespace)
+	if err != nil {
+		return err
+	}
+
+	c.dryRunReport.record(ctx, DryRunChange{
+		GVR:      schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"},
+		Name:     newNamespace.GetName(),
+		Upstream: upstream,
+		Action:   DryRunCreate,
+		Payload:  string(data),
+		Diff:     string(data),
+	})
+	return nil
+}
+
+// dryRunDiff returns the JSON merge patch from live to applied, ignoring the status and the
+// metadata fields maintained by the downstream API server.
+func dryRunDiff(live, applied *unstructured.Unstructured) (string, error) {
+	clean := func(obj *unstructured.Unstructured) ([]byte, error) {
+		obj = obj.DeepCopy()
+		for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp"} {
+			unstructured.RemoveNestedField(obj.Object, "metadata", field)
+		}
+		unstructured.RemoveNestedField(obj.Object, "status")
+		return json.Marshal(obj)
+	}
+
+	liveJSON, err := clean(live)
+	if err != nil {
+		return "", err
+	}
+	appliedJSON, err := clean(applied)
+	if err != nil {
+		return "", err
+	}
+	diff, err := jsonpatch.CreateMergePatch(liveJSON, appliedJSON)
+	if err != nil {
+		return "", err
+	}
+	return string(diff), nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/third_party/keyfunctions"
+)
+
+func TestSyncerProcessDryRun(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	namespacesGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
+	upstreamSecret := secret("default-token-abc", "test", "root:org:ws",
+		map[string]string{"state.workload.kcp.dev/" + syncTargetKey: "Sync"},
+		map[string]string{"kubernetes.io/service-account.name": "default"},
+		map[string][]byte{
+			"token":     []byte("token"),
+			"namespace": []byte("namespace"),
+		})
+	downstreamNamespace := namespace("kcp-hcbsa8z6c2er", "",
+		map[string]string{
+			"internal.workload.kcp.dev/cluster": syncTargetKey,
+		},
+		map[string]string{
+			"kcp.dev/namespace-locator": `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`,
+		})
+
+	tests := map[string]struct {
+		fromResources []runtime.Object
+		toResources   []runtime.Object
+
+		expectVerbsOnTo []string
+		expectChanges   []DryRunAction
+		expectDiff      string
+	}{
+		"deployment not synced yet, expect the namespace and deployment creations to be recorded": {
+			fromResources: []runtime.Object{
+				upstreamSecret,
+				deployment("theDeployment", "test", "root:org:ws", map[string]string{
+					"state.workload.kcp.dev/" + syncTargetKey: "Sync",
+				}, nil, nil),
+			},
+			expectVerbsOnTo: []string{"get"},
+			expectChanges:   []DryRunAction{DryRunCreate, DryRunCreate},
+		},
+		"deployment out of date downstream, expect the update to be recorded with its diff": {
+			fromResources: []runtime.Object{
+				upstreamSecret,
+				deployment("theDeployment", "test", "root:org:ws", map[string]string{
+					"state.workload.kcp.dev/" + syncTargetKey: "Sync",
+				}, nil, nil),
+			},
+			toResources: []runtime.Object{
+				downstreamNamespace,
+				deployment("theDeployment", "kcp-hcbsa8z6c2er", "", map[string]string{
+					"internal.workload.kcp.dev/cluster": syncTargetKey,
+				}, nil, nil),
+			},
+			expectVerbsOnTo: []string{"get", "patch"},
+			expectChanges:   []DryRunAction{DryRunUpdate},
+			expectDiff:      "kcp-api-access",
+		},
+		"deployment deleted upstream, expect the deletion to be recorded": {
+			fromResources: []runtime.Object{
+				upstreamSecret,
+			},
+			toResources: []runtime.Object{
+				downstreamNamespace,
+				deployment("theDeployment", "kcp-hcbsa8z6c2er", "", map[string]string{
+					"internal.workload.kcp.dev/cluster": syncTargetKey,
+				}, nil, nil),
+			},
+			expectVerbsOnTo: []string{"get"},
+			expectChanges:   []DryRunAction{DryRunDelete},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			fromNamespace := namespace("test", "root:org:ws", map[string]string{
+				"state.workload.kcp.dev/" + syncTargetKey: "Sync",
+			}, nil)
+			fromClient := dynamicfake.NewSimpleDynamicClient(scheme, append([]runtime.Object{fromNamespace}, tc.fromResources...)...)
+			fromClusterClient := &mockedDynamicCluster{client: fromClient}
+			toClient := dynamicfake.NewSimpleDynamicClient(scheme, tc.toResources...)
+
+			// The dry-run apply returns the applied object, as the API server would.
+			toClient.PrependReactor("patch", "*", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
+				patchAction := action.(clienttesting.PatchAction)
+				if patchAction.GetPatchType() != types.ApplyPatchType {
+					return false, nil, nil
+				}
+				var applied unstructured.Unstructured
+				if err := json.Unmarshal(patchAction.GetPatch(), &applied.Object); err != nil {
+					return true, nil, err
+				}
+				return true, &applied, nil
+			})
+
+			fromInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactory(fromClusterClient.Cluster(logicalcluster.Wildcard), time.Hour, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+				})
+			})
+			toInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(toClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey
+				}, cache.WithResyncPeriod(time.Hour), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+			})
+
+			upstreamURL, err := url.Parse("https://kcp.dev:6443")
+			require.NoError(t, err)
+			report := NewDryRunReport()
+			controller, err := NewSpecSyncer(SpecSyncerOptions{
+				SyncTargetWorkspace: logicalcluster.New("root:org:ws"),
+				SyncTargetName:      "us-west1",
+				SyncTargetKey:       syncTargetKey,
+				SyncTargetUID:       "syncTargetUID",
+				UpstreamURL:         upstreamURL,
+				UpstreamClient:      fromClusterClient,
+				DownstreamClient:    toClient,
+				UpstreamInformers:   fromInformers,
+				DownstreamInformers: toInformers,
+				DryRunReport:        report,
+			})
+			require.NoError(t, err)
+
+			gvrs := []schema.GroupVersionResource{
+				namespacesGVR,
+				{Group: "", Version: "v1", Resource: "secrets"},
+				deploymentsGVR,
+			}
+			fromInformers.AddGVRs(gvrs...)
+			toInformers.AddGVRs(gvrs...)
+			fromInformers.Start(ctx.Done())
+			toInformers.Start(ctx.Done())
+			fromInformers.WaitForCacheSync(ctx.Done())
+			toInformers.WaitForCacheSync(ctx.Done())
+
+			fromClient.ClearActions()
+			toClient.ClearActions()
+
+			key := kcpcache.ToClusterAwareKey("root:org:ws", "test", "theDeployment")
+			require.NoError(t, controller.process(ctx, deploymentsGVR, key))
+
+			require.Empty(t, fromClient.Actions(), "nothing should be written upstream")
+			var verbs []string
+			for _, action := range toClient.Actions() {
+				verbs = append(verbs, action.GetVerb())
+			}
+			require.Equal(t, tc.expectVerbsOnTo, verbs)
+
+			var actions []DryRunAction
+			for _, change := range report.Changes() {
+				actions = append(actions, change.Action)
+				require.Equal(t, "root:org:ws|test/", change.Upstream[:len("root:org:ws|test/")])
+				if change.GVR == deploymentsGVR {
+					require.Equal(t, "kcp-hcbsa8z6c2er", change.Namespace)
+					require.Equal(t, "theDeployment", change.Name)
+					require.Contains(t, change.Diff, tc.expectDiff)
+				}
+			}
+			require.Equal(t, tc.expectChanges, actions)
+
+			_, pending := report.Summary()
+			require.True(t, pending)
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
@@ -32,6 +33,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -39,6 +41,7 @@ import (
 	"k8s.io/utils/pointer"
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
@@ -46,7 +49,8 @@ const (
 	syncerApplyManager = "syncer"
 )
 
-type mutatorGvrMap map[schema.GroupVersionResource]func(obj *unstructured.Unstructured) error
+// mutatorGvrMap holds the mutators of each resource, applied in order.
+type mutatorGvrMap map[schema.GroupVersionResource][]func(obj *unstructured.Unstructured) error
 
 func deepEqualApartFromStatus(oldUnstrob, newUnstrob *unstructured.Unstructured) bool {
 	// TODO(jmprusi): Remove this after switching to virtual workspaces.
@@ -112,35 +116,19 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 		return nil
 	}
 
-	namespaceGvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
-	desiredNSLocator := shared.NewNamespaceLocator(clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, upstreamNamespace)
-	jsonNSLocator, err := json.Marshal(desiredNSLocator)
-	if err != nil {
-		return err
+	if upstreamNamespace == "" {
+		return c.processClusterScoped(ctx, gvr, clusterName, name)
 	}
-	downstreamNamespaces, err := c.downstreamInformers.ForResource(namespaceGvr).Informer().GetIndexer().ByIndex(byNamespaceLocatorIndexName, string(jsonNSLocator))
+
+	downstreamNamespace, collidingNamespaces, err := c.resolveDownstreamNamespaceName(ctx, clusterName, upstreamNamespace)
 	if err != nil {
 		return err
 	}
-
-	var downstreamNamespace string
-	if len(downstreamNamespaces) == 1 {
-		namespace := downstreamNamespaces[0].(*unstructured.Unstructured)
-		klog.V(4).Infof("Found downstream namespace %s for upstream namespace %s", namespace.GetName(), upstreamNamespace)
-		downstreamNamespace = namespace.GetName()
-	} else if len(downstreamNamespaces) > 1 {
+	if len(collidingNamespaces) > 0 {
 		// This should never happen unless there's some namespace collision.
-		var namespacesCollisions []string
-		for _, namespace := range downstreamNamespaces {
-			namespacesCollisions = append(namespacesCollisions, namespace.(*unstructured.Unstructured).GetName())
-		}
-		return fmt.Errorf("(namespace collision) found multiple downstream namespaces: %s for upstream namespace %s|%s", strings.Join(namespacesCollisions, ","), clusterName, upstreamNamespace)
-	} else {
-		klog.V(4).Infof("No downstream namespaces found for %s", key)
-		downstreamNamespace, err = shared.PhysicalClusterNamespaceName(desiredNSLocator)
+		downstreamNamespace, err = c.resolveNamespaceCollision(ctx, collidingNamespaces, clusterName, upstreamNamespace)
 		if err != nil {
-			klog.Errorf("Error hashing namespace %s|%s: %v", clusterName, upstreamNamespace, err)
-			return nil
+			return err
 		}
 	}
 
@@ -155,14 +143,22 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 	}
 	indexKey += name
 	// get the upstream object
-	obj, exists, err := c.upstreamInformers.ForResource(gvr).Informer().GetIndexer().GetByKey(indexKey)
+	upstreamInformer, err := c.upstreamInformers.SyncedInformer(gvr)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := upstreamInformer.Informer().GetIndexer().GetByKey(indexKey)
 	if err != nil {
 		return err
 	}
 	if !exists {
 		// deleted upstream => delete downstream
+		if c.dryRunReport != nil {
+			return c.dryRunDelete(ctx, gvr, downstreamNamespace, name, upstreamKey(clusterName, upstreamNamespace, name))
+		}
 		klog.Infof("Deleting downstream GVR %q object %s/%s for upstream cluster %q", gvr.String(), downstreamNamespace, name, clusterName)
 		if err := c.downstreamClient.Resource(gvr).Namespace(downstreamNamespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, gvr, "delete")
 			return err
 		}
 		return nil
@@ -178,25 +174,148 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 		return err
 	}
 
-	if added, err := c.ensureSyncerFinalizer(ctx, gvr, upstreamObj); added {
-		// The successful update of the upstream resource finalizer will trigger a new reconcile
-		return nil
-	} else if err != nil {
-		return err
+	// In dry-run mode the upstream object is not marked with the syncer finalizer, as nothing
+	// is synced downstream that would have to be cleaned up before the deletion upstream.
+	if c.dryRunReport == nil {
+		if added, err := c.ensureSyncerFinalizer(ctx, gvr, upstreamObj); added {
+			// The successful update of the upstream resource finalizer will trigger a new reconcile
+			return nil
+		} else if err != nil {
+			return err
+		}
 	}
 
 	return c.applyToDownstream(ctx, gvr, downstreamNamespace, upstreamObj)
 }
 
+// resolveNamespaceCollision resolves the collision of several downstream namespaces synced from the same upstream
+// namespace: the oldest one keeps being synced, and the others are quarantined, i.e. their downstream cluster label
+// is replaced with the quarantine label. It returns the name of the downstream namespace to sync.
+func (c *Controller) resolveNamespaceCollision(ctx context.Context, downstreamNamespaces []interface{}, clusterName logicalcluster.Name, upstreamNamespace string) (string, error) {
+	namespaces := make([]*unstructured.Unstructured, 0, len(downstreamNamespaces))
+	for _, obj := range downstreamNamespaces {
+		namespaces = append(namespaces, obj.(*unstructured.Unstructured))
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		iTime, jTime := namespaces[i].GetCreationTimestamp(), namespaces[j].GetCreationTimestamp()
+		if !iTime.Equal(&jTime) {
+			return iTime.Before(&jTime)
+		}
+		return namespaces[i].GetName() < namespaces[j].GetName()
+	})
+
+	winner := namespaces[0].GetName()
+	reason := fmt.Sprintf("downstream namespace %s was created earlier for upstream namespace %s|%s", winner, clusterName, upstreamNamespace)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				workloadv1alpha1.InternalDownstreamClusterLabel: nil,
+				workloadv1alpha1.QuarantinedNamespaceLabel:      c.syncTargetKey,
+			},
+			"annotations": map[string]interface{}{
+				workloadv1alpha1.QuarantineReasonAnnotation: reason,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	namespaceGvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+	for _, namespace := range namespaces[1:] {
+		if c.dryRunReport != nil {
+			klog.Infof("Dry run: would quarantine downstream namespace %s colliding with %s for upstream namespace %s|%s", namespace.GetName(), winner, clusterName, upstreamNamespace)
+			continue
+		}
+		if _, err := c.downstreamClient.Resource(namespaceGvr).Patch(ctx, namespace.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, namespaceGvr, "patch")
+			return "", err
+		}
+		klog.Infof("Quarantined downstream namespace %s colliding with %s for upstream namespace %s|%s", namespace.GetName(), winner, clusterName, upstreamNamespace)
+	}
+	return winner, nil
+}
+
+// newDownstreamNamespaceName returns the name of the downstream namespace to create for the namespace locator:
+// the first name of the naming strategy that is not taken by another downstream namespace. The existing downstream
+// namespaces are found by their namespace locator instead, so that they keep their name when the strategy changes.
+func (c *Controller) newDownstreamNamespaceName(ctx context.Context, desiredNSLocator shared.NamespaceLocator) (string, error) {
+	names, err := c.namespaceNamer(desiredNSLocator)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no downstream namespace name for upstream namespace %s|%s", desiredNSLocator.Workspace, desiredNSLocator.Namespace)
+	}
+
+	namespaceGvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+	for _, name := range names[:len(names)-1] {
+		// The downstream informers only see the namespaces synced to the SyncTarget.
+		namespace, err := c.downstreamClient.Resource(namespaceGvr).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		if nsLocator, exists, err := shared.LocatorFromAnnotations(namespace.GetAnnotations()); err == nil && exists && reflect.DeepEqual(desiredNSLocator, *nsLocator) {
+			return name, nil
+		}
+		klog.V(2).Infof("Downstream namespace %s is taken, not using it for upstream namespace %s|%s", name, desiredNSLocator.Workspace, desiredNSLocator.Namespace)
+	}
+	// The last name is the hash-based one, for which collisions are reported when ensuring the namespace exists.
+	return names[len(names)-1], nil
+}
+
+// resolveDownstreamNamespaceName returns the name of the downstream namespace of the given upstream namespace, found
+// by its namespace locator, or, when it does not exist yet, the name it is created with. When several downstream
+// namespaces collide for the upstream namespace, they are returned instead of a name.
+func (c *Controller) resolveDownstreamNamespaceName(ctx context.Context, clusterName logicalcluster.Name, upstreamNamespace string) (string, []interface{}, error) {
+	namespaceGvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+	desiredNSLocator := shared.NewNamespaceLocator(clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, upstreamNamespace)
+	jsonNSLocator, err := json.Marshal(desiredNSLocator)
+	if err != nil {
+		return "", nil, err
+	}
+	downstreamNamespaces, err := c.downstreamInformers.ForResource(namespaceGvr).Informer().GetIndexer().ByIndex(byNamespaceLocatorIndexName, string(jsonNSLocator))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(downstreamNamespaces) == 1 {
+		namespace := downstreamNamespaces[0].(*unstructured.Unstructured)
+		klog.V(4).Infof("Found downstream namespace %s for upstream namespace %s|%s", namespace.GetName(), clusterName, upstreamNamespace)
+		return namespace.GetName(), nil, nil
+	} else if len(downstreamNamespaces) > 1 {
+		return "", downstreamNamespaces, nil
+	}
+
+	klog.V(4).Infof("No downstream namespace found for upstream namespace %s|%s", clusterName, upstreamNamespace)
+	name, err := c.newDownstreamNamespaceName(ctx, desiredNSLocator)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, nil, nil
+}
+
+// downstreamNamespaceName returns the name of the downstream namespace of the given upstream namespace.
+// When it does not exist yet, it is the name the namespace is created with.
+func (c *Controller) downstreamNamespaceName(clusterName logicalcluster.Name, upstreamNamespace string) (string, bool, error) {
+	name, collidingNamespaces, err := c.resolveDownstreamNamespaceName(context.TODO(), clusterName, upstreamNamespace)
+	if err != nil {
+		return "", false, err
+	}
+	if len(collidingNamespaces) > 0 {
+		// The collision is resolved when the objects of the namespace are synced.
+		return "", false, nil
+	}
+	return name, true, nil
+}
+
 // TODO: This function is there as a quick and dirty implementation of namespace creation.
 //
 //	In fact We should also be getting notifications about namespaces created upstream and be creating downstream equivalents.
 func (c *Controller) ensureDownstreamNamespaceExists(ctx context.Context, downstreamNamespace string, upstreamObj *unstructured.Unstructured) error {
-	namespaces := c.downstreamClient.Resource(schema.GroupVersionResource{
-		Group:    "",
-		Version:  "v1",
-		Resource: "namespaces",
-	})
+	namespaceGvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+	namespaces := c.downstreamClient.Resource(namespaceGvr)
 
 	newNamespace := &unstructured.Unstructured{}
 	newNamespace.SetAPIVersion("v1")
@@ -223,9 +342,13 @@ func (c *Controller) ensureDownstreamNamespaceExists(ctx context.Context, downst
 	}
 
 	// Check if the namespace already exists, if not create it.
-	namespace, err := c.downstreamInformers.ForResource(schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}).Lister().Get(newNamespace.GetName())
+	namespace, err := c.downstreamInformers.ForResource(namespaceGvr).Lister().Get(newNamespace.GetName())
 	if err != nil && apierrors.IsNotFound(err) {
+		if c.dryRunReport != nil {
+			return c.dryRunCreateNamespace(ctx, newNamespace, upstreamKey(upstreamLogicalCluster, upstreamObj.GetNamespace(), ""))
+		}
 		if _, err := namespaces.Create(ctx, newNamespace, metav1.CreateOptions{}); err != nil {
+			syncermetrics.RecordWriteError(controllerName, namespaceGvr, "create")
 			return err
 		}
 		klog.Infof("Created downstream namespace %s for upstream namespace %s|%s", newNamespace.GetName(), desiredNSLocator.Workspace, desiredNSLocator.Namespace)
@@ -274,7 +397,9 @@ func (c *Controller) ensureSyncerFinalizer(ctx context.Context, gvr schema.Group
 
 		upstreamFinalizers = append(upstreamFinalizers, shared.SyncerFinalizerNamePrefix+c.syncTargetKey)
 		upstreamObjCopy.SetFinalizers(upstreamFinalizers)
-		if _, err := c.upstreamClient.Cluster(logicalCluster).Resource(gvr).Namespace(namespace).Update(ctx, upstreamObjCopy, metav1.UpdateOptions{}); err != nil {
+		_, err := c.upstreamClient.Cluster(logicalCluster).Resource(gvr).Namespace(namespace).Update(ctx, upstreamObjCopy, metav1.UpdateOptions{})
+		syncermetrics.RecordFinalizerAdded(gvr, err)
+		if err != nil {
 			klog.Errorf("Failed adding finalizer upstream on resource %s|%s/%s: %v", logicalCluster, namespace, name, err)
 			return false, err
 		}
@@ -291,6 +416,10 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 
 	// Run name transformations on the downstreamObj.
 	transformedName := getTransformedName(downstreamObj)
+	clusterScoped := upstreamObj.GetNamespace() == ""
+	if clusterScoped {
+		transformedName = shared.DownstreamClusterScopedName(gvr.GroupResource(), upstreamObjLogicalCluster, upstreamObj.GetName())
+	}
 
 	// TODO(jmprusi): When using syncer virtual workspace we would check the DeletionTimestamp on the upstream object, instead of the DeletionTimestamp annotation,
 	//                as the virtual workspace will set the the deletionTimestamp() on the location view by a transformation.
@@ -301,6 +430,12 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 
 	klog.V(4).Infof("Upstream object %s|%s/%s is intended to be removed %t %t", upstreamObjLogicalCluster, upstreamObj.GetNamespace(), upstreamObj.GetName(), intendedToBeRemovedFromLocation, stillOwnedByExternalActorForLocation)
 	if intendedToBeRemovedFromLocation && !stillOwnedByExternalActorForLocation {
+		if clusterScoped {
+			return c.deleteClusterScoped(ctx, gvr, upstreamObj, transformedName)
+		}
+		if c.dryRunReport != nil {
+			return c.dryRunDelete(ctx, gvr, downstreamNamespace, transformedName, upstreamKey(upstreamObjLogicalCluster, upstreamObj.GetNamespace(), upstreamObj.GetName()))
+		}
 		if err := c.downstreamClient.Resource(gvr).Namespace(downstreamNamespace).Delete(ctx, transformedName, metav1.DeleteOptions{}); err != nil {
 			if apierrors.IsNotFound(err) {
 				// That's not an error.
@@ -310,6 +445,7 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 				}
 				return nil
 			}
+			syncermetrics.RecordWriteError(controllerName, gvr, "delete")
 			klog.Errorf("Error deleting %s %s/%s from downstream %s|%s/%s: %v", gvr.Resource, upstreamObj.GetNamespace(), upstreamObj.GetName(), logicalcluster.From(upstreamObj), downstreamNamespace, downstreamObj.GetName(), err)
 			return err
 		}
@@ -318,7 +454,7 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 	}
 
 	// Run any transformations on the object before we apply it to the downstream cluster.
-	if mutator, ok := c.mutators[gvr]; ok {
+	for _, mutator := range c.mutators[gvr] {
 		if err := mutator(downstreamObj); err != nil {
 			return err
 		}
@@ -330,9 +466,14 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 	downstreamObj.SetNamespace(downstreamNamespace)
 	downstreamObj.SetManagedFields(nil)
 
-	// Strip cluster name annotation
+	// Strip cluster name annotation, and the drift annotations that only make sense upstream
 	downstreamAnnotations := downstreamObj.GetAnnotations()
 	delete(downstreamAnnotations, logicalcluster.AnnotationKey)
+	for key := range downstreamAnnotations {
+		if strings.HasPrefix(key, workloadv1alpha1.ClusterDriftAnnotationPrefix) {
+			delete(downstreamAnnotations, key)
+		}
+	}
 	// If we're left with 0 annotations, nil out the map so it's not included in the patch
 	if len(downstreamAnnotations) == 0 {
 		downstreamAnnotations = nil
@@ -355,6 +496,17 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 	labels[workloadv1alpha1.InternalDownstreamClusterLabel] = c.syncTargetKey
 	downstreamObj.SetLabels(labels)
 
+	// Cluster-scoped objects are shared by all the workspaces synced to the SyncTarget: the locator tells which
+	// workspace the object is synced from, and the objects synced from other workspaces are never overwritten.
+	if clusterScoped {
+		if err := c.ensureClusterScopedOwnership(ctx, gvr, transformedName, upstreamObjLogicalCluster); err != nil {
+			return err
+		}
+		if err := c.setClusterScopedLocator(downstreamObj, upstreamObjLogicalCluster); err != nil {
+			return err
+		}
+	}
+
 	if c.advancedSchedulingEnabled {
 		specDiffPatch := upstreamObj.GetAnnotations()[workloadv1alpha1.ClusterSpecDiffAnnotationPrefix+c.syncTargetKey]
 		if specDiffPatch != "" {
@@ -394,10 +546,59 @@ func (c *Controller) applyToDownstream(ctx context.Context, gvr schema.GroupVers
 		return err
 	}
 
-	if _, err := c.downstreamClient.Resource(gvr).Namespace(downstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(true)}); err != nil {
+	if c.dryRunReport != nil {
+		return c.dryRunApply(ctx, gvr, downstreamObj, data, upstreamKey(upstreamObjLogicalCluster, upstreamObj.GetNamespace(), upstreamObj.GetName()))
+	}
+
+	// Changes made directly downstream to the applied fields are reverted by forcing the apply, unless
+	// they are to be preserved for the resource, in which case the apply fails on conflicting fields.
+	preserveDrift := c.driftPreservedResources.Has(gvr.GroupResource().String())
+	downstreamInformer, err := c.downstreamInformers.SyncedInformer(gvr)
+	if err != nil {
+		return err
+	}
+	var live runtime.Object
+	if clusterScoped {
+		live, err = downstreamInformer.Lister().Get(downstreamObj.GetName())
+	} else {
+		live, err = downstreamInformer.Lister().ByNamespace(downstreamNamespace).Get(downstreamObj.GetName())
+	}
+	var drift *Drift
+	if err == nil {
+		if drift, err = detectDrift(live.(*unstructured.Unstructured), downstreamObj); err != nil {
+			return err
+		}
+		if drift != nil {
+			drift.Reverted = !preserveDrift
+			drift.DetectedAt = metav1.Now()
+			syncermetrics.RecordDrift(gvr, drift.Reverted)
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	if _, err := c.downstreamClient.Resource(gvr).Namespace(downstreamNamespace).Patch(ctx, downstreamObj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: syncerApplyManager, Force: pointer.Bool(!preserveDrift)}); err != nil {
+		if preserveDrift && apierrors.IsConflict(err) {
+			// The upstream changes are blocked by the changes preserved downstream. Record it, and retry
+			// until the conflicting changes are reverted downstream.
+			if drift == nil {
+				drift = &Drift{DetectedAt: metav1.Now()}
+			}
+			drift.Fields = sets.NewString(drift.Fields...).Insert(conflictingFields(err)...).List()
+			drift.Blocked = true
+			syncermetrics.RecordDriftBlocked(gvr)
+			if err := c.recordDrift(ctx, gvr, upstreamObj, drift); err != nil {
+				return err
+			}
+			return fmt.Errorf("not applying %s %s/%s from upstream %s|%s/%s, to preserve the changes made downstream: %w", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), logicalcluster.From(upstreamObj), upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
+		}
+		syncermetrics.RecordWriteError(controllerName, gvr, "apply")
 		klog.Errorf("Error upserting %s %s/%s from upstream %s|%s/%s: %v", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), logicalcluster.From(upstreamObj), upstreamObj.GetNamespace(), upstreamObj.GetName(), err)
 		return err
 	}
+	if err := c.recordDrift(ctx, gvr, upstreamObj, drift); err != nil {
+		return err
+	}
 	klog.Infof("Upserted %s %s/%s from upstream %s|%s/%s", gvr.Resource, downstreamObj.GetNamespace(), downstreamObj.GetName(), logicalcluster.From(upstreamObj), upstreamObj.GetNamespace(), upstreamObj.GetName())
 
 	return nil
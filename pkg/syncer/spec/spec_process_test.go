@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/url"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -45,6 +46,8 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 	"github.com/kcp-dev/kcp/third_party/keyfunctions"
 )
 
@@ -985,12 +988,16 @@ func TestSyncerProcess(t *testing.T) {
 			syncTargetKey := workloadv1alpha1.ToSyncTargetKey(tc.syncTargetWorkspace, tc.syncTargetName)
 
 			toClient := dynamicfake.NewSimpleDynamicClient(scheme, tc.toResources...)
-			fromInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactory(fromClusterClient.Cluster(logicalcluster.Wildcard), time.Hour, metav1.NamespaceAll, func(o *metav1.ListOptions) {
-				o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+			fromInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactory(fromClusterClient.Cluster(logicalcluster.Wildcard), time.Hour, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+				})
+			})
+			toInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(toClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+					o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+				}, cache.WithResyncPeriod(time.Hour), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
 			})
-			toInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(toClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
-				o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
-			}, cache.WithResyncPeriod(time.Hour), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
 
 			setupServersideApplyPatchReactor(toClient)
 			namespaceWatcherStarted := setupWatchReactor("namespaces", fromClient)
@@ -1003,9 +1010,23 @@ func TestSyncerProcess(t *testing.T) {
 			}
 			upstreamURL, err := url.Parse("https://kcp.dev:6443")
 			require.NoError(t, err)
-			controller, err := NewSpecSyncer(gvrs, kcpLogicalCluster, tc.syncTargetName, syncTargetKey, upstreamURL, tc.advancedSchedulingEnabled, fromClusterClient, toClient, fromInformers, toInformers, syncTargetUID)
+			controller, err := NewSpecSyncer(SpecSyncerOptions{
+				SyncTargetWorkspace:       kcpLogicalCluster,
+				SyncTargetName:            tc.syncTargetName,
+				SyncTargetKey:             syncTargetKey,
+				SyncTargetUID:             syncTargetUID,
+				UpstreamURL:               upstreamURL,
+				AdvancedSchedulingEnabled: tc.advancedSchedulingEnabled,
+				UpstreamClient:            fromClusterClient,
+				DownstreamClient:          toClient,
+				UpstreamInformers:         fromInformers,
+				DownstreamInformers:       toInformers,
+			})
 			require.NoError(t, err)
 
+			fromInformers.AddGVRs(gvrs...)
+			toInformers.AddGVRs(gvrs...)
+
 			fromInformers.Start(ctx.Done())
 			toInformers.Start(ctx.Done())
 
@@ -1034,6 +1055,228 @@ func TestSyncerProcess(t *testing.T) {
 	}
 }
 
+func TestNewDownstreamNamespaceName(t *testing.T) {
+	syncTargetWorkspace := logicalcluster.New("root:org:ws")
+	locator := shared.NewNamespaceLocator(logicalcluster.New("root:org:team"), syncTargetWorkspace, "syncTargetUID", "us-west1", "test")
+	hashName, err := shared.PhysicalClusterNamespaceName(locator)
+	require.NoError(t, err)
+	locatorJSON, err := json.Marshal(locator)
+	require.NoError(t, err)
+	otherLocatorJSON, err := json.Marshal(shared.NewNamespaceLocator(logicalcluster.New("root:org:other"), syncTargetWorkspace, "syncTargetUID", "us-west1", "test"))
+	require.NoError(t, err)
+
+	naming := &workloadv1alpha1.NamespaceNaming{Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate, Template: "{{.WorkspaceName}}-{{.Namespace}}"}
+
+	tests := map[string]struct {
+		naming              *workloadv1alpha1.NamespaceNaming
+		downstreamNamespace *corev1.Namespace
+		want                string
+	}{
+		"hash strategy": {
+			want: hashName,
+		},
+		"template strategy": {
+			naming: naming,
+			want:   "team-test",
+		},
+		"template strategy, the namespace is taken by another upstream namespace": {
+			naming: naming,
+			downstreamNamespace: namespace("team-test", "", nil, map[string]string{
+				shared.NamespaceLocatorAnnotation: string(otherLocatorJSON),
+			}),
+			want: hashName,
+		},
+		"template strategy, the namespace is taken by a namespace not synced": {
+			naming:              naming,
+			downstreamNamespace: namespace("team-test", "", nil, nil),
+			want:                hashName,
+		},
+		"template strategy, the namespace exists for the upstream namespace": {
+			naming: naming,
+			downstreamNamespace: namespace("team-test", "", nil, map[string]string{
+				shared.NamespaceLocatorAnnotation: string(locatorJSON),
+			}),
+			want: "team-test",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tc.downstreamNamespace != nil {
+				objects = append(objects, tc.downstreamNamespace)
+			}
+			c := &Controller{
+				downstreamClient: dynamicfake.NewSimpleDynamicClient(scheme, objects...),
+				namespaceNamer: func(l shared.NamespaceLocator) ([]string, error) {
+					return shared.DownstreamNamespaceNames(tc.naming, l)
+				},
+			}
+			got, err := c.newDownstreamNamespaceName(context.Background(), locator)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDownstreamNamespaceName(t *testing.T) {
+	syncTargetWorkspace := logicalcluster.New("root:org:ws")
+	upstreamCluster := logicalcluster.New("root:org:team")
+	locator := shared.NewNamespaceLocator(upstreamCluster, syncTargetWorkspace, "syncTargetUID", "us-west1", "test")
+	hashName, err := shared.PhysicalClusterNamespaceName(locator)
+	require.NoError(t, err)
+	locatorJSON, err := json.Marshal(locator)
+	require.NoError(t, err)
+	otherLocatorJSON, err := json.Marshal(shared.NewNamespaceLocator(logicalcluster.New("root:org:other"), syncTargetWorkspace, "syncTargetUID", "us-west1", "test"))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		downstreamNamespaces []runtime.Object
+		want                 string
+		wantFound            bool
+	}{
+		"namespace not created yet": {
+			want:      "team-test",
+			wantFound: true,
+		},
+		"namespace not created yet, the template name is taken by another upstream namespace": {
+			downstreamNamespaces: []runtime.Object{
+				namespace("team-test", "", nil, map[string]string{shared.NamespaceLocatorAnnotation: string(otherLocatorJSON)}),
+			},
+			want:      hashName,
+			wantFound: true,
+		},
+		"namespace created with the fallback name": {
+			downstreamNamespaces: []runtime.Object{
+				namespace("team-test", "", nil, map[string]string{shared.NamespaceLocatorAnnotation: string(otherLocatorJSON)}),
+				namespace(hashName, "", nil, map[string]string{shared.NamespaceLocatorAnnotation: string(locatorJSON)}),
+			},
+			want:      hashName,
+			wantFound: true,
+		},
+		"colliding namespaces": {
+			downstreamNamespaces: []runtime.Object{
+				namespace("team-test", "", nil, map[string]string{shared.NamespaceLocatorAnnotation: string(locatorJSON)}),
+				namespace(hashName, "", nil, map[string]string{shared.NamespaceLocatorAnnotation: string(locatorJSON)}),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := dynamicfake.NewSimpleDynamicClient(scheme, tc.downstreamNamespaces...)
+			informers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewDynamicSharedInformerFactory(client, time.Hour)
+			})
+			err := informers.ForResource(corev1.SchemeGroupVersion.WithResource("namespaces")).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: shared.IndexByNamespaceLocator})
+			require.NoError(t, err)
+			informers.Start(ctx.Done())
+			informers.WaitForCacheSync(ctx.Done())
+
+			c := &Controller{
+				downstreamClient:    client,
+				downstreamInformers: informers,
+				syncTargetWorkspace: syncTargetWorkspace,
+				syncTargetUID:       "syncTargetUID",
+				syncTargetName:      "us-west1",
+				namespaceNamer: func(l shared.NamespaceLocator) ([]string, error) {
+					return shared.DownstreamNamespaceNames(&workloadv1alpha1.NamespaceNaming{
+						Strategy: workloadv1alpha1.NamespaceNamingStrategyTemplate,
+						Template: "{{.WorkspaceName}}-{{.Namespace}}",
+					}, l)
+				},
+			}
+			got, found, err := c.downstreamNamespaceName(upstreamCluster, "test")
+			require.NoError(t, err)
+			require.Equal(t, tc.wantFound, found)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestResolveNamespaceCollision(t *testing.T) {
+	newNamespace := func(name string, created time.Time) *corev1.Namespace {
+		ns := namespace(name, "", map[string]string{
+			workloadv1alpha1.InternalDownstreamClusterLabel: "6ohB8yeXhwqTQVuBzJRgqcRJTpRjX7yTZu5g5g",
+		}, nil)
+		ns.CreationTimestamp = metav1.NewTime(created)
+		return ns
+	}
+	now := time.Now()
+
+	tests := map[string]struct {
+		namespaces      []*corev1.Namespace
+		dryRun          bool
+		wantWinner      string
+		wantQuarantined []string
+	}{
+		"the oldest namespace wins": {
+			namespaces: []*corev1.Namespace{
+				newNamespace("kcp-b", now.Add(-time.Hour)),
+				newNamespace("kcp-a", now),
+				newNamespace("kcp-c", now.Add(-2*time.Hour)),
+			},
+			wantWinner:      "kcp-c",
+			wantQuarantined: []string{"kcp-a", "kcp-b"},
+		},
+		"the first name wins on the same creation timestamp": {
+			namespaces: []*corev1.Namespace{
+				newNamespace("kcp-b", now),
+				newNamespace("kcp-a", now),
+			},
+			wantWinner:      "kcp-a",
+			wantQuarantined: []string{"kcp-b"},
+		},
+		"dry run does not quarantine": {
+			namespaces: []*corev1.Namespace{
+				newNamespace("kcp-b", now),
+				newNamespace("kcp-a", now.Add(-time.Hour)),
+			},
+			dryRun:     true,
+			wantWinner: "kcp-a",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var objects []runtime.Object
+			var downstreamNamespaces []interface{}
+			for _, ns := range tc.namespaces {
+				objects = append(objects, ns)
+				downstreamNamespaces = append(downstreamNamespaces, toUnstructured(t, ns))
+			}
+			client := dynamicfake.NewSimpleDynamicClient(scheme, objects...)
+			c := &Controller{
+				downstreamClient: client,
+				syncTargetKey:    "6ohB8yeXhwqTQVuBzJRgqcRJTpRjX7yTZu5g5g",
+			}
+			if tc.dryRun {
+				c.dryRunReport = NewDryRunReport()
+			}
+
+			winner, err := c.resolveNamespaceCollision(context.Background(), downstreamNamespaces, logicalcluster.New("root:org:ws"), "test")
+			require.NoError(t, err)
+			require.Equal(t, tc.wantWinner, winner)
+
+			var quarantined []string
+			for _, ns := range tc.namespaces {
+				got, err := client.Resource(corev1.SchemeGroupVersion.WithResource("namespaces")).Get(context.Background(), ns.Name, metav1.GetOptions{})
+				require.NoError(t, err)
+				if got.GetLabels()[workloadv1alpha1.QuarantinedNamespaceLabel] == "" {
+					require.Equal(t, c.syncTargetKey, got.GetLabels()[workloadv1alpha1.InternalDownstreamClusterLabel])
+					continue
+				}
+				require.Equal(t, c.syncTargetKey, got.GetLabels()[workloadv1alpha1.QuarantinedNamespaceLabel])
+				require.NotContains(t, got.GetLabels(), workloadv1alpha1.InternalDownstreamClusterLabel)
+				require.Contains(t, got.GetAnnotations()[workloadv1alpha1.QuarantineReasonAnnotation], tc.wantWinner)
+				quarantined = append(quarantined, got.GetName())
+			}
+			sort.Strings(quarantined)
+			require.Equal(t, tc.wantQuarantined, quarantined)
+		})
+	}
+}
+
 func setupServersideApplyPatchReactor(toClient *dynamicfake.FakeDynamicClient) {
 	toClient.PrependReactor("patch", "*", func(action clienttesting.Action) (handled bool, ret runtime.Object, err error) {
 		patchAction := action.(clienttesting.PatchAction)
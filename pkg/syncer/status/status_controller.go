@@ -29,11 +29,13 @@ import (
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	"github.com/kcp-dev/kcp/pkg/informer"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
 	"github.com/kcp-dev/kcp/third_party/keyfunctions"
 )
 
@@ -46,7 +48,7 @@ type Controller struct {
 
 	upstreamClient                         dynamic.ClusterInterface
 	downstreamClient                       dynamic.Interface
-	upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory
+	upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory
 	downstreamNamespaceLister              cache.GenericLister
 
 	syncTargetName            string
@@ -56,11 +58,13 @@ type Controller struct {
 	advancedSchedulingEnabled bool
 }
 
-func NewStatusSyncer(gvrs []schema.GroupVersionResource, syncTargetWorkspace logicalcluster.Name, syncTargetName, syncTargetKey string, advancedSchedulingEnabled bool,
-	upstreamClient dynamic.ClusterInterface, downstreamClient dynamic.Interface, upstreamInformers, downstreamInformers dynamicinformer.DynamicSharedInformerFactory, syncTargetUID types.UID) (*Controller, error) {
+func NewStatusSyncer(syncTargetWorkspace logicalcluster.Name, syncTargetName, syncTargetKey string, advancedSchedulingEnabled bool,
+	upstreamClient dynamic.ClusterInterface, downstreamClient dynamic.Interface, upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory, syncTargetUID types.UID) (*Controller, error) {
 
 	c := &Controller{
-		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName),
+		queue: syncermetrics.NewQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName), func(item interface{}) schema.GroupVersionResource {
+			return item.(queueKey).gvr
+		}),
 
 		upstreamClient:            upstreamClient,
 		downstreamClient:          downstreamClient,
@@ -75,27 +79,23 @@ func NewStatusSyncer(gvrs []schema.GroupVersionResource, syncTargetWorkspace log
 		advancedSchedulingEnabled: advancedSchedulingEnabled,
 	}
 
-	for _, gvr := range gvrs {
-		gvr := gvr // because used in closure
-
-		downstreamInformers.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				c.AddToQueue(gvr, obj)
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				oldUnstrob := oldObj.(*unstructured.Unstructured)
-				newUnstrob := newObj.(*unstructured.Unstructured)
-
-				if !deepEqualFinalizersAndStatus(oldUnstrob, newUnstrob) {
-					c.AddToQueue(gvr, newUnstrob)
-				}
-			},
-			DeleteFunc: func(obj interface{}) {
-				c.AddToQueue(gvr, obj)
-			},
-		})
-		klog.InfoS("Set up informer", "SyncTarget Workspace", syncTargetWorkspace, "SyncTarget Name", syncTargetName, "gvr", gvr.String())
-	}
+	downstreamInformers.AddEventHandler(informer.GVREventHandlerFuncs{
+		AddFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.AddToQueue(gvr, obj)
+		},
+		UpdateFunc: func(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+			oldUnstrob := oldObj.(*unstructured.Unstructured)
+			newUnstrob := newObj.(*unstructured.Unstructured)
+
+			if !deepEqualFinalizersAndStatus(oldUnstrob, newUnstrob) {
+				c.AddToQueue(gvr, newUnstrob)
+			}
+		},
+		DeleteFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.AddToQueue(gvr, obj)
+		},
+	})
+	klog.InfoS("Set up informers", "SyncTarget Workspace", syncTargetWorkspace, "SyncTarget Name", syncTargetName)
 
 	return c, nil
 }
@@ -105,6 +105,10 @@ type queueKey struct {
 	key string // meta namespace key
 }
 
+func (k queueKey) String() string {
+	return fmt.Sprintf("%s %s", k.gvr, k.key)
+}
+
 func (c *Controller) AddToQueue(gvr schema.GroupVersionResource, obj interface{}) {
 	key, err := keyfunctions.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -153,7 +157,17 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	// other workers.
 	defer c.queue.Done(key)
 
-	if err := c.process(ctx, qk.gvr, qk.key); err != nil {
+	if !c.downstreamInformers.Has(qk.gvr) {
+		// The resource type is not synced anymore.
+		klog.V(4).InfoS("Dropping key of a resource type that is not synced anymore", "gvr", qk.gvr, "key", qk.key)
+		c.queue.Forget(key)
+		return true
+	}
+
+	start := time.Now()
+	err := c.process(ctx, qk.gvr, qk.key)
+	syncermetrics.ObserveProcessing(controllerName, qk.gvr, key, start, err)
+	if err != nil {
 		runtime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, key, err))
 		c.queue.AddRateLimited(key)
 		return true
@@ -26,6 +26,7 @@ import (
 	"github.com/kcp-dev/logicalcluster/v2"
 
 	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -35,9 +36,12 @@ import (
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	workloadcliplugin "github.com/kcp-dev/kcp/pkg/cliplugins/workload/plugin"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 )
 
+var resourceQuotasGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "resourcequotas"}
+
 func deepEqualFinalizersAndStatus(oldUnstrob, newUnstrob *unstructured.Unstructured) bool {
 	newFinalizers := newUnstrob.GetFinalizers()
 	oldFinalizers := oldUnstrob.GetFinalizers()
@@ -57,6 +61,10 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 		klog.Errorf("Invalid key: %q: %v", key, err)
 		return nil
 	}
+	if downstreamNamespace == "" {
+		// the status of cluster-scoped objects is not synced upstream
+		return nil
+	}
 	// TODO(sttts): do not reference the cli plugin here
 	if strings.HasPrefix(downstreamNamespace, workloadcliplugin.SyncerIDPrefix) {
 		// skip syncer namespace
@@ -94,7 +102,11 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 	upstreamWorkspace := namespaceLocator.Workspace
 
 	// get the downstream object
-	obj, exists, err := c.downstreamInformers.ForResource(gvr).Informer().GetIndexer().GetByKey(key)
+	downstreamInformer, err := c.downstreamInformers.SyncedInformer(gvr)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := downstreamInformer.Informer().GetIndexer().GetByKey(key)
 	if err != nil {
 		return err
 	}
@@ -112,6 +124,11 @@ func (c *Controller) process(ctx context.Context, gvr schema.GroupVersionResourc
 }
 
 func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.GroupVersionResource, upstreamNamespace string, upstreamLogicalCluster logicalcluster.Name, downstreamObj *unstructured.Unstructured) error {
+	if gvr == resourceQuotasGVR {
+		// The status of the ResourceQuotas is maintained upstream by the kcp quota controller.
+		return nil
+	}
+
 	upstreamName := shared.GetUpstreamResourceName(gvr, downstreamObj.GetName())
 
 	downstreamStatus, statusExists, err := unstructured.NestedFieldCopy(downstreamObj.UnstructuredContent(), "status")
@@ -122,8 +139,17 @@ func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.Grou
 		return nil
 	}
 
-	existingObj, err := c.upstreamInformers.ForResource(gvr).Lister().ByNamespace(upstreamNamespace).Get(clusters.ToClusterAwareKey(upstreamLogicalCluster, upstreamName))
+	upstreamInformer, err := c.upstreamInformers.SyncedInformer(gvr)
 	if err != nil {
+		return err
+	}
+	existingObj, err := upstreamInformer.Lister().ByNamespace(upstreamNamespace).Get(clusters.ToClusterAwareKey(upstreamLogicalCluster, upstreamName))
+	if apierrors.IsNotFound(err) {
+		// When the SyncTarget is served by several syncer virtual workspaces, the upstream
+		// object is only known by the status syncer of the virtual workspace that serves it.
+		klog.V(4).Infof("Resource %s|%s/%s not found upstream, skipping status update", upstreamLogicalCluster, upstreamNamespace, upstreamName)
+		return nil
+	} else if err != nil {
 		klog.Errorf("Getting resource %s/%s: %v", upstreamNamespace, upstreamName, err)
 		return err
 	}
@@ -154,6 +180,7 @@ func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.Grou
 		}
 
 		if _, err := c.upstreamClient.Cluster(upstreamLogicalCluster).Resource(gvr).Namespace(upstreamNamespace).Update(ctx, newUpstream, metav1.UpdateOptions{}); err != nil {
+			syncermetrics.RecordWriteError(controllerName, gvr, "update")
 			klog.Errorf("Failed updating location status annotation of resource %s|%s/%s from syncTargetName namespace %s: %v", upstreamLogicalCluster, upstreamNamespace, upstreamName, downstreamObj.GetNamespace(), err)
 			return err
 		}
@@ -170,6 +197,7 @@ func (c *Controller) updateStatusInUpstream(ctx context.Context, gvr schema.Grou
 	// But for now let's only update the status.
 
 	if _, err := c.upstreamClient.Cluster(upstreamLogicalCluster).Resource(gvr).Namespace(upstreamNamespace).UpdateStatus(ctx, newUpstream, metav1.UpdateOptions{}); err != nil {
+		syncermetrics.RecordWriteError(controllerName, gvr, "update")
 		klog.Errorf("Failed updating status of resource %q %s|%s/%s from pcluster namespace %s: %v", gvr.String(), upstreamLogicalCluster, upstreamNamespace, upstreamName, downstreamObj.GetNamespace(), err)
 		return err
 	}
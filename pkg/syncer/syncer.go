@@ -18,14 +18,22 @@ package syncer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kcp-dev/logicalcluster/v2"
 
+	apiextensionsv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -33,17 +41,34 @@ import (
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubeinformers "k8s.io/client-go/informers"
+	kubernetesclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/component-base/featuregate"
 	"k8s.io/klog/v2"
 
 	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	kcpinformers "github.com/kcp-dev/kcp/pkg/client/informers/externalversions"
 	kcpfeatures "github.com/kcp-dev/kcp/pkg/features"
+	"github.com/kcp-dev/kcp/pkg/syncer/adoption"
+	"github.com/kcp-dev/kcp/pkg/syncer/crds"
+	"github.com/kcp-dev/kcp/pkg/syncer/credentials"
+	"github.com/kcp-dev/kcp/pkg/syncer/events"
+	"github.com/kcp-dev/kcp/pkg/syncer/health"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
 	"github.com/kcp-dev/kcp/pkg/syncer/namespace"
+	"github.com/kcp-dev/kcp/pkg/syncer/orphans"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
 	"github.com/kcp-dev/kcp/pkg/syncer/spec"
+	specmutators "github.com/kcp-dev/kcp/pkg/syncer/spec/mutators"
 	"github.com/kcp-dev/kcp/pkg/syncer/status"
+	"github.com/kcp-dev/kcp/pkg/syncer/tokens"
+	"github.com/kcp-dev/kcp/pkg/syncer/upsync"
 	"github.com/kcp-dev/kcp/third_party/keyfunctions"
 )
 
@@ -57,8 +82,36 @@ const (
 
 	// TODO(marun) Ensure backoff rather than using a constant to avoid thundering herds
 	gvrQueryInterval = 1 * time.Second
+
+	// gvrDiscoveryInterval is the interval at which upstream discovery is checked for new or
+	// removed resource types, once all the requested resource types have been found.
+	gvrDiscoveryInterval = 30 * time.Second
+
+	// namespaceGCInterval is the interval at which all the downstream namespaces are checked for deletion,
+	// in addition to the checks triggered by namespace changes.
+	namespaceGCInterval = 5 * time.Minute
+
+	// orphanSweepInterval is the interval at which all the synced downstream objects are checked for
+	// deletion, in addition to the sweep made once the syncer virtual workspaces are synced.
+	orphanSweepInterval = 10 * time.Minute
+
+	// crdInstallInterval is the interval at which the CRDs of the resources to sync are installed on the
+	// SyncTarget cluster, when enabled.
+	crdInstallInterval = 30 * time.Second
 )
 
+// heartbeatBackoff is the backoff of failed heartbeats. It gives up once the delay reaches the
+// heartbeat interval, since the next heartbeat is attempted anyway.
+var heartbeatBackoff = wait.Backoff{
+	Duration: 1 * time.Second,
+	Factor:   2.0,
+	Jitter:   1.0,
+	Steps:    math.MaxInt32,
+	Cap:      heartbeatInterval,
+}
+
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
 // SyncerConfig defines the syncer configuration that is guaranteed to
 // vary across syncer deployments. Capturing these details in a struct
 // simplifies defining these details in test fixture.
@@ -69,30 +122,91 @@ type SyncerConfig struct {
 	SyncTargetWorkspace logicalcluster.Name
 	SyncTargetName      string
 	SyncTargetUID       string
+
+	// ResourcesToSyncFunc, if set, returns the resources to sync instead of ResourcesToSync, so that
+	// they can change at runtime, e.g. when the syncer configuration file is reloaded.
+	ResourcesToSyncFunc func() sets.String
+
+	// ServiceAccountTokenMode defines how the pods of the synced workloads get their
+	// service account tokens to talk to kcp. It defaults to legacy token Secrets.
+	ServiceAccountTokenMode shared.ServiceAccountTokenMode
+
+	// DryRun makes the syncer compute the changes it would make on the SyncTarget cluster without
+	// applying them. The changes are logged, and summarized in the SyncTarget status.
+	DryRun bool
+
+	// DriftPreservedResources are the group resources, e.g. deployments.apps, for which the changes
+	// made directly on the SyncTarget cluster to the synced objects are preserved instead of reverted.
+	DriftPreservedResources sets.String
+
+	// PropagateEvents makes the syncer create upstream Events for the downstream Events of the
+	// synced objects, so that they show up in the workspace.
+	PropagateEvents bool
+
+	// OrphanMode defines whether the orphaned downstream objects, whose upstream object was deleted
+	// while the syncer was not watching, are deleted or only reported. They are deleted by default.
+	OrphanMode shared.OrphanMode
+
+	// HealthChecks, if set, gets the readiness checks of the syncer, named after the SyncTarget: the retrieval
+	// of the SyncTarget, the sync of the downstream and syncer virtual workspace informers, and the discovery
+	// of the resources to sync in each syncer virtual workspace.
+	HealthChecks *health.Checks
+
+	// UpstreamCredentials, if set, provides the clients of UpstreamConfig with short-lived tokens. They are
+	// rotated until the syncer is stopped.
+	UpstreamCredentials *credentials.Rotator
+
+	// InstallCRDs makes the syncer create and update the CRDs of the resources to sync on the SyncTarget
+	// cluster, from the APIResourceSchemas of the APIExports supported by the SyncTarget. The updates that
+	// are not compatible with the installed CRDs are refused, and reported in the syncer status.
+	InstallCRDs bool
+}
+
+// healthChecks returns the health checks of the configuration, or checks that are not served if unset.
+func (cfg *SyncerConfig) healthChecks() *health.Checks {
+	if cfg.HealthChecks != nil {
+		return cfg.HealthChecks
+	}
+	return health.NewChecks("readyz")
+}
+
+// checkName returns the name of a health check of the SyncTarget, so that the checks of the SyncTargets
+// served by the same process don't collide.
+func (cfg *SyncerConfig) checkName(name string) string {
+	return fmt.Sprintf("%s|%s/%s", cfg.SyncTargetWorkspace, cfg.SyncTargetName, name)
+}
+
+// resourcesToSync returns the resources requested in the configuration.
+func (cfg *SyncerConfig) resourcesToSync() sets.String {
+	if cfg.ResourcesToSyncFunc != nil {
+		return cfg.ResourcesToSyncFunc()
+	}
+	return cfg.ResourcesToSync
 }
 
 func StartSyncer(ctx context.Context, cfg *SyncerConfig, numSyncerThreads int, importPollInterval time.Duration) error {
 	logger := klog.FromContext(ctx)
-	logger.WithValues("target-workspace", cfg.SyncTargetWorkspace, "target-name", cfg.SyncTargetName)
+	logger = logger.WithValues("target-workspace", cfg.SyncTargetWorkspace, "target-name", cfg.SyncTargetName)
 	ctx = klog.NewContext(ctx, logger)
 	logger.V(2).Info("starting syncer")
 
+	if cfg.UpstreamCredentials != nil {
+		go cfg.UpstreamCredentials.Start(ctx)
+	}
+
 	kcpVersion := version.Get().GitVersion
+	checks := cfg.healthChecks()
 
 	kcpClusterClient, err := kcpclient.NewClusterForConfig(rest.AddUserAgent(rest.CopyConfig(cfg.UpstreamConfig), "kcp#syncer/"+kcpVersion))
 	if err != nil {
 		return err
 	}
 
-	// TODO(david): Implement real support for several virtual workspace URLs that can change over time.
-	// TODO(david): For now we retrieve the syncerVirtualWorkpaceURL at start, since we temporarily stick to a single URL (sharding not supported).
-	// TODO(david): But the complete implementation should setup a SyncTarget informer, create spec and status syncer for every URLs found in the
-	// TODO(david): Status.SyncerVirtualWorkspaceURLs slice, and update them each time this list changes.
-	var syncerVirtualWorkspaceURL string
 	// TODO(david): we need to provide user-facing details if this polling goes on forever. Blocking here is a bad UX.
 	// TODO(david): Also, any regressions in our code will make any e2e test that starts a syncer (at least in-process)
 	// TODO(david): block until it hits the 10 minute overall test timeout.
-	logger.Info("attempting to retrieve the Syncer virtual workspace URL")
+	logger.Info("attempting to retrieve the SyncTarget")
+	checks.Set(cfg.checkName("synctarget"), errors.New("the SyncTarget is not retrieved yet"))
 	var syncTarget *workloadv1alpha1.SyncTarget
 	err = wait.PollImmediateInfinite(5*time.Second, func() (bool, error) {
 		var err error
@@ -106,17 +220,9 @@ func StartSyncer(ctx context.Context, cfg *SyncerConfig, numSyncerThreads int, i
 		if cfg.SyncTargetUID != "" && cfg.SyncTargetUID != string(syncTarget.UID) {
 			return false, fmt.Errorf("unexpected SyncTarget UID %s, expected %s, refusing to sync", syncTarget.UID, cfg.SyncTargetUID)
 		}
-
-		if len(syncTarget.Status.VirtualWorkspaces) == 0 {
-			return false, nil
-		}
-
-		if len(syncTarget.Status.VirtualWorkspaces) > 1 {
-			logger.Error(fmt.Errorf("SyncTarget should not have several Syncer virtual workspace URLs: not supported for now, ignoring additional URLs"), "error processing SyncTarget")
-		}
-		syncerVirtualWorkspaceURL = syncTarget.Status.VirtualWorkspaces[0].URL
 		return true, nil
 	})
+	checks.Set(cfg.checkName("synctarget"), err)
 	if err != nil {
 		return err
 	}
@@ -124,132 +230,368 @@ func StartSyncer(ctx context.Context, cfg *SyncerConfig, numSyncerThreads int, i
 	// Resources are accepted as a set to ensure the provision of a
 	// unique set of resources, but all subsequent consumption is via
 	// slice whose entries are assumed to be unique.
-	resources := cfg.ResourcesToSync.List()
+	resources := func() []string {
+		return cfg.resourcesToSync().List()
+	}
 
-	// Start api import first because spec and status syncers are blocked by
-	// gvr discovery finding all the configured resource types in the kcp
-	// workspace.
+	// Start api import first because spec and status syncers only sync the
+	// resource types once gvr discovery finds them in the kcp workspace.
 	apiImporter, err := NewAPIImporter(cfg.UpstreamConfig, cfg.DownstreamConfig, resources, cfg.SyncTargetWorkspace, cfg.SyncTargetName)
 	if err != nil {
 		return err
 	}
 	go apiImporter.Start(ctx, importPollInterval)
 
-	upstreamConfig := rest.CopyConfig(cfg.UpstreamConfig)
-	upstreamConfig.Host = syncerVirtualWorkspaceURL
-	upstreamConfig.UserAgent = "kcp#spec-syncer/" + kcpVersion
-	downstreamConfig := rest.CopyConfig(cfg.DownstreamConfig)
-	downstreamConfig.UserAgent = "kcp#status-syncer/" + kcpVersion
+	// Check whether we're in the Advanced Scheduling feature-gated mode.
+	advancedSchedulingEnabled := false
+	if syncTarget.GetAnnotations()[AdvancedSchedulingFeatureAnnotation] == "true" {
+		logger.Info("Advanced Scheduling feature is enabled")
+		advancedSchedulingEnabled = true
+	}
 
-	upstreamDynamicClusterClient, err := dynamic.NewClusterForConfig(upstreamConfig)
+	upstreamURL, err := url.Parse(cfg.UpstreamConfig.Host)
 	if err != nil {
 		return err
 	}
+
+	downstreamConfig := rest.CopyConfig(cfg.DownstreamConfig)
+	downstreamConfig.UserAgent = "kcp#status-syncer/" + kcpVersion
 	downstreamDynamicClient, err := dynamic.NewForConfig(downstreamConfig)
 	if err != nil {
 		return err
 	}
-	upstreamDiscoveryClusterClient, err := discovery.NewDiscoveryClientForConfig(upstreamConfig)
-	if err != nil {
-		return err
-	}
-	upstreamDiscoveryClient := upstreamDiscoveryClusterClient.WithCluster(logicalcluster.Wildcard)
 
 	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(cfg.SyncTargetWorkspace, cfg.SyncTargetName)
-	upstreamInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactory(upstreamDynamicClusterClient.Cluster(logicalcluster.Wildcard), resyncPeriod, metav1.NamespaceAll, func(o *metav1.ListOptions) {
-		o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
-	})
-	downstreamInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+
+	// The downstream namespace controller is shared by all the syncer virtual workspaces, since a
+	// downstream namespace must only be deleted if its upstream namespace exists in none of them.
+	downstreamNamespaceInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
 		o.LabelSelector = workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey
 	}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
 
-	// TODO(ncdc): we need to provide user-facing details if this polling goes on forever. Blocking here is a bad UX.
-	// TODO(ncdc): Also, any regressions in our code will make any e2e test that starts a syncer (at least in-process)
-	// TODO(ncdc): block until it hits the 10 minute overall test timeout.
-	//
-	// Block syncer start on gvr discovery completing successfully and
-	// including the resources configured for syncing. The spec and status
-	// syncers depend on the types being present to start their informers.
-	var gvrs []schema.GroupVersionResource
-	err = wait.PollImmediateInfinite(gvrQueryInterval, func() (bool, error) {
-		logger.Info("attempting to retrieve GVRs from upstream...")
+	// The downstream namespaces quarantined after a namespace collision are watched by separate informers,
+	// since they are not synced anymore.
+	quarantinedNamespaceInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+		o.LabelSelector = workloadv1alpha1.QuarantinedNamespaceLabel + "=" + syncTargetKey
+	}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
 
-		var err error
-		// Get all types the upstream API server knows about.
-		// TODO: watch this and learn about new types, or forget about old ones.
-		gvrs, err = getAllGVRs(ctx, upstreamDiscoveryClient, resources...)
-		// TODO(marun) Should some of these errors be fatal?
+	syncTargetInformerFactory := kcpinformers.NewSharedInformerFactoryWithOptions(kcpClusterClient.Cluster(cfg.SyncTargetWorkspace), resyncPeriod,
+		kcpinformers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", cfg.SyncTargetName).String()
+		}))
+	syncTargetLister := syncTargetInformerFactory.Workload().V1alpha1().SyncTargets().Lister()
+
+	// getSyncTarget returns the SyncTarget served by the syncer from the informer cache.
+	getSyncTarget := func() (*workloadv1alpha1.SyncTarget, error) {
+		return syncTargetLister.Get(clusters.ToClusterAwareKey(cfg.SyncTargetWorkspace, cfg.SyncTargetName))
+	}
+
+	// The synced resources are the ones requested on the command line, and the ones
+	// accepted in the SyncTarget status, e.g. when a new APIExport is supported. The
+	// accepted resources are synced even if they are not requested on the command line,
+	// and they are logged when they change.
+	var acceptedOnlyLock sync.Mutex
+	var acceptedOnly sets.String
+	resourcesToSync := func() sets.String {
+		requested := cfg.resourcesToSync()
+		resources := sets.NewString(requested.List()...)
+		syncTarget, err := getSyncTarget()
 		if err != nil {
-			logger.Error(err, "failed to retrieve GVRs from kcp")
-			return false, nil
+			logger.Error(err, "failed to get SyncTarget")
+			return resources
 		}
-		return true, nil
-	})
-	if err != nil {
-		// Should never happen
-		return err
+		for _, syncedResource := range syncTarget.Status.SyncedResources {
+			if syncedResource.State != workloadv1alpha1.ResourceSchemaAcceptedState {
+				continue
+			}
+			resources.Insert(schema.GroupResource{Group: syncedResource.Group, Resource: syncedResource.Resource}.String())
+		}
+
+		acceptedOnlyLock.Lock()
+		defer acceptedOnlyLock.Unlock()
+		if added := resources.Difference(requested); !added.Equal(acceptedOnly) {
+			logger.Info("syncing resources accepted in the SyncTarget status in addition to --resources", "resources", added.List())
+			acceptedOnly = added
+		}
+		return resources
 	}
 
-	// Check whether we're in the Advanced Scheduling feature-gated mode.
-	advancedSchedulingEnabled := false
-	if syncTarget.GetAnnotations()[AdvancedSchedulingFeatureAnnotation] == "true" {
-		logger.Info("Advanced Scheduling feature is enabled")
-		advancedSchedulingEnabled = true
+	// The downstream namespaces are named with the naming strategy of the SyncTarget at the time they are created.
+	namespaceNamer := func(l shared.NamespaceLocator) ([]string, error) {
+		syncTarget, err := getSyncTarget()
+		if err != nil {
+			return nil, err
+		}
+		return shared.DownstreamNamespaceNames(syncTarget.Spec.NamespaceNaming, l)
 	}
 
-	logger.Info(fmt.Sprintf("creating spec syncer resources %v", resources))
-	upstreamURL, err := url.Parse(cfg.UpstreamConfig.Host)
-	if err != nil {
-		return err
+	// The downstream namespaces are isolated with the network policy template of the SyncTarget, if any.
+	networkIsolation := func() *workloadv1alpha1.NetworkIsolation {
+		syncTarget, err := getSyncTarget()
+		if err != nil {
+			logger.Error(err, "failed to get SyncTarget")
+			return nil
+		}
+		return syncTarget.Spec.NetworkIsolation
 	}
-	specSyncer, err := spec.NewSpecSyncer(gvrs, cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, upstreamURL, advancedSchedulingEnabled,
-		upstreamDynamicClusterClient, downstreamDynamicClient, upstreamInformers, downstreamInformers, syncTarget.GetUID())
+
+	// The synced workloads are mapped with the workload mappings of the SyncTarget, if any.
+	workloadMappings := func() *workloadv1alpha1.WorkloadMappings {
+		syncTarget, err := getSyncTarget()
+		if err != nil {
+			logger.Error(err, "failed to get SyncTarget")
+			return nil
+		}
+		return syncTarget.Spec.WorkloadMappings
+	}
+
+	// The hard limits of the synced ResourceQuotas are scaled with the ResourceQuota scaling of the SyncTarget, if any.
+	resourceQuotaScaling := func() *workloadv1alpha1.ResourceQuotaScaling {
+		syncTarget, err := getSyncTarget()
+		if err != nil {
+			logger.Error(err, "failed to get SyncTarget")
+			return nil
+		}
+		return syncTarget.Spec.ResourceQuotaScaling
+	}
+
+	downstreamKubeClient, err := kubernetesclient.NewForConfig(downstreamConfig)
 	if err != nil {
 		return err
 	}
 
-	logger.Info(fmt.Sprintf("creating status syncer resources %v", resources))
-	statusSyncer, err := status.NewStatusSyncer(gvrs, cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, advancedSchedulingEnabled,
-		upstreamDynamicClusterClient, downstreamDynamicClient, upstreamInformers, downstreamInformers, syncTarget.GetUID())
+	// Set once the syncer virtual workspaces are known, before any of their syncers is started.
+	var tokensController *tokens.Controller
+	var serviceAccountTokenSecret specmutators.ServiceAccountTokenSecretFunc
+
+	var dryRunReport *spec.DryRunReport
+	if cfg.DryRun {
+		logger.Info("running in dry-run mode, no change is made to the SyncTarget cluster")
+		dryRunReport = spec.NewDryRunReport()
+	}
+
+	var crdInstaller *crds.Installer
+	if cfg.InstallCRDs && !cfg.DryRun {
+		logger.Info("installing the CRDs of the resources to sync on the SyncTarget cluster")
+		downstreamCRDClient, err := apiextensionsv1client.NewForConfig(downstreamConfig)
+		if err != nil {
+			return err
+		}
+		downstreamDiscoveryClient, err := discovery.NewDiscoveryClientForConfig(downstreamConfig)
+		if err != nil {
+			return err
+		}
+		crdInstaller = crds.NewInstaller(syncTarget.GetUID(), syncTargetKey, getSyncTarget, cfg.resourcesToSync,
+			kcpClusterClient, downstreamCRDClient, downstreamDiscoveryClient)
+	}
+
+	var downstreamNamespaceController *namespace.DownstreamController
+	var quarantineController *namespace.QuarantineController
+	var orphanSweeper *orphans.Sweeper
+	requeueDownstreamNamespaces := func() {
+		for _, obj := range downstreamNamespaceInformers.ForResource(namespaceGVR).Informer().GetStore().List() {
+			downstreamNamespaceController.AddToQueue(obj, logger)
+		}
+		for _, obj := range quarantinedNamespaceInformers.ForResource(namespaceGVR).Informer().GetStore().List() {
+			quarantineController.AddToQueue(obj, logger)
+		}
+	}
+	vwSyncers := newVirtualWorkspaceSyncers(
+		func(ctx context.Context, syncerVirtualWorkspaceURL string, markSynced markSyncedFunc) error {
+			return startVirtualWorkspaceSyncers(ctx, cfg, syncerVirtualWorkspaceURL, markSynced, virtualWorkspaceSyncersOptions{
+				checks:                    checks,
+				syncTargetUID:             syncTarget.GetUID(),
+				upstreamURL:               upstreamURL,
+				advancedSchedulingEnabled: advancedSchedulingEnabled,
+				downstreamDynamicClient:   downstreamDynamicClient,
+				resourcesToSync:           resourcesToSync,
+				namespaceNamer:            namespaceNamer,
+				workloadMappings:          workloadMappings,
+				resourceQuotaScaling:      resourceQuotaScaling,
+				serviceAccountTokenSecret: serviceAccountTokenSecret,
+				dryRunReport:              dryRunReport,
+				numSyncerThreads:          numSyncerThreads,
+			})
+		},
+		func() {
+			// Upstream namespaces of a newly synced virtual workspace might make
+			// downstream namespaces deletable, or not deletable anymore.
+			requeueDownstreamNamespaces()
+			// Sweep the downstream objects orphaned while the syncer was not watching.
+			if !cfg.DryRun {
+				go sweepOrphans(ctx, orphanSweeper)
+			}
+		},
+	)
+
+	syncedGVRs := func() ([]schema.GroupVersionResource, bool) {
+		resources, informersSynced := vwSyncers.SyncedResources()
+		gvrs := make([]schema.GroupVersionResource, 0, len(resources))
+		for _, resource := range resources {
+			gvrs = append(gvrs, schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource})
+		}
+		return gvrs, informersSynced
+	}
+
+	// In projected mode, bound service account tokens are requested from kcp through the syncer
+	// virtual workspace and maintained in downstream Secrets, instead of syncing legacy token Secrets.
+	if cfg.ServiceAccountTokenMode == shared.ServiceAccountTokenModeProjected {
+		logger.Info("using projected service account tokens")
+		// The downstream workloads mounting the token Secrets are watched by separate informers, that
+		// index them by the Secrets they mount.
+		downstreamWorkloadInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+			return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+				o.LabelSelector = workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey
+			}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+		})
+		tokensController, err = tokens.NewController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTarget.GetUID(), vwSyncers.UpstreamNamespaceClient, downstreamKubeClient,
+			downstreamNamespaceInformers, downstreamWorkloadInformers, syncedGVRs)
+		if err != nil {
+			return err
+		}
+		serviceAccountTokenSecret = tokensController.ServiceAccountTokenSecret
+	}
+
+	downstreamNamespaceController, err = namespace.NewDownstreamController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, syncTarget.GetUID(), downstreamDynamicClient, vwSyncers.UpstreamNamespaceExists, networkIsolation, downstreamNamespaceInformers)
 	if err != nil {
 		return err
 	}
 
-	downstreamNamespaceController, err := namespace.NewDownstreamController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, syncTarget.GetUID(), downstreamDynamicClient, upstreamInformers, downstreamInformers)
+	quarantineController, err = namespace.NewQuarantineController(cfg.SyncTargetName, syncTargetKey, downstreamDynamicClient, vwSyncers.UpstreamNamespaceExists,
+		vwSyncers.GetUpstreamObject, vwSyncers.UpstreamNamespaceClient, quarantinedNamespaceInformers)
 	if err != nil {
 		return err
 	}
 
-	upstreamNamespaceController, err := namespace.NewUpstreamController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, syncTarget.GetUID(), downstreamDynamicClient, upstreamInformers, downstreamInformers)
+	// The downstream namespaces to adopt are watched by separate informers, since they are not synced yet.
+	adoptedNamespaceInformers := dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+		o.LabelSelector = workloadv1alpha1.AdoptionLabel + "=" + syncTargetKey
+	}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+	adoptionController, err := adoption.NewController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, syncTarget.GetUID(), downstreamDynamicClient,
+		adoptedNamespaceInformers, downstreamNamespaceInformers, syncedGVRs, vwSyncers.WorkspacePlaced, vwSyncers.UpstreamNamespaceClient)
 	if err != nil {
 		return err
 	}
 
-	upstreamInformers.Start(ctx.Done())
-	downstreamInformers.Start(ctx.Done())
+	var eventsController *events.Controller
+	var downstreamEventInformers kubeinformers.SharedInformerFactory
+	if cfg.PropagateEvents && !cfg.DryRun {
+		downstreamDiscoveryClient, err := discovery.NewDiscoveryClientForConfig(downstreamConfig)
+		if err != nil {
+			return err
+		}
+		downstreamEventInformers = kubeinformers.NewSharedInformerFactory(downstreamKubeClient, resyncPeriod)
+		eventsController, err = events.NewController(cfg.SyncTargetName, syncTargetKey, vwSyncers.GetUpstreamObject, vwSyncers.UpstreamNamespaceClient,
+			downstreamDynamicClient, downstreamDiscoveryClient, downstreamEventInformers.Core().V1().Events(), downstreamNamespaceInformers)
+		if err != nil {
+			return err
+		}
+	}
 
-	upstreamInformers.WaitForCacheSync(ctx.Done())
-	downstreamInformers.WaitForCacheSync(ctx.Done())
+	orphanMode := cfg.OrphanMode
+	if orphanMode == "" {
+		orphanMode = shared.OrphanModeDelete
+	}
+	orphanSweeper = orphans.NewSweeper(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, orphanMode, downstreamDynamicClient, downstreamNamespaceInformers, syncedGVRs, vwSyncers.UpstreamObjectExists, vwSyncers.GetUpstreamObject)
+
+	checks.Set(cfg.checkName("downstream-informers"), errors.New("the downstream informers are not synced yet"))
+	downstreamNamespaceInformers.Start(ctx.Done())
+	downstreamNamespaceInformers.WaitForCacheSync(ctx.Done())
+	if !cfg.DryRun {
+		go downstreamNamespaceController.Start(ctx, numSyncerThreads)
+		quarantinedNamespaceInformers.Start(ctx.Done())
+		quarantinedNamespaceInformers.WaitForCacheSync(ctx.Done())
+		go quarantineController.Start(ctx, numSyncerThreads)
+		adoptedNamespaceInformers.Start(ctx.Done())
+		adoptedNamespaceInformers.WaitForCacheSync(ctx.Done())
+		go adoptionController.Start(ctx, numSyncerThreads)
+		if tokensController != nil {
+			go tokensController.Start(ctx, numSyncerThreads)
+		}
+		if eventsController != nil {
+			downstreamEventInformers.Start(ctx.Done())
+			downstreamEventInformers.WaitForCacheSync(ctx.Done())
+			go eventsController.Start(ctx, numSyncerThreads)
+		}
+	}
+	checks.Set(cfg.checkName("downstream-informers"), nil)
 
-	go specSyncer.Start(ctx, numSyncerThreads)
-	go statusSyncer.Start(ctx, numSyncerThreads)
-	go downstreamNamespaceController.Start(ctx, numSyncerThreads)
-	go upstreamNamespaceController.Start(ctx, numSyncerThreads)
+	// The syncer is ready once the syncers of all the virtual workspace URLs of the SyncTarget are started,
+	// and their informers are synced.
+	checks.Add(cfg.checkName("virtual-workspaces"), func() error {
+		if len(vwSyncers.URLs()) == 0 {
+			return errors.New("no syncer virtual workspace URL in the SyncTarget status")
+		}
+		if _, informersSynced := vwSyncers.SyncedResources(); !informersSynced {
+			return errors.New("the informers of the syncer virtual workspaces are not synced yet")
+		}
+		return nil
+	})
 
-	if kcpfeatures.DefaultFeatureGate.Enabled(kcpfeatures.SyncerTunnel) {
-		go startSyncerTunnel(ctx, upstreamConfig, downstreamConfig, cfg.SyncTargetWorkspace, cfg.SyncTargetName)
+	// Watch the SyncTarget, and start and stop the spec and status syncers
+	// when syncer virtual workspace URLs are added or removed.
+	syncTargetUID := syncTarget.GetUID()
+	reconcileSyncTarget := func(obj interface{}) {
+		syncTarget, ok := obj.(*workloadv1alpha1.SyncTarget)
+		if !ok {
+			return
+		}
+		// A SyncTarget recreated with the same name is a different sync target, the syncer must not serve it.
+		if syncTarget.UID != syncTargetUID {
+			logger.Error(fmt.Errorf("unexpected SyncTarget UID %s, expected %s, refusing to sync", syncTarget.UID, syncTargetUID), "error processing SyncTarget")
+			vwSyncers.Reconcile(ctx, nil)
+			return
+		}
+		vwSyncers.Reconcile(ctx, syncTarget)
 	}
+	syncTargetInformerFactory.Workload().V1alpha1().SyncTargets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: reconcileSyncTarget,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			reconcileSyncTarget(newObj)
+			oldSyncTarget, ok := oldObj.(*workloadv1alpha1.SyncTarget)
+			if !ok {
+				return
+			}
+			newSyncTarget, ok := newObj.(*workloadv1alpha1.SyncTarget)
+			if !ok {
+				return
+			}
+			if !equality.Semantic.DeepEqual(oldSyncTarget.Spec.NetworkIsolation, newSyncTarget.Spec.NetworkIsolation) {
+				// Apply the network isolation change to all the downstream namespaces.
+				requeueDownstreamNamespaces()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			logger.Info("SyncTarget has been deleted, stopping all syncers")
+			vwSyncers.Reconcile(ctx, nil)
+		},
+	})
+	syncTargetInformerFactory.Start(ctx.Done())
 
-	// Attempt to heartbeat every interval
+	// Attempt to heartbeat every interval, reporting the syncer version, capabilities and informer state.
 	go wait.UntilWithContext(ctx, func(ctx context.Context) {
 		var heartbeatTime time.Time
 
-		// TODO(marun) Figure out a strategy for backoff to avoid a thundering herd problem with lots of syncers
-		// Attempt to heartbeat every second until successful. Errors are logged instead of being returned so the
-		// poll error can be safely ignored.
-		_ = wait.PollImmediateInfiniteWithContext(ctx, 1*time.Second, func(ctx context.Context) (bool, error) {
-			patchBytes := []byte(fmt.Sprintf(`[{"op":"test","path":"/metadata/uid","value":%q},{"op":"replace","path":"/status/lastSyncerHeartbeatTime","value":%q}]`, cfg.SyncTargetUID, time.Now().Format(time.RFC3339)))
-			syncTarget, err = kcpClusterClient.Cluster(cfg.SyncTargetWorkspace).WorkloadV1alpha1().SyncTargets().Patch(ctx, cfg.SyncTargetName, types.JSONPatchType, patchBytes, metav1.PatchOptions{}, "status")
+		// Attempt to heartbeat until successful, backing off exponentially with jitter so that many syncers
+		// failing at the same time don't retry in lockstep. Errors are logged instead of being returned so the
+		// backoff error can be safely ignored: the next interval starts over.
+		_ = wait.ExponentialBackoffWithContext(ctx, heartbeatBackoff, func() (bool, error) {
+			resources, informersSynced := vwSyncers.SyncedResources()
+			syncerStatus := &workloadv1alpha1.SyncerStatus{
+				Version:         kcpVersion,
+				FeatureGates:    enabledFeatureGates(),
+				Resources:       resources,
+				InformersSynced: informersSynced,
+			}
+			if crdInstaller != nil {
+				syncerStatus.RefusedCRDUpdates = crdInstaller.RefusedUpdates()
+			}
+			patchBytes, err := heartbeatPatch(syncTargetUID, time.Now(), syncerStatus)
+			if err != nil {
+				return false, err
+			}
+			syncTarget, err := kcpClusterClient.Cluster(cfg.SyncTargetWorkspace).WorkloadV1alpha1().SyncTargets().Patch(ctx, cfg.SyncTargetName, types.JSONPatchType, patchBytes, metav1.PatchOptions{}, "status")
+			syncermetrics.RecordHeartbeat(err)
 			if err != nil {
 				logger.Error(err, "failed to set status.lastSyncerHeartbeatTime")
 				return false, nil //nolint:nilerr
@@ -261,9 +603,312 @@ func StartSyncer(ctx context.Context, cfg *SyncerConfig, numSyncerThreads int, i
 		logger.V(5).Info("Heartbeat set", "heartbeatTime", heartbeatTime)
 	}, heartbeatInterval)
 
+	if !cfg.DryRun {
+		// Periodically check all the downstream namespaces, so that the ones orphaned while the syncer
+		// was not watching, e.g. when their workspace was deleted, are garbage collected.
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			requeueDownstreamNamespaces()
+		}, namespaceGCInterval)
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			sweepOrphans(ctx, orphanSweeper)
+		}, orphanSweepInterval)
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			updateNamespaceCollisionCondition(ctx, kcpClusterClient, getSyncTarget, cfg.SyncTargetWorkspace, syncTargetUID, quarantinedNamespaceInformers)
+		}, heartbeatInterval)
+	}
+
+	if crdInstaller != nil {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := crdInstaller.Install(ctx); err != nil {
+				logger.Error(err, "failed to install the CRDs on the SyncTarget cluster")
+			}
+		}, crdInstallInterval)
+	}
+
+	if dryRunReport != nil {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			updateDryRunCondition(ctx, kcpClusterClient, getSyncTarget, cfg.SyncTargetWorkspace, syncTargetUID, dryRunReport)
+		}, heartbeatInterval)
+	}
+
+	return nil
+}
+
+// sweepOrphans garbage-collects the orphaned downstream objects, logging the errors.
+func sweepOrphans(ctx context.Context, orphanSweeper *orphans.Sweeper) {
+	if err := orphanSweeper.Sweep(ctx); err != nil {
+		klog.FromContext(ctx).Error(err, "failed to sweep orphaned downstream objects")
+	}
+}
+
+// virtualWorkspaceSyncersOptions are the options of the syncers started against a syncer virtual workspace URL.
+type virtualWorkspaceSyncersOptions struct {
+	checks                    *health.Checks
+	syncTargetUID             types.UID
+	upstreamURL               *url.URL
+	advancedSchedulingEnabled bool
+	downstreamDynamicClient   dynamic.Interface
+	resourcesToSync           func() sets.String
+	namespaceNamer            shared.NamespaceNamer
+	workloadMappings          specmutators.WorkloadMappingsFunc
+	resourceQuotaScaling      specmutators.ResourceQuotaScalingFunc
+	serviceAccountTokenSecret specmutators.ServiceAccountTokenSecretFunc
+	dryRunReport              *spec.DryRunReport
+	numSyncerThreads          int
+}
+
+// startVirtualWorkspaceSyncers starts the spec and status syncers, and the upstream namespace controller,
+// against a single syncer virtual workspace URL. They are stopped when the context is done. The last error
+// of the discovery of the resources to sync is reported in a health check, removed when the context is done.
+func startVirtualWorkspaceSyncers(ctx context.Context, cfg *SyncerConfig, syncerVirtualWorkspaceURL string, markSynced markSyncedFunc, options virtualWorkspaceSyncersOptions) error {
+	logger := klog.FromContext(ctx)
+	kcpVersion := version.Get().GitVersion
+
+	upstreamConfig := rest.CopyConfig(cfg.UpstreamConfig)
+	upstreamConfig.Host = syncerVirtualWorkspaceURL
+	upstreamConfig.UserAgent = "kcp#spec-syncer/" + kcpVersion
+	downstreamConfig := rest.CopyConfig(cfg.DownstreamConfig)
+	downstreamConfig.UserAgent = "kcp#status-syncer/" + kcpVersion
+
+	upstreamDynamicClusterClient, err := dynamic.NewClusterForConfig(upstreamConfig)
+	if err != nil {
+		return err
+	}
+	upstreamDiscoveryClusterClient, err := discovery.NewDiscoveryClientForConfig(upstreamConfig)
+	if err != nil {
+		return err
+	}
+	upstreamDiscoveryClient := upstreamDiscoveryClusterClient.WithCluster(logicalcluster.Wildcard)
+
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(cfg.SyncTargetWorkspace, cfg.SyncTargetName)
+	upstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+		return dynamicinformer.NewFilteredDynamicSharedInformerFactory(upstreamDynamicClusterClient.Cluster(logicalcluster.Wildcard), resyncPeriod, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateSync)
+		})
+	})
+	downstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+		return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(options.downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = workloadv1alpha1.InternalDownstreamClusterLabel + "=" + syncTargetKey
+		}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+	})
+
+	// The upsynced objects are watched by separate informers, since they are labelled differently.
+	upsyncUpstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+		return dynamicinformer.NewFilteredDynamicSharedInformerFactory(upstreamDynamicClusterClient.Cluster(logicalcluster.Wildcard), resyncPeriod, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateUpsync)
+		})
+	})
+	upsyncDownstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+		return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(options.downstreamDynamicClient, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey + "=" + string(workloadv1alpha1.ResourceStateUpsync)
+		}, cache.WithResyncPeriod(resyncPeriod), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+	})
+
+	logger.Info("creating spec syncer")
+	specSyncer, err := spec.NewSpecSyncer(spec.SpecSyncerOptions{
+		SyncTargetWorkspace:       cfg.SyncTargetWorkspace,
+		SyncTargetName:            cfg.SyncTargetName,
+		SyncTargetKey:             syncTargetKey,
+		SyncTargetUID:             options.syncTargetUID,
+		UpstreamURL:               options.upstreamURL,
+		AdvancedSchedulingEnabled: options.advancedSchedulingEnabled,
+		UpstreamClient:            upstreamDynamicClusterClient,
+		DownstreamClient:          options.downstreamDynamicClient,
+		UpstreamInformers:         upstreamInformers,
+		DownstreamInformers:       downstreamInformers,
+		ServiceAccountTokenSecret: options.serviceAccountTokenSecret,
+		DryRunReport:              options.dryRunReport,
+		DriftPreservedResources:   cfg.DriftPreservedResources,
+		NamespaceNamer:            options.namespaceNamer,
+		WorkloadMappings:          options.workloadMappings,
+		ResourceQuotaScaling:      options.resourceQuotaScaling,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("creating status syncer")
+	statusSyncer, err := status.NewStatusSyncer(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, options.advancedSchedulingEnabled,
+		upstreamDynamicClusterClient, options.downstreamDynamicClient, upstreamInformers, downstreamInformers, options.syncTargetUID)
+	if err != nil {
+		return err
+	}
+
+	upstreamNamespaceController, err := namespace.NewUpstreamController(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, options.syncTargetUID, options.downstreamDynamicClient, upstreamInformers, downstreamInformers)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("creating upsyncer")
+	upsyncer, err := upsync.NewUpsyncer(cfg.SyncTargetWorkspace, cfg.SyncTargetName, syncTargetKey, options.syncTargetUID, upstreamDynamicClusterClient,
+		upsyncUpstreamInformers, upsyncDownstreamInformers, upstreamInformers.ForResource(namespaceGVR).Lister(), downstreamInformers.ForResource(namespaceGVR))
+	if err != nil {
+		return err
+	}
+
+	discoveryCheckName := cfg.checkName("gvr-discovery/" + syncerVirtualWorkspaceURL)
+	options.checks.Set(discoveryCheckName, errors.New("the resources to sync are not discovered yet"))
+	setDiscoveryError := func(err error) {
+		// Discoveries interrupted by the stop of the syncers must not add the check back.
+		if ctx.Err() == nil {
+			options.checks.Set(discoveryCheckName, err)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		options.checks.Remove(discoveryCheckName)
+	}()
+
+	// Start the informers the controllers depend on independently of the synced resources, e.g. namespaces.
+	upstreamInformers.Start(ctx.Done())
+	downstreamInformers.Start(ctx.Done())
+
+	upstreamInformers.WaitForCacheSync(ctx.Done())
+	downstreamInformers.WaitForCacheSync(ctx.Done())
+
+	// TODO(ncdc): we need to provide user-facing details if this polling goes on forever. Blocking here is a bad UX.
+	// TODO(ncdc): Also, any regressions in our code will make any e2e test that starts a syncer (at least in-process)
+	// TODO(ncdc): block until it hits the 10 minute overall test timeout.
+	//
+	// Block syncer start on a first successful gvr discovery, such that the spec and status
+	// syncers don't start with no resources to sync at all. Resources which are not found yet
+	// are added later by the discovery loop below.
+	var complete bool
+	err = wait.PollImmediateInfiniteWithContext(ctx, gvrQueryInterval, func(ctx context.Context) (bool, error) {
+		logger.Info("attempting to retrieve GVRs from upstream...")
+
+		var err error
+		complete, err = updateSyncedGVRs(ctx, upstreamDiscoveryClient, options.resourcesToSync(), upstreamInformers, downstreamInformers, upsyncUpstreamInformers, upsyncDownstreamInformers)
+		setDiscoveryError(err)
+		// TODO(marun) Should some of these errors be fatal?
+		if err != nil {
+			logger.Error(err, "failed to retrieve GVRs from kcp")
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	markSynced(upstreamDynamicClusterClient, upstreamInformers.ForResource(namespaceGVR).Informer().GetIndexer(), upstreamInformers, downstreamInformers)
+
+	go specSyncer.Start(ctx, options.numSyncerThreads)
+	// In dry-run mode, nothing is synced downstream, so there is no status to sync upstream,
+	// and no downstream namespace to delete. Nothing is upsynced either.
+	if options.dryRunReport == nil {
+		go statusSyncer.Start(ctx, options.numSyncerThreads)
+		go upstreamNamespaceController.Start(ctx, options.numSyncerThreads)
+		go upsyncer.Start(ctx, options.numSyncerThreads)
+	}
+
+	if kcpfeatures.DefaultFeatureGate.Enabled(kcpfeatures.SyncerTunnel) {
+		go startSyncerTunnel(ctx, upstreamConfig, downstreamConfig, cfg.SyncTargetWorkspace, cfg.SyncTargetName)
+	}
+
+	// Keep watching upstream discovery, and learn about new types, or forget about old ones.
+	go func() {
+		for {
+			interval := gvrDiscoveryInterval
+			if !complete {
+				interval = gvrQueryInterval
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+
+			var err error
+			complete, err = updateSyncedGVRs(ctx, upstreamDiscoveryClient, options.resourcesToSync(), upstreamInformers, downstreamInformers, upsyncUpstreamInformers, upsyncDownstreamInformers)
+			setDiscoveryError(err)
+			if err != nil {
+				logger.Error(err, "failed to retrieve GVRs from kcp")
+				complete = false
+			}
+		}
+	}()
+
 	return nil
 }
 
+// heartbeatPatch returns the JSON patch setting the heartbeat time and the syncer status of the
+// SyncTarget, failing if the SyncTarget UID is not the expected one.
+func heartbeatPatch(syncTargetUID types.UID, now time.Time, syncerStatus *workloadv1alpha1.SyncerStatus) ([]byte, error) {
+	return json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/uid", "value": syncTargetUID},
+		{"op": "replace", "path": "/status/lastSyncerHeartbeatTime", "value": now.Format(time.RFC3339)},
+		{"op": "add", "path": "/status/syncer", "value": syncerStatus},
+	})
+}
+
+// enabledFeatureGates returns the sorted names of the kcp feature gates enabled in the syncer.
+func enabledFeatureGates() []string {
+	var enabled []string
+	for _, name := range kcpfeatures.KnownFeatures() {
+		if kcpfeatures.DefaultFeatureGate.Enabled(featuregate.Feature(name)) {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// updateSyncedGVRs adds the informers of the discovered resource types to sync, and removes the
+// informers of the resource types that are not served anymore, or not requested anymore.
+// The upsync informers follow the same resource types.
+// It returns whether all the requested resource types have been found upstream.
+func updateSyncedGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterface, resourcesToSync sets.String, upstreamInformers, downstreamInformers, upsyncUpstreamInformers, upsyncDownstreamInformers resourcesync.SyncerInformerFactory) (bool, error) {
+	logger := klog.FromContext(ctx)
+
+	gvrs, notFoundResourceTypes, err := getAllGVRs(ctx, discoveryClient, resourcesToSync.List()...)
+	if err != nil {
+		return false, err
+	}
+	if notFoundResourceTypes.Len() != 0 {
+		// Some of the API resources expected to be there are still not published by KCP.
+		// They are retried until the corresponding resources are added inside KCP as CRDs and
+		// published as API resources.
+		logger.Info("some resource types were requested to be synced, but were not found in the KCP logical cluster", "resources", notFoundResourceTypes.List())
+	}
+
+	discovered := map[schema.GroupVersionResource]bool{}
+	var toAdd, toRemove []schema.GroupVersionResource
+	for _, gvr := range gvrs {
+		discovered[gvr] = true
+		if !upstreamInformers.Has(gvr) {
+			toAdd = append(toAdd, gvr)
+		}
+	}
+	for _, gvr := range upstreamInformers.GVRs() {
+		if !discovered[gvr] {
+			toRemove = append(toRemove, gvr)
+		}
+	}
+
+	if len(toAdd) > 0 {
+		logger.Info("starting to sync resources", "gvrs", toAdd)
+
+		// Downstream informers are synced first, such that the spec syncer doesn't process
+		// upstream objects, and the upsyncer doesn't delete them, against an empty downstream cache.
+		for _, informers := range []resourcesync.SyncerInformerFactory{downstreamInformers, upsyncDownstreamInformers, upstreamInformers, upsyncUpstreamInformers} {
+			informers.AddGVRs(toAdd...)
+			informers.Start(ctx.Done())
+			informers.WaitForCacheSync(ctx.Done())
+		}
+	}
+
+	if len(toRemove) > 0 {
+		logger.Info("stopping to sync resources", "gvrs", toRemove)
+
+		for _, informers := range []resourcesync.SyncerInformerFactory{upstreamInformers, upsyncUpstreamInformers, downstreamInformers, upsyncDownstreamInformers} {
+			informers.RemoveGVRs(toRemove...)
+		}
+	}
+
+	return notFoundResourceTypes.Len() == 0, nil
+}
+
 func contains(ss []string, s string) bool {
 	for _, n := range ss {
 		if n == s {
@@ -273,7 +918,9 @@ func contains(ss []string, s string) bool {
 	return false
 }
 
-func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterface, resourcesToSync ...string) ([]schema.GroupVersionResource, error) {
+// getAllGVRs returns the resource types to sync among the ones served upstream, and the
+// requested resource types that were not found.
+func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterface, resourcesToSync ...string) ([]schema.GroupVersionResource, sets.String, error) {
 	toSyncSet := sets.NewString(resourcesToSync...)
 	willBeSyncedSet := sets.NewString()
 	rs, err := discoveryClient.ServerPreferredResources()
@@ -285,9 +932,9 @@ func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterfac
 			// In fact this might be related to a bug in the changes made on the feature-logical-cluster
 			// Kubernetes branch to support legacy schema resources added as CRDs.
 			// If this is confirmed, this test will be removed when the CRD bug is fixed.
-			return nil, err
+			return nil, nil, err
 		} else {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	// TODO(jmprusi): Added Configmaps and Secrets to the default syncing, but we should figure out
@@ -327,8 +974,8 @@ func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterfac
 				// foo/status, pods/exec, namespace/finalize, etc.
 				continue
 			}
-			if !ai.Namespaced {
-				// Ignore cluster-scoped things.
+			if !ai.Namespaced && ai.Name == "namespaces" {
+				// Namespaces are not synced as such, but created for the namespaced objects.
 				continue
 			}
 			if !contains(ai.Verbs, "watch") {
@@ -341,12 +988,6 @@ func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterfac
 	}
 
 	notFoundResourceTypes := toSyncSet.Difference(willBeSyncedSet)
-	if notFoundResourceTypes.Len() != 0 {
-		// Some of the API resources expected to be there are still not published by KCP.
-		// We should just retry without a limit on the number of retries in such a case,
-		// until the corresponding resources are added inside KCP as CRDs and published as API resources.
-		return nil, fmt.Errorf("the following resource types were requested to be synced, but were not found in the KCP logical cluster: %v", notFoundResourceTypes.List())
-	}
 
 	gvrs := make([]schema.GroupVersionResource, 0, gvrstrs.Len())
 	for _, gvrstr := range gvrstrs.List() {
@@ -357,5 +998,5 @@ func getAllGVRs(ctx context.Context, discoveryClient discovery.DiscoveryInterfac
 		}
 		gvrs = append(gvrs, *gvr)
 	}
-	return gvrs, nil
+	return gvrs, notFoundResourceTypes, nil
 }
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/klog/v2"
+
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/util/conditions"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+)
+
+// updateNamespaceCollisionCondition reflects the downstream namespaces quarantined after a namespace collision
+// in the DownstreamNamespacesCollisionFree condition of the SyncTarget.
+func updateNamespaceCollisionCondition(ctx context.Context, kcpClusterClient kcpclient.ClusterInterface, getSyncTarget func() (*workloadv1alpha1.SyncTarget, error),
+	syncTargetWorkspace logicalcluster.Name, syncTargetUID types.UID, quarantinedNamespaceInformers dynamicinformer.DynamicSharedInformerFactory) {
+	logger := klog.FromContext(ctx)
+
+	syncTarget, err := getSyncTarget()
+	if err != nil {
+		logger.Error(err, "failed to get SyncTarget to report namespace collisions")
+		return
+	}
+	if syncTarget.UID != syncTargetUID {
+		return
+	}
+
+	quarantined, err := quarantinedNamespaceInformers.ForResource(namespaceGVR).Lister().List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "failed to list quarantined namespaces")
+		return
+	}
+	names := make([]string, 0, len(quarantined))
+	for _, obj := range quarantined {
+		namespace, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		names = append(names, namespace.GetName())
+	}
+	sort.Strings(names)
+
+	condition := conditions.TrueCondition(workloadv1alpha1.DownstreamNamespacesCollisionFree)
+	if len(names) > 0 {
+		condition = conditions.FalseCondition(workloadv1alpha1.DownstreamNamespacesCollisionFree, workloadv1alpha1.NamespacesQuarantinedReason, conditionsv1alpha1.ConditionSeverityWarning,
+			fmt.Sprintf("downstream namespaces quarantined after a namespace collision: %s", strings.Join(names, ", ")))
+	}
+	if existing := conditions.Get(syncTarget, workloadv1alpha1.DownstreamNamespacesCollisionFree); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return
+	}
+
+	syncTarget = syncTarget.DeepCopy()
+	conditions.Set(syncTarget, condition)
+	if _, err := kcpClusterClient.Cluster(syncTargetWorkspace).WorkloadV1alpha1().SyncTargets().UpdateStatus(ctx, syncTarget, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "failed to report namespace collisions in the SyncTarget status")
+		return
+	}
+	logger.V(2).Info("reported namespace collisions in the SyncTarget status", "status", condition.Status, "message", condition.Message)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	conditionsv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/apis/third_party/conditions/util/conditions"
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	kcpclient "github.com/kcp-dev/kcp/pkg/client/clientset/versioned"
+	"github.com/kcp-dev/kcp/pkg/syncer/spec"
+)
+
+// updateDryRunCondition reflects the downstream changes a syncer in dry-run mode would have made
+// in the DownstreamInSync condition of the SyncTarget.
+func updateDryRunCondition(ctx context.Context, kcpClusterClient kcpclient.ClusterInterface, getSyncTarget func() (*workloadv1alpha1.SyncTarget, error),
+	syncTargetWorkspace logicalcluster.Name, syncTargetUID types.UID, report *spec.DryRunReport) {
+	logger := klog.FromContext(ctx)
+
+	syncTarget, err := getSyncTarget()
+	if err != nil {
+		logger.Error(err, "failed to get SyncTarget to report dry-run changes")
+		return
+	}
+	if syncTarget.UID != syncTargetUID {
+		return
+	}
+
+	condition := conditions.TrueCondition(workloadv1alpha1.DownstreamInSync)
+	if summary, pending := report.Summary(); pending {
+		condition = conditions.FalseCondition(workloadv1alpha1.DownstreamInSync, workloadv1alpha1.DryRunChangesPendingReason, conditionsv1alpha1.ConditionSeverityInfo, summary)
+	}
+	if existing := conditions.Get(syncTarget, workloadv1alpha1.DownstreamInSync); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return
+	}
+
+	syncTarget = syncTarget.DeepCopy()
+	conditions.Set(syncTarget, condition)
+	if _, err := kcpClusterClient.Cluster(syncTargetWorkspace).WorkloadV1alpha1().SyncTargets().UpdateStatus(ctx, syncTarget, metav1.UpdateOptions{}); err != nil {
+		logger.Error(err, "failed to report dry-run changes in the SyncTarget status")
+		return
+	}
+	logger.V(2).Info("reported dry-run changes in the SyncTarget status", "status", condition.Status, "message", condition.Message)
+}
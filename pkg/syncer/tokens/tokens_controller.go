@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/logging"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	controllerName              = "kcp-workload-syncer-tokens"
+	byNamespaceLocatorIndexName = "syncer-tokens-ByNamespaceLocator"
+
+	// defaultTokenExpiration is the expiration requested for the service account tokens.
+	defaultTokenExpiration = 1 * time.Hour
+)
+
+var serviceAccountsGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "serviceaccounts"}
+
+// Controller maintains downstream Secrets holding bound service account tokens requested
+// from kcp through the token subresource of the syncer virtual workspace, for the upstream
+// service accounts used by the pod templates of the synced workloads. Tokens are refreshed
+// before they expire, and Secrets no longer mounted by any workload are deleted.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	requestToken              func(ctx context.Context, clusterName logicalcluster.Name, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error)
+	getDownstreamNamespace    func(namespaceLocator shared.NamespaceLocator) (string, error)
+	isDownstreamSecretMounted func(ctx context.Context, namespace, name string) (bool, error)
+	getDownstreamSecret       func(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+	createDownstreamSecret    func(ctx context.Context, secret *corev1.Secret) error
+	updateDownstreamSecret    func(ctx context.Context, secret *corev1.Secret) error
+	deleteDownstreamSecret    func(ctx context.Context, namespace, name string) error
+	now                       func() time.Time
+
+	tokenExpiration time.Duration
+
+	syncTargetName      string
+	syncTargetWorkspace logicalcluster.Name
+	syncTargetUID       types.UID
+}
+
+func NewController(
+	syncTargetWorkspace logicalcluster.Name,
+	syncTargetName string,
+	syncTargetUID types.UID,
+	upstreamNamespaceClient func(clusterName logicalcluster.Name, namespace string) (dynamic.Interface, error),
+	downstreamKubeClient kubernetesclient.Interface,
+	downstreamNamespaceInformers dynamicinformer.DynamicSharedInformerFactory,
+	downstreamWorkloadInformers resourcesync.SyncerInformerFactory,
+	syncedResources func() ([]schema.GroupVersionResource, bool),
+) (*Controller, error) {
+	namespaceGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+	downstreamNamespaceIndexer := downstreamNamespaceInformers.ForResource(namespaceGVR).Informer().GetIndexer()
+	mounts := &secretMounts{
+		workloadInformers: downstreamWorkloadInformers,
+		syncedResources:   syncedResources,
+	}
+
+	c := &Controller{
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName),
+
+		requestToken: func(ctx context.Context, clusterName logicalcluster.Name, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error) {
+			// Only the service accounts synced to the SyncTarget are served by the virtual workspace.
+			client, err := upstreamNamespaceClient(clusterName, namespace)
+			if err != nil {
+				return nil, err
+			}
+			unstructuredTokenRequest, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&authenticationv1.TokenRequest{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: authenticationv1.SchemeGroupVersion.String(),
+					Kind:       "TokenRequest",
+				},
+				Spec: authenticationv1.TokenRequestSpec{
+					ExpirationSeconds: &expirationSeconds,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			result, err := client.Resource(serviceAccountsGVR).Namespace(namespace).Create(ctx, &unstructured.Unstructured{Object: unstructuredTokenRequest}, metav1.CreateOptions{}, "token")
+			if err != nil {
+				return nil, err
+			}
+			tokenRequest := &authenticationv1.TokenRequest{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(result.UnstructuredContent(), tokenRequest); err != nil {
+				return nil, err
+			}
+			return tokenRequest, nil
+		},
+		getDownstreamNamespace: func(namespaceLocator shared.NamespaceLocator) (string, error) {
+			namespaceLocatorJSONBytes, err := json.Marshal(namespaceLocator)
+			if err != nil {
+				return "", err
+			}
+			namespaces, err := downstreamNamespaceIndexer.ByIndex(byNamespaceLocatorIndexName, string(namespaceLocatorJSONBytes))
+			if err != nil {
+				return "", err
+			}
+			if len(namespaces) == 0 {
+				return "", nil
+			}
+			// There should be only one namespace with the same namespace locator, return it.
+			return namespaces[0].(metav1.Object).GetName(), nil
+		},
+		isDownstreamSecretMounted: mounts.isMounted,
+		getDownstreamSecret: func(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+			return downstreamKubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		createDownstreamSecret: func(ctx context.Context, secret *corev1.Secret) error {
+			_, err := downstreamKubeClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+			return err
+		},
+		updateDownstreamSecret: func(ctx context.Context, secret *corev1.Secret) error {
+			_, err := downstreamKubeClient.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+			return err
+		},
+		deleteDownstreamSecret: func(ctx context.Context, namespace, name string) error {
+			return downstreamKubeClient.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+		now: time.Now,
+
+		tokenExpiration: defaultTokenExpiration,
+
+		syncTargetName:      syncTargetName,
+		syncTargetWorkspace: syncTargetWorkspace,
+		syncTargetUID:       syncTargetUID,
+	}
+
+	if err := downstreamNamespaceInformers.ForResource(namespaceGVR).Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: shared.IndexByNamespaceLocator}); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ServiceAccountTokenSecret implements mutators.ServiceAccountTokenSecretFunc. It returns the name of the
+// downstream Secret holding the token of the service account, and makes sure the Secret is maintained.
+func (c *Controller) ServiceAccountTokenSecret(clusterName logicalcluster.Name, namespace, serviceAccountName string) (string, error) {
+	c.queue.Add(kcpcache.ToClusterAwareKey(clusterName.String(), namespace, serviceAccountName))
+	return shared.ProjectedServiceAccountTokenSecretName(serviceAccountName), nil
+}
+
+// Start starts N worker processes processing work items.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := logging.WithReconciler(klog.FromContext(ctx), controllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// startWorker processes work items until stopCh is closed.
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	serviceAccountKey := key.(string)
+
+	logger := logging.WithQueueKey(klog.FromContext(ctx), serviceAccountKey)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(4).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	requeueAfter, err := c.process(ctx, serviceAccountKey)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+
+	return true
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/spec/mutators"
+)
+
+const bySecretVolumeIndexName = "syncer-tokens-BySecretVolume"
+
+// secretMounts finds the Secrets mounted by the downstream workloads synced to the SyncTarget, with an index of
+// the informers of the synced workload resources by the Secrets their pod templates mount.
+type secretMounts struct {
+	workloadInformers resourcesync.SyncerInformerFactory
+	syncedResources   func() ([]schema.GroupVersionResource, bool)
+
+	// lock serializes the updates of the informers.
+	lock sync.Mutex
+}
+
+// isMounted returns whether the pod template of any downstream workload of the namespace mounts the Secret.
+// The workload resources that are not synced, e.g. CronJobs on a SyncTarget cluster not serving batch/v1
+// CronJobs, do not mount any Secret.
+func (m *secretMounts) isMounted(ctx context.Context, namespace, name string) (bool, error) {
+	gvrs, err := m.updateInformers(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, gvr := range gvrs {
+		if !m.workloadInformers.HasSynced(gvr) {
+			return false, fmt.Errorf("informer of downstream %s is not synced yet", gvr)
+		}
+		informer, err := m.workloadInformers.SyncedInformer(gvr)
+		if err != nil {
+			return false, err
+		}
+		workloads, err := informer.Informer().GetIndexer().ByIndex(bySecretVolumeIndexName, namespace+"/"+name)
+		if err != nil {
+			return false, err
+		}
+		if len(workloads) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// updateInformers starts the informers of the synced workload resources, stops the ones of the workload resources
+// not synced anymore, and returns the synced workload resources.
+func (m *secretMounts) updateInformers(ctx context.Context) ([]schema.GroupVersionResource, error) {
+	syncedResources, synced := m.syncedResources()
+	if !synced {
+		return nil, errors.New("synced resources are not known yet")
+	}
+	podSpecPaths := map[schema.GroupVersionResource][]string{}
+	for _, gvr := range syncedResources {
+		if podSpecPath, ok := mutators.PodSpecPaths[gvr]; ok {
+			podSpecPaths[gvr] = podSpecPath
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, gvr := range m.workloadInformers.GVRs() {
+		if _, ok := podSpecPaths[gvr]; !ok {
+			m.workloadInformers.RemoveGVRs(gvr)
+		}
+	}
+	gvrs := make([]schema.GroupVersionResource, 0, len(podSpecPaths))
+	for gvr, podSpecPath := range podSpecPaths {
+		gvrs = append(gvrs, gvr)
+		if m.workloadInformers.Has(gvr) {
+			continue
+		}
+		m.workloadInformers.AddGVRs(gvr)
+		informer, err := m.workloadInformers.SyncedInformer(gvr)
+		if err != nil {
+			return nil, err
+		}
+		if err := informer.Informer().AddIndexers(cache.Indexers{bySecretVolumeIndexName: indexBySecretVolume(podSpecPath)}); err != nil {
+			return nil, err
+		}
+	}
+	m.workloadInformers.Start(ctx.Done())
+
+	return gvrs, nil
+}
+
+// indexBySecretVolume returns an index function indexing the workloads by the <namespace>/<name> keys of the
+// Secrets mounted by the pod spec at the given path.
+func indexBySecretVolume(podSpecPath []string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		workload, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("workload expected to be *unstructured.Unstructured, got %T", obj)
+		}
+		unstructuredPodSpec, found, err := unstructured.NestedMap(workload.Object, podSpecPath...)
+		if err != nil || !found {
+			return nil, err
+		}
+		var podSpec corev1.PodSpec
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredPodSpec, &podSpec); err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		for _, name := range mountedSecrets(&podSpec) {
+			keys = append(keys, workload.GetNamespace()+"/"+name)
+		}
+		return keys, nil
+	}
+}
+
+// mountedSecrets returns the names of the Secrets mounted by the volumes of the pod spec.
+func mountedSecrets(podSpec *corev1.PodSpec) []string {
+	var names []string
+	for _, volume := range podSpec.Volumes {
+		if volume.Secret != nil {
+			names = append(names, volume.Secret.SecretName)
+		}
+		if volume.Projected == nil {
+			continue
+		}
+		for _, source := range volume.Projected.Sources {
+			if source.Secret != nil {
+				names = append(names, source.Secret.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+// process makes sure the downstream Secret of the service account holds a token which is not
+// close to expiry. It returns the duration after which the token must be refreshed.
+func (c *Controller) process(ctx context.Context, key string) (time.Duration, error) {
+	logger := klog.FromContext(ctx)
+
+	clusterName, namespace, serviceAccountName, err := kcpcache.SplitMetaClusterNamespaceKey(key)
+	if err != nil {
+		logger.Error(err, "Invalid key")
+		return 0, nil
+	}
+
+	locator := shared.NewNamespaceLocator(clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, namespace)
+	downstreamNamespace, err := c.getDownstreamNamespace(locator)
+	if err != nil {
+		return 0, err
+	}
+	if downstreamNamespace == "" {
+		// The spec syncer creates the downstream namespace before applying the workload.
+		return 0, fmt.Errorf("downstream namespace for %s|%s not found yet", clusterName, namespace)
+	}
+
+	secretName := shared.ProjectedServiceAccountTokenSecretName(serviceAccountName)
+	existing, err := c.getDownstreamSecret(ctx, downstreamNamespace, secretName)
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Refresh tokens when 80% of their lifetime has passed.
+	refreshMargin := c.tokenExpiration / 5
+
+	if existing != nil {
+		if expiration, err := time.Parse(time.RFC3339, existing.Annotations[shared.ServiceAccountTokenExpirationAnnotation]); err == nil {
+			if refreshIn := expiration.Add(-refreshMargin).Sub(c.now()); refreshIn > 0 {
+				logger.V(4).Info("token is up to date", "secret", downstreamNamespace+"/"+secretName, "expiration", expiration)
+				return refreshIn, nil
+			}
+		}
+
+		// Stop refreshing the token once no workload mounts it anymore. It is maintained again as soon as
+		// a synced workload uses the service account.
+		mounted, err := c.isDownstreamSecretMounted(ctx, downstreamNamespace, secretName)
+		if err != nil {
+			return 0, err
+		}
+		if !mounted {
+			logger.V(2).Info("deleting downstream token secret not mounted by any workload", "secret", downstreamNamespace+"/"+secretName)
+			if err := c.deleteDownstreamSecret(ctx, downstreamNamespace, secretName); err != nil && !apierrors.IsNotFound(err) {
+				return 0, err
+			}
+			return 0, nil
+		}
+	}
+
+	tokenRequest, err := c.requestToken(ctx, clusterName, namespace, serviceAccountName, int64(c.tokenExpiration.Seconds()))
+	if apierrors.IsNotFound(err) {
+		// The service account doesn't exist (anymore) upstream, stop maintaining its token.
+		logger.V(2).Info("service account not found upstream")
+		if existing == nil {
+			return 0, nil
+		}
+		logger.V(2).Info("deleting downstream token secret", "secret", downstreamNamespace+"/"+secretName)
+		if err := c.deleteDownstreamSecret(ctx, downstreamNamespace, secretName); err != nil && !apierrors.IsNotFound(err) {
+			return 0, err
+		}
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	expiration := tokenRequest.Status.ExpirationTimestamp.Time
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: downstreamNamespace,
+			Annotations: map[string]string{
+				shared.ServiceAccountTokenExpirationAnnotation: expiration.UTC().Format(time.RFC3339),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"token":     []byte(tokenRequest.Status.Token),
+			"namespace": []byte(namespace),
+		},
+	}
+
+	if existing == nil {
+		logger.V(2).Info("creating downstream token secret", "secret", downstreamNamespace+"/"+secretName, "expiration", expiration)
+		if err := c.createDownstreamSecret(ctx, secret); err != nil {
+			return 0, err
+		}
+	} else {
+		logger.V(2).Info("refreshing downstream token secret", "secret", downstreamNamespace+"/"+secretName, "expiration", expiration)
+		secret.ResourceVersion = existing.ResourceVersion
+		if err := c.updateDownstreamSecret(ctx, secret); err != nil {
+			return 0, err
+		}
+	}
+
+	refreshIn := expiration.Add(-refreshMargin).Sub(c.now())
+	if refreshIn <= 0 {
+		// The token lifetime granted by kcp is shorter than the margin, refresh it half-way.
+		refreshIn = expiration.Sub(c.now()) / 2
+	}
+	return refreshIn, nil
+}
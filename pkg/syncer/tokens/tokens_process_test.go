@@ -0,0 +1,295 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+func TestTokensProcess(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		downstreamNamespace string
+		existingExpiration  *time.Time
+		serviceAccountGone  bool
+		secretNotMounted    bool
+
+		expectError        bool
+		expectTokenRequest bool
+		expectCreated      bool
+		expectUpdated      bool
+		expectDeleted      bool
+		expectRequeueAfter time.Duration
+	}{
+		"no downstream namespace yet, expect error": {
+			expectError: true,
+		},
+		"no secret yet, expect a token to be requested and the secret to be created": {
+			downstreamNamespace: "kcp-hcbsa8z6c2er",
+			expectTokenRequest:  true,
+			expectCreated:       true,
+			expectRequeueAfter:  48 * time.Minute,
+		},
+		"fresh token, expect a requeue before expiry": {
+			downstreamNamespace: "kcp-hcbsa8z6c2er",
+			existingExpiration:  timePtr(now.Add(30 * time.Minute)),
+			expectRequeueAfter:  18 * time.Minute,
+		},
+		"token close to expiry, expect a token to be requested and the secret to be updated": {
+			downstreamNamespace: "kcp-hcbsa8z6c2er",
+			existingExpiration:  timePtr(now.Add(5 * time.Minute)),
+			expectTokenRequest:  true,
+			expectUpdated:       true,
+			expectRequeueAfter:  48 * time.Minute,
+		},
+		"token close to expiry, not mounted by any workload anymore, expect the secret to be deleted": {
+			downstreamNamespace: "kcp-hcbsa8z6c2er",
+			existingExpiration:  timePtr(now.Add(5 * time.Minute)),
+			secretNotMounted:    true,
+			expectDeleted:       true,
+		},
+		"service account deleted upstream, expect the secret to be deleted": {
+			downstreamNamespace: "kcp-hcbsa8z6c2er",
+			existingExpiration:  timePtr(now.Add(5 * time.Minute)),
+			serviceAccountGone:  true,
+			expectTokenRequest:  true,
+			expectDeleted:       true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var tokenRequested, created, updated, deleted bool
+			var createdOrUpdated *corev1.Secret
+
+			c := &Controller{
+				requestToken: func(ctx context.Context, clusterName logicalcluster.Name, namespace, serviceAccountName string, expirationSeconds int64) (*authenticationv1.TokenRequest, error) {
+					tokenRequested = true
+					require.Equal(t, logicalcluster.New("root:org:ws"), clusterName)
+					require.Equal(t, "test", namespace)
+					require.Equal(t, "default", serviceAccountName)
+					if tc.serviceAccountGone {
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "serviceaccounts"}, serviceAccountName)
+					}
+					return &authenticationv1.TokenRequest{
+						Status: authenticationv1.TokenRequestStatus{
+							Token:               "token",
+							ExpirationTimestamp: metav1.NewTime(now.Add(time.Duration(expirationSeconds) * time.Second)),
+						},
+					}, nil
+				},
+				getDownstreamNamespace: func(namespaceLocator shared.NamespaceLocator) (string, error) {
+					return tc.downstreamNamespace, nil
+				},
+				isDownstreamSecretMounted: func(ctx context.Context, namespace, name string) (bool, error) {
+					require.Equal(t, tc.downstreamNamespace, namespace)
+					require.Equal(t, "kcp-default-projected-token", name)
+					return !tc.secretNotMounted, nil
+				},
+				getDownstreamSecret: func(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+					if tc.existingExpiration == nil {
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+					}
+					return &corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:            name,
+							Namespace:       namespace,
+							ResourceVersion: "1",
+							Annotations: map[string]string{
+								shared.ServiceAccountTokenExpirationAnnotation: tc.existingExpiration.Format(time.RFC3339),
+							},
+						},
+					}, nil
+				},
+				createDownstreamSecret: func(ctx context.Context, secret *corev1.Secret) error {
+					created = true
+					createdOrUpdated = secret
+					return nil
+				},
+				updateDownstreamSecret: func(ctx context.Context, secret *corev1.Secret) error {
+					updated = true
+					createdOrUpdated = secret
+					return nil
+				},
+				deleteDownstreamSecret: func(ctx context.Context, namespace, name string) error {
+					deleted = true
+					return nil
+				},
+				now: func() time.Time { return now },
+
+				tokenExpiration: defaultTokenExpiration,
+
+				syncTargetName:      "us-west1",
+				syncTargetWorkspace: logicalcluster.New("root:org:ws"),
+				syncTargetUID:       "syncTargetUID",
+			}
+
+			key := kcpcache.ToClusterAwareKey("root:org:ws", "test", "default")
+			requeueAfter, err := c.process(context.Background(), key)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expectTokenRequest, tokenRequested, "token requested")
+			require.Equal(t, tc.expectCreated, created, "secret created")
+			require.Equal(t, tc.expectUpdated, updated, "secret updated")
+			require.Equal(t, tc.expectDeleted, deleted, "secret deleted")
+			require.Equal(t, tc.expectRequeueAfter, requeueAfter)
+
+			if createdOrUpdated != nil {
+				require.Equal(t, "kcp-default-projected-token", createdOrUpdated.Name)
+				require.Equal(t, tc.downstreamNamespace, createdOrUpdated.Namespace)
+				require.Equal(t, []byte("token"), createdOrUpdated.Data["token"])
+				require.Equal(t, []byte("test"), createdOrUpdated.Data["namespace"])
+				require.Equal(t, now.Add(time.Hour).Format(time.RFC3339), createdOrUpdated.Annotations[shared.ServiceAccountTokenExpirationAnnotation])
+			}
+			if updated {
+				require.Equal(t, "1", createdOrUpdated.ResourceVersion)
+			}
+		})
+	}
+}
+
+func TestSecretMountsIsMounted(t *testing.T) {
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	cronJobsGVR := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "app",
+			"namespace": "kcp-hcbsa8z6c2er",
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"volumes": []interface{}{
+						map[string]interface{}{
+							"name":      "config",
+							"configMap": map[string]interface{}{"name": "config"},
+						},
+						map[string]interface{}{
+							"name": "kcp-api-access",
+							"projected": map[string]interface{}{
+								"sources": []interface{}{
+									map[string]interface{}{"secret": map[string]interface{}{"name": "kcp-default-projected-token"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	tests := map[string]struct {
+		syncedResources []schema.GroupVersionResource
+		notSynced       bool
+		namespace       string
+		name            string
+
+		expectMounted bool
+		expectError   bool
+	}{
+		"mounted by a synced workload": {
+			syncedResources: []schema.GroupVersionResource{deploymentsGVR},
+			namespace:       "kcp-hcbsa8z6c2er",
+			name:            "kcp-default-projected-token",
+			expectMounted:   true,
+		},
+		"other Secret": {
+			syncedResources: []schema.GroupVersionResource{deploymentsGVR},
+			namespace:       "kcp-hcbsa8z6c2er",
+			name:            "kcp-other-projected-token",
+		},
+		"other namespace": {
+			syncedResources: []schema.GroupVersionResource{deploymentsGVR},
+			namespace:       "kcp-01c0zzvlqsi7n",
+			name:            "kcp-default-projected-token",
+		},
+		"workloads not synced are not watched": {
+			syncedResources: []schema.GroupVersionResource{cronJobsGVR},
+			namespace:       "kcp-hcbsa8z6c2er",
+			name:            "kcp-default-projected-token",
+		},
+		"synced resources not known yet": {
+			notSynced:   true,
+			namespace:   "kcp-hcbsa8z6c2er",
+			name:        "kcp-default-projected-token",
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				deploymentsGVR: "DeploymentList",
+				cronJobsGVR:    "CronJobList",
+			}, deployment)
+			mounts := &secretMounts{
+				workloadInformers: resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+					return dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+				}),
+				syncedResources: func() ([]schema.GroupVersionResource, bool) {
+					return tc.syncedResources, !tc.notSynced
+				},
+			}
+
+			var mounted bool
+			var err error
+			require.Eventually(t, func() bool {
+				mounted, err = mounts.isMounted(ctx, tc.namespace, tc.name)
+				return tc.expectError || err == nil
+			}, wait.ForeverTestTimeout, 100*time.Millisecond)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectMounted, mounted)
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
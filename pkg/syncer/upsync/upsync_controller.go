@@ -0,0 +1,297 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	kubernetesinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/kcp-dev/kcp/pkg/informer"
+	"github.com/kcp-dev/kcp/pkg/logging"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+const (
+	controllerName              = "kcp-workload-syncer-upsync"
+	byNamespaceLocatorIndexName = "syncer-upsync-ByNamespaceLocator"
+)
+
+// Controller mirrors the objects created on the SyncTarget with the state.workload.kcp.dev/<sync-target-key>
+// label set to Upsync into the workspace they belong to, and deletes them from the workspace when they are
+// deleted on the SyncTarget. The syncer owns the upstream objects: changes made to them are reverted.
+//
+// Namespaced objects are upsynced to the workspace and namespace their downstream namespace is synced from.
+// Cluster-scoped objects are upsynced to the workspace of their workload.kcp.dev/upsync-workspace annotation, as
+// long as the workspace is placed on the SyncTarget, i.e. has namespaces synced to it.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	upstreamClient                         dynamic.ClusterInterface
+	upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory
+
+	getDownstreamNamespace     func(name string) (*unstructured.Unstructured, error)
+	getDownstreamNamespaceName func(locator shared.NamespaceLocator) (string, bool, error)
+	upstreamNamespaceExists    func(clusterName logicalcluster.Name, name string) (bool, error)
+	workspacePlaced            func(clusterName logicalcluster.Name) (bool, error)
+
+	syncTargetName      string
+	syncTargetWorkspace logicalcluster.Name
+	syncTargetUID       types.UID
+	syncTargetKey       string
+}
+
+// NewUpsyncer returns an upsync controller. upstreamInformers and downstreamInformers must only watch
+// the upsynced objects, while the namespace lister and informer are the ones of the namespaces synced to the SyncTarget.
+func NewUpsyncer(syncTargetWorkspace logicalcluster.Name, syncTargetName, syncTargetKey string, syncTargetUID types.UID,
+	upstreamClient dynamic.ClusterInterface, upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory,
+	upstreamNamespaceLister cache.GenericLister, downstreamNamespaceInformer kubernetesinformers.GenericInformer) (*Controller, error) {
+	if err := downstreamNamespaceInformer.Informer().AddIndexers(cache.Indexers{byNamespaceLocatorIndexName: shared.IndexByNamespaceLocator}); err != nil {
+		return nil, err
+	}
+
+	c := &Controller{
+		queue: syncermetrics.NewQueue(controllerName, workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName), func(item interface{}) schema.GroupVersionResource {
+			return item.(queueKey).gvr
+		}),
+
+		upstreamClient:      upstreamClient,
+		upstreamInformers:   upstreamInformers,
+		downstreamInformers: downstreamInformers,
+
+		getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+			obj, err := downstreamNamespaceInformer.Lister().Get(name)
+			if err != nil {
+				return nil, err
+			}
+			unstr, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return nil, fmt.Errorf("namespace %q expected to be *unstructured.Unstructured, got %T", name, obj)
+			}
+			return unstr, nil
+		},
+		getDownstreamNamespaceName: func(locator shared.NamespaceLocator) (string, bool, error) {
+			locatorJSON, err := json.Marshal(locator)
+			if err != nil {
+				return "", false, err
+			}
+			namespaces, err := downstreamNamespaceInformer.Informer().GetIndexer().ByIndex(byNamespaceLocatorIndexName, string(locatorJSON))
+			if err != nil {
+				return "", false, err
+			}
+			if len(namespaces) != 1 {
+				// Namespace collisions are reported by the spec syncer.
+				return "", false, nil
+			}
+			namespace, ok := namespaces[0].(metav1.Object)
+			if !ok {
+				return "", false, fmt.Errorf("namespace expected to be a metav1.Object, got %T", namespaces[0])
+			}
+			return namespace.GetName(), true, nil
+		},
+		upstreamNamespaceExists: func(clusterName logicalcluster.Name, name string) (bool, error) {
+			_, err := upstreamNamespaceLister.Get(clusters.ToClusterAwareKey(clusterName, name))
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		},
+		workspacePlaced: func(clusterName logicalcluster.Name) (bool, error) {
+			namespaces, err := upstreamNamespaceLister.List(labels.Everything())
+			if err != nil {
+				return false, err
+			}
+			for _, obj := range namespaces {
+				namespace, ok := obj.(metav1.Object)
+				if !ok {
+					return false, fmt.Errorf("namespace expected to be a metav1.Object, got %T", obj)
+				}
+				if logicalcluster.From(namespace) == clusterName {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+
+		syncTargetName:      syncTargetName,
+		syncTargetWorkspace: syncTargetWorkspace,
+		syncTargetUID:       syncTargetUID,
+		syncTargetKey:       syncTargetKey,
+	}
+
+	logger := logging.WithReconciler(klog.Background(), controllerName)
+
+	downstreamInformers.AddEventHandler(informer.GVREventHandlerFuncs{
+		AddFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.enqueueDownstream(gvr, obj, logger)
+		},
+		UpdateFunc: func(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+			c.enqueueDownstream(gvr, newObj, logger)
+		},
+		DeleteFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.enqueueDownstream(gvr, obj, logger)
+		},
+	})
+	upstreamInformers.AddEventHandler(informer.GVREventHandlerFuncs{
+		AddFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.enqueueUpstream(gvr, obj, logger)
+		},
+		UpdateFunc: func(gvr schema.GroupVersionResource, oldObj, newObj interface{}) {
+			c.enqueueUpstream(gvr, newObj, logger)
+		},
+		DeleteFunc: func(gvr schema.GroupVersionResource, obj interface{}) {
+			c.enqueueUpstream(gvr, obj, logger)
+		},
+	})
+
+	return c, nil
+}
+
+// queueKey identifies an upsynced object by its upstream location.
+type queueKey struct {
+	gvr         schema.GroupVersionResource
+	clusterName logicalcluster.Name
+	namespace   string
+	name        string
+}
+
+func (k queueKey) String() string {
+	if k.namespace == "" {
+		return fmt.Sprintf("%s %s|%s", k.gvr, k.clusterName, k.name)
+	}
+	return fmt.Sprintf("%s %s|%s/%s", k.gvr, k.clusterName, k.namespace, k.name)
+}
+
+func (c *Controller) enqueueDownstream(gvr schema.GroupVersionResource, obj interface{}, logger logr.Logger) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	downstreamObj, ok := obj.(metav1.Object)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("expected a metav1.Object, got %T", obj))
+		return
+	}
+
+	clusterName, namespace, found, err := c.upstreamLocation(downstreamObj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !found {
+		logger.V(4).Info("ignoring downstream object without upstream location", "gvr", gvr.String(), "namespace", downstreamObj.GetNamespace(), "name", downstreamObj.GetName())
+		return
+	}
+	c.enqueue(queueKey{gvr: gvr, clusterName: clusterName, namespace: namespace, name: downstreamObj.GetName()}, logger)
+}
+
+func (c *Controller) enqueueUpstream(gvr schema.GroupVersionResource, obj interface{}, logger logr.Logger) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	upstreamObj, ok := obj.(metav1.Object)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("expected a metav1.Object, got %T", obj))
+		return
+	}
+	c.enqueue(queueKey{gvr: gvr, clusterName: logicalcluster.From(upstreamObj), namespace: upstreamObj.GetNamespace(), name: upstreamObj.GetName()}, logger)
+}
+
+func (c *Controller) enqueue(key queueKey, logger logr.Logger) {
+	logger.V(4).Info("queueing upsynced object", "key", key.String())
+	c.queue.Add(key)
+}
+
+// Start starts N worker processes processing work items.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := logging.WithReconciler(klog.FromContext(ctx), controllerName)
+	ctx = klog.NewContext(ctx, logger)
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// startWorker processes work items until stopCh is closed.
+func (c *Controller) startWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	qk := key.(queueKey)
+
+	logger := logging.WithQueueKey(klog.FromContext(ctx), qk.String())
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(4).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	if !c.downstreamInformers.Has(qk.gvr) {
+		// The resource type is not synced anymore.
+		logger.V(4).Info("Dropping key of a resource type that is not synced anymore")
+		c.queue.Forget(key)
+		return true
+	}
+
+	start := time.Now()
+	err := c.process(ctx, qk)
+	syncermetrics.ObserveProcessing(controllerName, qk.gvr, key, start, err)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("%s failed to sync %q, err: %w", controllerName, qk.String(), err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+
+	return true
+}
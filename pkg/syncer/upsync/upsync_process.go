@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upsync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	syncermetrics "github.com/kcp-dev/kcp/pkg/syncer/metrics"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+)
+
+func (c *Controller) process(ctx context.Context, key queueKey) error {
+	logger := klog.FromContext(ctx)
+
+	downstreamObj, err := c.getDownstreamObject(key)
+	if err != nil {
+		return err
+	}
+	upstreamObj, err := c.getUpstreamObject(key)
+	if err != nil {
+		return err
+	}
+
+	upstreamClient := c.upstreamClient.Cluster(key.clusterName).Resource(key.gvr).Namespace(key.namespace)
+
+	if downstreamObj == nil {
+		if upstreamObj == nil {
+			return nil
+		}
+		logger.Info("Deleting upstream object, it is not upsynced anymore")
+		uid := upstreamObj.GetUID()
+		err := upstreamClient.Delete(ctx, key.name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+		if err != nil && !apierrors.IsNotFound(err) {
+			syncermetrics.RecordWriteError(controllerName, key.gvr, "delete")
+			return err
+		}
+		return nil
+	}
+
+	desired := upsyncedObject(downstreamObj, key.namespace, c.syncTargetKey)
+	downstreamStatus, statusExists, err := unstructured.NestedFieldCopy(downstreamObj.UnstructuredContent(), "status")
+	if err != nil {
+		return err
+	}
+
+	if upstreamObj == nil {
+		if key.namespace != "" {
+			// When the SyncTarget is served by several syncer virtual workspaces, the upstream
+			// namespace is only known by the upsyncer of the virtual workspace that serves it.
+			exists, err := c.upstreamNamespaceExists(key.clusterName, key.namespace)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				logger.V(4).Info("Upstream namespace not found, skipping upsync")
+				return nil
+			}
+		} else {
+			// The workspace of a cluster-scoped object is chosen downstream: only the workspaces placed on the
+			// SyncTarget can be written to. The namespaces synced to the SyncTarget of a workspace are only known
+			// by the upsyncer of the virtual workspace that serves it.
+			placed, err := c.workspacePlaced(key.clusterName)
+			if err != nil {
+				return err
+			}
+			if !placed {
+				logger.Info("Workspace is not placed on the SyncTarget, skipping upsync")
+				return nil
+			}
+		}
+
+		logger.Info("Creating upstream object")
+		upstreamObj, err = upstreamClient.Create(ctx, desired, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// The syncer only owns the upstream objects it upsynced.
+			logger.Info("An upstream object with the same name exists and is not upsynced, not overwriting it")
+			return nil
+		}
+		if err != nil {
+			syncermetrics.RecordWriteError(controllerName, key.gvr, "create")
+			return err
+		}
+	} else if !equalIgnoringStatus(upstreamObj, desired) {
+		logger.Info("Updating upstream object")
+		desired.SetResourceVersion(upstreamObj.GetResourceVersion())
+		upstreamObj, err = upstreamClient.Update(ctx, desired, metav1.UpdateOptions{})
+		if err != nil {
+			syncermetrics.RecordWriteError(controllerName, key.gvr, "update")
+			return err
+		}
+	}
+
+	if !statusExists {
+		return nil
+	}
+	upstreamStatus, _, err := unstructured.NestedFieldNoCopy(upstreamObj.UnstructuredContent(), "status")
+	if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(upstreamStatus, downstreamStatus) {
+		return nil
+	}
+
+	logger.V(2).Info("Updating upstream object status")
+	upstreamObj = upstreamObj.DeepCopy()
+	if err := unstructured.SetNestedField(upstreamObj.UnstructuredContent(), downstreamStatus, "status"); err != nil {
+		return err
+	}
+	if _, err := upstreamClient.UpdateStatus(ctx, upstreamObj, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The resource has no status subresource, the status has been updated with the object.
+			return nil
+		}
+		syncermetrics.RecordWriteError(controllerName, key.gvr, "update")
+		return err
+	}
+	return nil
+}
+
+// upstreamLocation returns the logical cluster and namespace a downstream object is upsynced to. The workspace of
+// a cluster-scoped object is the one of its annotation, and is checked to be placed on the SyncTarget before the
+// object is created.
+func (c *Controller) upstreamLocation(downstreamObj metav1.Object) (clusterName logicalcluster.Name, namespace string, found bool, err error) {
+	if downstreamObj.GetNamespace() == "" {
+		workspace := downstreamObj.GetAnnotations()[workloadv1alpha1.UpsyncWorkspaceAnnotation]
+		if workspace == "" {
+			return logicalcluster.Name{}, "", false, nil
+		}
+		return logicalcluster.New(workspace), "", true, nil
+	}
+
+	downstreamNamespace, err := c.getDownstreamNamespace(downstreamObj.GetNamespace())
+	if apierrors.IsNotFound(err) {
+		// Only objects in the namespaces synced to the SyncTarget are upsynced.
+		return logicalcluster.Name{}, "", false, nil
+	}
+	if err != nil {
+		return logicalcluster.Name{}, "", false, err
+	}
+	locator, exists, err := shared.LocatorFromAnnotations(downstreamNamespace.GetAnnotations())
+	if err != nil {
+		return logicalcluster.Name{}, "", false, fmt.Errorf("namespace %q: error decoding annotation: %w", downstreamNamespace.GetName(), err)
+	}
+	if !exists || locator.SyncTarget.UID != c.syncTargetUID || locator.SyncTarget.Workspace != c.syncTargetWorkspace.String() {
+		return logicalcluster.Name{}, "", false, nil
+	}
+	return locator.Workspace, locator.Namespace, true, nil
+}
+
+// getDownstreamObject returns the downstream object upsynced to the upstream location of the key, or nil.
+func (c *Controller) getDownstreamObject(key queueKey) (*unstructured.Unstructured, error) {
+	downstreamKey := key.name
+	if key.namespace != "" {
+		locator := shared.NewNamespaceLocator(key.clusterName, c.syncTargetWorkspace, c.syncTargetUID, c.syncTargetName, key.namespace)
+		downstreamNamespace, found, err := c.getDownstreamNamespaceName(locator)
+		if err != nil || !found {
+			return nil, err
+		}
+		downstreamKey = downstreamNamespace + "/" + key.name
+	}
+
+	downstreamInformer, err := c.downstreamInformers.SyncedInformer(key.gvr)
+	if err != nil {
+		return nil, err
+	}
+	obj, exists, err := downstreamInformer.Informer().GetIndexer().GetByKey(downstreamKey)
+	if err != nil || !exists {
+		return nil, err
+	}
+	downstreamObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("downstream object %s expected to be *unstructured.Unstructured, got %T", downstreamKey, obj)
+	}
+
+	// A cluster-scoped object with the same name might be upsynced to another workspace.
+	clusterName, namespace, found, err := c.upstreamLocation(downstreamObj)
+	if err != nil {
+		return nil, err
+	}
+	if !found || clusterName != key.clusterName || namespace != key.namespace {
+		return nil, nil
+	}
+	return downstreamObj, nil
+}
+
+// getUpstreamObject returns the upsynced upstream object of the key, or nil.
+func (c *Controller) getUpstreamObject(key queueKey) (*unstructured.Unstructured, error) {
+	upstreamInformer, err := c.upstreamInformers.SyncedInformer(key.gvr)
+	if err != nil {
+		return nil, err
+	}
+	lister := upstreamInformer.Lister()
+	var obj runtime.Object
+	if key.namespace != "" {
+		obj, err = lister.ByNamespace(key.namespace).Get(clusters.ToClusterAwareKey(key.clusterName, key.name))
+	} else {
+		obj, err = lister.Get(clusters.ToClusterAwareKey(key.clusterName, key.name))
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	upstreamObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("upstream object %s expected to be *unstructured.Unstructured, got %T", key, obj)
+	}
+	return upstreamObj, nil
+}
+
+// upsyncedObject returns the upstream object mirroring the downstream object, without its status.
+// The downstream metadata set by the SyncTarget cluster, e.g. the UID or owner references, is dropped, and so are
+// the workload labels of other SyncTargets, so that an upsynced object cannot be synced to them.
+func upsyncedObject(downstreamObj *unstructured.Unstructured, upstreamNamespace, syncTargetKey string) *unstructured.Unstructured {
+	upstreamObj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range downstreamObj.Object {
+		if k == "metadata" || k == "status" {
+			continue
+		}
+		upstreamObj.Object[k] = runtime.DeepCopyJSONValue(v)
+	}
+
+	upstreamObj.SetName(downstreamObj.GetName())
+	upstreamObj.SetNamespace(upstreamNamespace)
+	upstreamObj.SetLabels(shared.WithoutForeignWorkloadLabels(downstreamObj.GetLabels(), syncTargetKey))
+
+	annotations := downstreamObj.GetAnnotations()
+	delete(annotations, workloadv1alpha1.UpsyncWorkspaceAnnotation)
+	if len(annotations) > 0 {
+		upstreamObj.SetAnnotations(annotations)
+	}
+
+	return upstreamObj
+}
+
+// equalIgnoringStatus returns whether the upstream object has the content and the labels and
+// annotations of the desired upsynced object, ignoring the annotations set by kcp.
+func equalIgnoringStatus(upstreamObj, desired *unstructured.Unstructured) bool {
+	for k, v := range desired.Object {
+		if k == "metadata" {
+			continue
+		}
+		if !equality.Semantic.DeepEqual(upstreamObj.Object[k], v) {
+			return false
+		}
+	}
+	for k := range upstreamObj.Object {
+		if _, ok := desired.Object[k]; !ok && k != "metadata" && k != "status" {
+			return false
+		}
+	}
+
+	upstreamAnnotations := upstreamObj.GetAnnotations()
+	delete(upstreamAnnotations, logicalcluster.AnnotationKey)
+	return equality.Semantic.DeepEqual(labelsOrNil(upstreamObj.GetLabels()), labelsOrNil(desired.GetLabels())) &&
+		equality.Semantic.DeepEqual(labelsOrNil(upstreamAnnotations), labelsOrNil(desired.GetAnnotations()))
+}
+
+func labelsOrNil(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+	"github.com/kcp-dev/kcp/pkg/syncer/shared"
+	"github.com/kcp-dev/kcp/third_party/keyfunctions"
+)
+
+var (
+	configMapsGVR        = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	persistentVolumesGVR = schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}
+)
+
+var _ dynamic.ClusterInterface = (*mockedDynamicCluster)(nil)
+
+type mockedDynamicCluster struct {
+	client *dynamicfake.FakeDynamicClient
+}
+
+func (mdc *mockedDynamicCluster) Cluster(name logicalcluster.Name) dynamic.Interface {
+	return mdc.client
+}
+
+func TestUpsyncerProcess(t *testing.T) {
+	syncTargetWorkspace := logicalcluster.New("root:org:ws")
+	syncTargetName := "us-west1"
+	syncTargetUID := types.UID("syncTargetUID")
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(syncTargetWorkspace, syncTargetName)
+	upstreamCluster := logicalcluster.New("root:org:ws")
+
+	downstreamNamespace, err := shared.PhysicalClusterNamespaceName(shared.NewNamespaceLocator(upstreamCluster, syncTargetWorkspace, syncTargetUID, syncTargetName, "test"))
+	require.NoError(t, err)
+	locator := `{"syncTarget":{"workspace":"root:org:ws","name":"us-west1","uid":"syncTargetUID"},"workspace":"root:org:ws","namespace":"test"}`
+
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	configMap := func(namespace string, annotations map[string]string, data map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"data":       data,
+		}}
+		obj.SetNamespace(namespace)
+		obj.SetName("cm")
+		obj.SetLabels(map[string]string{stateLabel: "Upsync"})
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	persistentVolume := func(annotations map[string]string, phase string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolume",
+			"spec": map[string]interface{}{
+				"capacity": map[string]interface{}{"storage": "1Gi"},
+			},
+			"status": map[string]interface{}{
+				"phase": phase,
+			},
+		}}
+		obj.SetName("pv")
+		obj.SetLabels(map[string]string{stateLabel: "Upsync"})
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	upstreamAnnotations := map[string]string{logicalcluster.AnnotationKey: upstreamCluster.String()}
+
+	tests := map[string]struct {
+		gvr                     schema.GroupVersionResource
+		key                     queueKey
+		downstreamObjects       []runtime.Object
+		upstreamObjects         []runtime.Object
+		upstreamNamespaceExists bool
+		workspaceNotPlaced      bool
+
+		wantActions []clienttesting.Action
+	}{
+		"namespaced object created downstream is created upstream": {
+			gvr:                     configMapsGVR,
+			key:                     queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			downstreamObjects:       []runtime.Object{configMap(downstreamNamespace, map[string]string{"a": "b"}, map[string]interface{}{"foo": "bar"})},
+			upstreamNamespaceExists: true,
+			wantActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "test", configMap("test", map[string]string{"a": "b"}, map[string]interface{}{"foo": "bar"})),
+			},
+		},
+		"workload labels of other SyncTargets are not upsynced": {
+			gvr: configMapsGVR,
+			key: queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			downstreamObjects: []runtime.Object{func() *unstructured.Unstructured {
+				cm := configMap(downstreamNamespace, nil, map[string]interface{}{"foo": "bar"})
+				cm.SetLabels(map[string]string{
+					stateLabel: "Upsync",
+					"app":      "test",
+					workloadv1alpha1.ClusterResourceStateLabelPrefix + "other":                  "Sync",
+					workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix + "other": "2022-01-01T00:00:00Z",
+					workloadv1alpha1.InternalDownstreamClusterLabel:                             upstreamCluster.String(),
+				})
+				return cm
+			}()},
+			upstreamNamespaceExists: true,
+			wantActions: []clienttesting.Action{
+				clienttesting.NewCreateAction(configMapsGVR, "test", func() *unstructured.Unstructured {
+					cm := configMap("test", nil, map[string]interface{}{"foo": "bar"})
+					cm.SetLabels(map[string]string{stateLabel: "Upsync", "app": "test"})
+					return cm
+				}()),
+			},
+		},
+		"namespaced object in a namespace not served by this virtual workspace is not created upstream": {
+			gvr:               configMapsGVR,
+			key:               queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			downstreamObjects: []runtime.Object{configMap(downstreamNamespace, nil, map[string]interface{}{"foo": "bar"})},
+		},
+		"upstream object in sync is not updated": {
+			gvr:               configMapsGVR,
+			key:               queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			downstreamObjects: []runtime.Object{configMap(downstreamNamespace, nil, map[string]interface{}{"foo": "bar"})},
+			upstreamObjects:   []runtime.Object{configMap("test", upstreamAnnotations, map[string]interface{}{"foo": "bar"})},
+		},
+		"upstream object changed upstream is reverted": {
+			gvr:               configMapsGVR,
+			key:               queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			downstreamObjects: []runtime.Object{configMap(downstreamNamespace, nil, map[string]interface{}{"foo": "bar"})},
+			upstreamObjects:   []runtime.Object{configMap("test", upstreamAnnotations, map[string]interface{}{"foo": "changed"})},
+			wantActions: []clienttesting.Action{
+				clienttesting.NewUpdateAction(configMapsGVR, "test", configMap("test", nil, map[string]interface{}{"foo": "bar"})),
+			},
+		},
+		"upstream object is deleted when deleted downstream": {
+			gvr:             configMapsGVR,
+			key:             queueKey{gvr: configMapsGVR, clusterName: upstreamCluster, namespace: "test", name: "cm"},
+			upstreamObjects: []runtime.Object{configMap("test", upstreamAnnotations, map[string]interface{}{"foo": "bar"})},
+			wantActions: []clienttesting.Action{
+				clienttesting.NewDeleteAction(configMapsGVR, "test", "cm"),
+			},
+		},
+		"cluster-scoped object is created upstream, with its status": {
+			gvr:               persistentVolumesGVR,
+			key:               queueKey{gvr: persistentVolumesGVR, clusterName: upstreamCluster, name: "pv"},
+			downstreamObjects: []runtime.Object{persistentVolume(map[string]string{workloadv1alpha1.UpsyncWorkspaceAnnotation: upstreamCluster.String()}, "Bound")},
+			wantActions: []clienttesting.Action{
+				clienttesting.NewRootCreateAction(persistentVolumesGVR, func() *unstructured.Unstructured {
+					pv := persistentVolume(nil, "")
+					unstructured.RemoveNestedField(pv.Object, "status")
+					return pv
+				}()),
+				clienttesting.NewRootUpdateSubresourceAction(persistentVolumesGVR, "status", persistentVolume(nil, "Bound")),
+			},
+		},
+		"cluster-scoped object upsynced to a workspace not placed on the SyncTarget is not created upstream": {
+			gvr:                persistentVolumesGVR,
+			key:                queueKey{gvr: persistentVolumesGVR, clusterName: upstreamCluster, name: "pv"},
+			downstreamObjects:  []runtime.Object{persistentVolume(map[string]string{workloadv1alpha1.UpsyncWorkspaceAnnotation: upstreamCluster.String()}, "Bound")},
+			workspaceNotPlaced: true,
+		},
+		"cluster-scoped object status is updated upstream": {
+			gvr:               persistentVolumesGVR,
+			key:               queueKey{gvr: persistentVolumesGVR, clusterName: upstreamCluster, name: "pv"},
+			downstreamObjects: []runtime.Object{persistentVolume(map[string]string{workloadv1alpha1.UpsyncWorkspaceAnnotation: upstreamCluster.String()}, "Released")},
+			upstreamObjects:   []runtime.Object{persistentVolume(upstreamAnnotations, "Bound")},
+			wantActions: []clienttesting.Action{
+				clienttesting.NewRootUpdateSubresourceAction(persistentVolumesGVR, "status", persistentVolume(upstreamAnnotations, "Released")),
+			},
+		},
+		"cluster-scoped object upsynced to another workspace is ignored, and the upstream object deleted": {
+			gvr:               persistentVolumesGVR,
+			key:               queueKey{gvr: persistentVolumesGVR, clusterName: upstreamCluster, name: "pv"},
+			downstreamObjects: []runtime.Object{persistentVolume(map[string]string{workloadv1alpha1.UpsyncWorkspaceAnnotation: "root:org:other"}, "Bound")},
+			upstreamObjects:   []runtime.Object{persistentVolume(upstreamAnnotations, "Bound")},
+			wantActions: []clienttesting.Action{
+				clienttesting.NewRootDeleteAction(persistentVolumesGVR, "pv"),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listKinds := map[schema.GroupVersionResource]string{
+				configMapsGVR:        "ConfigMapList",
+				persistentVolumesGVR: "PersistentVolumeList",
+			}
+			downstreamClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, tc.downstreamObjects...)
+			upstreamClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, tc.upstreamObjects...)
+
+			downstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewFilteredDynamicSharedInformerFactoryWithOptions(downstreamClient, metav1.NamespaceAll, nil,
+					cache.WithResyncPeriod(time.Hour), cache.WithKeyFunction(keyfunctions.DeletionHandlingMetaNamespaceKeyFunc))
+			})
+			upstreamInformers := resourcesync.NewDynamicInformerFactory(func() dynamicinformer.DynamicSharedInformerFactory {
+				return dynamicinformer.NewDynamicSharedInformerFactory(upstreamClient, time.Hour)
+			})
+			for _, informers := range []resourcesync.SyncerInformerFactory{downstreamInformers, upstreamInformers} {
+				informers.AddGVRs(tc.gvr)
+				informers.Start(ctx.Done())
+				informers.WaitForCacheSync(ctx.Done())
+			}
+
+			c := &Controller{
+				upstreamClient:      &mockedDynamicCluster{client: upstreamClient},
+				upstreamInformers:   upstreamInformers,
+				downstreamInformers: downstreamInformers,
+				getDownstreamNamespace: func(name string) (*unstructured.Unstructured, error) {
+					if name != downstreamNamespace {
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, name)
+					}
+					ns := &unstructured.Unstructured{}
+					ns.SetName(name)
+					ns.SetAnnotations(map[string]string{shared.NamespaceLocatorAnnotation: locator})
+					return ns, nil
+				},
+				getDownstreamNamespaceName: func(l shared.NamespaceLocator) (string, bool, error) {
+					if l.Workspace != upstreamCluster || l.Namespace != "test" {
+						return "", false, nil
+					}
+					return downstreamNamespace, true, nil
+				},
+				upstreamNamespaceExists: func(clusterName logicalcluster.Name, name string) (bool, error) {
+					return tc.upstreamNamespaceExists, nil
+				},
+				workspacePlaced: func(clusterName logicalcluster.Name) (bool, error) {
+					return !tc.workspaceNotPlaced, nil
+				},
+				syncTargetName:      syncTargetName,
+				syncTargetWorkspace: syncTargetWorkspace,
+				syncTargetUID:       syncTargetUID,
+				syncTargetKey:       syncTargetKey,
+			}
+
+			upstreamClient.ClearActions()
+			require.NoError(t, c.process(ctx, tc.key))
+
+			var actions []clienttesting.Action
+			for _, action := range upstreamClient.Actions() {
+				if action.GetVerb() != "list" && action.GetVerb() != "watch" {
+					actions = append(actions, action)
+				}
+			}
+			require.Empty(t, cmp.Diff(tc.wantActions, actions))
+		})
+	}
+}
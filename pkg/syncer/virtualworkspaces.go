@@ -0,0 +1,392 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+	"k8s.io/klog/v2"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/syncer/resourcesync"
+)
+
+// startVirtualWorkspaceSyncersFunc starts the spec and status syncers for the given
+// syncer virtual workspace URL. It is expected to block until the syncers have been
+// started, or to return an error. Once the upstream informers are synced, it must call
+// markSynced with the upstream client of the virtual workspace, the upstream namespace indexer,
+// and the informer factories of the synced resource types.
+type startVirtualWorkspaceSyncersFunc func(ctx context.Context, url string, markSynced markSyncedFunc) error
+
+type markSyncedFunc func(upstreamClient dynamic.ClusterInterface, upstreamNamespaceIndexer cache.Indexer, upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory)
+
+// startBackoff is the backoff of the failed starts of the syncers of a syncer virtual workspace URL.
+var startBackoff = wait.Backoff{
+	Duration: 1 * time.Second,
+	Factor:   2.0,
+	Jitter:   1.0,
+	Steps:    math.MaxInt32,
+	Cap:      5 * time.Minute,
+}
+
+// virtualWorkspaceSyncers tracks the syncers started for every syncer virtual workspace URL
+// found in the SyncTarget status, starting and stopping them as URLs are added or removed.
+type virtualWorkspaceSyncers struct {
+	start    startVirtualWorkspaceSyncersFunc
+	onSynced func()
+
+	// startBackoff is the backoff of the failed starts of the syncers of a URL.
+	startBackoff wait.Backoff
+
+	lock    sync.RWMutex
+	started map[string]*virtualWorkspaceSyncer
+}
+
+type virtualWorkspaceSyncer struct {
+	cancel context.CancelFunc
+
+	// upstreamClient is nil until the upstream informers are synced.
+	upstreamClient dynamic.ClusterInterface
+	// upstreamNamespaceIndexer is nil until the upstream informers are synced.
+	upstreamNamespaceIndexer cache.Indexer
+	// upstreamInformers and downstreamInformers are nil until the upstream informers are synced.
+	upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory
+}
+
+func newVirtualWorkspaceSyncers(start startVirtualWorkspaceSyncersFunc, onSynced func()) *virtualWorkspaceSyncers {
+	return &virtualWorkspaceSyncers{
+		start:        start,
+		onSynced:     onSynced,
+		startBackoff: startBackoff,
+		started:      map[string]*virtualWorkspaceSyncer{},
+	}
+}
+
+// Reconcile starts syncers for the virtual workspace URLs of the SyncTarget that have no syncers yet,
+// and stops the syncers of the URLs that are not in the SyncTarget status anymore. A nil SyncTarget
+// stops all the syncers.
+func (s *virtualWorkspaceSyncers) Reconcile(ctx context.Context, syncTarget *workloadv1alpha1.SyncTarget) {
+	logger := klog.FromContext(ctx)
+
+	desiredURLs := sets.NewString()
+	if syncTarget != nil {
+		for _, vw := range syncTarget.Status.VirtualWorkspaces {
+			desiredURLs.Insert(vw.URL)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for url, started := range s.started {
+		if desiredURLs.Has(url) {
+			continue
+		}
+		logger.Info("stopping syncers for removed syncer virtual workspace URL", "url", url)
+		started.cancel()
+		delete(s.started, url)
+	}
+
+	for _, url := range desiredURLs.List() {
+		if _, ok := s.started[url]; ok {
+			continue
+		}
+		logger.Info("starting syncers for syncer virtual workspace URL", "url", url)
+		vwCtx, cancel := context.WithCancel(ctx)
+		started := &virtualWorkspaceSyncer{cancel: cancel}
+		s.started[url] = started
+		go s.run(vwCtx, url, started)
+	}
+}
+
+func (s *virtualWorkspaceSyncers) run(ctx context.Context, url string, started *virtualWorkspaceSyncer) {
+	logger := klog.FromContext(ctx).WithValues("url", url)
+	ctx = klog.NewContext(ctx, logger)
+
+	markSynced := func(upstreamClient dynamic.ClusterInterface, upstreamNamespaceIndexer cache.Indexer, upstreamInformers, downstreamInformers resourcesync.SyncerInformerFactory) {
+		s.lock.Lock()
+		started.upstreamClient = upstreamClient
+		started.upstreamNamespaceIndexer = upstreamNamespaceIndexer
+		started.upstreamInformers = upstreamInformers
+		started.downstreamInformers = downstreamInformers
+		s.lock.Unlock()
+
+		if s.onSynced != nil {
+			s.onSynced()
+		}
+	}
+
+	// Failed starts are retried with an exponential backoff, until the URL is removed from the SyncTarget.
+	backoff := s.startBackoff
+	for {
+		// Every attempt has its own context, so that what a failed attempt started is stopped before the next one.
+		attemptCtx, cancelAttempt := context.WithCancel(ctx)
+		err := s.start(attemptCtx, url, markSynced)
+		if err == nil {
+			go func() {
+				<-ctx.Done()
+				cancelAttempt()
+			}()
+			return
+		}
+		cancelAttempt()
+
+		delay := backoff.Step()
+		logger.Error(err, "failed to start syncers for syncer virtual workspace URL, retrying", "delay", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// URLs returns the syncer virtual workspace URLs for which syncers are started.
+func (s *virtualWorkspaceSyncers) URLs() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return sets.StringKeySet(s.started).List()
+}
+
+// SyncedResources returns the resource types synced by any of the syncer virtual workspaces, and
+// whether their informers are synced. The returned boolean is true only when syncers are started
+// for at least one virtual workspace, and all the informers of all the virtual workspaces are synced.
+func (s *virtualWorkspaceSyncers) SyncedResources() ([]workloadv1alpha1.SyncerResource, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	allSynced := len(s.started) > 0
+	informersSynced := map[schema.GroupVersionResource]bool{}
+	for _, started := range s.started {
+		if started.upstreamInformers == nil || started.downstreamInformers == nil {
+			allSynced = false
+			continue
+		}
+		for _, gvr := range started.upstreamInformers.GVRs() {
+			synced, found := informersSynced[gvr]
+			if !found {
+				synced = true
+			}
+			synced = synced && started.upstreamInformers.HasSynced(gvr) && started.downstreamInformers.HasSynced(gvr)
+			informersSynced[gvr] = synced
+			allSynced = allSynced && synced
+		}
+	}
+
+	resources := make([]workloadv1alpha1.SyncerResource, 0, len(informersSynced))
+	for gvr, synced := range informersSynced {
+		resources = append(resources, workloadv1alpha1.SyncerResource{
+			Group:           gvr.Group,
+			Version:         gvr.Version,
+			Resource:        gvr.Resource,
+			InformersSynced: synced,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		if resources[i].Resource != resources[j].Resource {
+			return resources[i].Resource < resources[j].Resource
+		}
+		return resources[i].Version < resources[j].Version
+	})
+	return resources, allSynced
+}
+
+// UpstreamNamespaceExists checks whether the upstream namespace exists in any of the syncer
+// virtual workspaces. It returns an error as long as any of the virtual workspaces is not synced,
+// since the namespace might be served by that one.
+func (s *virtualWorkspaceSyncers) UpstreamNamespaceExists(clusterName logicalcluster.Name, upstreamNamespaceName string) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	started, err := s.upstreamNamespaceSyncer(clusterName, upstreamNamespaceName)
+	return started != nil, err
+}
+
+// UpstreamNamespaceClient returns the client of the syncer virtual workspace serving the upstream namespace,
+// i.e. through which the upstream namespace is synced to the SyncTarget. It returns a NotFound error if none
+// of the virtual workspaces serves it.
+func (s *virtualWorkspaceSyncers) UpstreamNamespaceClient(clusterName logicalcluster.Name, upstreamNamespaceName string) (dynamic.Interface, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	started, err := s.upstreamNamespaceSyncer(clusterName, upstreamNamespaceName)
+	if err != nil {
+		return nil, err
+	}
+	if started == nil {
+		return nil, apierrors.NewNotFound(namespaceGVR.GroupResource(), upstreamNamespaceName)
+	}
+	return started.upstreamClient.Cluster(clusterName), nil
+}
+
+// WorkspacePlaced checks whether the workspace is placed on the SyncTarget, i.e. whether any of its namespaces
+// is synced to the SyncTarget through one of the syncer virtual workspaces. It returns an error as long as any
+// of the virtual workspaces is not synced.
+func (s *virtualWorkspaceSyncers) WorkspacePlaced(clusterName logicalcluster.Name) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.started) == 0 {
+		return false, fmt.Errorf("no syncer virtual workspace is started")
+	}
+
+	for url, started := range s.started {
+		if started.upstreamNamespaceIndexer == nil {
+			return false, fmt.Errorf("upstream informers for syncer virtual workspace %s are not synced yet", url)
+		}
+		for _, obj := range started.upstreamNamespaceIndexer.List() {
+			namespace, ok := obj.(metav1.Object)
+			if !ok {
+				return false, fmt.Errorf("namespace expected to be metav1.Object, got %T", obj)
+			}
+			if logicalcluster.From(namespace) == clusterName {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// upstreamNamespaceSyncer returns the started syncer of the virtual workspace serving the upstream namespace,
+// or nil if there is none. The caller must hold the lock.
+func (s *virtualWorkspaceSyncers) upstreamNamespaceSyncer(clusterName logicalcluster.Name, upstreamNamespaceName string) (*virtualWorkspaceSyncer, error) {
+	if len(s.started) == 0 {
+		return nil, fmt.Errorf("no syncer virtual workspace is started")
+	}
+
+	upstreamNamespaceKey := clusters.ToClusterAwareKey(clusterName, upstreamNamespaceName)
+	for url, started := range s.started {
+		if started.upstreamNamespaceIndexer == nil {
+			return nil, fmt.Errorf("upstream informers for syncer virtual workspace %s are not synced yet", url)
+		}
+		_, exists, err := started.upstreamNamespaceIndexer.GetByKey(upstreamNamespaceKey)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return started, nil
+		}
+	}
+	return nil, nil
+}
+
+// UpstreamObjectExists checks whether the upstream object of the given resource type exists in any of
+// the syncer virtual workspaces. It returns an error as long as any of the virtual workspaces is not
+// synced, or if the resource type is synced by none of them, since an empty informer cache must not
+// be mistaken for a deletion.
+func (s *virtualWorkspaceSyncers) UpstreamObjectExists(gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.started) == 0 {
+		return false, fmt.Errorf("no syncer virtual workspace is started")
+	}
+
+	// The upstream informers are keyed with <namespace>/<cluster>|<name>.
+	key := clusters.ToClusterAwareKey(clusterName, name)
+	if namespace != "" {
+		key = namespace + "/" + key
+	}
+	synced := false
+	for url, started := range s.started {
+		if started.upstreamInformers == nil {
+			return false, fmt.Errorf("upstream informers for syncer virtual workspace %s are not synced yet", url)
+		}
+		if !started.upstreamInformers.Has(gvr) {
+			continue
+		}
+		if !started.upstreamInformers.HasSynced(gvr) {
+			return false, fmt.Errorf("upstream informer of %s for syncer virtual workspace %s is not synced yet", gvr, url)
+		}
+		synced = true
+		upstreamInformer, err := started.upstreamInformers.SyncedInformer(gvr)
+		if err != nil {
+			return false, err
+		}
+		_, exists, err := upstreamInformer.Informer().GetIndexer().GetByKey(key)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	if !synced {
+		return false, fmt.Errorf("resource %s is not synced", gvr)
+	}
+	return false, nil
+}
+
+// GetUpstreamObject gets the upstream object of the given resource type through the syncer virtual workspaces,
+// which only serve the objects synced to, or upsynced from, the SyncTarget. It returns a NotFound error if none
+// of the virtual workspaces serves the object, and an error as long as any of them is not synced.
+func (s *virtualWorkspaceSyncers) GetUpstreamObject(ctx context.Context, gvr schema.GroupVersionResource, clusterName logicalcluster.Name, namespace, name string) (*unstructured.Unstructured, error) {
+	upstreamClients, err := s.upstreamClients()
+	if err != nil {
+		return nil, err
+	}
+
+	// The requests are made without holding the lock, so that a slow virtual workspace does not block the others.
+	for _, upstreamClient := range upstreamClients {
+		obj, err := upstreamClient.Cluster(clusterName).Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		return obj, err
+	}
+	return nil, apierrors.NewNotFound(gvr.GroupResource(), name)
+}
+
+// upstreamClients returns the upstream clients of the started syncer virtual workspaces. It returns an error
+// as long as any of them is not synced.
+func (s *virtualWorkspaceSyncers) upstreamClients() ([]dynamic.ClusterInterface, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.started) == 0 {
+		return nil, fmt.Errorf("no syncer virtual workspace is started")
+	}
+
+	upstreamClients := make([]dynamic.ClusterInterface, 0, len(s.started))
+	for url, started := range s.started {
+		if started.upstreamClient == nil {
+			return nil, fmt.Errorf("upstream informers for syncer virtual workspace %s are not synced yet", url)
+		}
+		upstreamClients = append(upstreamClients, started.upstreamClient)
+	}
+	return upstreamClients, nil
+}
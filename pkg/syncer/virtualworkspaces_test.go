@@ -0,0 +1,363 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clusters"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+)
+
+// runningURLs records the URLs whose syncers are running, i.e. started and not stopped yet.
+type runningURLs struct {
+	lock     sync.Mutex
+	running  map[string]int
+	attempts map[string]int
+}
+
+func newRunningURLs() *runningURLs {
+	return &runningURLs{running: map[string]int{}, attempts: map[string]int{}}
+}
+
+func (r *runningURLs) start(fail func(url string, attempt int) bool) startVirtualWorkspaceSyncersFunc {
+	return func(ctx context.Context, url string, markSynced markSyncedFunc) error {
+		r.lock.Lock()
+		r.attempts[url]++
+		attempt := r.attempts[url]
+		r.running[url]++
+		r.lock.Unlock()
+
+		go func() {
+			<-ctx.Done()
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			r.running[url]--
+			if r.running[url] == 0 {
+				delete(r.running, url)
+			}
+		}()
+
+		if fail != nil && fail(url, attempt) {
+			return fmt.Errorf("failed to start %s", url)
+		}
+		return nil
+	}
+}
+
+func (r *runningURLs) snapshot() map[string]int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	snapshot := map[string]int{}
+	for url, n := range r.running {
+		snapshot[url] = n
+	}
+	return snapshot
+}
+
+func syncTargetWithURLs(urls ...string) *workloadv1alpha1.SyncTarget {
+	syncTarget := &workloadv1alpha1.SyncTarget{}
+	for _, url := range urls {
+		syncTarget.Status.VirtualWorkspaces = append(syncTarget.Status.VirtualWorkspaces, workloadv1alpha1.VirtualWorkspace{URL: url})
+	}
+	return syncTarget
+}
+
+func TestVirtualWorkspaceSyncersConcurrentReconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	running := newRunningURLs()
+	syncers := newVirtualWorkspaceSyncers(running.start(nil), nil)
+
+	targets := []*workloadv1alpha1.SyncTarget{
+		syncTargetWithURLs("https://shard-1", "https://shard-2"),
+		syncTargetWithURLs("https://shard-2", "https://shard-3"),
+		syncTargetWithURLs("https://shard-1"),
+		nil,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			syncers.Reconcile(ctx, targets[i%len(targets)])
+		}(i)
+	}
+	wg.Wait()
+
+	syncers.Reconcile(ctx, syncTargetWithURLs("https://shard-2", "https://shard-3"))
+	require.Equal(t, []string{"https://shard-2", "https://shard-3"}, syncers.URLs())
+	require.Eventually(t, func() bool {
+		// Every desired URL runs exactly once, and the stopped ones don't run anymore.
+		return fmt.Sprint(running.snapshot()) == fmt.Sprint(map[string]int{"https://shard-2": 1, "https://shard-3": 1})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "running: %v", running.snapshot())
+
+	syncers.Reconcile(ctx, nil)
+	require.Empty(t, syncers.URLs())
+	require.Eventually(t, func() bool {
+		return len(running.snapshot()) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "running: %v", running.snapshot())
+}
+
+func TestVirtualWorkspaceSyncersRetryFailedStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	running := newRunningURLs()
+	syncers := newVirtualWorkspaceSyncers(running.start(func(url string, attempt int) bool {
+		return attempt < 3
+	}), nil)
+	syncers.startBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 10}
+
+	syncers.Reconcile(ctx, syncTargetWithURLs("https://shard-1"))
+	require.Eventually(t, func() bool {
+		running.lock.Lock()
+		defer running.lock.Unlock()
+		return running.attempts["https://shard-1"] == 3
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+
+	// Only the successful attempt keeps running.
+	require.Eventually(t, func() bool {
+		return fmt.Sprint(running.snapshot()) == fmt.Sprint(map[string]int{"https://shard-1": 1})
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "running: %v", running.snapshot())
+	require.Equal(t, []string{"https://shard-1"}, syncers.URLs())
+}
+
+func TestVirtualWorkspaceSyncersStopRetryingRemovedURL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	running := newRunningURLs()
+	syncers := newVirtualWorkspaceSyncers(running.start(func(url string, attempt int) bool {
+		return true
+	}), nil)
+	syncers.startBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 1}
+
+	syncers.Reconcile(ctx, syncTargetWithURLs("https://shard-1"))
+	require.Eventually(t, func() bool {
+		running.lock.Lock()
+		defer running.lock.Unlock()
+		return running.attempts["https://shard-1"] > 1
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+
+	syncers.Reconcile(ctx, nil)
+	running.lock.Lock()
+	attempts := running.attempts["https://shard-1"]
+	running.lock.Unlock()
+
+	// At most the attempt in flight completes after the URL is removed.
+	time.Sleep(100 * time.Millisecond)
+	running.lock.Lock()
+	defer running.lock.Unlock()
+	require.LessOrEqual(t, running.attempts["https://shard-1"], attempts+1)
+}
+
+func TestUpstreamNamespaceExists(t *testing.T) {
+	tests := []struct {
+		name       string
+		started    map[string][]string
+		notSynced  bool
+		namespace  string
+		wantExists bool
+		wantError  bool
+	}{
+		{
+			name:      "no virtual workspace is started",
+			namespace: "test",
+			wantError: true,
+		},
+		{
+			name:      "a virtual workspace is not synced yet",
+			started:   map[string][]string{"https://shard-1": {"root:org:ws|test"}},
+			notSynced: true,
+			namespace: "test",
+			wantError: true,
+		},
+		{
+			name:       "namespace exists in one of the virtual workspaces",
+			started:    map[string][]string{"https://shard-1": {"root:org:ws|other"}, "https://shard-2": {"root:org:ws|test"}},
+			namespace:  "test",
+			wantExists: true,
+		},
+		{
+			name:      "namespace exists in another workspace only",
+			started:   map[string][]string{"https://shard-1": {"root:org:other|test"}},
+			namespace: "test",
+		},
+		{
+			name:      "namespace exists in none of the virtual workspaces",
+			started:   map[string][]string{"https://shard-1": {"root:org:ws|other"}, "https://shard-2": {}},
+			namespace: "test",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			syncers := newVirtualWorkspaceSyncers(nil, nil)
+			for url, namespaces := range tc.started {
+				started := &virtualWorkspaceSyncer{}
+				if !tc.notSynced {
+					started.upstreamNamespaceIndexer = namespaceIndexer(t, namespaces...)
+				}
+				syncers.started[url] = started
+			}
+
+			exists, err := syncers.UpstreamNamespaceExists(logicalcluster.New("root:org:ws"), tc.namespace)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantExists, exists)
+		})
+	}
+}
+
+func TestWorkspacePlaced(t *testing.T) {
+	tests := []struct {
+		name       string
+		started    map[string][]string
+		notSynced  bool
+		wantPlaced bool
+		wantError  bool
+	}{
+		{
+			name:      "no virtual workspace is started",
+			wantError: true,
+		},
+		{
+			name:      "a virtual workspace is not synced yet",
+			started:   map[string][]string{"https://shard-1": {"root:org:ws|test"}},
+			notSynced: true,
+			wantError: true,
+		},
+		{
+			name:       "a namespace of the workspace is synced through one of the virtual workspaces",
+			started:    map[string][]string{"https://shard-1": {"root:org:other|test"}, "https://shard-2": {"root:org:ws|test"}},
+			wantPlaced: true,
+		},
+		{
+			name:    "only namespaces of other workspaces are synced",
+			started: map[string][]string{"https://shard-1": {"root:org:other|test"}, "https://shard-2": {}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			syncers := newVirtualWorkspaceSyncers(nil, nil)
+			for url, namespaces := range tc.started {
+				started := &virtualWorkspaceSyncer{}
+				if !tc.notSynced {
+					started.upstreamNamespaceIndexer = namespaceIndexer(t, namespaces...)
+				}
+				syncers.started[url] = started
+			}
+
+			placed, err := syncers.WorkspacePlaced(logicalcluster.New("root:org:ws"))
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantPlaced, placed)
+		})
+	}
+}
+
+type mockedDynamicCluster struct {
+	client dynamic.Interface
+}
+
+func (mdc *mockedDynamicCluster) Cluster(name logicalcluster.Name) dynamic.Interface {
+	return mdc.client
+}
+
+func TestGetUpstreamObjectDoesNotBlockReconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configMapsGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	requested := make(chan struct{})
+	unblock := make(chan struct{})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client.PrependReactor("get", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		close(requested)
+		<-unblock
+		return false, nil, nil
+	})
+
+	running := newRunningURLs()
+	syncers := newVirtualWorkspaceSyncers(running.start(nil), nil)
+	syncers.started["https://shard-1"] = &virtualWorkspaceSyncer{cancel: func() {}, upstreamClient: &mockedDynamicCluster{client: client}}
+
+	errs := make(chan error)
+	go func() {
+		_, err := syncers.GetUpstreamObject(ctx, configMapsGVR, logicalcluster.New("root:org:ws"), "test", "cm")
+		errs <- err
+	}()
+	<-requested
+
+	// Reconcile takes the write lock while the upstream request is pending.
+	reconciled := make(chan struct{})
+	go func() {
+		syncers.Reconcile(ctx, syncTargetWithURLs("https://shard-2"))
+		close(reconciled)
+	}()
+	select {
+	case <-reconciled:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("Reconcile is blocked by a pending upstream request")
+	}
+
+	close(unblock)
+	require.Error(t, <-errs, "the fake client should not find the object")
+}
+
+// namespaceIndexer returns an indexer of the given upstream namespaces, given as <cluster>|<name>.
+func namespaceIndexer(t *testing.T, keys ...string) cache.Indexer {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, key := range keys {
+		clusterName, name := clusters.SplitClusterAwareKey(key)
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName(name)
+		ns.SetAnnotations(map[string]string{logicalcluster.AnnotationKey: clusterName.String()})
+		require.NoError(t, indexer.Add(ns))
+	}
+	return indexer
+}
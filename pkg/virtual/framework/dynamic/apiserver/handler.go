@@ -213,6 +213,8 @@ func (r *resourceHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		handlerFunc = r.serveStatus(w, req, requestInfo, apiDef, supportedTypes)
 	case len(subresource) == 0:
 		handlerFunc = r.serveResource(w, req, requestInfo, apiDef, supportedTypes)
+	case subresource != "status" && apiDef.GetSubResourceStorage(subresource) != nil:
+		handlerFunc = r.serveSubResource(w, req, requestInfo, apiDef, subresource)
 	default:
 		responsewriters.ErrorNegotiated(
 			apierrors.NewNotFound(schema.GroupResource{Group: requestInfo.APIGroup, Resource: requestInfo.Resource}, requestInfo.Name),
@@ -304,3 +306,26 @@ func (r *resourceHandler) serveStatus(w http.ResponseWriter, req *http.Request,
 	)
 	return nil
 }
+
+// serveSubResource serves the subresources other than status that the API definition provides a storage for,
+// e.g. the ones computed from, or acting on, the resource instead of being part of it.
+func (r *resourceHandler) serveSubResource(w http.ResponseWriter, req *http.Request, requestInfo *apirequest.RequestInfo, apiDef apidefinition.APIDefinition, subresource string) http.HandlerFunc {
+	requestScope := apiDef.GetSubResourceRequestScope(subresource)
+	storage := apiDef.GetSubResourceStorage(subresource)
+
+	switch requestInfo.Verb {
+	case "get":
+		if storage, isAble := storage.(rest.Getter); isAble {
+			return handlers.GetResource(storage, requestScope)
+		}
+	case "create":
+		if storage, isAble := storage.(rest.NamedCreater); isAble {
+			return handlers.CreateNamedResource(storage, requestScope, r.admission)
+		}
+	}
+	responsewriters.ErrorNegotiated(
+		apierrors.NewMethodNotSupported(schema.GroupResource{Group: requestInfo.APIGroup, Resource: requestInfo.Resource + "/" + subresource}, requestInfo.Verb),
+		codecs, schema.GroupVersion{Group: requestInfo.APIGroup, Version: requestInfo.APIVersion}, w, req,
+	)
+	return nil
+}
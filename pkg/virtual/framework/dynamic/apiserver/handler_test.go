@@ -184,6 +184,9 @@ func TestRouting(t *testing.T) {
 					*base
 					*lister
 				}{},
+				"token": &struct {
+					*base
+				}{},
 			},
 		},
 	}
@@ -237,6 +240,7 @@ func TestRouting(t *testing.T) {
 		APIVersion        string
 		Verb              string
 		Resource          string
+		Subresource       string
 		IsResourceRequest bool
 
 		HasSynced bool
@@ -713,6 +717,34 @@ func TestRouting(t *testing.T) {
 				}))
 			},
 		},
+		{
+			Name:                 "existing core group, subresource request with unsupported verb",
+			Method:               "POST",
+			Path:                 "/api/v1/namespaces/default/services/foo/token",
+			APIGroup:             "",
+			APIVersion:           "v1",
+			Verb:                 "create",
+			Resource:             "services",
+			Subresource:          "token",
+			HasSynced:            true,
+			IsResourceRequest:    true,
+			ExpectDelegateCalled: false,
+			ExpectStatus:         405,
+		},
+		{
+			Name:                 "existing core group, unknown subresource request",
+			Method:               "GET",
+			Path:                 "/api/v1/namespaces/default/services/foo/unknown",
+			APIGroup:             "",
+			APIVersion:           "v1",
+			Verb:                 "get",
+			Resource:             "services",
+			Subresource:          "unknown",
+			HasSynced:            true,
+			IsResourceRequest:    true,
+			ExpectDelegateCalled: false,
+			ExpectStatus:         404,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -752,6 +784,7 @@ func TestRouting(t *testing.T) {
 						&apirequest.RequestInfo{
 							Verb:              tc.Verb,
 							Resource:          tc.Resource,
+							Subresource:       tc.Subresource,
 							APIGroup:          tc.APIGroup,
 							APIVersion:        tc.APIVersion,
 							IsResourceRequest: tc.IsResourceRequest,
@@ -25,6 +25,7 @@ import (
 	"github.com/kcp-dev/logicalcluster/v2"
 
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
@@ -175,13 +176,15 @@ func BuildVirtualWorkspace(
 				wildcardKcpInformers.Apis().V1alpha1().APIExports(),
 				func(syncTargetWorkspace logicalcluster.Name, syncTargetName string, apiResourceSchema *apisv1alpha1.APIResourceSchema, version string, apiExportIdentityHash string) (apidefinition.APIDefinition, error) {
 					syncTargetKey := workloadv1alpha1.ToSyncTargetKey(syncTargetWorkspace, syncTargetName)
-					requirements, selectable := labels.SelectorFromSet(map[string]string{
-						workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey: string(workloadv1alpha1.ResourceStateSync),
-					}).Requirements()
-					if !selectable {
-						return nil, fmt.Errorf("unable to create a selector from the provided labels")
+					// Objects synced to the SyncTarget, and objects upsynced from it, are served.
+					requirement, err := labels.NewRequirement(workloadv1alpha1.ClusterResourceStateLabelPrefix+syncTargetKey, selection.In, []string{
+						string(workloadv1alpha1.ResourceStateSync),
+						string(workloadv1alpha1.ResourceStateUpsync),
+					})
+					if err != nil {
+						return nil, fmt.Errorf("unable to create a selector from the provided labels: %w", err)
 					}
-					storageWrapper := forwardingregistry.WithStaticLabelSelector(requirements)
+					storageWrapper := withUpsyncedCreateAndDelete(syncTargetKey, newWorkspacePlacedFunc(dynamicClusterClient, syncTargetKey), forwardingregistry.WithStaticLabelSelector(labels.Requirements{*requirement}))
 
 					ctx, cancelFn := context.WithCancel(context.Background())
 					storageBuilder := NewStorageBuilder(ctx, dynamicClusterClient, apiExportIdentityHash, storageWrapper)
@@ -190,6 +193,13 @@ func BuildVirtualWorkspace(
 						cancelFn()
 						return nil, err
 					}
+					if isServiceAccounts(apiResourceSchema) {
+						// The syncer requests the tokens of the synced service accounts through the token subresource.
+						if def, err = withServiceAccountToken(def, kubeClusterClient); err != nil {
+							cancelFn()
+							return nil, err
+						}
+					}
 					return &apiDefinitionWithCancel{
 						APIDefinition: def,
 						cancelFn:      cancelFn,
@@ -18,20 +18,29 @@ package builder
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/kcp-dev/logicalcluster/v2"
 
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
 	"k8s.io/apiextensions-apiserver/pkg/registry/customresource"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/kube-openapi/pkg/validation/validate"
 
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
 	"github.com/kcp-dev/kcp/pkg/virtual/framework/dynamic/apiserver"
 	registry "github.com/kcp-dev/kcp/pkg/virtual/framework/forwardingregistry"
 )
 
+var namespaceGVR = schema.GroupVersionResource{Group: "", Version: "v1", Resource: "namespaces"}
+
 // NewStorageBuilder returns a forwarding storage build function, with an optional storage wrapper e.g. to add label based filtering.
 func NewStorageBuilder(ctx context.Context, clusterClient dynamic.ClusterInterface, apiExportIdentityHash string, wrapper registry.StorageWrapper) apiserver.RestProviderFunc {
 	return func(resource schema.GroupVersionResource, kind schema.GroupVersionKind, listKind schema.GroupVersionKind, typer runtime.ObjectTyper, tableConvertor rest.TableConvertor, namespaceScoped bool, schemaValidator *validate.SchemaValidator, subresourcesSchemaValidator map[string]*validate.SchemaValidator, structuralSchema *structuralschema.Structural) (mainStorage rest.Storage, subresourceStorages map[string]rest.Storage) {
@@ -109,6 +118,8 @@ func NewStorageBuilder(ctx context.Context, clusterClient dynamic.ClusterInterfa
 			registry.ListerFunc
 			registry.UpdaterFunc
 			registry.WatcherFunc
+			registry.CreaterFunc
+			registry.GracefulDeleterFunc
 
 			registry.TableConvertorFunc
 			registry.CategoriesProviderFunc
@@ -118,10 +129,12 @@ func NewStorageBuilder(ctx context.Context, clusterClient dynamic.ClusterInterfa
 			ListFactoryFunc: storage.ListFactoryFunc,
 			DestroyerFunc:   storage.DestroyerFunc,
 
-			GetterFunc:  storage.GetterFunc,
-			ListerFunc:  storage.ListerFunc,
-			UpdaterFunc: storage.UpdaterFunc,
-			WatcherFunc: storage.WatcherFunc,
+			GetterFunc:          storage.GetterFunc,
+			ListerFunc:          storage.ListerFunc,
+			UpdaterFunc:         storage.UpdaterFunc,
+			WatcherFunc:         storage.WatcherFunc,
+			CreaterFunc:         storage.CreaterFunc,
+			GracefulDeleterFunc: storage.GracefulDeleterFunc,
 
 			TableConvertorFunc:      storage.TableConvertorFunc,
 			CategoriesProviderFunc:  storage.CategoriesProviderFunc,
@@ -129,3 +142,115 @@ func NewStorageBuilder(ctx context.Context, clusterClient dynamic.ClusterInterfa
 		}, subresourceStorages
 	}
 }
+
+// workspacePlacedFunc checks whether the namespace of the logical cluster is synced to the SyncTarget, or, if the
+// namespace is empty, whether any namespace of the logical cluster is.
+type workspacePlacedFunc func(ctx context.Context, clusterName logicalcluster.Name, namespace string) (bool, error)
+
+// withUpsyncedCreateAndDelete wraps the storage so that only the objects upsynced from the SyncTarget, i.e. with the
+// state.workload.kcp.dev/<sync-target-key> label set to Upsync, can be created and deleted. The objects synced to
+// the SyncTarget are deleted by the workspace users only, and only created by the syncer when it adopts pre-existing
+// downstream objects, in namespaces already synced to the SyncTarget. Upsynced objects can only be created in the
+// namespaces synced to the SyncTarget, and cluster-scoped ones in the workspaces with such namespaces, so that a
+// syncer cannot write to workspaces that are not placed on its SyncTarget. Created objects cannot carry the workload
+// labels of other SyncTargets or the internal ones, so that a syncer cannot sync objects to other SyncTargets.
+func withUpsyncedCreateAndDelete(syncTargetKey string, workspacePlaced workspacePlacedFunc, wrapper registry.StorageWrapper) registry.StorageWrapper {
+	state := func(obj metav1.Object) workloadv1alpha1.ResourceState {
+		return workloadv1alpha1.ResourceState(obj.GetLabels()[workloadv1alpha1.ClusterResourceStateLabelPrefix+syncTargetKey])
+	}
+	isUpsynced := func(obj metav1.Object) bool {
+		return state(obj) == workloadv1alpha1.ResourceStateUpsync
+	}
+
+	return func(resource schema.GroupResource, storage *registry.StoreFuncs) *registry.StoreFuncs {
+		storage = wrapper(resource, storage)
+
+		delegateCreater := storage.CreaterFunc
+		storage.CreaterFunc = func(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+			metaObj, ok := obj.(metav1.Object)
+			if !ok {
+				return nil, fmt.Errorf("expected a metav1.Object, got %T", obj)
+			}
+			cluster, err := genericapirequest.ValidClusterFrom(ctx)
+			if err != nil {
+				return nil, err
+			}
+			namespace := genericapirequest.NamespaceValue(ctx)
+			adopted := state(metaObj) == workloadv1alpha1.ResourceStateSync && namespace != ""
+			if !isUpsynced(metaObj) && !adopted {
+				return nil, apierrors.NewForbidden(resource, metaObj.GetName(), fmt.Errorf("only upsynced objects, and synced objects in the namespaces synced to the SyncTarget, can be created"))
+			}
+			for key := range metaObj.GetLabels() {
+				if workloadv1alpha1.IsForeignWorkloadLabel(key, syncTargetKey) {
+					return nil, apierrors.NewForbidden(resource, metaObj.GetName(), fmt.Errorf("label %s cannot be set by the syncer", key))
+				}
+			}
+			placed, err := workspacePlaced(ctx, cluster.Name, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if !placed {
+				if namespace != "" {
+					return nil, apierrors.NewForbidden(resource, metaObj.GetName(), fmt.Errorf("namespace %s|%s is not synced to the SyncTarget", cluster.Name, namespace))
+				}
+				return nil, apierrors.NewForbidden(resource, metaObj.GetName(), fmt.Errorf("workspace %s is not placed on the SyncTarget", cluster.Name))
+			}
+			return delegateCreater.Create(ctx, obj, createValidation, options)
+		}
+
+		delegateGetter := storage.GetterFunc
+		delegateDeleter := storage.GracefulDeleterFunc
+		storage.GracefulDeleterFunc = func(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+			obj, err := delegateGetter.Get(ctx, name, &metav1.GetOptions{})
+			if err != nil {
+				return nil, false, err
+			}
+			metaObj, ok := obj.(metav1.Object)
+			if !ok {
+				return nil, false, fmt.Errorf("expected a metav1.Object, got %T", obj)
+			}
+			if !isUpsynced(metaObj) {
+				return nil, false, apierrors.NewForbidden(resource, name, fmt.Errorf("only upsynced objects can be deleted"))
+			}
+
+			// Make sure the deleted object is the checked one.
+			if options.Preconditions == nil {
+				options.Preconditions = &metav1.Preconditions{}
+			}
+			if options.Preconditions.UID == nil {
+				uid := metaObj.GetUID()
+				options.Preconditions.UID = &uid
+			}
+			return delegateDeleter.Delete(ctx, name, deleteValidation, options)
+		}
+
+		return storage
+	}
+}
+
+// newWorkspacePlacedFunc returns a workspacePlacedFunc checking the state.workload.kcp.dev/<sync-target-key> label
+// of the namespaces with the given client.
+func newWorkspacePlacedFunc(dynamicClusterClient dynamic.ClusterInterface, syncTargetKey string) workspacePlacedFunc {
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+	return func(ctx context.Context, clusterName logicalcluster.Name, namespace string) (bool, error) {
+		namespaces := dynamicClusterClient.Cluster(clusterName).Resource(namespaceGVR)
+		if namespace != "" {
+			ns, err := namespaces.Get(ctx, namespace, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return ns.GetLabels()[stateLabel] == string(workloadv1alpha1.ResourceStateSync), nil
+		}
+		list, err := namespaces.List(ctx, metav1.ListOptions{
+			LabelSelector: stateLabel + "=" + string(workloadv1alpha1.ResourceStateSync),
+			Limit:         1,
+		})
+		if err != nil {
+			return false, err
+		}
+		return len(list.Items) > 0, nil
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	workloadv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/workload/v1alpha1"
+	registry "github.com/kcp-dev/kcp/pkg/virtual/framework/forwardingregistry"
+)
+
+var configMapsGR = schema.GroupResource{Resource: "configmaps"}
+
+func identityWrapper(resource schema.GroupResource, storage *registry.StoreFuncs) *registry.StoreFuncs {
+	return storage
+}
+
+func configMap(labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("test")
+	obj.SetName("cm")
+	obj.SetUID("uid")
+	obj.SetLabels(labels)
+	return obj
+}
+
+func requestContext(clusterName, namespace string) context.Context {
+	ctx := genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Name: logicalcluster.New(clusterName)})
+	if namespace != "" {
+		ctx = genericapirequest.WithNamespace(ctx, namespace)
+	}
+	return ctx
+}
+
+func TestWithUpsyncedCreate(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	tests := map[string]struct {
+		labels      map[string]string
+		namespace   string
+		placed      map[string]bool
+		placedError error
+
+		wantCreated   bool
+		wantForbidden bool
+		wantError     bool
+	}{
+		"upsynced object in a synced namespace is created": {
+			labels:      map[string]string{stateLabel: "Upsync"},
+			namespace:   "test",
+			placed:      map[string]bool{"root:org:user|test": true},
+			wantCreated: true,
+		},
+		"upsynced cluster-scoped object in a placed workspace is created": {
+			labels:      map[string]string{stateLabel: "Upsync"},
+			placed:      map[string]bool{"root:org:user|": true},
+			wantCreated: true,
+		},
+		"synced object in a synced namespace is created": {
+			labels:      map[string]string{stateLabel: "Sync"},
+			namespace:   "test",
+			placed:      map[string]bool{"root:org:user|test": true},
+			wantCreated: true,
+		},
+		"synced object in a namespace not synced to the SyncTarget is forbidden": {
+			labels:        map[string]string{stateLabel: "Sync"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|other": true},
+			wantForbidden: true,
+		},
+		"synced cluster-scoped object is forbidden": {
+			labels:        map[string]string{stateLabel: "Sync"},
+			placed:        map[string]bool{"root:org:user|": true},
+			wantForbidden: true,
+		},
+		"object without state is forbidden": {
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|test": true},
+			wantForbidden: true,
+		},
+		"object upsynced from another SyncTarget is forbidden": {
+			labels:        map[string]string{workloadv1alpha1.ClusterResourceStateLabelPrefix + "other": "Upsync"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|test": true},
+			wantForbidden: true,
+		},
+		"upsynced object with the state label of another SyncTarget is forbidden": {
+			labels:        map[string]string{stateLabel: "Upsync", workloadv1alpha1.ClusterResourceStateLabelPrefix + "other": "Sync"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|test": true},
+			wantForbidden: true,
+		},
+		"upsynced object with the deletion label of another SyncTarget is forbidden": {
+			labels:        map[string]string{stateLabel: "Upsync", workloadv1alpha1.InternalClusterDeletionTimestampAnnotationPrefix + "other": "true"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|test": true},
+			wantForbidden: true,
+		},
+		"synced object with an internal workload label is forbidden": {
+			labels:        map[string]string{stateLabel: "Sync", workloadv1alpha1.InternalDownstreamClusterLabel: "root:org:user"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|test": true},
+			wantForbidden: true,
+		},
+		"upsynced object in a namespace not synced to the SyncTarget is forbidden": {
+			labels:        map[string]string{stateLabel: "Upsync"},
+			namespace:     "test",
+			placed:        map[string]bool{"root:org:user|other": true},
+			wantForbidden: true,
+		},
+		"upsynced cluster-scoped object in a workspace not placed on the SyncTarget is forbidden": {
+			labels:        map[string]string{stateLabel: "Upsync"},
+			wantForbidden: true,
+		},
+		"placement check failure is an error": {
+			labels:      map[string]string{stateLabel: "Upsync"},
+			namespace:   "test",
+			placedError: errors.New("failed"),
+			wantError:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var created runtime.Object
+			storage := &registry.StoreFuncs{
+				CreaterFunc: func(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+					created = obj
+					return obj, nil
+				},
+			}
+			workspacePlaced := func(ctx context.Context, clusterName logicalcluster.Name, namespace string) (bool, error) {
+				return tc.placed[clusterName.String()+"|"+namespace], tc.placedError
+			}
+			storage = withUpsyncedCreateAndDelete(syncTargetKey, workspacePlaced, identityWrapper)(configMapsGR, storage)
+
+			_, err := storage.Create(requestContext("root:org:user", tc.namespace), configMap(tc.labels), nil, &metav1.CreateOptions{})
+			switch {
+			case tc.wantForbidden:
+				require.True(t, apierrors.IsForbidden(err), "expected Forbidden, got %v", err)
+			case tc.wantError:
+				require.Error(t, err)
+			default:
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.wantCreated, created != nil)
+		})
+	}
+}
+
+func TestWithUpsyncedDelete(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	tests := map[string]struct {
+		existing      *unstructured.Unstructured
+		preconditions *metav1.Preconditions
+
+		wantDeleted   bool
+		wantUID       types.UID
+		wantForbidden bool
+		wantNotFound  bool
+	}{
+		"upsynced object is deleted, with a UID precondition": {
+			existing:    configMap(map[string]string{stateLabel: "Upsync"}),
+			wantDeleted: true,
+			wantUID:     "uid",
+		},
+		"upsynced object is deleted, with the UID precondition of the request": {
+			existing:      configMap(map[string]string{stateLabel: "Upsync"}),
+			preconditions: &metav1.Preconditions{UID: func() *types.UID { uid := types.UID("other"); return &uid }()},
+			wantDeleted:   true,
+			wantUID:       "other",
+		},
+		"synced object is forbidden": {
+			existing:      configMap(map[string]string{stateLabel: "Sync"}),
+			wantForbidden: true,
+		},
+		"missing object is not found": {
+			wantNotFound: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var deletedUID *types.UID
+			storage := &registry.StoreFuncs{
+				GetterFunc: func(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+					if tc.existing == nil {
+						return nil, apierrors.NewNotFound(configMapsGR, name)
+					}
+					return tc.existing, nil
+				},
+				GracefulDeleterFunc: func(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+					deletedUID = options.Preconditions.UID
+					return nil, true, nil
+				},
+			}
+			workspacePlaced := func(ctx context.Context, clusterName logicalcluster.Name, namespace string) (bool, error) {
+				return true, nil
+			}
+			storage = withUpsyncedCreateAndDelete(syncTargetKey, workspacePlaced, identityWrapper)(configMapsGR, storage)
+
+			_, _, err := storage.Delete(requestContext("root:org:user", "test"), "cm", nil, &metav1.DeleteOptions{Preconditions: tc.preconditions})
+			switch {
+			case tc.wantForbidden:
+				require.True(t, apierrors.IsForbidden(err), "expected Forbidden, got %v", err)
+			case tc.wantNotFound:
+				require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+			default:
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.wantDeleted, deletedUID != nil)
+			if deletedUID != nil {
+				require.Equal(t, tc.wantUID, *deletedUID)
+			}
+		})
+	}
+}
+
+type fakeDynamicClusterClient struct {
+	clients map[logicalcluster.Name]dynamic.Interface
+}
+
+func (c *fakeDynamicClusterClient) Cluster(name logicalcluster.Name) dynamic.Interface {
+	return c.clients[name]
+}
+
+func TestWorkspacePlaced(t *testing.T) {
+	syncTargetKey := workloadv1alpha1.ToSyncTargetKey(logicalcluster.New("root:org:ws"), "us-west1")
+	stateLabel := workloadv1alpha1.ClusterResourceStateLabelPrefix + syncTargetKey
+
+	namespace := func(name string, labels map[string]string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Namespace")
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+	newClient := func(objects ...runtime.Object) dynamic.Interface {
+		return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{namespaceGVR: "NamespaceList"}, objects...)
+	}
+	workspacePlaced := newWorkspacePlacedFunc(&fakeDynamicClusterClient{clients: map[logicalcluster.Name]dynamic.Interface{
+		logicalcluster.New("root:org:placed"): newClient(
+			namespace("synced", map[string]string{stateLabel: "Sync"}),
+			namespace("not-synced", nil),
+		),
+		logicalcluster.New("root:org:not-placed"): newClient(
+			namespace("synced-elsewhere", map[string]string{workloadv1alpha1.ClusterResourceStateLabelPrefix + "other": "Sync"}),
+		),
+	}}, syncTargetKey)
+
+	tests := []struct {
+		clusterName string
+		namespace   string
+		wantPlaced  bool
+	}{
+		{clusterName: "root:org:placed", wantPlaced: true},
+		{clusterName: "root:org:placed", namespace: "synced", wantPlaced: true},
+		{clusterName: "root:org:placed", namespace: "not-synced"},
+		{clusterName: "root:org:placed", namespace: "missing"},
+		{clusterName: "root:org:not-placed"},
+		{clusterName: "root:org:not-placed", namespace: "synced-elsewhere"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.clusterName+"|"+tc.namespace, func(t *testing.T) {
+			placed, err := workspacePlaced(context.Background(), logicalcluster.New(tc.clusterName), tc.namespace)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantPlaced, placed)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/endpoints/handlers"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	apisv1alpha1 "github.com/kcp-dev/kcp/pkg/apis/apis/v1alpha1"
+	"github.com/kcp-dev/kcp/pkg/virtual/framework/dynamic/apidefinition"
+)
+
+const tokenSubresource = "token"
+
+type createTokenFunc func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string, tokenRequest *authenticationv1.TokenRequest, options metav1.CreateOptions) (*authenticationv1.TokenRequest, error)
+
+func isServiceAccounts(apiResourceSchema *apisv1alpha1.APIResourceSchema) bool {
+	return apiResourceSchema.Spec.Group == "" && apiResourceSchema.Spec.Names.Plural == "serviceaccounts"
+}
+
+// withServiceAccountToken adds the token subresource to the serviceaccounts API definition, so that the syncer
+// can request tokens for the service accounts synced to its SyncTarget only.
+func withServiceAccountToken(def apidefinition.APIDefinition, kubeClusterClient kubernetesclient.ClusterInterface) (apidefinition.APIDefinition, error) {
+	serviceAccounts, ok := def.GetStorage().(rest.Getter)
+	if !ok {
+		return nil, fmt.Errorf("storage for serviceaccounts should be a getter")
+	}
+
+	scope := *def.GetRequestScope()
+	scope.Subresource = tokenSubresource
+	scope.Kind = authenticationv1.SchemeGroupVersion.WithKind("TokenRequest")
+	scope.HubGroupVersion = authenticationv1.SchemeGroupVersion
+	scope.Serializer = clientgoscheme.Codecs
+	scope.StandardSerializers = clientgoscheme.Codecs.SupportedMediaTypes()
+	scope.Creater = clientgoscheme.Scheme
+	scope.Convertor = clientgoscheme.Scheme
+	scope.Defaulter = clientgoscheme.Scheme
+	scope.Typer = clientgoscheme.Scheme
+	scope.UnsafeConvertor = runtime.UnsafeObjectConvertor(clientgoscheme.Scheme)
+	scope.FieldManager = nil
+	scope.OpenapiModels = nil
+
+	return &apiDefinitionWithToken{
+		APIDefinition: def,
+		tokenStorage: &tokenREST{
+			serviceAccounts: serviceAccounts,
+			createToken: func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string, tokenRequest *authenticationv1.TokenRequest, options metav1.CreateOptions) (*authenticationv1.TokenRequest, error) {
+				return kubeClusterClient.Cluster(clusterName).CoreV1().ServiceAccounts(namespace).CreateToken(ctx, name, tokenRequest, options)
+			},
+		},
+		tokenRequestScope: &scope,
+	}, nil
+}
+
+// apiDefinitionWithToken serves the token subresource in addition to the ones of the wrapped API definition.
+type apiDefinitionWithToken struct {
+	apidefinition.APIDefinition
+	tokenStorage      rest.Storage
+	tokenRequestScope *handlers.RequestScope
+}
+
+func (d *apiDefinitionWithToken) GetSubResourceStorage(subresource string) rest.Storage {
+	if subresource == tokenSubresource {
+		return d.tokenStorage
+	}
+	return d.APIDefinition.GetSubResourceStorage(subresource)
+}
+
+func (d *apiDefinitionWithToken) GetSubResourceRequestScope(subresource string) *handlers.RequestScope {
+	if subresource == tokenSubresource {
+		return d.tokenRequestScope
+	}
+	return d.APIDefinition.GetSubResourceRequestScope(subresource)
+}
+
+// tokenREST creates tokens for the service accounts that are visible through the virtual workspace.
+type tokenREST struct {
+	serviceAccounts rest.Getter
+	createToken     createTokenFunc
+}
+
+var _ rest.NamedCreater = &tokenREST{}
+
+func (r *tokenREST) New() runtime.Object {
+	return &authenticationv1.TokenRequest{}
+}
+
+func (r *tokenREST) Destroy() {}
+
+func (r *tokenREST) Create(ctx context.Context, name string, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	cluster, err := genericapirequest.ValidClusterFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cluster.Wildcard {
+		return nil, apierrors.NewBadRequest("tokens cannot be requested across workspaces")
+	}
+	namespace, ok := genericapirequest.NamespaceFrom(ctx)
+	if !ok || namespace == "" {
+		return nil, apierrors.NewBadRequest("namespace is required")
+	}
+	tokenRequest, ok := obj.(*authenticationv1.TokenRequest)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("not a TokenRequest: %T", obj))
+	}
+
+	// The service account must be synced to the SyncTarget, i.e. served by the label-filtered storage.
+	if _, err := r.serviceAccounts.Get(ctx, name, &metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	if createValidation != nil {
+		if err := createValidation(ctx, obj.DeepCopyObject()); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.createToken(ctx, cluster.Name, namespace, name, tokenRequest, *options)
+}
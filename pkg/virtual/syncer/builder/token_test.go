@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The KCP Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kcp-dev/logicalcluster/v2"
+	"github.com/stretchr/testify/require"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	registry "github.com/kcp-dev/kcp/pkg/virtual/framework/forwardingregistry"
+)
+
+func TestTokenCreate(t *testing.T) {
+	serviceAccountsGR := schema.GroupResource{Resource: "serviceaccounts"}
+
+	tests := map[string]struct {
+		ctx    context.Context
+		synced bool
+
+		wantCreated    bool
+		wantNotFound   bool
+		wantBadRequest bool
+	}{
+		"token of a synced service account is created": {
+			ctx:         requestContext("root:org:user", "test"),
+			synced:      true,
+			wantCreated: true,
+		},
+		"token of a service account not synced to the SyncTarget is not found": {
+			ctx:          requestContext("root:org:user", "test"),
+			wantNotFound: true,
+		},
+		"token request without namespace is rejected": {
+			ctx:            requestContext("root:org:user", ""),
+			synced:         true,
+			wantBadRequest: true,
+		},
+		"token request across workspaces is rejected": {
+			ctx:            genericapirequest.WithNamespace(genericapirequest.WithCluster(context.Background(), genericapirequest.Cluster{Wildcard: true}), "test"),
+			synced:         true,
+			wantBadRequest: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var created bool
+			storage := &tokenREST{
+				serviceAccounts: &registry.StoreFuncs{
+					GetterFunc: func(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+						if !tc.synced {
+							return nil, apierrors.NewNotFound(serviceAccountsGR, name)
+						}
+						return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name}}, nil
+					},
+				},
+				createToken: func(ctx context.Context, clusterName logicalcluster.Name, namespace, name string, tokenRequest *authenticationv1.TokenRequest, options metav1.CreateOptions) (*authenticationv1.TokenRequest, error) {
+					require.Equal(t, logicalcluster.New("root:org:user"), clusterName)
+					require.Equal(t, "test", namespace)
+					require.Equal(t, "sa", name)
+					created = true
+					return &authenticationv1.TokenRequest{Status: authenticationv1.TokenRequestStatus{Token: "token"}}, nil
+				},
+			}
+
+			obj, err := storage.Create(tc.ctx, "sa", &authenticationv1.TokenRequest{}, nil, &metav1.CreateOptions{})
+			switch {
+			case tc.wantNotFound:
+				require.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+			case tc.wantBadRequest:
+				require.True(t, apierrors.IsBadRequest(err), "expected BadRequest, got %v", err)
+			default:
+				require.NoError(t, err)
+				require.Equal(t, "token", obj.(*authenticationv1.TokenRequest).Status.Token)
+			}
+			require.Equal(t, tc.wantCreated, created)
+		})
+	}
+}